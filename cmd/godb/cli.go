@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go-database/godb"
+)
+
+// CLI の表示
+//
+// データベースエンジン（godb.DB の Exec）は実行結果を Result で返すだけなので、表示はここで行う
+// 情報メッセージ（「テーブル 'users' を作成しました」など）は main.go でエンジンに渡す Logger が標準出力に出す
+
+// printResult - 実行結果を表示する（通知、行を返す文なら結果の表。SELECT で行がなければその旨）
+func printResult(res *godb.Result) {
+	for _, notice := range res.Notices {
+		fmt.Println(notice)
+	}
+	if len(res.Columns) == 0 {
+		return
+	}
+	var rows [][]any
+	for res.Next() {
+		rows = append(rows, res.Values())
+	}
+	if len(rows) == 0 && res.Command == "SELECT" {
+		fmt.Println("条件に一致するデータがありません")
+		return
+	}
+	displayResults(res.Columns, rows)
+}
+
+// displayResults - 検索結果を表示
+func displayResults(columns []godb.ResultColumn, rows [][]any) {
+	// 値を表示用の文字列にする（NULL は "NULL"）
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(row))
+		for j, v := range row {
+			cells[i][j] = godb.FormatValue(v)
+		}
+	}
+
+	// 各カラムの表示幅（ヘッダーと値のうち最も長いもの。改行を含む値は最も長い行）
+	widths := make([]int, len(columns))
+	for i, col := range columns {
+		widths[i] = len(col.Name)
+		for _, row := range cells {
+			for _, line := range strings.Split(row[i], "\n") {
+				if len(line) > widths[i] {
+					widths[i] = len(line)
+				}
+			}
+		}
+	}
+
+	// ヘッダーを出力
+	// - : 左よせ
+	// * : 幅を引数で指定
+	// s : string 対象
+	for i, col := range columns {
+		if i > 0 {
+			fmt.Print(" | ")
+		}
+		fmt.Printf("%-*s", widths[i], col.Name)
+	}
+	fmt.Println()
+	for i := range columns {
+		if i > 0 {
+			fmt.Print("-+-")
+		}
+		fmt.Print(strings.Repeat("-", widths[i]))
+	}
+	fmt.Println()
+
+	// データを出力（改行を含む値（EXPLAIN (FORMAT JSON) など）は、同じ列のまま次の行に続ける）
+	for _, row := range cells {
+		lines := make([][]string, len(row))
+		height := 1
+		for i, cell := range row {
+			lines[i] = strings.Split(cell, "\n")
+			if len(lines[i]) > height {
+				height = len(lines[i])
+			}
+		}
+		for k := 0; k < height; k++ {
+			for i := range columns {
+				if i > 0 {
+					fmt.Print(" | ")
+				}
+				line := ""
+				if k < len(lines[i]) {
+					line = lines[i][k]
+				}
+				fmt.Printf("%-*s", widths[i], line)
+			}
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-database/godb"
+)
+
+func main() {
+	// データベースエンジンを初期化（ファイルはすべてデータディレクトリの下に置く）
+	dataDir := flag.String("data", "data", "データディレクトリ")
+	autoAnalyze := flag.Float64("auto-analyze", 0.1, "変更した行が行数のこの割合を超えたら自動で ANALYZE する（0 なら自動 ANALYZE しない）")
+	syncMode := flag.String("sync", "full", "コミットしたときに WAL をディスクに書き出すか（full / off）")
+	pageSize := flag.Int("page-size", 8192, "データファイルを読む 1 ページのバイト数")
+	bufferPool := flag.Int("buffer-pool", 1024, "バッファプールに置くページの数")
+	flag.Parse()
+
+	opts := godb.DefaultOptions()
+	opts.PageSize = *pageSize
+	opts.BufferPoolSize = *bufferPool
+	opts.AutoAnalyzeScale = *autoAnalyze
+	if *autoAnalyze == 0 {
+		opts.AutoAnalyzeScale = -1
+	}
+	switch *syncMode {
+	case "full":
+		opts.SyncMode = godb.SyncFull
+	case "off":
+		opts.SyncMode = godb.SyncOff
+	default:
+		fmt.Println("エラー: -sync には full か off を指定してください")
+		os.Exit(1)
+	}
+	// 情報メッセージ（テーブルを作成しました など）は標準出力に出す
+	opts.Logger = log.New(os.Stdout, "", 0)
+	db, err := godb.Open(*dataDir, &opts)
+	if err != nil {
+		fmt.Println("エラー:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Go Database Engine with B+Tree Index - CREATE TABLE、INSERT、SELECT を試してみましょう")
+	fmt.Println("例:")
+	fmt.Println("  CREATE TABLE users (id INT PRIMARY KEY, name TEXT);")
+	fmt.Println("  INSERT INTO users (id, name) VALUES (1, 'Alice');")
+	fmt.Println("  UPDATE users SET name = 'Bob' WHERE id = 1;")
+	fmt.Println("  SELECT * FROM users;")
+	fmt.Println("  SELECT * FROM users WHERE id = 1;")
+	fmt.Println("  SELECT name, count(*) FROM users WHERE name IS NOT NULL GROUP BY name ORDER BY name DESC NULLS LAST LIMIT 10;")
+	fmt.Println("  SELECT id::TEXT || name, CAST('2024-01-31' AS DATE) + 1 FROM users;")
+	fmt.Println("  CREATE INDEX ON items ((attrs->>'color')); SELECT * FROM items WHERE attrs->>'color' = 'red'; (式のインデックス)")
+	fmt.Println("  CREATE TABLE orders (id SERIAL PRIMARY KEY, item TEXT); INSERT INTO orders (item) VALUES ('pen'); (自動採番)")
+	fmt.Println("  INSERT INTO orders (item) VALUES ('ink') RETURNING id; (追加した行の値を返す)")
+	fmt.Println("  INSERT INTO users (name, id) VALUES ('Bob', 2), ('Carol', 3); (複数行)")
+	fmt.Println("  INSERT INTO archive SELECT * FROM users WHERE id > 1; (SELECT の結果を追加)")
+	fmt.Println("  INSERT INTO users (id, name) VALUES (1, 'Alice') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name; (UPSERT)")
+	fmt.Println("  ALTER TABLE users ADD COLUMN age INT DEFAULT 0; ALTER TABLE users RENAME COLUMN name TO full_name;")
+	fmt.Println("  TRUNCATE users; DROP TABLE IF EXISTS users;")
+	fmt.Println("  SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'users'; (カタログ)")
+	fmt.Println("  SELECT u.name, o.total FROM users u LEFT JOIN orders o ON o.user_id = u.id; (結合)")
+	fmt.Println("  SELECT id FROM users WHERE id >= 10 AND id < 20; (インデックスの範囲検索)")
+	fmt.Println("  ANALYZE users; SELECT * FROM pg_stats WHERE tablename = 'users'; (統計情報)")
+	fmt.Println("  EXPLAIN ANALYZE SELECT * FROM users WHERE id = 1; (実行計画)")
+	fmt.Println("  PREPARE find (INT) AS SELECT * FROM users WHERE id = $1; EXECUTE find(1); (プリペアド文)")
+	fmt.Println("  SHOW INDEX; (インデックス状況表示)")
+	fmt.Print("SQL> ")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if scanner.Scan() {
+		sql := scanner.Text()
+
+		// データベースエンジンでSQL文を実行して、結果を表示
+		res, err := db.Exec(sql)
+		if err != nil {
+			fmt.Println("エラー:", err)
+		} else {
+			printResult(res)
+		}
+	}
+	if err := db.Close(); err != nil {
+		fmt.Println("エラー:", err)
+	}
+}
@@ -1,3 +1,5 @@
 module go-database
 
 go 1.22.3
+
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,359 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// duplicateKeyErrorは一意インデックスに既存のキーを挿入しようとした場合のエラー
+// postgres の "duplicate key value violates unique constraint" に相当する
+type duplicateKeyError struct {
+	IndexName string   // インデックス名（制約名）
+	TableName string   // 対象テーブル名
+	Columns   []string // 対象カラム名
+	Key       string   // 重複したキー（エンコード済み）
+}
+
+func (e *duplicateKeyError) Error() string {
+	return fmt.Sprintf("重複したキー値が一意性制約 \"%s\" に違反しています: キー (%s)=%s は既に存在します",
+		e.IndexName, strings.Join(e.Columns, ", "), formatIndexKey(e.Key))
+}
+
+// B+Treeのノードサイズ（キーの最大数）
+// 学習用で小さな値を置いておく
+const btreeOrder = 4
+
+// btreeNodeはB+Treeのノードを表す
+// b tree の leaf node は複数の value を持っている（1：1対応ではない）
+// leaf node は keys, values を4(btreeOrder)つ持ち、内部ノードは　子ノードを 5 つもつ ( = btreeOrder + 1)
+// 内部ノードでは、key = 境界の値, leaf node だと key = values（実際のデータ）
+// だからこノード自体は key + 1 になるのか
+type btreeNode struct {
+	IsLeaf   bool         // リーフノードかどうか
+	Keys     []string     // キーの配列（ソート済み、indexkey.go でエンコードしたもの）
+	Values   [][]int      // 値の配列（リーフノードの場合：レコード位置のリスト（posting list）、内部ノードでは未使用）
+	Children []*btreeNode // 子ノードへのポインタ（内部ノードのみ）
+	Next     *btreeNode   // 次のリーフノードへのポインタ（リーフノードのみ）
+}
+
+// btreeはB+Treeの根ノードを管理する
+// 非一意インデックスでは 1 つのキーに複数のレコード位置がぶら下がる（posting list 方式）
+// 一意インデックス（主キーなど）では重複キーの挿入を duplicateKeyError で拒否する
+type btree struct {
+	Root      *btreeNode // 根ノード
+	Name      string     // インデックス名（制約名、例: users_pkey）
+	TableName string     // 対象テーブル名
+	Columns   []string   // 対象カラム名（複合キーの場合は複数）
+	Unique    bool       // 一意インデックスかどうか
+}
+
+// newBTree - 新しいB+Treeを作成
+func newBTree(name, tableName string, columns []string, unique bool) *btree {
+	// 初期状態では空のリーフノードを根とする
+	root := &btreeNode{
+		IsLeaf:   true,
+		Keys:     make([]string, 0, btreeOrder),
+		Values:   make([][]int, 0, btreeOrder),
+		Children: nil,
+		Next:     nil, // leaf node 同士は範囲検索（where）をするために、連結リストで結ばれる
+	}
+
+	return &btree{
+		Root:      root,
+		Name:      name,
+		TableName: tableName,
+		Columns:   columns,
+		Unique:    unique,
+	}
+}
+
+// Insert - B+Treeにキー・値のペアを挿入
+// 一意インデックスで既にキーが存在する場合は、木を変更せずに duplicateKeyError を返す
+// （NULL を含むキーは他のキーと等しくならないので、一意インデックスでも重複して登録できる）
+func (bt *btree) Insert(key string, value int) error {
+	if bt.Unique && !keyHasNull(key) {
+		if _, found := bt.Search(key); found {
+			return &duplicateKeyError{IndexName: bt.Name, TableName: bt.TableName, Columns: bt.Columns, Key: key}
+		}
+	}
+
+	root := bt.Root
+
+	// 根ノードが満杯の場合は分割
+	if len(root.Keys) >= btreeOrder {
+		newRoot := &btreeNode{
+			IsLeaf:   false,
+			Keys:     make([]string, 0, btreeOrder),
+			Values:   make([][]int, 0, btreeOrder),
+			Children: make([]*btreeNode, 0, btreeOrder+1),
+		}
+
+		newRoot.Children = append(newRoot.Children, root)
+		bt.splitChild(newRoot, 0)
+		bt.Root = newRoot
+	}
+
+	bt.insertNonFull(bt.Root, key, value)
+	return nil
+}
+
+// insertNonFull - 満杯でないノードに挿入
+func (bt *btree) insertNonFull(node *btreeNode, key string, value int) {
+	if node.IsLeaf {
+		// リーフノードの場合、適切な位置に挿入
+		pos := sort.Search(len(node.Keys), func(i int) bool {
+			return node.Keys[i] >= key
+		})
+
+		// 既存キーの場合は posting list にレコード位置を追加する
+		// （一意インデックスの重複は Insert の時点で弾いているので、ここに来るのは非一意インデックスのみ）
+		if pos < len(node.Keys) && node.Keys[pos] == key {
+			node.Values[pos] = append(node.Values[pos], value)
+			return
+		}
+
+		// 新しいキーを挿入
+		node.Keys = append(node.Keys, "")
+		node.Values = append(node.Values, nil)
+
+		// 挿入位置を空けるためにシフト
+		copy(node.Keys[pos+1:], node.Keys[pos:])
+		copy(node.Values[pos+1:], node.Values[pos:])
+
+		node.Keys[pos] = key
+		node.Values[pos] = []int{value}
+	} else {
+		// 内部ノード( != leaf node ) の場合、適切な子ノードを見つけて再帰的に挿入
+		pos := sort.Search(len(node.Keys), func(i int) bool {
+			return node.Keys[i] > key
+		})
+
+		child := node.Children[pos]
+
+		// 子ノードが満杯の場合は分割
+		if len(child.Keys) >= btreeOrder {
+			bt.splitChild(node, pos)
+
+			// 分割後、適切な子ノードを選択
+			// 昇格キーと同じキーは右側に入っている（searchNode も右側を探す）ので >= で比較する
+			if key >= node.Keys[pos] {
+				pos++
+			}
+		}
+
+		bt.insertNonFull(node.Children[pos], key, value)
+	}
+}
+
+// splitChild - 満杯の子ノードを分割
+func (bt *btree) splitChild(parent *btreeNode, childIndex int) {
+	fullChild := parent.Children[childIndex]
+	// btree では、真ん中のキーを親に昇格させる
+	// この時昇格させるのは、あくまでキーであり、value を持った leaf node ではない
+	// 親ノードが保持しているのは、n 以上の値なら右側のリーフに入ってるから(右を分割していく設計なら)そちらを探索しなよ、というキー
+	// 子ノードと一緒のキーを持つことになる
+	mid := btreeOrder / 2
+
+	// 新しいノードを作成（右半分）
+	newChild := &btreeNode{
+		IsLeaf:   fullChild.IsLeaf,
+		Keys:     make([]string, 0, btreeOrder),
+		Values:   make([][]int, 0, btreeOrder),
+		Children: nil,
+		Next:     nil,
+	}
+
+	if fullChild.IsLeaf {
+		// リーフノードの場合
+		// leaf node の場合、親ノードを作った上で、リーフノードも作ってるんか
+		// つまり、leaf として新しい childNode を生成して、それに元の keys, values の半分をコピー
+		// その上で、境界値の key を親ノードに持たせる(昇格させる）のか
+		newChild.Keys = append(newChild.Keys, fullChild.Keys[mid:]...)
+		newChild.Values = append(newChild.Values, fullChild.Values[mid:]...)
+
+		// リンクリストの更新
+		newChild.Next = fullChild.Next
+		fullChild.Next = newChild
+
+		// 元のノードを左半分に縮小
+		fullChild.Keys = fullChild.Keys[:mid]
+		fullChild.Values = fullChild.Values[:mid]
+
+		// 親ノードに中央キーを昇格（リーフの場合は最初のキーをコピー）
+		promotedKey := newChild.Keys[0]
+
+		// 親ノードの slice をダミー値で拡張
+		parent.Keys = append(parent.Keys, "")
+		parent.Children = append(parent.Children, nil)
+
+		// 親ノードの中で　promotedKey と value を入れる位置を格納する
+		copy(parent.Keys[childIndex+1:], parent.Keys[childIndex:])
+		copy(parent.Children[childIndex+2:], parent.Children[childIndex+1:])
+
+		parent.Keys[childIndex] = promotedKey
+		parent.Children[childIndex+1] = newChild
+	} else {
+		// 内部ノードの場合
+		// 子ノードの分割が必要になる代わりに linked list 周りの処理が不要って感じかなぁ
+		// 内部ノードの Values は使っていない（空）ので、キーと子ノードだけを分ける
+		newChild.Keys = append(newChild.Keys, fullChild.Keys[mid+1:]...)
+		newChild.Children = append(newChild.Children, fullChild.Children[mid+1:]...)
+
+		// 昇格させるキー
+		promotedKey := fullChild.Keys[mid]
+
+		// 元のノードを左半分に縮小
+		fullChild.Keys = fullChild.Keys[:mid]
+		fullChild.Children = fullChild.Children[:mid+1]
+
+		// 親ノードに昇格キーと新しい子ノードを挿入
+		parent.Keys = append(parent.Keys, "")
+		parent.Children = append(parent.Children, nil)
+
+		copy(parent.Keys[childIndex+1:], parent.Keys[childIndex:])
+		copy(parent.Children[childIndex+2:], parent.Children[childIndex+1:])
+
+		parent.Keys[childIndex] = promotedKey
+		parent.Children[childIndex+1] = newChild
+	}
+}
+
+// Search - B+Treeからキーを検索して値を取得
+// 非一意インデックスの場合は posting list の先頭の値を返す（全件欲しい場合は SearchAll）
+func (bt *btree) Search(key string) (int, bool) {
+	values := bt.SearchAll(key)
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+// SearchAll - B+Treeからキーを検索して、一致するすべての値（レコード位置）を取得
+func (bt *btree) SearchAll(key string) []int {
+	return bt.searchNode(bt.Root, key)
+}
+
+// searchNode - ノード内でキーを検索
+func (bt *btree) searchNode(node *btreeNode, key string) []int {
+	if node.IsLeaf {
+		// リーフノードの場合、線形検索
+		pos := sort.Search(len(node.Keys), func(i int) bool {
+			return node.Keys[i] >= key
+		})
+
+		if pos < len(node.Keys) && node.Keys[pos] == key {
+			return node.Values[pos]
+		}
+		return nil
+	} else {
+		// 内部ノードの場合、適切な子ノードを選択して再帰検索
+		pos := sort.Search(len(node.Keys), func(i int) bool {
+			return node.Keys[i] > key
+		})
+
+		// TODO:
+		// 実際のRDBでは、スタックオーバーフローなどのパフォーマンス対策として、loop処理をしてるはず
+		return bt.searchNode(node.Children[pos], key)
+	}
+}
+
+// SearchRange - 範囲に入るキーの値（レコード位置）をキーの順にすべて取得
+// from 以上（fromInclusive が false なら from より大きい）、to 以下（toInclusive が false なら to 未満）のキーが対象
+// from が空なら先頭から、to が空なら末尾まで（エンコードしたキーは空にならない）
+func (bt *btree) SearchRange(from string, fromInclusive bool, to string, toInclusive bool) []int {
+	// from が入っているリーフまで降りる（from が空なら一番左のリーフ）
+	node := bt.Root
+	for !node.IsLeaf {
+		pos := sort.Search(len(node.Keys), func(i int) bool {
+			return node.Keys[i] > from
+		})
+		node = node.Children[pos]
+	}
+
+	// 範囲検索（where）のためにリーフ同士は連結リストで結ばれているので、次のリーフへ進みながら集める
+	values := []int{}
+	for ; node != nil; node = node.Next {
+		for i, key := range node.Keys {
+			if from != "" && (key < from || (key == from && !fromInclusive)) {
+				continue
+			}
+			if to != "" && (key > to || (key == to && !toInclusive)) {
+				return values
+			}
+			values = append(values, node.Values[i]...)
+		}
+	}
+	return values
+}
+
+// Delete - B+Treeからキー・値のペアを削除
+// posting list が空になったらキー自体をリーフから取り除く
+// ノードの併合（merge）は行わない。postgres の B-tree もページの回収は VACUUM に任せていて、削除のたびには併合しない
+func (bt *btree) Delete(key string, value int) bool {
+	node := bt.Root
+	for !node.IsLeaf {
+		pos := sort.Search(len(node.Keys), func(i int) bool {
+			return node.Keys[i] > key
+		})
+		node = node.Children[pos]
+	}
+
+	pos := sort.Search(len(node.Keys), func(i int) bool {
+		return node.Keys[i] >= key
+	})
+	if pos >= len(node.Keys) || node.Keys[pos] != key {
+		return false
+	}
+
+	values := node.Values[pos]
+	for i, v := range values {
+		if v != value {
+			continue
+		}
+		node.Values[pos] = append(values[:i], values[i+1:]...)
+		if len(node.Values[pos]) == 0 {
+			node.Keys = append(node.Keys[:pos], node.Keys[pos+1:]...)
+			node.Values = append(node.Values[:pos], node.Values[pos+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+// PrintTree - デバッグ用：B+Treeの構造を w に書く
+func (bt *btree) PrintTree(w io.Writer) {
+	fmt.Fprintf(w, "B+Tree %s for %s(%s):\n", bt.Name, bt.TableName, strings.Join(bt.Columns, ", "))
+	bt.printNode(w, bt.Root, 0)
+}
+
+// printNode - ノードを再帰的に表示
+func (bt *btree) printNode(w io.Writer, node *btreeNode, depth int) {
+	if node == nil {
+		return
+	}
+
+	indent := ""
+	for i := 0; i < depth; i++ {
+		indent += "  "
+	}
+
+	if node.IsLeaf {
+		fmt.Fprintf(w, "%sLeaf: Keys=%v, Values=%v\n", indent, formatIndexKeys(node.Keys), node.Values)
+	} else {
+		fmt.Fprintf(w, "%sInternal: Keys=%v\n", indent, formatIndexKeys(node.Keys))
+		for _, child := range node.Children {
+			bt.printNode(w, child, depth+1)
+		}
+	}
+}
+
+// formatIndexKeys - デバッグ表示用にキーの配列を読める形に変換
+func formatIndexKeys(keys []string) []string {
+	formatted := make([]string, len(keys))
+	for i, key := range keys {
+		formatted[i] = formatIndexKey(key)
+	}
+	return formatted
+}
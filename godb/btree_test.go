@@ -0,0 +1,275 @@
+package godb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testKey - テスト用のキー（B+Tree は文字列の大小だけで並べるので、ゼロ埋めした数値で十分）
+func testKey(i int) string {
+	return fmt.Sprintf("%04d", i)
+}
+
+func TestBTreeNonUnique(t *testing.T) {
+	bt := newBTree("users_age_idx", "users", []string{"age"}, false)
+
+	// 分割が起きるくらいの件数を、同じキーが何度も出てくるように挿入する
+	for i := 0; i < 30; i++ {
+		if err := bt.Insert(testKey(i%5), i); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+
+	for key := 0; key < 5; key++ {
+		values := bt.SearchAll(testKey(key))
+		if len(values) != 6 {
+			t.Errorf("key=%d の件数が一致しません。期待: 6, 実際: %d (%v)", key, len(values), values)
+		}
+		for _, v := range values {
+			if v%5 != key {
+				t.Errorf("key=%d に別のキーの値 %d が入っています", key, v)
+			}
+		}
+	}
+
+	if values := bt.SearchAll(testKey(100)); len(values) != 0 {
+		t.Errorf("存在しないキーで値が返りました: %v", values)
+	}
+}
+
+func TestBTreeUnique(t *testing.T) {
+	bt := newBTree("users_pkey", "users", []string{"id"}, true)
+
+	for i := 0; i < 20; i++ {
+		if err := bt.Insert(testKey(i), i*10); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+
+	err := bt.Insert(testKey(7), 999)
+	var dupErr *duplicateKeyError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("DuplicateKeyError が期待されましたが %v でした", err)
+	}
+	if dupErr.Key != testKey(7) || dupErr.IndexName != "users_pkey" {
+		t.Errorf("エラー内容が一致しません: %+v", dupErr)
+	}
+
+	// 重複挿入で既存の値が上書きされていないこと
+	values := bt.SearchAll(testKey(7))
+	if len(values) != 1 || values[0] != 70 {
+		t.Errorf("既存の値が変更されています: %v", values)
+	}
+}
+
+func TestBTreeDelete(t *testing.T) {
+	bt := newBTree("users_age_idx", "users", []string{"age"}, false)
+	for i := 0; i < 12; i++ {
+		bt.Insert(testKey(i%3), i)
+	}
+
+	if !bt.Delete(testKey(1), 4) {
+		t.Fatalf("削除に失敗しました")
+	}
+	if bt.Delete(testKey(1), 4) {
+		t.Errorf("削除済みの値が再度削除できてしまいました")
+	}
+
+	values := bt.SearchAll(testKey(1))
+	if len(values) != 3 {
+		t.Errorf("削除後の件数が一致しません。期待: 3, 実際: %d (%v)", len(values), values)
+	}
+
+	// posting list が空になったらキーごと消える
+	for _, v := range []int{0, 3, 6, 9} {
+		bt.Delete(testKey(0), v)
+	}
+	if _, found := bt.Search(testKey(0)); found {
+		t.Errorf("すべての値を削除したキーが残っています")
+	}
+	if _, found := bt.Search(testKey(2)); !found {
+		t.Errorf("削除していないキーが見つかりません")
+	}
+}
+
+func TestBTreeNonUniqueSplitBoundary(t *testing.T) {
+	bt := newBTree("users_age_idx", "users", []string{"age"}, false)
+
+	// 分割で昇格したキーと同じキーを後から挿入しても、検索で見つかること
+	for i := 0; i < 8; i++ {
+		bt.Insert(testKey(i), i)
+	}
+	for i := 0; i < 8; i++ {
+		bt.Insert(testKey(i), 100+i)
+	}
+	for i := 0; i < 8; i++ {
+		if values := bt.SearchAll(testKey(i)); len(values) != 2 {
+			t.Errorf("key=%d の件数が一致しません。期待: 2, 実際: %d (%v)", i, len(values), values)
+		}
+	}
+}
+
+func TestBTreeSearchRange(t *testing.T) {
+	bt := newBTree("users_age_idx", "users", []string{"age"}, false)
+	// 分割が起きて複数のリーフにまたがるように挿入する（キー 0〜19、キーごとに 2 件）
+	for i := 0; i < 40; i++ {
+		bt.Insert(testKey(i%20), i)
+	}
+
+	tests := []struct {
+		name          string
+		from          string
+		fromInclusive bool
+		to            string
+		toInclusive   bool
+		expected      []int // 期待するキー（キーごとに 2 件ずつ返る）
+	}{
+		{name: "両端を含む", from: testKey(3), fromInclusive: true, to: testKey(6), toInclusive: true, expected: []int{3, 4, 5, 6}},
+		{name: "両端を含まない", from: testKey(3), to: testKey(6), expected: []int{4, 5}},
+		{name: "下限なし", to: testKey(2), toInclusive: true, expected: []int{0, 1, 2}},
+		{name: "上限なし", from: testKey(17), expected: []int{18, 19}},
+		{name: "範囲にキーがない", from: testKey(100), fromInclusive: true, expected: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := bt.SearchRange(tt.from, tt.fromInclusive, tt.to, tt.toInclusive)
+			keys := []int{}
+			for i, v := range values {
+				if i%2 == 0 {
+					keys = append(keys, v%20)
+				} else if v%20 != keys[len(keys)-1] {
+					t.Errorf("同じキーの値が続いていません: %v", values)
+				}
+			}
+			if len(values) != 2*len(keys) || !reflect.DeepEqual(keys, tt.expected) {
+				t.Errorf("期待: %v, 実際: %v (%v)", tt.expected, keys, values)
+			}
+		})
+	}
+}
+
+func TestEncodeIndexKeyOrder(t *testing.T) {
+	tableDef := &tableSchema{
+		Name: "follows",
+		Columns: []columnDef{
+			{Name: "user_id", Type: "INT"},
+			{Name: "name", Type: "TEXT"},
+		},
+	}
+	columns := []string{"user_id", "name"}
+
+	// エンコード後の文字列の大小が、値としての大小と一致すること
+	rows := []tableRow{
+		{"-10", "b"},
+		{"-1", "a"},
+		{"0", ""},
+		{"2", "a"},
+		{"2", "ab"},
+		{"2", "b"},
+		{"10", "a"},
+	}
+	var prev string
+	for i, row := range rows {
+		key, err := encodeIndexKey(tableDef, columns, row)
+		if err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+		if i > 0 && prev >= key {
+			t.Errorf("%v のキーが前の行より大きくなっていません", row)
+		}
+		if got := decodeIndexKey(key); !reflect.DeepEqual(got, []string(row)) {
+			t.Errorf("デコード結果が一致しません。期待: %v, 実際: %v", row, got)
+		}
+		prev = key
+	}
+}
+
+func TestIndexKeyNull(t *testing.T) {
+	tableDef := &tableSchema{
+		Name: "users",
+		Columns: []columnDef{
+			{Name: "id", Type: "INT"},
+			{Name: "email", Type: "TEXT"},
+		},
+	}
+	columns := []string{"email"}
+
+	nullKey, err := encodeIndexKey(tableDef, columns, tableRow{"1", nullField})
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	textKey, err := encodeIndexKey(tableDef, columns, tableRow{"2", "zzz"})
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	// NULL は昇順で最後に並ぶ
+	if nullKey <= textKey {
+		t.Errorf("NULL のキーが値のあるキーより後に並んでいません")
+	}
+	if got := formatIndexKey(nullKey); got != "(NULL)" {
+		t.Errorf("表示が一致しません。期待: (NULL), 実際: %s", got)
+	}
+
+	// 一意インデックスでも NULL は何件でも登録できる
+	bt := newBTree("users_email_key", "users", columns, true)
+	for i := 0; i < 3; i++ {
+		if err := bt.Insert(nullKey, i); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+	if err := bt.Insert(textKey, 3); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if err := bt.Insert(textKey, 4); err == nil {
+		t.Errorf("期待されたエラーが発生しませんでした")
+	}
+	if values := bt.SearchAll(nullKey); len(values) != 3 {
+		t.Errorf("NULL のキーの件数が一致しません。期待: 3, 実際: %d", len(values))
+	}
+}
+
+func TestEncodeIndexKeyTypedOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		colType string
+		fields  []string // 昇順に並べた値
+	}{
+		{name: "DECIMAL", colType: "DECIMAL", fields: []string{"-100", "-2.5", "-0.001", "0", "0.001", "0.01", "1", "1.5", "10", "123.456"}},
+		{name: "FLOAT", colType: "FLOAT", fields: []string{"-1e+100", "-2.5", "-0.001", "0", "1e-10", "1", "1.5", "1e+100"}},
+		{name: "BOOLEAN", colType: "BOOLEAN", fields: []string{"false", "true"}},
+		{name: "DATE", colType: "DATE", fields: []string{"1969-12-31", "1970-01-01", "2024-02-29", "2024-03-01"}},
+		{name: "BYTEA", colType: "BYTEA", fields: []string{`\x`, `\x00`, `\x0000`, `\x0001`, `\x01`, `\xff`}},
+		{name: "TIMESTAMP", colType: "TIMESTAMP", fields: []string{"1960-01-01 00:00:00", "2024-01-01 00:00:00", "2024-01-01 00:00:00.000001", "2024-01-01 12:00:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableDef := &tableSchema{Name: "t", Columns: []columnDef{{Name: "v", Type: tt.colType}}}
+			var prev string
+			for i, field := range tt.fields {
+				key, err := encodeIndexKey(tableDef, []string{"v"}, tableRow{field})
+				if err != nil {
+					t.Fatalf("予期しないエラー: %v", err)
+				}
+				if i > 0 && prev >= key {
+					t.Errorf("%s のキーが前の値より大きくなっていません", field)
+				}
+				if got := decodeIndexKey(key); !reflect.DeepEqual(got, []string{field}) {
+					t.Errorf("デコード結果が一致しません。期待: %v, 実際: %v", field, got)
+				}
+				prev = key
+			}
+		})
+	}
+
+	// 値が同じ DECIMAL はスケールが違っても同じキーになる
+	tableDef := &tableSchema{Name: "t", Columns: []columnDef{{Name: "v", Type: "DECIMAL"}}}
+	a, _ := encodeIndexKey(tableDef, []string{"v"}, tableRow{"1.5"})
+	b, _ := encodeIndexKey(tableDef, []string{"v"}, tableRow{"1.500"})
+	if a != b {
+		t.Errorf("1.5 と 1.500 のキーが一致しません")
+	}
+}
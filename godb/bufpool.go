@@ -0,0 +1,144 @@
+package godb
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"sync"
+)
+
+// バッファプール
+//
+// データファイル（users.db）はページ（Options.PageSize バイト。既定は 8KB）単位で読み、読んだページをメモリに置いておく
+// 同じページをもう一度読むときはファイルを読まずにメモリから返す（hit）
+//   - 置いておくページの数は Options.BufferPoolSize まで。あふれたら一番長く使っていないページから捨てる（LRU）
+//   - データファイルを書き換えるとき（storage.go の AppendRows / WriteAllRows など）はそのファイルのページを捨てる
+//   - 行外保存のサイドファイル（toast.go）・カタログ・シーケンスのファイルはバッファプールを通さない
+// どの演算子が何ページを hit / read したかは EXPLAIN ANALYZE の Buffers に出る
+
+const (
+	defaultPageSize       = 8192 // 1 ページの大きさの既定値（postgres と同じ 8KB）
+	defaultBufferPoolSize = 1024 // バッファプールのページ数の既定値（8KB のページなら 8MB）
+)
+
+// bufferPool - データファイルのページのキャッシュ
+type bufferPool struct {
+	pageSize int
+	capacity int      // 置いておくページの数の上限
+	syncMode SyncMode // 追記した行をディスクに書き出すか（AppendRows）
+
+	mu    sync.Mutex
+	files map[string]map[int64]*list.Element // ファイル名 → ページ番号 → lru の要素
+	lru   *list.List                         // ページを使った順（先頭が最後に使ったもの）
+}
+
+// cachedPage - バッファプールに置いたページ（ファイルの最後のページは pageSize より短い）
+type cachedPage struct {
+	file string
+	page int64
+	data []byte
+}
+
+// bufferUsage - 読んだページの数（EXPLAIN ANALYZE の Buffers: shared hit=... read=...）
+type bufferUsage struct {
+	hit  int64 // バッファプールにあったページ
+	read int64 // データファイルから読んだページ
+}
+
+func (u *bufferUsage) add(other bufferUsage) {
+	u.hit += other.hit
+	u.read += other.read
+}
+
+func newBufferPool(pageSize, capacity int, syncMode SyncMode) *bufferPool {
+	return &bufferPool{
+		pageSize: pageSize,
+		capacity: capacity,
+		syncMode: syncMode,
+		files:    make(map[string]map[int64]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// readPage - データファイル f（名前は file）の page 番目のページを返す（ファイルの終わりより後なら空）
+func (bp *bufferPool) readPage(f *os.File, file string, page int64, usage *bufferUsage) ([]byte, error) {
+	bp.mu.Lock()
+	if elem, ok := bp.files[file][page]; ok {
+		bp.lru.MoveToFront(elem)
+		bp.mu.Unlock()
+		usage.hit++
+		return elem.Value.(*cachedPage).data, nil
+	}
+	bp.mu.Unlock()
+
+	data := make([]byte, bp.pageSize)
+	n, err := f.ReadAt(data, page*int64(bp.pageSize))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	usage.read++
+	bp.put(file, page, data[:n])
+	return data[:n], nil
+}
+
+// put - ページをバッファプールに置く（あふれたら一番長く使っていないページを捨てる）
+func (bp *bufferPool) put(file string, page int64, data []byte) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if bp.files[file] == nil {
+		bp.files[file] = make(map[int64]*list.Element)
+	}
+	bp.files[file][page] = bp.lru.PushFront(&cachedPage{file: file, page: page, data: data})
+	for bp.lru.Len() > bp.capacity {
+		victim := bp.lru.Remove(bp.lru.Back()).(*cachedPage)
+		delete(bp.files[victim.file], victim.page)
+		if len(bp.files[victim.file]) == 0 {
+			delete(bp.files, victim.file)
+		}
+	}
+}
+
+// invalidate - ファイルのページをすべて捨てる（ファイルを書き換えたとき）
+func (bp *bufferPool) invalidate(file string) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for _, elem := range bp.files[file] {
+		bp.lru.Remove(elem)
+	}
+	delete(bp.files, file)
+}
+
+// pageReader - データファイルをバッファプールのページを通して先頭から読む io.Reader
+type pageReader struct {
+	bp     *bufferPool
+	f      *os.File
+	file   string
+	offset int64
+	usage  bufferUsage
+}
+
+func (r *pageReader) Read(p []byte) (int, error) {
+	pageSize := int64(r.bp.pageSize)
+	data, err := r.bp.readPage(r.f, r.file, r.offset/pageSize, &r.usage)
+	if err != nil {
+		return 0, err
+	}
+	start := int(r.offset % pageSize)
+	if start >= len(data) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[start:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// clear - すべてのページを捨てる（トランザクションを取り消してファイルを戻したとき）
+func (bp *bufferPool) clear() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.files = make(map[string]map[int64]*list.Element)
+	bp.lru.Init()
+}
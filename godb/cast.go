@@ -0,0 +1,315 @@
+package godb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 型変換のルール
+//
+// postgres の pg_cast と同じく「変換元の型 → 変換先の型」ごとに、どの場面で変換してよいかを表で持つ
+//   - 暗黙（castImplicit）    : 比較・演算で両辺の型を揃えるとき。情報が落ちない変換だけ（INT → DECIMAL、DATE → TIMESTAMP など）
+//   - 代入（castAssignment）  : INSERT / UPDATE でカラムに値を入れるとき。丸めや範囲チェックを伴う変換も含む（DECIMAL → INT など）
+//   - 明示（castExplicit）    : CAST(x AS t) / x::t。文字列の値をその型の表記として読む変換も含む
+//
+// 場面は 暗黙 < 代入 < 明示 の順に広くなり、狭い場面で使える変換は広い場面でも使える
+// 'abc' のような型のない文字列リテラルは、postgres の unknown 型と同じく比較・代入の相手の型の表記として読む
+
+// castContextは型変換が行われる場面
+type castContext int
+
+const (
+	castImplicit castContext = iota
+	castAssignment
+	castExplicit
+)
+
+// castTableは型変換の表（変換元 → 変換先 → 変換できる最も狭い場面）
+// 表にない組み合わせはどの場面でも変換できない。同じ種類の型どうしは常に変換できる
+// 整数の値は INT / BIGINT の区別なく BIGINT、文字列の値は TEXT として引く
+var castTable = map[TypeKind]map[TypeKind]castContext{
+	TypeBigInt: {
+		TypeInt:     castAssignment,
+		TypeFloat:   castImplicit,
+		TypeDecimal: castImplicit,
+		TypeBoolean: castExplicit,
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+	TypeFloat: {
+		TypeInt:     castAssignment,
+		TypeBigInt:  castAssignment,
+		TypeDecimal: castAssignment,
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+	TypeDecimal: {
+		TypeInt:     castAssignment,
+		TypeBigInt:  castAssignment,
+		TypeFloat:   castImplicit,
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+	TypeBoolean: {
+		TypeInt:     castExplicit,
+		TypeBigInt:  castExplicit,
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+	TypeText: {
+		TypeVarchar:   castImplicit,
+		TypeInt:       castExplicit,
+		TypeBigInt:    castExplicit,
+		TypeFloat:     castExplicit,
+		TypeDecimal:   castExplicit,
+		TypeBoolean:   castExplicit,
+		TypeDate:      castExplicit,
+		TypeTimestamp: castExplicit,
+		TypeBytea:     castExplicit,
+		TypeJSON:      castExplicit,
+	},
+	TypeDate: {
+		TypeTimestamp: castImplicit,
+		TypeText:      castAssignment,
+		TypeVarchar:   castAssignment,
+	},
+	TypeTimestamp: {
+		TypeDate:    castAssignment,
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+	TypeBytea: {
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+	TypeJSON: {
+		TypeText:    castAssignment,
+		TypeVarchar: castAssignment,
+	},
+}
+
+// TypeMismatchErrorは値の型が期待する型に合わないことを表す
+type TypeMismatchError struct {
+	Column   string // 代入先のカラム名（比較・演算ではカラムの側のカラム名。どちらでもなければ空）
+	Expected string // 期待する型（比較・演算では Column の側か左辺の型）
+	Actual   string // 値の型（比較・演算では右辺の型）
+	Value    string // 値（SQL のリテラルの表記）
+	Expr     string // 比較・演算の式（比較・演算以外では空）
+}
+
+func (e *TypeMismatchError) Error() string {
+	switch {
+	case e.Expr != "" && e.Column != "":
+		return fmt.Sprintf("カラム '%s' の %s 型と %s 型の値は比較・演算できません: %s", e.Column, e.Expected, e.Actual, e.Expr)
+	case e.Expr != "":
+		return fmt.Sprintf("%s 型と %s 型の値は比較・演算できません: %s", e.Expected, e.Actual, e.Expr)
+	case e.Column != "":
+		return fmt.Sprintf("カラム '%s' は %s 型ですが、値 %s は %s 型です（CAST で型を変換してください）", e.Column, e.Expected, e.Value, e.Actual)
+	}
+	return fmt.Sprintf("%s 型の値 %s は %s 型に変換できません", e.Actual, e.Value, e.Expected)
+}
+
+// literalTextは値を SQL のリテラルの表記にする（エラーメッセージ用。文字列は 'a' のように引用符で囲む）
+func literalText(v any) string {
+	return (&literal{Value: v}).String()
+}
+
+// valueKindは値の型の種類を返す（NULL は false）
+func valueKind(v any) (TypeKind, bool) {
+	switch v.(type) {
+	case int64:
+		return TypeBigInt, true
+	case float64:
+		return TypeFloat, true
+	case Decimal:
+		return TypeDecimal, true
+	case bool:
+		return TypeBoolean, true
+	case string:
+		return TypeText, true
+	case Date:
+		return TypeDate, true
+	case Timestamp:
+		return TypeTimestamp, true
+	case []byte:
+		return TypeBytea, true
+	case JSON:
+		return TypeJSON, true
+	}
+	return 0, false
+}
+
+// canCastは from の型の値を ctx の場面で to の型に変換できるか
+func canCast(from, to TypeKind, ctx castContext) bool {
+	if from == to || (SQLType{Kind: from}.isInteger() && SQLType{Kind: to}.isInteger()) ||
+		(SQLType{Kind: from}.isString() && SQLType{Kind: to}.isString()) {
+		return true
+	}
+	need, ok := castTable[from][to]
+	return ok && need <= ctx
+}
+
+// castValueは値を ctx の場面の規則で型 t に変換する
+// 変換できない組み合わせは TypeMismatchError、範囲・長さ・表記の誤りはそれぞれのエラーになる
+func castValue(v any, t SQLType, ctx castContext) (any, error) {
+	kind, ok := valueKind(v)
+	if !ok {
+		return nil, nil
+	}
+	if !canCast(kind, t.Kind, ctx) {
+		return nil, &TypeMismatchError{Expected: t.String(), Actual: valueTypeName(v), Value: literalText(v)}
+	}
+	return convertValue(v, t)
+}
+
+// commonKindは 2 つの型の値を比較・演算するときに揃える型を返す
+// 一方からもう一方へ暗黙に変換できれば変換先の型（INT と DECIMAL なら DECIMAL）
+func commonKind(a, b TypeKind) (TypeKind, bool) {
+	switch {
+	case canCast(a, b, castImplicit):
+		return b, true
+	case canCast(b, a, castImplicit):
+		return a, true
+	}
+	return 0, false
+}
+
+// unifyValuesは 2 つの値を共通の型に揃える（どちらかが NULL ならそのまま）
+func unifyValues(left, right any) (any, any, error) {
+	lk, lok := valueKind(left)
+	rk, rok := valueKind(right)
+	if !lok || !rok || lk == rk {
+		return left, right, nil
+	}
+	kind, ok := commonKind(lk, rk)
+	if !ok {
+		return nil, nil, &TypeMismatchError{Expected: valueTypeName(left), Actual: valueTypeName(right), Value: literalText(right)}
+	}
+	t := SQLType{Kind: kind}
+	var err error
+	if lk != kind {
+		left, err = convertValue(left, t)
+	} else {
+		right, err = convertValue(right, t)
+	}
+	return left, right, err
+}
+
+// isUnknownLiteralは型のない文字列リテラル（'2024-01-31' など）かどうか
+func isUnknownLiteral(e exprNode) bool {
+	lit, ok := e.(*literal)
+	if !ok {
+		return false
+	}
+	_, isString := lit.Value.(string)
+	return isString
+}
+
+// assignmentContextはカラムに式の値を代入するときの変換の場面を返す
+// 型のない文字列リテラルはカラムの型の表記として読むので、明示的な CAST と同じ扱いにする
+func assignmentContext(e exprNode) castContext {
+	if isUnknownLiteral(e) {
+		return castExplicit
+	}
+	return castAssignment
+}
+
+// coerceUnknownLiteralは型のない文字列リテラルの値を、相手の値の型の表記として読む
+// 'abc' と TEXT の値のように相手も文字列なら何もしない
+func coerceUnknownLiteral(literal string, other any) (any, error) {
+	kind, ok := valueKind(other)
+	if !ok || kind == TypeText {
+		return literal, nil
+	}
+	return convertValue(literal, SQLType{Kind: kind})
+}
+
+// withExprは型の不一致のエラーに、エラーになった式を付ける
+func withExpr(err error, e exprNode) error {
+	var mismatch *TypeMismatchError
+	if errors.As(err, &mismatch) && mismatch.Column == "" && mismatch.Expr == "" {
+		mismatch.Expr = e.String()
+	}
+	return err
+}
+
+// checkExprTypesは式の中の比較・演算の両辺の型を、行を読む前（プランを作るとき）に確かめる
+// 実行時の値の型（INT のカラムの値も int64）ではなくカラムの宣言された型で見るので、空のテーブルでも型の合わない式はエラーになる
+// 両辺の型はカラム・定数・CAST・型の決まったパラメータのときだけ見る（それ以外の式は評価するときに確かめる）
+func checkExprTypes(sc *scope, e exprNode) error {
+	if e == nil {
+		return nil
+	}
+	var err error
+	walkExpr(e, func(sub exprNode) {
+		if bin, ok := sub.(*binaryExpr); ok && err == nil {
+			err = checkOperandTypes(sc, bin)
+		}
+	})
+	return err
+}
+
+// checkOperandTypesは比較・演算の両辺の型を evalExpr と同じ規則で確かめる
+//   - 型のない文字列リテラルは相手の型の表記として読めるか（INT のカラムと 'abc' はエラー）
+//   - 両辺の型が決まっている比較は、暗黙の変換で揃えられるか（INT のカラムと TEXT のカラムはエラー）
+func checkOperandTypes(sc *scope, e *binaryExpr) error {
+	switch e.Op {
+	case "AND", "OR", "||", "->", "->>":
+		return nil
+	}
+	lt, lok := operandType(sc, e.Left)
+	rt, rok := operandType(sc, e.Right)
+	switch {
+	case isUnknownLiteral(e.Left) && rok:
+		return checkUnknownLiteral(e.Left.(*literal), e.Right, rt, e)
+	case isUnknownLiteral(e.Right) && lok:
+		return checkUnknownLiteral(e.Right.(*literal), e.Left, lt, e)
+	case lok && rok && e.Op != "+" && e.Op != "-" && e.Op != "*" && e.Op != "/" && e.Op != "%":
+		lk, rk := castKind(lt), castKind(rt)
+		if _, ok := commonKind(lk, rk); ok || lk == rk {
+			return nil
+		}
+		mismatch := &TypeMismatchError{Expected: lt.String(), Actual: rt.String(), Expr: e.String()}
+		if ref, ok := e.Left.(*columnRef); ok {
+			mismatch.Column = ref.Name
+		} else if ref, ok := e.Right.(*columnRef); ok {
+			mismatch.Column, mismatch.Expected, mismatch.Actual = ref.Name, rt.String(), lt.String()
+		}
+		return mismatch
+	}
+	return nil
+}
+
+// checkUnknownLiteralは型のない文字列リテラルを、相手の式（other）の型 t の表記として読めるか確かめる
+func checkUnknownLiteral(lit *literal, other exprNode, t SQLType, e *binaryExpr) error {
+	if t.isString() {
+		return nil
+	}
+	if _, err := convertValue(lit.Value, SQLType{Kind: t.Kind}); err != nil {
+		if ref, ok := other.(*columnRef); ok {
+			return fmt.Errorf("カラム '%s' は %s 型ですが、%v: %s", ref.Name, t, err, e.String())
+		}
+		return fmt.Errorf("%v: %s", err, e.String())
+	}
+	return nil
+}
+
+// operandTypeは比較・演算のオペランドの型を返す（カラム・定数・CAST・パラメータのうち型の決まるものだけ）
+func operandType(sc *scope, e exprNode) (SQLType, bool) {
+	switch e.(type) {
+	case *columnRef, *literal, *castExpr, *paramExpr:
+		return knownType(sc, e)
+	}
+	return SQLType{}, false
+}
+
+// castKindは型の変換の表（castTable）を引くときの種類を返す（整数は BIGINT、文字列は TEXT）
+func castKind(t SQLType) TypeKind {
+	switch {
+	case t.isInteger():
+		return TypeBigInt
+	case t.isString():
+		return TypeText
+	}
+	return t.Kind
+}
@@ -0,0 +1,562 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// システムカタログ
+//
+// テーブル定義（カラム・制約・インデックス・スキーマの版）はすべてデータディレクトリの 1 つのカタログファイル（catalog.json）に保存する
+// 以前はテーブルごとの .schema ファイルだったので、RENAME TO や外部キーの参照先の書き換えのように
+// 複数のテーブル定義を変える操作の途中で失敗すると、ファイルどうしが食い違ったまま残ることがあった
+//
+// カタログの変更（CREATE / DROP / ALTER TABLE・TRUNCATE・CREATE INDEX）は 1 文を 1 つのトランザクションにして WAL に記録する（commitCatalog）
+//   1. BEGIN、新しいカタログ全体（CATALOG）、あとで行うファイルの操作（CREATE_FILE / REMOVE_FILES / RENAME_FILES / DROP_SEQUENCE）を WAL に書く
+//   2. COMMIT を書いて WAL をディスクに書き出す（ここでコミットが確定する）
+//   3. catalog.json を一時ファイルに書いてから置き換え、ファイルの操作を行う
+//   4. CHECKPOINT を書く
+// 3 の途中でクラッシュしても、起動時に WAL から 3 をやり直すので（replayCatalog）、カタログとデータファイルは食い違わない
+// 1 の途中でエラーになったりクラッシュしたりしたら、COMMIT がないので何も変わらない
+//
+// データディレクトリに catalog.json がなく .schema ファイルがあれば、起動時にそれを読み込んでカタログに移す（移したら .schema ファイルは消す）
+//
+// カタログの内容は読み取り専用の仮想テーブル（システムビュー）として SELECT できる
+//   SELECT table_name FROM information_schema.tables WHERE table_schema = 'public';
+//   SELECT column_name, data_type, is_nullable FROM information_schema.columns WHERE table_name = 'users';
+//   SELECT indexname, indexdef FROM pg_indexes WHERE tablename = 'users';
+//   SELECT attname, n_distinct, most_common_vals FROM pg_stats WHERE tablename = 'users';
+
+// catalogFileNameはカタログを保存するファイル名（データディレクトリの直下）
+const catalogFileName = "catalog.json"
+
+// databaseNameはシステムビューの table_catalog に出すデータベース名
+const databaseName = "go-database"
+
+// catalog - システムカタログ（データベースの全テーブルの定義）
+type catalog struct {
+	Tables map[string]*tableSchema // テーブル名 → テーブル定義
+
+	dir string // データディレクトリ
+}
+
+// newCatalog - 空のカタログを作る
+func newCatalog(dir string) *catalog {
+	return &catalog{Tables: make(map[string]*tableSchema), dir: dir}
+}
+
+// loadCatalog - データディレクトリのカタログファイルを読み込む（なければ .schema ファイルから移行する）
+func loadCatalog(dir string) (*catalog, error) {
+	data, err := os.ReadFile(filepath.Join(dir, catalogFileName))
+	if os.IsNotExist(err) {
+		return migrateTableSchemas(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	catalog := newCatalog(dir)
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("カタログ '%s' が壊れています: %v", catalogFileName, err)
+	}
+	if catalog.Tables == nil {
+		catalog.Tables = make(map[string]*tableSchema)
+	}
+	for name, tableDef := range catalog.Tables {
+		tableDef.path = catalog.tablePath(name)
+	}
+	return catalog, nil
+}
+
+// migrateTableSchemas - テーブルごとの .schema ファイルを読み込んでカタログに移す
+func migrateTableSchemas(dir string) (*catalog, error) {
+	catalog := newCatalog(dir)
+	files, err := filepath.Glob(filepath.Join(dir, "*.schema"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return catalog, nil
+	}
+	for _, file := range files {
+		tableDef, err := loadTableSchema(file)
+		if err != nil {
+			return nil, fmt.Errorf("スキーマ '%s' の読み込みに失敗しました: %v", file, err)
+		}
+		tableDef.path = catalog.tablePath(tableDef.Name)
+		catalog.Tables[tableDef.Name] = tableDef
+	}
+	// カタログを保存してから .schema ファイルを消す（途中で落ちても、次の起動ではカタログを読む）
+	data, err := catalog.encode()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCatalogFile(dir, data); err != nil {
+		return nil, fmt.Errorf("カタログ保存エラー: %v", err)
+	}
+	for _, file := range files {
+		if err := removeTableSchema(file); err != nil {
+			return nil, err
+		}
+	}
+	return catalog, nil
+}
+
+// encode - カタログ全体を JSON にする
+func (c *catalog) encode() ([]byte, error) {
+	// CHECK 式の < や > が \u003c のようにエスケープされないよう、HTML エスケープは無効にする
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCatalogFile - カタログファイルを書く（一時ファイルに書いてディスクに書き出してから置き換える）
+func writeCatalogFile(dir string, data []byte) error {
+	filename := filepath.Join(dir, catalogFileName)
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// tablePath - テーブルのファイルのパス（拡張子なし。例: data/base/users）
+func (c *catalog) tablePath(tableName string) string {
+	return filepath.Join(c.dir, baseDirName, tableName)
+}
+
+// tableNames - テーブル名の一覧（名前順）
+func (c *catalog) tableNames() []string {
+	names := make([]string, 0, len(c.Tables))
+	for name := range c.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// catalogChange - 1 つの文によるカタログの変更
+type catalogChange struct {
+	Removed []string       // カタログから削除するテーブル
+	Tables  []*tableSchema // 登録（同じ名前があれば置き換え）するテーブル定義
+	Files   []fileOp       // カタログを書き換えたあとに行うファイルの操作
+}
+
+// fileOp - カタログの変更に伴うファイルの操作（WAL に記録してから行うので、途中でクラッシュしても起動時にやり直せる）
+// どれも 2 回行っても結果が変わらない（既にないファイルの削除や、名前を変え終わったファイルの名前の変更は何もしない）
+type fileOp struct {
+	Op      opType // opTypeCreateFile / opTypeRemoveFiles / opTypeRenameFiles / opTypeDropSequence
+	Name    string // テーブル名（DROP_SEQUENCE はシーケンス名）
+	NewName string // 新しいテーブル名（RENAME_FILES）
+}
+
+// commitCatalog - カタログの変更を 1 つのトランザクションとして WAL に記録してから反映する
+func (db *database) commitCatalog(change catalogChange) error {
+	next := newCatalog(db.dir)
+	for name, tableDef := range db.catalog.Tables {
+		next.Tables[name] = tableDef
+	}
+	for _, name := range change.Removed {
+		delete(next.Tables, name)
+	}
+	for _, tableDef := range change.Tables {
+		next.Tables[tableDef.Name] = tableDef
+	}
+	data, err := next.encode()
+	if err != nil {
+		return err
+	}
+
+	// WAL に書いてコミットする（ここまでにエラーになったら何も変わらない）
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	err = db.logOperation(tx, opTypeCatalog, "", string(data))
+	for _, op := range change.Files {
+		if err != nil {
+			break
+		}
+		err = db.logOperation(tx, op.Op, op.Name, op.NewName)
+	}
+	if err == nil {
+		err = db.CommitTransaction(tx)
+	}
+	if err != nil {
+		db.RollbackTransaction(tx)
+		return err
+	}
+
+	// コミット済みなので、ここから先でエラーになっても次の起動時に WAL からやり直せる
+	for _, tableDef := range change.Tables {
+		tableDef.path = next.tablePath(tableDef.Name)
+	}
+	db.catalog = next
+	db.planVersion++
+	for _, name := range change.Removed {
+		delete(db.indexes, name)
+	}
+	if err := writeCatalogFile(db.dir, data); err != nil {
+		return fmt.Errorf("カタログ保存エラー（次の起動時にやり直します）: %v", err)
+	}
+	for _, op := range change.Files {
+		if err := applyFileOp(db.pool, db.dir, op); err != nil {
+			return fmt.Errorf("ファイル操作エラー（次の起動時にやり直します）: %v", err)
+		}
+		if op.Op == opTypeDropSequence {
+			delete(db.sequences, op.Name)
+		}
+	}
+	return db.wal.checkpoint()
+}
+
+// applyFileOp - ファイルの操作を行う（コミットしたあとと、起動時のやり直しで使う）
+func applyFileOp(pool *bufferPool, dir string, op fileOp) error {
+	path := func(name string) string {
+		return filepath.Join(dir, baseDirName, name)
+	}
+	switch op.Op {
+	case opTypeCreateFile:
+		return pool.CreateTableFile(path(op.Name))
+	case opTypeRemoveFiles:
+		return pool.RemoveTableFiles(path(op.Name))
+	case opTypeRenameFiles:
+		return pool.RenameTableFiles(path(op.Name), path(op.NewName))
+	case opTypeDropSequence:
+		if err := os.Remove(sequenceFileName(dir, op.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("WAL の操作 %s は不明です", op.Op)
+}
+
+// replayCatalog - 起動時に、最後の CHECKPOINT より後にコミットしたカタログの変更を WAL からやり直す
+// （カタログを読み込む前に呼ぶ）
+func (db *database) replayCatalog() error {
+	entries, err := db.wal.readAll()
+	if err != nil {
+		return err
+	}
+	redo := committedSinceCheckpoint(entries)
+	if len(redo) == 0 {
+		return nil
+	}
+	for _, entry := range redo {
+		var err error
+		if entry.Operation == opTypeCatalog {
+			err = writeCatalogFile(db.dir, []byte(entry.Data))
+		} else {
+			err = applyFileOp(db.pool, db.dir, fileOp{Op: entry.Operation, Name: entry.TableName, NewName: entry.Data})
+		}
+		if err != nil {
+			return fmt.Errorf("WAL のやり直しに失敗しました（LSN %d）: %v", entry.LSN, err)
+		}
+	}
+	db.logf("WAL から %d 件の操作をやり直しました", len(redo))
+	return db.wal.checkpoint()
+}
+
+// システムビュー
+//
+// information_schema（SQL 標準）と pg_catalog（postgres）の一部を、カタログから行を作る読み取り専用の仮想テーブルとして提供する
+// ユーザーのテーブルのスキーマは postgres と同じく public とする
+// pg_catalog のビューはスキーマを省略しても引ける（pg_indexes）
+
+// systemView - システムビュー 1 つ分の定義
+type systemView struct {
+	Schema  string                     // スキーマ（information_schema / pg_catalog）
+	Name    string                     // ビュー名
+	Columns []columnDef                // カラム
+	rows    func(db *database) [][]any // 行（カラムの順の値）を作る
+}
+
+// fullName - スキーマ名付きのビュー名
+func (v systemView) fullName() string {
+	return v.Schema + "." + v.Name
+}
+
+// viewColumns - 「名前 型」の並びからビューのカラムを作る
+func viewColumns(specs ...string) []columnDef {
+	columns := make([]columnDef, len(specs))
+	for i, spec := range specs {
+		name, typ, _ := strings.Cut(spec, " ")
+		columns[i] = columnDef{Name: name, Type: typ}
+	}
+	return columns
+}
+
+// systemViews - システムビューの一覧
+func systemViews() []systemView {
+	return []systemView{
+		{
+			Schema:  "information_schema",
+			Name:    "tables",
+			Columns: viewColumns("table_catalog TEXT", "table_schema TEXT", "table_name TEXT", "table_type TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					rows = append(rows, []any{databaseName, "public", name, "BASE TABLE"})
+				}
+				for _, view := range systemViews() {
+					rows = append(rows, []any{databaseName, view.Schema, view.Name, "VIEW"})
+				}
+				return rows
+			},
+		},
+		{
+			Schema: "information_schema",
+			Name:   "columns",
+			Columns: viewColumns("table_catalog TEXT", "table_schema TEXT", "table_name TEXT", "column_name TEXT",
+				"ordinal_position INT", "column_default TEXT", "is_nullable TEXT", "data_type TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				addColumns := func(schema, table string, tableDef *tableSchema, columns []columnDef) {
+					for i, col := range columns {
+						var def any
+						if col.Default != "" {
+							def = col.Default
+						}
+						nullable := "YES"
+						if col.NotNull || (tableDef != nil && tableDef.PrimaryKey != nil && containsName(tableDef.PrimaryKey.Columns, col.Name)) {
+							nullable = "NO"
+						}
+						rows = append(rows, []any{databaseName, schema, table, col.Name, int64(i + 1), def, nullable, col.Type})
+					}
+				}
+				for _, name := range db.catalog.tableNames() {
+					tableDef := db.catalog.Tables[name]
+					addColumns("public", name, tableDef, tableDef.Columns)
+				}
+				for _, view := range systemViews() {
+					addColumns(view.Schema, view.Name, nil, view.Columns)
+				}
+				return rows
+			},
+		},
+		{
+			Schema: "information_schema",
+			Name:   "table_constraints",
+			Columns: viewColumns("constraint_schema TEXT", "constraint_name TEXT", "table_schema TEXT", "table_name TEXT",
+				"constraint_type TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					tableDef := db.catalog.Tables[name]
+					add := func(constraint, kind string) {
+						rows = append(rows, []any{"public", constraint, "public", name, kind})
+					}
+					if tableDef.PrimaryKey != nil {
+						add(tableDef.PrimaryKey.Name, "PRIMARY KEY")
+					}
+					for _, unique := range tableDef.Uniques {
+						add(unique.Name, "UNIQUE")
+					}
+					for _, fk := range tableDef.ForeignKeys {
+						add(fk.Name, "FOREIGN KEY")
+					}
+					for _, check := range tableDef.Checks {
+						add(check.Name, "CHECK")
+					}
+				}
+				return rows
+			},
+		},
+		{
+			Schema: "information_schema",
+			Name:   "key_column_usage",
+			Columns: viewColumns("constraint_schema TEXT", "constraint_name TEXT", "table_schema TEXT", "table_name TEXT",
+				"column_name TEXT", "ordinal_position INT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					tableDef := db.catalog.Tables[name]
+					add := func(constraint string, columns []string) {
+						for i, col := range columns {
+							rows = append(rows, []any{"public", constraint, "public", name, col, int64(i + 1)})
+						}
+					}
+					for _, key := range tableDef.KeyConstraints() {
+						add(key.Name, key.Columns)
+					}
+					for _, fk := range tableDef.ForeignKeys {
+						add(fk.Name, fk.Columns)
+					}
+				}
+				return rows
+			},
+		},
+		{
+			Schema: "information_schema",
+			Name:   "referential_constraints",
+			Columns: viewColumns("constraint_schema TEXT", "constraint_name TEXT", "table_name TEXT", "unique_table_name TEXT",
+				"unique_column_names TEXT", "update_rule TEXT", "delete_rule TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					for _, fk := range db.catalog.Tables[name].ForeignKeys {
+						rows = append(rows, []any{"public", fk.Name, name, fk.RefTable,
+							strings.Join(fk.RefColumns, ", "), fk.OnUpdate, fk.OnDelete})
+					}
+				}
+				return rows
+			},
+		},
+		{
+			Schema:  "information_schema",
+			Name:    "check_constraints",
+			Columns: viewColumns("constraint_schema TEXT", "constraint_name TEXT", "check_clause TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					for _, check := range db.catalog.Tables[name].Checks {
+						rows = append(rows, []any{"public", check.Name, check.Expr})
+					}
+				}
+				return rows
+			},
+		},
+		{
+			Schema:  "pg_catalog",
+			Name:    "pg_indexes",
+			Columns: viewColumns("schemaname TEXT", "tablename TEXT", "indexname TEXT", "indexdef TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					specs, err := db.catalog.Tables[name].indexSpecs()
+					if err != nil {
+						continue // 式の壊れたインデックスは起動時にエラーになっているので、ここでは飛ばす
+					}
+					for _, spec := range specs {
+						rows = append(rows, []any{"public", name, spec.Name, indexDefinition(name, spec)})
+					}
+				}
+				return rows
+			},
+		},
+		{
+			Schema: "pg_catalog",
+			Name:   "pg_stats",
+			Columns: viewColumns("schemaname TEXT", "tablename TEXT", "attname TEXT", "null_frac FLOAT", "n_distinct FLOAT",
+				"most_common_vals TEXT", "most_common_freqs TEXT", "histogram_bounds TEXT"),
+			rows: func(db *database) [][]any {
+				rows := [][]any{}
+				for _, name := range db.catalog.tableNames() {
+					tableDef := db.catalog.Tables[name]
+					for _, col := range tableDef.Columns {
+						stats := tableDef.Stats.columnStats(col)
+						if stats == nil {
+							continue // ANALYZE していないテーブルと、ANALYZE より後に追加したカラム
+						}
+						rows = append(rows, []any{"public", name, col.Name, stats.NullFrac, stats.NDistinct,
+							statsValues(col, stats.MostCommonValues), statsFreqs(stats.MostCommonFreqs),
+							statsValues(col, stats.HistogramBounds)})
+					}
+				}
+				return rows
+			},
+		},
+	}
+}
+
+// statsValues - 統計情報の値（データファイルの表記）の並びを postgres の配列の表記（{1,2,3}）にする（空なら NULL）
+func statsValues(col columnDef, fields []string) any {
+	if len(fields) == 0 {
+		return nil
+	}
+	texts := make([]string, len(fields))
+	for i, field := range fields {
+		texts[i] = field
+		if v, err := decodeField(col, field); err == nil {
+			texts[i] = formatValue(v)
+		}
+	}
+	return "{" + strings.Join(texts, ",") + "}"
+}
+
+// statsFreqs - 最頻値の割合の並びを postgres の配列の表記にする（空なら NULL）
+func statsFreqs(freqs []float64) any {
+	if len(freqs) == 0 {
+		return nil
+	}
+	texts := make([]string, len(freqs))
+	for i, freq := range freqs {
+		texts[i] = formatValue(freq)
+	}
+	return "{" + strings.Join(texts, ",") + "}"
+}
+
+// indexDefinition - インデックスを作る CREATE INDEX 文（pg_indexes.indexdef）
+// 主キー・UNIQUE 制約のインデックスも、同じキーの UNIQUE インデックスとして表す
+func indexDefinition(tableName string, spec indexSpec) string {
+	keys := make([]string, len(spec.Keys))
+	for i, key := range spec.Keys {
+		// 式のキーは括弧で囲む（CREATE INDEX と同じ書き方。式の表記が既に括弧で始まっていればそのまま）
+		keys[i] = spec.Labels[i]
+		if _, isColumn := key.(*columnRef); !isColumn && !strings.HasPrefix(keys[i], "(") {
+			keys[i] = "(" + keys[i] + ")"
+		}
+	}
+	unique := ""
+	if spec.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, spec.Name, tableName, strings.Join(keys, ", "))
+}
+
+// lookupSystemView - 名前（information_schema.tables など）に一致するシステムビューを探す
+func lookupSystemView(name string) (systemView, bool) {
+	name = strings.ToLower(name)
+	for _, view := range systemViews() {
+		if name == view.fullName() || (view.Schema == "pg_catalog" && name == view.Name) {
+			return view, true
+		}
+	}
+	return systemView{}, false
+}
+
+// tableDef - システムビューのテーブル定義（名前はスキーマ名付き）
+func (v systemView) tableDef() *tableSchema {
+	tableDef := &tableSchema{Name: v.fullName(), Columns: v.Columns}
+	tableDef.initVersion()
+	return tableDef
+}
+
+// scanSystemView - システムビューの全行を作る
+func (db *database) scanSystemView(view systemView) ([]tableRow, error) {
+	tableDef := view.tableDef()
+	rows := []tableRow{}
+	for _, values := range view.rows(db) {
+		row := make(tableRow, len(values))
+		for i, v := range values {
+			field, err := encodeField(tableDef.Columns[i], v)
+			if err != nil {
+				return nil, err
+			}
+			row[i] = field
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,222 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UniqueViolationErrorはPRIMARY KEY / UNIQUE 制約違反を表す
+// postgres の "duplicate key value violates unique constraint" + "Key (id)=(1) already exists." に相当する
+type UniqueViolationError struct {
+	Constraint string   // 違反した制約名
+	TableName  string   // 対象テーブル名
+	Columns    []string // 制約のカラム
+	Values     []string // 重複した値
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("テーブル '%s' の一意性制約 \"%s\" に違反しています: キー (%s)=(%s) は既に存在します",
+		e.TableName, e.Constraint, strings.Join(e.Columns, ", "), strings.Join(e.Values, ", "))
+}
+
+// newUniqueViolationError - インデックスキーから制約違反エラーを作る
+func newUniqueViolationError(tableDef *tableSchema, spec indexSpec, key string) *UniqueViolationError {
+	return &UniqueViolationError{
+		Constraint: spec.Name,
+		TableName:  tableDef.Name,
+		Columns:    spec.Labels,
+		Values:     decodeIndexKey(key),
+	}
+}
+
+// checkPrimaryKeyValues - 主キーのカラムが NULL でないか確認する
+func checkPrimaryKeyValues(tableDef *tableSchema, row tableRow) error {
+	if tableDef.PrimaryKey == nil {
+		return nil
+	}
+	for _, col := range tableDef.PrimaryKey.Columns {
+		pos := tableDef.ColumnIndex(col)
+		if isNullField(tableDef.Columns[pos], row[pos]) {
+			return fmt.Errorf("主キー列 '%s' に NULL は指定できません（制約 \"%s\"）", col, tableDef.PrimaryKey.Name)
+		}
+	}
+	return nil
+}
+
+// checkUniqueOnInsert - 新しい行が既存の行と PRIMARY KEY / UNIQUE 制約・UNIQUE インデックスで重複しないか、インデックスで確認する
+func (db *database) checkUniqueOnInsert(tableDef *tableSchema, row tableRow) error {
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return err
+	}
+	for i, spec := range specs {
+		if !spec.Unique {
+			continue
+		}
+		key, err := encodeKeyExprs(tableDef, spec.Keys, row)
+		if err != nil {
+			return err
+		}
+		if keyHasNull(key) {
+			continue // NULL を含むキーはどのキーとも重複しない
+		}
+		btree := db.indexes[tableDef.Name][i]
+		if _, found := btree.Search(key); found {
+			return newUniqueViolationError(tableDef, spec, key)
+		}
+	}
+	return nil
+}
+
+// checkUniqueRows - 行の集合全体で PRIMARY KEY / UNIQUE 制約・UNIQUE インデックスの重複がないか確認する（UPDATE 後の状態の検証用）
+// UPDATE では複数行のキーが同時に入れ替わることがある（id = id + 1 など）ので、1 行ずつではなく更新後の全体で判定する
+func checkUniqueRows(tableDef *tableSchema, rows []tableRow) error {
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if !spec.Unique {
+			continue
+		}
+		seen := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			key, err := encodeKeyExprs(tableDef, spec.Keys, row)
+			if err != nil {
+				return err
+			}
+			if keyHasNull(key) {
+				continue
+			}
+			if seen[key] {
+				return newUniqueViolationError(tableDef, spec, key)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// NotNullViolationErrorはNOT NULL制約違反を表す
+type NotNullViolationError struct {
+	TableName string // 対象テーブル名
+	Column    string // 値のないカラム
+}
+
+func (e *NotNullViolationError) Error() string {
+	return fmt.Sprintf("テーブル '%s' のカラム '%s' は NOT NULL 制約のため値が必要です", e.TableName, e.Column)
+}
+
+// CheckViolationErrorはCHECK制約違反を表す
+type CheckViolationError struct {
+	TableName  string // 対象テーブル名
+	Constraint string // 違反した制約名
+	Expr       string // 制約の条件式
+}
+
+func (e *CheckViolationError) Error() string {
+	return fmt.Sprintf("テーブル '%s' の行が CHECK 制約 \"%s\" %s に違反しています", e.TableName, e.Constraint, e.Expr)
+}
+
+// validateTableConstraints - CREATE TABLE 時に DEFAULT 式が評価でき、カラムの型に合うか確認する
+// nextval などシーケンスを使う DEFAULT 式は、評価すると値が進んでしまうのでシーケンスが存在するかだけを確認する
+// （SERIAL / AUTO_INCREMENT のシーケンスはこのあと作るので確認しない）
+func (db *database) validateTableConstraints(tableDef *tableSchema) error {
+	for _, col := range tableDef.Columns {
+		if col.Sequence != "" {
+			if _, exists := db.sequences[col.Sequence]; exists {
+				return fmt.Errorf("シーケンス '%s' は既に存在します", col.Sequence)
+			}
+			continue
+		}
+		if col.Default == "" {
+			continue
+		}
+		expr, err := parseExpr(col.Default)
+		if err != nil {
+			return fmt.Errorf("カラム '%s' の DEFAULT 式が不正です: %v", col.Name, err)
+		}
+		if usesSequence(expr) {
+			if err := db.checkSequenceCalls(expr); err != nil {
+				return fmt.Errorf("カラム '%s' の DEFAULT 式: %v", col.Name, err)
+			}
+			continue
+		}
+		if _, err := db.evalDefault(col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalDefault - カラムの DEFAULT 式を評価して、データファイルに保存する文字列を返す
+func (db *database) evalDefault(col columnDef) (string, error) {
+	expr, err := parseExpr(col.Default)
+	if err != nil {
+		return "", fmt.Errorf("カラム '%s' の DEFAULT 式が不正です: %v", col.Name, err)
+	}
+	v, err := evalExpr(db.bindSequences(expr), noColumnsEnv("DEFAULT 式"))
+	if err != nil {
+		return "", fmt.Errorf("カラム '%s' の DEFAULT 式を評価できません: %v", col.Name, err)
+	}
+	return encodeFieldAs(col, v, assignmentContext(expr))
+}
+
+// applyDefaults - INSERT で値が指定されなかったカラムに DEFAULT 式の値を入れる（DEFAULT がなければ NULL）
+// DEFAULT のない NOT NULL カラムが省略されていたら NotNullViolationError
+func (db *database) applyDefaults(tableDef *tableSchema, row tableRow, assigned []bool) error {
+	for i, col := range tableDef.Columns {
+		if assigned[i] {
+			continue
+		}
+		if col.Default == "" {
+			if col.NotNull {
+				return &NotNullViolationError{TableName: tableDef.Name, Column: col.Name}
+			}
+			row[i] = nullField
+			continue
+		}
+		value, err := db.evalDefault(col)
+		if err != nil {
+			return err
+		}
+		row[i] = value
+	}
+	return nil
+}
+
+// checkRowConstraints - 1 行が NOT NULL 制約と CHECK 制約を満たすか確認する（INSERT / UPDATE 共通）
+func checkRowConstraints(tableDef *tableSchema, row tableRow) error {
+	env := rowEnv(tableDef, row)
+	for i, col := range tableDef.Columns {
+		if !col.NotNull {
+			continue
+		}
+		if i >= len(row) || isNullField(col, row[i]) {
+			return &NotNullViolationError{TableName: tableDef.Name, Column: col.Name}
+		}
+	}
+
+	for _, check := range tableDef.Checks {
+		expr, err := parseExpr(check.Expr)
+		if err != nil {
+			return fmt.Errorf("CHECK 制約 \"%s\" の式が不正です: %v", check.Name, err)
+		}
+		result, err := evalExpr(expr, env)
+		if err != nil {
+			return fmt.Errorf("CHECK 制約 \"%s\" を評価できません: %v", check.Name, err)
+		}
+		// SQL の CHECK は「偽でなければ通す」ので、結果が NULL の場合は違反にしない
+		if result == nil {
+			continue
+		}
+		ok, isBool := result.(bool)
+		if !isBool {
+			return fmt.Errorf("CHECK 制約 \"%s\" の式は真偽値を返す必要があります", check.Name)
+		}
+		if !ok {
+			return &CheckViolationError{TableName: tableDef.Name, Constraint: check.Name, Expr: check.Expr}
+		}
+	}
+	return nil
+}
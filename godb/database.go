@@ -0,0 +1,801 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// database構造体 - データベースエンジンの中心
+type database struct {
+	dir       string                   // データディレクトリ（datadir.go）
+	lock      *os.File                 // データディレクトリのロック
+	wal       *walManager              // WAL（カタログの変更を記録する）
+	catalog   *catalog                 // システムカタログ（テーブル定義）
+	indexes   map[string][]*btree      // テーブルごとのB+Treeインデックス（主キー・UNIQUE制約と CREATE INDEX のもの、tableSchema.indexSpecs() と同じ順番）
+	sequences map[string]*sequence     // シーケンス（CREATE SEQUENCE と SERIAL / AUTO_INCREMENT のカラムのもの）
+	modified  map[string]int64         // 前回の ANALYZE から変更した行の数（テーブルごと。stats.go）
+	pool      *bufferPool              // データファイルのページのキャッシュ（bufpool.go）
+	logger    Logger                   // 情報メッセージの出力先（result.go）
+	ctx       context.Context          // 実行中の文のコンテキスト（godb.go の ExecContext。取り消されたらスキャンと書き込みをやめる）
+	prepared  map[string]*preparedStmt // PREPARE したプリペアド文（名前ごと。prepare.go）
+
+	// カタログかインデックスを作り直すたびに増やす（プリペアド文のキャッシュしたプランが古くなったかを見る）
+	planVersion int64
+
+	autoAnalyzeScale float64 // 自動 ANALYZE の閾値の行数に対する割合（0 なら自動 ANALYZE しない）
+}
+
+// openDatabase - データディレクトリ dir のデータベースを開く（なければ作る。opts は既定値を埋めたもの。godb.go の Open）
+// データディレクトリをロックし、WAL にコミット済みで反映していないカタログの変更をやり直してから、
+// カタログからテーブル定義を読み込み、インデックスをデータファイルから再構築する
+// （インデックスはメモリ上にしかないので、起動のたびに作り直さないと一意性チェックが効かない）
+func openDatabase(dir string, opts Options) (*database, error) {
+	lock, err := openDataDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db := &database{
+		dir:       dir,
+		lock:      lock,
+		catalog:   newCatalog(dir),
+		indexes:   make(map[string][]*btree),
+		sequences: make(map[string]*sequence),
+		modified:  make(map[string]int64),
+		pool:      newBufferPool(opts.PageSize, opts.BufferPoolSize, opts.SyncMode),
+		logger:    opts.Logger,
+		ctx:       context.Background(),
+		prepared:  make(map[string]*preparedStmt),
+
+		autoAnalyzeScale: opts.AutoAnalyzeScale,
+	}
+	if err := db.open(opts.SyncMode); err != nil {
+		if db.wal != nil {
+			db.wal.Close()
+		}
+		unlockDataDir(lock)
+		return nil, err
+	}
+	return db, nil
+}
+
+// open - WAL を開いてやり直しを行い、テーブルとシーケンスを読み込む
+// 終わっていないトランザクションのスナップショットが残っていれば（トランザクションの途中で落ちた）、その時点に戻す
+func (db *database) open(syncMode SyncMode) error {
+	wal, err := newWALManager(filepath.Join(db.dir, walDirName), syncMode)
+	if err != nil {
+		return err
+	}
+	db.wal = wal
+	if err := db.replayCatalog(); err != nil {
+		return err
+	}
+	if err := db.recoverSnapshot(); err != nil {
+		return err
+	}
+	if err := db.loadTables(); err != nil {
+		return fmt.Errorf("テーブル読み込みエラー: %v", err)
+	}
+	sequences, err := loadSequences(db.dir)
+	if err != nil {
+		return fmt.Errorf("シーケンス読み込みエラー: %v", err)
+	}
+	db.sequences = sequences
+	modified, err := loadModified(db.dir)
+	if err != nil {
+		return fmt.Errorf("統計情報の読み込みエラー: %v", err)
+	}
+	db.modified = modified
+	return nil
+}
+
+// Close - データベースを閉じる
+// シーケンスの払い出し済みで使わなかった値を戻して保存し、変更した行の数（自動 ANALYZE 用）を保存して、
+// WAL を閉じてデータディレクトリのロックを外す
+func (db *database) Close() error {
+	for _, seq := range db.sequences {
+		if err := seq.release(); err != nil {
+			return fmt.Errorf("シーケンス '%s' の保存に失敗しました: %v", seq.Def.Name, err)
+		}
+	}
+	if err := db.saveModified(); err != nil {
+		return fmt.Errorf("統計情報の保存に失敗しました: %v", err)
+	}
+	if err := db.wal.Close(); err != nil {
+		return err
+	}
+	return unlockDataDir(db.lock)
+}
+
+// loadTables - カタログを読み込んでメモリに登録し、インデックスを再構築する
+func (db *database) loadTables() error {
+	catalog, err := loadCatalog(db.dir)
+	if err != nil {
+		return err
+	}
+	db.catalog = catalog
+	db.indexes = make(map[string][]*btree)
+
+	for _, name := range catalog.tableNames() {
+		tableDef := catalog.Tables[name]
+		// 型名を検証して正規化する（型を検証するようになる前に作ったテーブルの INTEGER などもここで INT になる）
+		for i, col := range tableDef.Columns {
+			t, err := parseType(col.Type)
+			if err != nil {
+				return fmt.Errorf("テーブル '%s' のカラム '%s' の型が不正です: %v", name, col.Name, err)
+			}
+			tableDef.Columns[i].Type = t.String()
+		}
+		tableDef.initVersion()
+
+		if err := db.rebuildIndexes(tableDef.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildIndexes - インデックスを作り直し、データファイルを先頭から読んでレコード位置を登録し直す
+// UPDATE でデータファイルを書き直したあとにも使う
+func (db *database) rebuildIndexes(tableName string) error {
+	tableDef := db.catalog.Tables[tableName]
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return err
+	}
+
+	// 主キー・UNIQUE制約ごとに一意のB+Treeインデックスを、CREATE INDEX のインデックスごとに B+Tree を作成
+	indexes := []*btree{}
+	for _, spec := range specs {
+		indexes = append(indexes, newBTree(spec.Name, tableName, spec.Labels, spec.Unique))
+	}
+	db.indexes[tableName] = indexes
+	db.planVersion++
+
+	rows, err := db.pool.ReadAllRows(tableDef.path)
+	if os.IsNotExist(err) {
+		// まだ一度も INSERT されていない場合はデータファイルがない
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("データ読み込みエラー: %v", err)
+	}
+
+	for position, row := range rows {
+		row = normalizeRow(tableDef, row)
+		for i, spec := range specs {
+			key, err := encodeKeyExprs(tableDef, spec.Keys, row)
+			if err != nil {
+				return fmt.Errorf("インデックス再構築エラー: %v", err)
+			}
+			if err := indexes[i].Insert(key, position); err != nil {
+				return fmt.Errorf("インデックス再構築エラー: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeRow - データファイルから読んだ行を、現在のスキーマのカラムの並びにする
+// 行を書いたときの版のカラムの並びからカラム番号が同じフィールドを移し、その版になかったカラムは
+// ALTER TABLE ADD COLUMN のときの DEFAULT の値（DEFAULT がなければ NULL）にする（schema.go 参照）
+func normalizeRow(tableDef *tableSchema, row tableRow) tableRow {
+	version, fields := splitRowVersion(row)
+	if version == tableDef.Version && len(fields) == len(tableDef.Columns) {
+		return fields
+	}
+	layout := tableDef.columnsAt(version)
+	normalized := make(tableRow, len(tableDef.Columns))
+	for i, col := range tableDef.Columns {
+		normalized[i] = nullField
+		if col.Missing != nil {
+			normalized[i] = *col.Missing
+		}
+		for j, old := range layout {
+			if old.ID == col.ID {
+				if j < len(fields) {
+					normalized[i] = fields[j]
+				}
+				break
+			}
+		}
+	}
+	return normalized
+}
+
+// getTable - テーブル定義を取得（存在しない場合はエラー）
+func (db *database) getTable(tableName string) (*tableSchema, error) {
+	tableDef, exists := db.catalog.Tables[tableName]
+	if !exists {
+		if _, ok := lookupSystemView(tableName); ok {
+			return nil, fmt.Errorf("'%s' は読み取り専用のシステムビューです", tableName)
+		}
+		return nil, fmt.Errorf("テーブル '%s' は存在しません", tableName)
+	}
+	return tableDef, nil
+}
+
+// CreateTable - CREATE TABLE文を実行
+func (db *database) CreateTable(sql string) (*Result, error) {
+	tableDef, err := parseCreateTable(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	res := newResult("CREATE TABLE")
+	if _, exists := db.catalog.Tables[tableDef.Name]; exists {
+		if tableDef.IfNotExists {
+			res.notice("テーブル '%s' は既に存在するためスキップしました", tableDef.Name)
+			return res, nil
+		}
+		return nil, fmt.Errorf("テーブル '%s' は既に存在します", tableDef.Name)
+	}
+	if err := db.validateTableConstraints(tableDef); err != nil {
+		return nil, err
+	}
+	if err := db.validateForeignKeys(tableDef); err != nil {
+		return nil, err
+	}
+
+	// SERIAL / AUTO_INCREMENT のカラムのシーケンスを作成
+	if err := db.createOwnedSequences(tableDef); err != nil {
+		return nil, err
+	}
+
+	// カタログに登録して空のデータファイルを作る（同じ名前で削除したテーブルのファイルが残っていても使わない）
+	tableDef.initVersion()
+	if err := db.commitCatalog(catalogChange{
+		Tables: []*tableSchema{tableDef},
+		Files:  []fileOp{{Op: opTypeCreateFile, Name: tableDef.Name}},
+	}); err != nil {
+		return nil, err
+	}
+
+	// 主キー・UNIQUE制約用のB+Treeインデックスを作成
+	if err := db.rebuildIndexes(tableDef.Name); err != nil {
+		return nil, err
+	}
+	for _, btree := range db.indexes[tableDef.Name] {
+		if tableDef.PrimaryKey != nil && btree.Name == tableDef.PrimaryKey.Name {
+			db.logf("主キーインデックス '%s' (%s) を作成しました", btree.Name, strings.Join(btree.Columns, ", "))
+		} else {
+			db.logf("一意インデックス '%s' (%s) を作成しました", btree.Name, strings.Join(btree.Columns, ", "))
+		}
+	}
+
+	db.logf("テーブル '%s' を作成しました", tableDef.Name)
+	columns := make([]string, len(tableDef.Columns))
+	for i, col := range tableDef.Columns {
+		columns[i] = fmt.Sprintf("%s(%s)", col.Name, col.Type)
+		if col.NotNull {
+			columns[i] += " NOT NULL"
+		}
+		if col.Default != "" {
+			columns[i] += " DEFAULT " + col.Default
+		}
+	}
+	db.logf("カラム: %s", strings.Join(columns, ", "))
+	for _, check := range tableDef.Checks {
+		db.logf("CHECK 制約 '%s': %s", check.Name, check.Expr)
+	}
+	for _, fk := range tableDef.ForeignKeys {
+		db.logf("外部キー制約 '%s': (%s) → %s(%s) ON DELETE %s ON UPDATE %s", fk.Name,
+			strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "), fk.OnDelete, fk.OnUpdate)
+	}
+
+	return res, nil
+}
+
+// Insert - INSERT文を実行
+// VALUES の全行（INSERT ... SELECT なら SELECT の全行）の制約を確認してから、まとめてファイルに書き込む
+// 途中の行でエラーになった場合はどの行も追加しない
+func (db *database) Insert(sql string) (*Result, error) {
+	insertDef, err := parseInsert(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	return db.insert(insertDef)
+}
+
+// insert - パースした INSERT 文を実行する（Insert とプリペアド文の EXECUTE で使う）
+func (db *database) insert(insertDef *insertDef) (*Result, error) {
+	tableDef, err := db.getTable(insertDef.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 追加する行ごとの値の式（INSERT ... SELECT は先に SELECT を実行して、結果の値を式にする）
+	sourceRows := insertDef.Rows
+	if insertDef.Select != nil {
+		result, err := db.query(insertDef.Select)
+		if err != nil {
+			return nil, err
+		}
+		for _, values := range result.rows {
+			exprs := make([]exprNode, len(values))
+			for i, v := range values {
+				exprs[i] = valueExpr(v)
+			}
+			sourceRows = append(sourceRows, exprs)
+		}
+	}
+
+	// カラム名が省略された場合はテーブルの全カラムを定義順に指定したものとして扱う
+	columns := insertDef.Columns
+	if columns == nil {
+		for _, col := range tableDef.Columns {
+			columns = append(columns, col.Name)
+		}
+	}
+
+	rows := make([]tableRow, 0, len(sourceRows))
+	for _, values := range sourceRows {
+		if len(values) > len(columns) {
+			return nil, fmt.Errorf("INSERT の値の数がテーブル '%s' のカラム数より多いです", tableDef.Name)
+		}
+		if insertDef.Columns != nil && len(values) != len(columns) {
+			return nil, fmt.Errorf("INSERT の値の数が指定したカラムの数と一致しません")
+		}
+		row, err := db.buildInsertRow(tableDef, columns, values)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		db.logf("追加する行がありません")
+		return newResult("INSERT"), nil
+	}
+	if insertDef.OnConflict != nil {
+		return db.upsert(tableDef, insertDef, rows)
+	}
+
+	// レコード位置を取得（現在のレコード数）
+	// まだデータファイルがない場合は 0 件として扱う
+	recordCount, err := db.pool.CountRows(tableDef.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("レコード数取得エラー: %v", err)
+	}
+
+	// 主キー・UNIQUE制約・外部キーを 1 行ずつ確認し、メモリ上のインデックスに登録していく
+	// （同じ文で追加する行どうしの重複や、先に追加する行を参照する外部キーも確認できる）
+	// データファイルに書き込んでからインデックスで弾くと、重複行だけがファイルに残ってしまうので先に確認する
+	// エラーになったらインデックスをデータファイルから作り直して、登録した分を取り消す
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := db.indexInsertRows(tableDef, specs, rows, recordCount)
+
+	// RETURNING 句も書き込む前に評価しておく（評価でエラーになったら行を追加しない）
+	var returned *queryResult
+	if err == nil && insertDef.Returning != nil {
+		returned, err = evalReturning(tableDef, db.bindReturning(insertDef.Returning), rows)
+	}
+	if err == nil {
+		err = db.ctx.Err()
+	}
+	if err == nil {
+		if err = db.pool.AppendRows(tableDef.path, tableDef.Version, rows); err != nil {
+			err = fmt.Errorf("データ保存エラー: %v", err)
+		}
+	}
+	if err != nil {
+		if rerr := db.rebuildIndexes(tableDef.Name); rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+
+	db.logInserted(tableDef, specs, rows, keys, recordCount)
+	db.countModified(tableDef.Name, len(rows))
+	res := newResult("INSERT")
+	res.RowsAffected = int64(len(rows))
+	res.setRows(returned)
+	return res, nil
+}
+
+// buildInsertRow - INSERT の 1 行分の値の式を評価して、カラムの順番の Row にする
+// 指定のないカラムは DEFAULT 式の値か NULL。NOT NULL / CHECK 制約と主キーの NULL もここで確認する
+func (db *database) buildInsertRow(tableDef *tableSchema, columns []string, values []exprNode) (tableRow, error) {
+	row := make(tableRow, len(tableDef.Columns))
+	assigned := make([]bool, len(tableDef.Columns))
+	for i, value := range values {
+		colName := columns[i]
+		pos := tableDef.ColumnIndex(colName)
+		if pos < 0 {
+			return nil, fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", colName, tableDef.Name)
+		}
+		if assigned[pos] {
+			return nil, fmt.Errorf("カラム '%s' が複数回指定されています", colName)
+		}
+		field, err := evalAssignment(tableDef.Columns[pos], db.bindSequences(value), noColumnsEnv("VALUES"))
+		if err != nil {
+			return nil, err
+		}
+		row[pos] = field
+		assigned[pos] = true
+	}
+	if err := db.applyDefaults(tableDef, row, assigned); err != nil {
+		return nil, err
+	}
+	if err := checkRowConstraints(tableDef, row); err != nil {
+		return nil, err
+	}
+	if err := checkPrimaryKeyValues(tableDef, row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// indexInsertRows - 追加する行の一意性と外部キーを確認しながら、メモリ上のインデックスに登録する
+// 行ごと・インデックスごとのキーを返す（keys[行][インデックス]）
+func (db *database) indexInsertRows(tableDef *tableSchema, specs []indexSpec, rows []tableRow, recordCount int) ([][]string, error) {
+	var err error
+	keys := make([][]string, len(rows))
+	for i, row := range rows {
+		if err := db.checkUniqueOnInsert(tableDef, row); err != nil {
+			return nil, err
+		}
+		// 外部キーの参照先が存在するか（親テーブルのインデックスで確認）
+		if err := db.checkForeignKeysOnInsert(tableDef, row); err != nil {
+			return nil, err
+		}
+		keys[i] = make([]string, len(specs))
+		for j, spec := range specs {
+			if keys[i][j], err = encodeKeyExprs(tableDef, spec.Keys, row); err != nil {
+				return nil, err
+			}
+			if err := db.indexes[tableDef.Name][j].Insert(keys[i][j], recordCount+i); err != nil {
+				return nil, fmt.Errorf("インデックス登録エラー: %v", err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// logInserted - 追加した行とインデックスへの登録内容を情報メッセージに出す
+func (db *database) logInserted(tableDef *tableSchema, specs []indexSpec, rows []tableRow, keys [][]string, recordCount int) {
+	for i := range rows {
+		for j, spec := range specs {
+			db.logf("インデックスに登録: %s key=%s, position=%d", spec.Name, formatIndexKey(keys[i][j]), recordCount+i)
+		}
+	}
+	if len(rows) == 1 {
+		db.logf("テーブル '%s' に 1 行追加しました: (%s)", tableDef.Name, formatRow(tableDef, rows[0]))
+		return
+	}
+	db.logf("テーブル '%s' に %d 行追加しました", tableDef.Name, len(rows))
+}
+
+// Update - UPDATE文を実行
+// 対象行の変更と外部キーの CASCADE などの波及をメモリ上で行い、制約を満たしていればまとめてファイルに書き込む
+func (db *database) Update(sql string) (*Result, error) {
+	updateDef, err := parseUpdate(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	return db.update(updateDef)
+}
+
+// update - パースした UPDATE 文を実行する（Update とプリペアド文の EXECUTE で使う）
+func (db *database) update(updateDef *updateDef) (*Result, error) {
+	tableDef, err := db.getTable(updateDef.TableName)
+	if err != nil {
+		return nil, err
+	}
+	// 行を読む前に WHERE 句と SET 句の式の型を確かめる（空のテーブルでも型の合わない式はエラー）
+	sc := &scope{sources: []source{{alias: tableDef.Name, tableDef: tableDef}}}
+	if err := checkExprTypes(sc, updateDef.Where); err != nil {
+		return nil, err
+	}
+	for _, set := range updateDef.Sets {
+		if err := checkExprTypes(sc, set.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	// SET 句のカラムを解決
+	setPositions := make([]int, len(updateDef.Sets))
+	for i, set := range updateDef.Sets {
+		pos := tableDef.ColumnIndex(set.Column)
+		if pos < 0 {
+			return nil, fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", set.Column, tableDef.Name)
+		}
+		setPositions[i] = pos
+	}
+
+	st := db.newStmtState()
+	rows, err := st.load(tableDef)
+	if err != nil {
+		return nil, err
+	}
+
+	// 対象行を先に決めてから更新する（CASCADE で同じテーブルの行が変わっても対象は変えない）
+	targets, err := matchingPositions(tableDef, rows, db.bindSequences(updateDef.Where))
+	if err != nil {
+		return nil, err
+	}
+	for _, pos := range targets {
+		if rows[pos] == nil {
+			continue
+		}
+		// SET 句の式は更新前の行の値で評価する（SET a = b, b = a で値が入れ替わる）
+		env := rowEnv(tableDef, rows[pos])
+		newRow := make(tableRow, len(rows[pos]))
+		copy(newRow, rows[pos])
+		for j, set := range updateDef.Sets {
+			field, err := evalAssignment(tableDef.Columns[setPositions[j]], db.bindSequences(set.Value), env)
+			if err != nil {
+				return nil, err
+			}
+			newRow[setPositions[j]] = field
+		}
+		if err := st.updateRow(tableDef, pos, newRow); err != nil {
+			return nil, err
+		}
+	}
+
+	// RETURNING 句は更新後の行で評価する（CASCADE で同じ文の中で削除された行は返さない）
+	var returned *queryResult
+	if updateDef.Returning != nil {
+		updated := []tableRow{}
+		for _, pos := range targets {
+			if rows[pos] != nil {
+				updated = append(updated, rows[pos])
+			}
+		}
+		if returned, err = evalReturning(tableDef, db.bindReturning(updateDef.Returning), updated); err != nil {
+			return nil, err
+		}
+	}
+
+	// 更新後の全行で主キー・UNIQUE制約を確認してから書き込む
+	if err := st.commit(); err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		db.logf("条件に一致するデータがありません")
+	} else {
+		db.logf("テーブル '%s' の %d 行を更新しました", tableDef.Name, len(targets))
+	}
+	res := newResult("UPDATE")
+	res.RowsAffected = int64(len(targets))
+	res.setRows(returned)
+	return res, nil
+}
+
+// Delete - DELETE文を実行
+// 外部キーで参照されている行は ON DELETE の動作（RESTRICT / CASCADE / SET NULL）に従う
+func (db *database) Delete(sql string) (*Result, error) {
+	deleteDef, err := parseDelete(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	return db.delete(deleteDef)
+}
+
+// delete - パースした DELETE 文を実行する（Delete とプリペアド文の EXECUTE で使う）
+func (db *database) delete(deleteDef *deleteDef) (*Result, error) {
+	tableDef, err := db.getTable(deleteDef.TableName)
+	if err != nil {
+		return nil, err
+	}
+	sc := &scope{sources: []source{{alias: tableDef.Name, tableDef: tableDef}}}
+	if err := checkExprTypes(sc, deleteDef.Where); err != nil {
+		return nil, err
+	}
+
+	st := db.newStmtState()
+	rows, err := st.load(tableDef)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := matchingPositions(tableDef, rows, db.bindSequences(deleteDef.Where))
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING 句は削除前の行で評価する
+	deleted := []tableRow{}
+	for _, pos := range targets {
+		if rows[pos] != nil {
+			deleted = append(deleted, rows[pos])
+		}
+		if err := st.deleteRow(tableDef, pos); err != nil {
+			return nil, err
+		}
+	}
+
+	var returned *queryResult
+	if deleteDef.Returning != nil {
+		if returned, err = evalReturning(tableDef, db.bindReturning(deleteDef.Returning), deleted); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := st.commit(); err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		db.logf("条件に一致するデータがありません")
+	} else {
+		db.logf("テーブル '%s' から %d 行を削除しました", tableDef.Name, len(targets))
+	}
+	res := newResult("DELETE")
+	res.RowsAffected = int64(len(targets))
+	res.setRows(returned)
+	return res, nil
+}
+
+// matchingPositions - WHERE 条件が TRUE になる行のレコード位置の一覧
+func matchingPositions(tableDef *tableSchema, rows []tableRow, where exprNode) ([]int, error) {
+	positions := []int{}
+	for pos, row := range rows {
+		if row == nil {
+			continue
+		}
+		match, err := evalCondition(where, rowEnv(tableDef, row))
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			positions = append(positions, pos)
+		}
+	}
+	return positions, nil
+}
+
+// Select - SELECT文を実行
+func (db *database) Select(sql string) (*Result, error) {
+	selectDef, err := parseSelect(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+
+	result, err := db.query(selectDef)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsResult("SELECT", result), nil
+}
+
+// cancelled - 実行中の文のコンテキストが取り消されていればそのエラーを返す（スキャンが行を読むたびに確かめる）
+// プリペアド文のプランは文をまたいで使うので、スキャンにはコンテキストでなくこのメソッドを持たせる
+func (db *database) cancelled() error {
+	return db.ctx.Err()
+}
+
+// query - SELECT 文を実行して結果を返す（SELECT と INSERT ... SELECT で使う）
+func (db *database) query(selectDef *selectDef) (*queryResult, error) {
+	db.bindQuery(selectDef)
+
+	// プラン（物理演算子の木）を作って実行する（plan.go / executor.go）
+	plan, columns, err := db.planSelect(selectDef)
+	if err != nil {
+		return nil, err
+	}
+	return runPlan(plan, columns)
+}
+
+// bindQuery - SELECT 文の式の nextval などをシーケンスに結び付ける
+func (db *database) bindQuery(selectDef *selectDef) {
+	selectDef.Where = db.bindSequences(selectDef.Where)
+	for i := range selectDef.Items {
+		selectDef.Items[i].Expr = db.bindSequences(selectDef.Items[i].Expr)
+	}
+	for i := range selectDef.Joins {
+		selectDef.Joins[i].On = db.bindSequences(selectDef.Joins[i].On)
+	}
+}
+
+// splitConjuncts - a AND b AND c を [a, b, c] に分解する
+func splitConjuncts(e exprNode) []exprNode {
+	if bin, ok := e.(*binaryExpr); ok && bin.Op == "AND" {
+		return append(splitConjuncts(bin.Left), splitConjuncts(bin.Right)...)
+	}
+	return []exprNode{e}
+}
+
+// exprAndLiteral - 「式 = 定数」または「定数 = 式」の形なら式と定数を返す
+func exprAndLiteral(bin *binaryExpr) (exprNode, *literal) {
+	if lit, ok := bin.Right.(*literal); ok {
+		if _, isLit := bin.Left.(*literal); !isLit {
+			return bin.Left, lit
+		}
+	}
+	if lit, ok := bin.Left.(*literal); ok {
+		if _, isLit := bin.Right.(*literal); !isLit {
+			return bin.Right, lit
+		}
+	}
+	return nil, nil
+}
+
+// exprAndParam - 「式 = パラメータ」または「パラメータ = 式」の形なら式とパラメータを返す
+func exprAndParam(bin *binaryExpr) (exprNode, *paramExpr) {
+	if param, ok := bin.Right.(*paramExpr); ok {
+		if _, isParam := bin.Left.(*paramExpr); !isParam {
+			return bin.Left, param
+		}
+	}
+	if param, ok := bin.Left.(*paramExpr); ok {
+		if _, isParam := bin.Right.(*paramExpr); !isParam {
+			return bin.Right, param
+		}
+	}
+	return nil, nil
+}
+
+// ExecuteSQL - SQL文を判定して適切なメソッドを呼び出し、実行結果を返す（表示は呼び出し側で行う）
+func (db *database) ExecuteSQL(sql string) (*Result, error) {
+	sql = strings.TrimSpace(sql)
+	if err := db.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(strings.ToUpper(sql), "CREATE INDEX") || strings.HasPrefix(strings.ToUpper(sql), "CREATE UNIQUE INDEX") {
+		return db.CreateIndex(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "CREATE SEQUENCE") {
+		return db.CreateSequence(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "CREATE TABLE") {
+		return db.CreateTable(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "DROP TABLE") {
+		return db.DropTable(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "TRUNCATE") {
+		return db.Truncate(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "EXPLAIN") {
+		return db.Explain(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "PREPARE") {
+		return db.Prepare(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "EXECUTE") {
+		return db.Execute(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "DEALLOCATE") {
+		return db.Deallocate(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "ANALYZE") {
+		return db.Analyze(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "ALTER TABLE") {
+		return db.AlterTable(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "INSERT INTO") {
+		return db.Insert(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "UPDATE") {
+		return db.Update(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "DELETE FROM") {
+		return db.Delete(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "SELECT") {
+		return db.Select(sql)
+	} else if strings.ToUpper(sql) == "SHOW INDEX" {
+		// デバッグ用：インデックスの状況を表示
+		return db.ShowIndex()
+	} else {
+		return nil, fmt.Errorf("サポートされていないSQL文です")
+	}
+}
+
+// ShowIndex - デバッグ用：B+Treeインデックスの状況を「インデックス状況」の 1 列の結果にする（1 行に木の 1 行）
+func (db *database) ShowIndex() (*Result, error) {
+	tableNames := make([]string, 0, len(db.indexes))
+	for tableName := range db.indexes {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	var sb strings.Builder
+	for _, tableName := range tableNames {
+		fmt.Fprintf(&sb, "テーブル: %s\n", tableName)
+		for _, btree := range db.indexes[tableName] {
+			btree.PrintTree(&sb)
+		}
+	}
+	result := &queryResult{columns: []ResultColumn{{Name: "インデックス状況", Type: SQLType{Kind: TypeText}}}}
+	for _, line := range strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n") {
+		if line != "" {
+			result.rows = append(result.rows, []any{line})
+		}
+	}
+	return newRowsResult("SHOW INDEX", result), nil
+}
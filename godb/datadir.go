@@ -0,0 +1,119 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// データディレクトリ
+//
+// データベースのファイルはすべて 1 つのデータディレクトリの下に置く
+//   <データディレクトリ>/
+//     LOCK          … 開いているプロセスのロック（2 つのプロセスが同時に開いてファイルを壊さないようにする）
+//     catalog.json  … システムカタログ（catalog.go）
+//     stat.json     … 前回の ANALYZE から変更した行の数（自動 ANALYZE 用。stats.go）
+//     base/         … テーブルのデータファイル（users.db）・サイドファイル（users.toast）・シーケンス（users_id_seq.sequence）
+//     wal/          … WAL のセグメント（0000000000000001.wal。wal.go）
+//     snapshot/     … 終わっていないトランザクションを始めた時点のファイル（DB.Begin。snapshot.go）
+// インデックスはメモリ上の B+Tree で、起動時にデータファイルから作り直すのでファイルはない
+
+const (
+	lockFileName = "LOCK" // ロックファイル
+	baseDirName  = "base" // テーブル・シーケンスのファイルを置くディレクトリ
+	walDirName   = "wal"  // WAL のセグメントを置くディレクトリ
+)
+
+// DataDirLockedErrorはデータディレクトリを他のプロセスが使っていることを表す
+type DataDirLockedError struct {
+	Dir string // データディレクトリ
+}
+
+func (e *DataDirLockedError) Error() string {
+	return fmt.Sprintf("データディレクトリ '%s' は他のプロセスが使用中です", e.Dir)
+}
+
+// openDataDir - データディレクトリ（と base/・wal/）がなければ作り、ロックを取る
+// ロックは返したファイルを閉じるまで（database.Close）持ち続ける
+// base/ がなければ以前の形式（ファイルを直下に置いていた）か新しいデータディレクトリなので、base/ を作る前に直下のファイルを移す
+func openDataDir(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("データディレクトリ '%s' を作成できません: %v", dir, err)
+	}
+	lock, err := lockDataDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, baseDirName)); os.IsNotExist(err) {
+		if err := migrateFlatLayout(dir); err != nil {
+			unlockDataDir(lock)
+			return nil, err
+		}
+	}
+	for _, sub := range []string{baseDirName, walDirName} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			unlockDataDir(lock)
+			return nil, fmt.Errorf("データディレクトリ '%s' を作成できません: %v", dir, err)
+		}
+	}
+	return lock, nil
+}
+
+// migrateFlatLayout - データディレクトリの直下に置いていた以前の形式のファイル（users.db / users.toast / users_id_seq.sequence）を base/ に移す
+// 移すのはカタログ（.schema ファイルならカタログに移してから。catalog.go）にあるテーブルのデータファイル・サイドファイルとシーケンス、
+// それと CREATE SEQUENCE で作ったシーケンス（シーケンスとして読めるファイル）だけで、ほかのファイルには触らない
+// 途中で落ちても次の起動でやり直せるように、base.tmp/ に移してから base/ に名前を変える
+func migrateFlatLayout(dir string) error {
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for name, tableDef := range catalog.Tables {
+		files = append(files, tableFileName(name), toastFileName(name))
+		for _, col := range tableDef.Columns {
+			if col.Sequence != "" {
+				files = append(files, col.Sequence+".sequence")
+			}
+		}
+	}
+	sequences, err := filepath.Glob(filepath.Join(dir, "*.sequence"))
+	if err != nil {
+		return err
+	}
+	for _, file := range sequences {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var seq sequence
+		if json.Unmarshal(data, &seq) == nil && seq.Def.Name+".sequence" == filepath.Base(file) {
+			files = append(files, filepath.Base(file))
+		}
+	}
+
+	tmp := filepath.Join(dir, baseDirName+".tmp")
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return fmt.Errorf("データディレクトリ '%s' を作成できません: %v", dir, err)
+	}
+	for _, file := range files {
+		if err := os.Rename(filepath.Join(dir, file), filepath.Join(tmp, file)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("'%s' を %s/ に移せません: %v", file, baseDirName, err)
+		}
+	}
+	return os.Rename(tmp, filepath.Join(dir, baseDirName))
+}
+
+// syncDir - ディレクトリをディスクに書き出す（ディレクトリの中で rename したファイルの名前を確定させる）
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,152 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles - dir の下にファイルを作る（ファイル名 → 内容）
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("ファイルを作成できません: %v", err)
+		}
+	}
+}
+
+// fileExists - ファイルがあるか
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestDataDirLock(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("データベースを開けません: %v", err)
+	}
+	if !fileExists(filepath.Join(dir, lockFileName)) {
+		t.Errorf("ロックファイルがありません")
+	}
+
+	// 開いている間はほかから開けない
+	_, err = Open(dir, nil)
+	var locked *DataDirLockedError
+	if !errors.As(err, &locked) || locked.Dir != dir {
+		t.Fatalf("DataDirLockedError になりませんでした: %v", err)
+	}
+
+	// 閉じたら開ける
+	if err := db.Close(); err != nil {
+		t.Fatalf("閉じられません: %v", err)
+	}
+	db, err = Open(dir, nil)
+	if err != nil {
+		t.Fatalf("閉じたあとに開けません: %v", err)
+	}
+	db.Close()
+}
+
+func TestReplayCatalog(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDBAt(t, dir, "CREATE TABLE a (id INT)")
+	db.Close()
+	catalog, err := os.ReadFile(filepath.Join(dir, catalogFileName))
+	if err != nil {
+		t.Fatalf("カタログを読めません: %v", err)
+	}
+
+	db = openTestDBAt(t, dir, "CREATE TABLE b (id INT PRIMARY KEY)")
+	db.Close()
+
+	// CREATE TABLE b を WAL にコミットしたあと、カタログとデータファイルに反映する前に落ちたことにする
+	// （最後の CHECKPOINT を消し、カタログを前の内容に戻し、データファイルを消す）
+	segments, err := filepath.Glob(filepath.Join(dir, walDirName, "*.wal"))
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("WAL のセグメントがありません: %v", err)
+	}
+	segment := segments[len(segments)-1]
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("WAL を読めません: %v", err)
+	}
+	last := strings.LastIndex(strings.TrimSuffix(string(data), "\n"), "\n") + 1
+	if !strings.Contains(string(data[last:]), string(opTypeCheckpoint)) {
+		t.Fatalf("WAL の最後が CHECKPOINT ではありません: %s", data[last:])
+	}
+	writeFiles(t, dir, map[string]string{catalogFileName: string(catalog)})
+	if err := os.WriteFile(segment, data[:last], 0644); err != nil {
+		t.Fatalf("WAL を書けません: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, baseDirName, "b.db")); err != nil {
+		t.Fatalf("データファイルを消せません: %v", err)
+	}
+
+	// 開き直すと WAL から CREATE TABLE b をやり直す
+	db = openTestDBAt(t, dir, "INSERT INTO b VALUES (1)")
+	defer db.Close()
+	if rows := queryRows(t, db, "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name"); !reflect.DeepEqual(rows, [][]string{{"a"}, {"b"}}) {
+		t.Errorf("テーブルが一致しません: %v", rows)
+	}
+	if _, err := db.Exec("INSERT INTO b VALUES (1)"); err == nil {
+		t.Errorf("やり直したテーブルの主キーが効いていません")
+	}
+}
+
+func TestMigrateFlatLayout(t *testing.T) {
+	// base/ を使う前の形式: テーブルの .schema・.db とシーケンスのファイルをデータディレクトリの直下に置いていた
+	legacy := map[string]string{
+		"users.schema":         `{"Name": "users", "Columns": [{"Name": "id", "Type": "INT"}, {"Name": "name", "Type": "TEXT"}], "PrimaryKey": {"Name": "users_pkey", "Columns": ["id"]}}`,
+		"users.db":             "1,Alice\n2,Bob\n",
+		"order_no.sequence":    `{"Def": {"Name": "order_no", "Start": 1, "Increment": 1, "MinValue": 1, "MaxValue": 100}, "Logged": 5, "IsCalled": true}`,
+		"notes.db":             "テーブルではないファイル\n",
+		"backup.sequence":      "シーケンスではないファイル\n",
+		"users_backup.schema~": "エディタのバックアップ\n",
+	}
+
+	t.Run("直下のテーブルとシーケンスを base/ に移す", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir, legacy)
+		db := openTestDBAt(t, dir)
+		defer db.Close()
+
+		if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, [][]string{{"1", "Alice"}, {"2", "Bob"}}) {
+			t.Errorf("移したテーブルの行が一致しません: %v", rows)
+		}
+		if rows := queryRows(t, db, "SELECT nextval('order_no') FROM users WHERE id = 1"); !reflect.DeepEqual(rows, [][]string{{"6"}}) {
+			t.Errorf("移したシーケンスの値が一致しません: %v", rows)
+		}
+		for _, name := range []string{"users.db", "order_no.sequence"} {
+			if !fileExists(filepath.Join(dir, baseDirName, name)) || fileExists(filepath.Join(dir, name)) {
+				t.Errorf("%s が base/ に移っていません", name)
+			}
+		}
+		if fileExists(filepath.Join(dir, "users.schema")) || !fileExists(filepath.Join(dir, catalogFileName)) {
+			t.Errorf(".schema ファイルがカタログに移っていません")
+		}
+		// テーブル・シーケンスでないファイルには触らない
+		for _, name := range []string{"notes.db", "backup.sequence", "users_backup.schema~"} {
+			if !fileExists(filepath.Join(dir, name)) || fileExists(filepath.Join(dir, baseDirName, name)) {
+				t.Errorf("%s が移されました", name)
+			}
+		}
+	})
+
+	t.Run("base/ があれば移さない", func(t *testing.T) {
+		dir := t.TempDir()
+		openTestDBAt(t, dir).Close()
+		writeFiles(t, dir, map[string]string{"users.db": "1,Alice\n"})
+		db := openTestDBAt(t, dir)
+		defer db.Close()
+
+		if !fileExists(filepath.Join(dir, "users.db")) || fileExists(filepath.Join(dir, baseDirName, "users.db")) {
+			t.Errorf("base/ のあるデータディレクトリの直下のファイルが移されました")
+		}
+	})
+}
@@ -0,0 +1,648 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// テーブルの削除・変更（DROP TABLE / TRUNCATE / ALTER TABLE）
+//
+// ALTER TABLE はできるだけデータファイルを書き直さず、スキーマだけを変える
+//   - RENAME COLUMN / RENAME TO: スキーマ（RENAME TO ならファイル名も）を変えるだけ（カラム番号は変わらない）
+//   - ADD COLUMN / DROP COLUMN: スキーマの版を上げるだけで、既存の行は前の版のまま残す（schema.go 参照）
+//     ADD COLUMN したカラムは、前の版の行では ADD COLUMN のときの DEFAULT の値（columnDef.Missing）になる（postgres の attmissingval と同じ）
+//     DEFAULT が nextval のように行ごとに値の変わる式の場合だけ、全行に値を入れて書き直す
+//
+// 他のテーブルの外部キーから参照されているテーブル・カラムは削除できない（postgres の RESTRICT と同じ。CASCADE は未対応）
+
+// cloneTableDef - テーブル定義のコピーを作る（変更の途中でエラーになっても元の定義を壊さないように）
+func cloneTableDef(tableDef *tableSchema) (*tableSchema, error) {
+	data, err := json.Marshal(tableDef)
+	if err != nil {
+		return nil, err
+	}
+	var clone tableSchema
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, err
+	}
+	clone.path = tableDef.path
+	return &clone, nil
+}
+
+// containsName - 名前の一覧に name があるか（大文字・小文字は区別しない）
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteColumnRefs - 式のテキストの中のカラム参照を書き換えて、式のテキストに戻す（CHECK 制約・インデックスの式）
+func rewriteColumnRefs(text string, rewrite func(ref *columnRef)) (string, error) {
+	expr, err := parseExpr(text)
+	if err != nil {
+		return "", err
+	}
+	walkExpr(expr, func(e exprNode) {
+		if ref, ok := e.(*columnRef); ok {
+			rewrite(ref)
+		}
+	})
+	return expr.String(), nil
+}
+
+// exprReferences - 式のテキストがカラムを参照しているか
+func exprReferences(text, column string) (bool, error) {
+	expr, err := parseExpr(text)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	walkExpr(expr, func(e exprNode) {
+		if ref, ok := e.(*columnRef); ok && strings.EqualFold(ref.Name, column) {
+			found = true
+		}
+	})
+	return found, nil
+}
+
+// checkNotReferenced - 一緒に処理するテーブル以外の外部キーから参照されていないか確認する（DROP TABLE / TRUNCATE）
+func (db *database) checkNotReferenced(tableNames []string, action string) error {
+	for _, name := range tableNames {
+		for _, ref := range db.referencingForeignKeys(name) {
+			if !containsName(tableNames, ref.child.Name) {
+				return fmt.Errorf("テーブル '%s' はテーブル '%s' の外部キー制約 \"%s\" から参照されているため%sできません",
+					name, ref.child.Name, ref.fk.Name, action)
+			}
+		}
+	}
+	return nil
+}
+
+// DropTable - DROP TABLE文を実行
+func (db *database) DropTable(sql string) (*Result, error) {
+	def, err := parseDropTable(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+
+	res := newResult("DROP TABLE")
+	targets := []*tableSchema{}
+	for _, name := range def.TableNames {
+		tableDef, exists := db.catalog.Tables[name]
+		if !exists {
+			if def.IfExists {
+				res.notice("テーブル '%s' は存在しないためスキップしました", name)
+				continue
+			}
+			return nil, fmt.Errorf("テーブル '%s' は存在しません", name)
+		}
+		targets = append(targets, tableDef)
+	}
+	if err := db.checkNotReferenced(def.TableNames, "削除"); err != nil {
+		return nil, err
+	}
+
+	// カタログから消し、データファイルと SERIAL / AUTO_INCREMENT のカラムのシーケンスも消す（全部のテーブルで 1 つのトランザクション）
+	change := catalogChange{}
+	for _, tableDef := range targets {
+		change.Removed = append(change.Removed, tableDef.Name)
+		change.Files = append(change.Files, fileOp{Op: opTypeRemoveFiles, Name: tableDef.Name})
+		for _, col := range tableDef.Columns {
+			if col.Sequence != "" {
+				change.Files = append(change.Files, fileOp{Op: opTypeDropSequence, Name: col.Sequence})
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return res, nil
+	}
+	if err := db.commitCatalog(change); err != nil {
+		return nil, err
+	}
+	for _, tableDef := range targets {
+		db.logf("テーブル '%s' を削除しました", tableDef.Name)
+	}
+	return res, nil
+}
+
+// Truncate - TRUNCATE文を実行
+// 行を 1 行ずつ削除するのではなく、データファイルを空にしてインデックスを作り直す（ON DELETE の動作は行わない）
+func (db *database) Truncate(sql string) (*Result, error) {
+	def, err := parseTruncate(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	for _, name := range def.TableNames {
+		if _, err := db.getTable(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := db.checkNotReferenced(def.TableNames, "空に"); err != nil {
+		return nil, err
+	}
+
+	// データファイルを空で作り直す（以前の版のカラムの並びも要らなくなる。全部のテーブルで 1 つのトランザクション）
+	change := catalogChange{}
+	for _, name := range def.TableNames {
+		change.Files = append(change.Files, fileOp{Op: opTypeCreateFile, Name: name})
+		if tableDef := db.catalog.Tables[name]; len(tableDef.History) > 0 {
+			cleared, err := cloneTableDef(tableDef)
+			if err != nil {
+				return nil, err
+			}
+			cleared.History = nil
+			change.Tables = append(change.Tables, cleared)
+		}
+	}
+	if err := db.commitCatalog(change); err != nil {
+		return nil, err
+	}
+
+	for _, name := range def.TableNames {
+		if err := db.rebuildIndexes(name); err != nil {
+			return nil, err
+		}
+		if def.RestartIdentity {
+			for _, col := range db.catalog.Tables[name].Columns {
+				if col.Sequence == "" {
+					continue
+				}
+				seq, err := db.getSequence(col.Sequence)
+				if err != nil {
+					return nil, err
+				}
+				if err := seq.restart(); err != nil {
+					return nil, fmt.Errorf("シーケンス '%s' の保存に失敗しました: %v", col.Sequence, err)
+				}
+			}
+		}
+		db.logf("テーブル '%s' を空にしました", name)
+	}
+	return newResult("TRUNCATE"), nil
+}
+
+// AlterTable - ALTER TABLE文を実行
+func (db *database) AlterTable(sql string) (*Result, error) {
+	def, err := parseAlterTable(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	tableDef, err := db.getTable(def.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	res := newResult("ALTER TABLE")
+	switch def.Action {
+	case alterAddColumn:
+		err = db.addColumn(tableDef, def, res)
+	case alterDropColumn:
+		err = db.dropColumn(tableDef, def, res)
+	case alterRenameColumn:
+		err = db.renameColumn(tableDef, def)
+	case alterRenameTable:
+		err = db.renameTable(tableDef, def)
+	default:
+		err = fmt.Errorf("サポートされていない ALTER TABLE の操作です: %s", def.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// replaceTables - 変更したテーブル定義をカタログの定義とまとめて入れ替えて保存し、インデックスを作り直す
+func (db *database) replaceTables(tableDefs ...*tableSchema) error {
+	if err := db.commitCatalog(catalogChange{Tables: tableDefs}); err != nil {
+		return err
+	}
+	for _, tableDef := range tableDefs {
+		if err := db.rebuildIndexes(tableDef.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropHistory - テーブルの全行を今の版で書き直したあとに、以前の版のカラムの並びを捨てる
+func (db *database) dropHistory(tableDef *tableSchema) error {
+	if len(tableDef.History) == 0 {
+		return nil
+	}
+	cleared, err := cloneTableDef(tableDef)
+	if err != nil {
+		return err
+	}
+	cleared.History = nil
+	return db.commitCatalog(catalogChange{Tables: []*tableSchema{cleared}})
+}
+
+// rewriteTableName - ADD COLUMN で書き直した行を置いておくファイルの名前（拡張子なし）
+// 引用符付きの識別子なら "." を含むテーブル名も作れるので、カタログのテーブルと重ならない名前を選ぶ
+func (db *database) rewriteTableName(tableName string) string {
+	name := tableName + ".rewrite"
+	for db.catalog.Tables[name] != nil {
+		name += "_"
+	}
+	return name
+}
+
+// addColumn - ALTER TABLE ADD COLUMN
+func (db *database) addColumn(tableDef *tableSchema, def *alterTableDef, res *Result) error {
+	col := def.Added.Columns[0]
+	if tableDef.ColumnIndex(col.Name) >= 0 {
+		if def.IfNotExists {
+			res.notice("カラム '%s' は既に存在するためスキップしました", col.Name)
+			return nil
+		}
+		return fmt.Errorf("カラム '%s' はテーブル '%s' に既に存在します", col.Name, tableDef.Name)
+	}
+	// 新しいカラムの DEFAULT 式だけを確認する（既存のカラムのシーケンスは作成済み）
+	if err := db.validateTableConstraints(def.Added); err != nil {
+		return err
+	}
+
+	// カラムとカラム制約を加えた定義を作る
+	newDef, err := cloneTableDef(tableDef)
+	if err != nil {
+		return err
+	}
+	newDef.newVersion()
+	col.ID = newDef.nextColumnID()
+	newDef.Columns = append(newDef.Columns, col)
+	if def.Added.PrimaryKey != nil {
+		if err := newDef.addKeyConstraint(*def.Added.PrimaryKey, true); err != nil {
+			return err
+		}
+	}
+	newDef.Uniques = append(newDef.Uniques, def.Added.Uniques...)
+	newDef.Checks = append(newDef.Checks, def.Added.Checks...)
+	newDef.ForeignKeys = append(newDef.ForeignKeys, def.Added.ForeignKeys...)
+	if err := newDef.resolveConstraints(); err != nil {
+		return err
+	}
+	if err := db.validateForeignKeys(newDef); err != nil {
+		return err
+	}
+
+	// 既存の行のこのカラムの値
+	// DEFAULT が行ごとに値の変わる式（nextval）なら行ごとに評価して書き直し、そうでなければ 1 回だけ評価して Missing に持つ
+	last := len(newDef.Columns) - 1
+	rewrite := false
+	if col.Default != "" {
+		expr, err := parseExpr(col.Default)
+		if err != nil {
+			return err
+		}
+		if rewrite = usesSequence(expr); !rewrite {
+			value, err := db.evalDefault(col)
+			if err != nil {
+				return err
+			}
+			newDef.Columns[last].Missing = &value
+		}
+	}
+
+	if err := db.createOwnedSequences(def.Added); err != nil {
+		return err
+	}
+	// ここから先でエラーになったら、作ったシーケンスも消す
+	fail := func(err error) error {
+		if col.Sequence != "" {
+			db.dropSequence(col.Sequence)
+		}
+		return err
+	}
+
+	// 既存の行が新しいカラムの制約（NOT NULL・CHECK・一意性・外部キー）を満たすか確認する
+	rows, err := db.pool.ReadAllRows(tableDef.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fail(fmt.Errorf("データ読み込みエラー: %v", err))
+	}
+	for i, row := range rows {
+		row = normalizeRow(newDef, row)
+		if rewrite {
+			if row[last], err = db.evalDefault(col); err != nil {
+				return fail(err)
+			}
+		}
+		if err := checkPrimaryKeyValues(newDef, row); err != nil {
+			return fail(err)
+		}
+		if err := checkRowConstraints(newDef, row); err != nil {
+			return fail(err)
+		}
+		// 名前の決まった（resolveConstraints 後の）制約で確認する。追加分は末尾にある
+		for _, fk := range newDef.ForeignKeys[len(newDef.ForeignKeys)-len(def.Added.ForeignKeys):] {
+			if foreignKeyIsNull(newDef, fk, row) {
+				continue
+			}
+			found, err := db.parentKeyExists(newDef, fk, row)
+			if err != nil {
+				return fail(err)
+			}
+			if !found {
+				return fail(newForeignKeyViolationError(newDef.Name, fk, newDef, fk.Columns, row, false))
+			}
+		}
+		rows[i] = row
+	}
+	if err := checkUniqueRows(newDef, rows); err != nil {
+		return fail(err)
+	}
+
+	// 書き直す行は別のファイルに書いておき、カタログの変更と同じトランザクションでデータファイルと入れ替える
+	// （カタログより先にデータファイルを書き直すと、途中で落ちたときにカタログの知らない版の行が残る）
+	change := catalogChange{Tables: []*tableSchema{newDef}}
+	if rewrite {
+		rewriteName := db.rewriteTableName(newDef.Name)
+		rewritePath := db.catalog.tablePath(rewriteName)
+		if err := db.pool.WriteRowsFile(newDef.path, tableFileName(rewritePath), newDef.Version, rows); err != nil {
+			db.pool.RemoveTableFiles(rewritePath)
+			return fail(fmt.Errorf("データ保存エラー: %v", err))
+		}
+		newDef.History = nil
+		change.Files = []fileOp{{Op: opTypeRenameFiles, Name: rewriteName, NewName: newDef.Name}}
+	}
+
+	if err := db.commitCatalog(change); err != nil {
+		return err
+	}
+	if err := db.rebuildIndexes(newDef.Name); err != nil {
+		return err
+	}
+	db.logf("テーブル '%s' にカラム '%s' (%s) を追加しました", newDef.Name, col.Name, col.Type)
+	return nil
+}
+
+// dropColumn - ALTER TABLE DROP COLUMN
+// カラムを使っている主キー・UNIQUE 制約・CHECK 制約・外部キー制約・インデックスも一緒に削除する
+func (db *database) dropColumn(tableDef *tableSchema, def *alterTableDef, res *Result) error {
+	pos := tableDef.ColumnIndex(def.Column)
+	if pos < 0 {
+		if def.IfExists {
+			res.notice("カラム '%s' は存在しないためスキップしました", def.Column)
+			return nil
+		}
+		return fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", def.Column, tableDef.Name)
+	}
+	column := tableDef.Columns[pos]
+	if len(tableDef.Columns) == 1 {
+		return fmt.Errorf("テーブル '%s' の最後のカラムは削除できません", tableDef.Name)
+	}
+	for _, ref := range db.referencingForeignKeys(tableDef.Name) {
+		if ref.child.Name != tableDef.Name && containsName(ref.fk.RefColumns, column.Name) {
+			return fmt.Errorf("カラム '%s' はテーブル '%s' の外部キー制約 \"%s\" から参照されているため削除できません",
+				column.Name, ref.child.Name, ref.fk.Name)
+		}
+	}
+
+	newDef, err := cloneTableDef(tableDef)
+	if err != nil {
+		return err
+	}
+	newDef.newVersion()
+	newDef.Columns = append(newDef.Columns[:pos:pos], newDef.Columns[pos+1:]...)
+
+	dropped := []string{} // 一緒に削除した制約・インデックスの名前
+	if newDef.PrimaryKey != nil && containsName(newDef.PrimaryKey.Columns, column.Name) {
+		dropped = append(dropped, newDef.PrimaryKey.Name)
+		newDef.PrimaryKey = nil
+	}
+	uniques := []keyConstraint{}
+	for _, unique := range newDef.Uniques {
+		if containsName(unique.Columns, column.Name) {
+			dropped = append(dropped, unique.Name)
+			continue
+		}
+		uniques = append(uniques, unique)
+	}
+	newDef.Uniques = uniques
+	foreignKeys := []foreignKeyDef{}
+	for _, fk := range newDef.ForeignKeys {
+		if containsName(fk.Columns, column.Name) || (fk.RefTable == tableDef.Name && containsName(fk.RefColumns, column.Name)) {
+			dropped = append(dropped, fk.Name)
+			continue
+		}
+		foreignKeys = append(foreignKeys, fk)
+	}
+	newDef.ForeignKeys = foreignKeys
+	checks := []checkConstraint{}
+	for _, check := range newDef.Checks {
+		uses, err := exprReferences(check.Expr, column.Name)
+		if err != nil {
+			return err
+		}
+		if uses {
+			dropped = append(dropped, check.Name)
+			continue
+		}
+		checks = append(checks, check)
+	}
+	newDef.Checks = checks
+	indexes := []indexDef{}
+	for _, index := range newDef.Indexes {
+		uses := false
+		for _, text := range index.Exprs {
+			found, err := exprReferences(text, column.Name)
+			if err != nil {
+				return err
+			}
+			uses = uses || found
+		}
+		if uses {
+			dropped = append(dropped, index.Name)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	newDef.Indexes = indexes
+
+	// データファイルはそのまま（前の版の行のこのカラムのフィールドは、読むときに読み飛ばす）
+	// SERIAL / AUTO_INCREMENT のカラムならシーケンスも一緒に消す
+	change := catalogChange{Tables: []*tableSchema{newDef}}
+	if column.Sequence != "" {
+		change.Files = append(change.Files, fileOp{Op: opTypeDropSequence, Name: column.Sequence})
+	}
+	if err := db.commitCatalog(change); err != nil {
+		return err
+	}
+	if err := db.rebuildIndexes(newDef.Name); err != nil {
+		return err
+	}
+
+	db.logf("テーブル '%s' のカラム '%s' を削除しました", newDef.Name, column.Name)
+	for _, name := range dropped {
+		res.notice("カラム '%s' を使っている制約・インデックス '%s' も削除しました", column.Name, name)
+	}
+	return nil
+}
+
+// renameColumn - ALTER TABLE RENAME COLUMN
+// 制約・インデックスのカラムと式、このカラムを参照している外部キーのカラム名も書き換える（データファイルはそのまま）
+func (db *database) renameColumn(tableDef *tableSchema, def *alterTableDef) error {
+	pos := tableDef.ColumnIndex(def.Column)
+	if pos < 0 {
+		return fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", def.Column, tableDef.Name)
+	}
+	if tableDef.ColumnIndex(def.NewName) >= 0 {
+		return fmt.Errorf("カラム '%s' はテーブル '%s' に既に存在します", def.NewName, tableDef.Name)
+	}
+	oldName := tableDef.Columns[pos].Name
+	rename := func(columns []string) {
+		for i, col := range columns {
+			if strings.EqualFold(col, oldName) {
+				columns[i] = def.NewName
+			}
+		}
+	}
+	renameRef := func(ref *columnRef) {
+		if strings.EqualFold(ref.Name, oldName) {
+			ref.Name = def.NewName
+		}
+	}
+
+	newDef, err := cloneTableDef(tableDef)
+	if err != nil {
+		return err
+	}
+	newDef.Columns[pos].Name = def.NewName
+	if newDef.PrimaryKey != nil {
+		rename(newDef.PrimaryKey.Columns)
+	}
+	for _, unique := range newDef.Uniques {
+		rename(unique.Columns)
+	}
+	for _, fk := range newDef.ForeignKeys {
+		rename(fk.Columns)
+		if fk.RefTable == tableDef.Name {
+			rename(fk.RefColumns)
+		}
+	}
+	for i, check := range newDef.Checks {
+		if newDef.Checks[i].Expr, err = rewriteColumnRefs(check.Expr, renameRef); err != nil {
+			return err
+		}
+	}
+	for _, index := range newDef.Indexes {
+		for i, text := range index.Exprs {
+			if index.Exprs[i], err = rewriteColumnRefs(text, renameRef); err != nil {
+				return err
+			}
+		}
+	}
+
+	// このカラムを参照している他のテーブルの外部キー
+	children, err := db.updateReferencingTables(tableDef.Name, func(fk *foreignKeyDef) {
+		rename(fk.RefColumns)
+	})
+	if err != nil {
+		return err
+	}
+	if err := db.replaceTables(append([]*tableSchema{newDef}, children...)...); err != nil {
+		return err
+	}
+
+	db.logf("テーブル '%s' のカラム '%s' の名前を '%s' に変更しました", newDef.Name, oldName, def.NewName)
+	return nil
+}
+
+// renameTable - ALTER TABLE RENAME TO
+// データファイル・サイドファイルの名前を変え、このテーブルを参照している外部キーの参照先も書き換える
+// （制約・インデックス・シーケンスの名前は postgres と同じく元のまま）
+func (db *database) renameTable(tableDef *tableSchema, def *alterTableDef) error {
+	oldName, newName := tableDef.Name, def.NewName
+	if _, exists := db.catalog.Tables[newName]; exists {
+		return fmt.Errorf("テーブル '%s' は既に存在します", newName)
+	}
+	if _, exists := db.sequences[newName]; exists {
+		return fmt.Errorf("'%s' は既にシーケンスの名前として使われています", newName)
+	}
+	renameRef := func(ref *columnRef) {
+		if ref.Table == oldName {
+			ref.Table = newName
+		}
+	}
+
+	newDef, err := cloneTableDef(tableDef)
+	if err != nil {
+		return err
+	}
+	newDef.Name = newName
+	for i, fk := range newDef.ForeignKeys {
+		if fk.RefTable == oldName {
+			newDef.ForeignKeys[i].RefTable = newName
+		}
+	}
+	for i, check := range newDef.Checks {
+		if newDef.Checks[i].Expr, err = rewriteColumnRefs(check.Expr, renameRef); err != nil {
+			return err
+		}
+	}
+	for _, index := range newDef.Indexes {
+		for i, text := range index.Exprs {
+			if index.Exprs[i], err = rewriteColumnRefs(text, renameRef); err != nil {
+				return err
+			}
+		}
+	}
+	children, err := db.updateReferencingTables(oldName, func(fk *foreignKeyDef) {
+		fk.RefTable = newName
+	})
+	if err != nil {
+		return err
+	}
+
+	// 古い名前の定義の削除・新しい名前と参照しているテーブルの定義の登録・ファイル名の変更を 1 つのトランザクションで行う
+	changed := append([]*tableSchema{newDef}, children...)
+	if err := db.commitCatalog(catalogChange{
+		Removed: []string{oldName},
+		Tables:  changed,
+		Files:   []fileOp{{Op: opTypeRenameFiles, Name: oldName, NewName: newName}},
+	}); err != nil {
+		return err
+	}
+	for _, tableDef := range changed {
+		if err := db.rebuildIndexes(tableDef.Name); err != nil {
+			return err
+		}
+	}
+
+	db.logf("テーブル '%s' の名前を '%s' に変更しました", oldName, newName)
+	return nil
+}
+
+// updateReferencingTables - tableName を参照している他のテーブルの外部キーを update で書き換えた定義のコピーを返す
+// （自分自身を参照する外部キーは呼び出し側で書き換える）
+func (db *database) updateReferencingTables(tableName string, update func(fk *foreignKeyDef)) ([]*tableSchema, error) {
+	children := []*tableSchema{}
+	for _, ref := range db.referencingForeignKeys(tableName) {
+		if ref.child.Name == tableName {
+			continue
+		}
+		var child *tableSchema
+		for _, c := range children {
+			if c.Name == ref.child.Name {
+				child = c
+			}
+		}
+		if child == nil {
+			var err error
+			if child, err = cloneTableDef(ref.child); err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		}
+		for i := range child.ForeignKeys {
+			if child.ForeignKeys[i].Name == ref.fk.Name {
+				update(&child.ForeignKeys[i])
+			}
+		}
+	}
+	return children, nil
+}
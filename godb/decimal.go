@@ -0,0 +1,209 @@
+package godb
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimalは DECIMAL / NUMERIC 型の値（10 進の固定小数点数）
+// 値は unscaled × 10^(-scale) で、float64 と違って 0.1 + 0.2 = 0.3 のように誤差なく計算できる
+// scale は表示する小数点以下の桁数も表す（postgres と同じく 1.50 と 1.5 は等しいが、表示は区別する）
+type Decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// decimalDivScaleは割り算の結果の小数点以下の最小桁数（postgres の numeric の割り算と同じく 16 桁）
+const decimalDivScale = 16
+
+// NewDecimalFromIntは整数から Decimal を作る
+func NewDecimalFromInt(n int64) Decimal {
+	return Decimal{unscaled: big.NewInt(n), scale: 0}
+}
+
+// ParseDecimalは "-12.340" のような 10 進表記の文字列を Decimal にする（指数表記 1.5e3 も受け付ける）
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Decimal{}, fmt.Errorf("'%s' は数値ではありません", s)
+		}
+		mantissa, exp = s[:i], e
+	}
+
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") || strings.HasPrefix(mantissa, "+") {
+		sign, mantissa = mantissa[:1], mantissa[1:]
+	}
+	intPart, fracPart := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		intPart, fracPart = mantissa[:i], mantissa[i+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("'%s' は数値ではありません", s)
+	}
+
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if sign == "-" {
+		unscaled.Neg(unscaled)
+	}
+	d := Decimal{unscaled: unscaled, scale: len(fracPart)}
+	// 指数の分だけ小数点を動かす
+	if exp > 0 {
+		if exp <= d.scale {
+			d.scale -= exp
+		} else {
+			d.unscaled.Mul(d.unscaled, pow10(exp-d.scale))
+			d.scale = 0
+		}
+	} else {
+		d.scale -= exp
+	}
+	return d, nil
+}
+
+// decimalFromFloatは float64 を Decimal にする（float64 を 10 進で表したときの最短の表記を使う）
+func decimalFromFloat(f float64) (Decimal, error) {
+	return ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// pow10は 10^n を返す
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// withScaleは小数点以下の桁数を scale に増やした同じ値を返す（scale は d.scale 以上）
+func (d Decimal) withScale(scale int) *big.Int {
+	return new(big.Int).Mul(d.unscaled, pow10(scale-d.scale))
+}
+
+// alignは 2 つの値の小数点以下の桁数を揃えて unscaled を返す
+func (d Decimal) align(o Decimal) (*big.Int, *big.Int, int) {
+	scale := max(d.scale, o.scale)
+	return d.withScale(scale), o.withScale(scale), scale
+}
+
+func (d Decimal) String() string {
+	s := new(big.Int).Abs(d.unscaled).String()
+	if d.scale > 0 {
+		if len(s) <= d.scale {
+			s = strings.Repeat("0", d.scale-len(s)+1) + s
+		}
+		s = s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	}
+	if d.unscaled.Sign() < 0 {
+		return "-" + s
+	}
+	return s
+}
+
+// Signは符号（-1, 0, 1）を返す
+func (d Decimal) Sign() int {
+	return d.unscaled.Sign()
+}
+
+// Cmpは値を比較する（-1, 0, 1）
+func (d Decimal) Cmp(o Decimal) int {
+	a, b, _ := d.align(o)
+	return a.Cmp(b)
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b, scale := d.align(o)
+	return Decimal{unscaled: a.Add(a, b), scale: scale}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	a, b, scale := d.align(o)
+	return Decimal{unscaled: a.Sub(a, b), scale: scale}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.unscaled, o.unscaled), scale: d.scale + o.scale}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.unscaled), scale: d.scale}
+}
+
+// Divは割り算の結果を、小数点以下 max(16, 両辺の桁数) 桁に四捨五入して返す
+func (d Decimal) Div(o Decimal) (Decimal, error) {
+	if o.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("ゼロ除算です")
+	}
+	scale := max(decimalDivScale, d.scale, o.scale)
+	// d / o を 10^(scale+1) 倍した整数を求めてから、最後の 1 桁で四捨五入する
+	num := new(big.Int).Mul(d.unscaled, pow10(scale+1+o.scale))
+	den := new(big.Int).Mul(o.unscaled, pow10(d.scale))
+	q := new(big.Int).Quo(num, den)
+	return Decimal{unscaled: q, scale: scale + 1}.Round(scale), nil
+}
+
+// Modは剰余（符号は左辺と同じ）を返す
+func (d Decimal) Mod(o Decimal) (Decimal, error) {
+	if o.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("ゼロ除算です")
+	}
+	a, b, scale := d.align(o)
+	return Decimal{unscaled: new(big.Int).Rem(a, b), scale: scale}, nil
+}
+
+// Roundは小数点以下 scale 桁に四捨五入する（0.5 は 0 から遠い方に丸める。postgres の numeric と同じ）
+func (d Decimal) Round(scale int) Decimal {
+	if scale >= d.scale {
+		return Decimal{unscaled: d.withScale(scale), scale: scale}
+	}
+	divisor := pow10(d.scale - scale)
+	q, r := new(big.Int).QuoRem(d.unscaled, divisor, new(big.Int))
+	// |r| * 2 >= divisor なら 0 から遠い方へ
+	r.Abs(r).Lsh(r, 1)
+	if r.Cmp(divisor) >= 0 {
+		if d.unscaled.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{unscaled: q, scale: scale}
+}
+
+// IntegerDigitsは整数部の桁数を返す（0.5 なら 0、DECIMAL(p, s) の範囲チェック用）
+func (d Decimal) IntegerDigits() int {
+	intPart := new(big.Int).Quo(new(big.Int).Abs(d.unscaled), pow10(d.scale))
+	if intPart.Sign() == 0 {
+		return 0
+	}
+	return len(intPart.String())
+}
+
+// Int64は整数に四捨五入した値を返す（int64 に収まらなければ false）
+func (d Decimal) Int64() (int64, bool) {
+	n := d.Round(0).unscaled
+	if !n.IsInt64() {
+		return 0, false
+	}
+	return n.Int64(), true
+}
+
+// Float64は float64 に変換する（誤差が出ることがある）
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// normalizeは 0.d1d2...dn × 10^exp の形（d1 は 0 以外、末尾の 0 は除く）にして符号・桁の並び・指数を返す
+// 値が同じなら scale が違っても同じ結果になるので、インデックスのキーに使う
+func (d Decimal) normalize() (sign int, digits string, exp int) {
+	sign = d.Sign()
+	if sign == 0 {
+		return 0, "", 0
+	}
+	s := new(big.Int).Abs(d.unscaled).String()
+	exp = len(s) - d.scale
+	return sign, strings.TrimRight(s, "0"), exp
+}
@@ -0,0 +1,611 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// database/sql のドライバ
+//
+//	import _ "go-database/godb" // "godb" という名前でドライバを登録する
+//	db, err := sql.Open("godb", "data?sync=off&page_size=8192&buffer_pool=1024")
+//	rows, err := db.QueryContext(ctx, "SELECT id, name FROM users WHERE id = ?", 1)
+//
+// DSN はデータディレクトリのパスで、? の後ろに Options を書ける（sync=full|off・page_size・buffer_pool・auto_analyze）
+// 自分で開いた DB は sql.OpenDB(godb.NewConnector(db)) で使える
+//   - データディレクトリは 1 つのプロセスで 1 回しか開けないので、sql.Open ごとに DB を 1 つ開いて、コネクションプールの接続で共有する
+//     （sql.DB の Close で閉じる）。文は DB の中で 1 つずつ実行する
+//   - パラメータは ?（順番）・$1（番号）・:name / @name（sql.Named の名前）で書く。パラメータのある文はプリペアド文（prepare.go）にして、
+//     値はパラメータに渡す（SQL 文に埋め込まないので、値で文の意味が変わることはない）。Prepare した文はパースとプランを使い回す
+//   - トランザクション（BeginTx）はその接続が終わるまで DB を占有する。分離レベルはどれを指定しても直列化（ほかの文は待たされる）。読み取り専用には対応しない
+//   - コンテキストが取り消されたら、待っている文・実行中の文をやめて ctx.Err() を返す（godb.go の ExecContext）
+//   - 結果の列の型は ColumnTypes で取れる（DatabaseTypeName は INT・VARCHAR・DECIMAL など、Length は VARCHAR(n) の n、DecimalSize は DECIMAL(p, s)）
+//   - 値は int64・float64・bool・string・[]byte・time.Time で返す。DECIMAL と JSON は string、DATE と TIMESTAMP は UTC の time.Time
+
+// DriverName - database/sql に登録するドライバの名前
+const DriverName = "godb"
+
+func init() {
+	sql.Register(DriverName, &sqlDriver{})
+}
+
+// sqlDriver - database/sql のドライバ
+type sqlDriver struct{}
+
+// Open - DSN のデータベースを開いて接続を返す（接続を閉じたらデータベースも閉じる）
+// sql.Open は OpenConnector を使うので、ここを通るのは driver.Driver を直接使ったときだけ
+func (d *sqlDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cn, err := c.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	cn.(*conn).owner = c.(*connector)
+	return cn, nil
+}
+
+// OpenConnector - DSN を読んで、接続を作る Connector を返す（データベースは最初に接続したときに開く）
+func (d *sqlDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	dir, opts, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{dir: dir, opts: opts}, nil
+}
+
+// parseDSN - DSN（data?sync=off&page_size=8192）をデータディレクトリと Options に分ける
+func parseDSN(dsn string) (string, Options, error) {
+	opts := Options{}
+	dir, query, _ := strings.Cut(dsn, "?")
+	if dir == "" {
+		return "", opts, fmt.Errorf("DSN にデータディレクトリがありません")
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", opts, fmt.Errorf("DSN '%s' が読めません: %v", dsn, err)
+	}
+	for key, values := range params {
+		value := values[len(values)-1]
+		switch key {
+		case "sync":
+			switch value {
+			case "full":
+				opts.SyncMode = SyncFull
+			case "off":
+				opts.SyncMode = SyncOff
+			default:
+				return "", opts, fmt.Errorf("DSN の sync には full か off を指定してください")
+			}
+		case "page_size", "buffer_pool":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return "", opts, fmt.Errorf("DSN の %s '%s' は整数ではありません", key, value)
+			}
+			if key == "page_size" {
+				opts.PageSize = n
+			} else {
+				opts.BufferPoolSize = n
+			}
+		case "auto_analyze":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", opts, fmt.Errorf("DSN の auto_analyze '%s' は数値ではありません", value)
+			}
+			if f == 0 {
+				f = -1 // 0 なら自動 ANALYZE しない（CLI の -auto-analyze と同じ）
+			}
+			opts.AutoAnalyzeScale = f
+		default:
+			return "", opts, fmt.Errorf("DSN のパラメータ '%s' は不明です", key)
+		}
+	}
+	if opts, err = opts.withDefaults(); err != nil {
+		return "", opts, err
+	}
+	return dir, opts, nil
+}
+
+// NewConnector - 開いた DB を database/sql から使う Connector を返す（sql.OpenDB に渡す）
+// sql.DB を閉じても db は閉じない
+func NewConnector(db *DB) driver.Connector {
+	return &connector{db: db, external: true}
+}
+
+// connector - 1 つのデータベースへの接続を作る（接続はすべて同じ DB を使う）
+type connector struct {
+	dir      string
+	opts     Options
+	external bool // db を NewConnector で受け取った（Close で閉じない）
+
+	mu sync.Mutex
+	db *DB
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		db, err := Open(c.dir, &c.opts)
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+	}
+	return &conn{db: c.db}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &sqlDriver{}
+}
+
+// Close - データベースを閉じる（sql.DB の Close から呼ばれる）
+func (c *connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil || c.external {
+		return nil
+	}
+	db := c.db
+	c.db = nil
+	return db.Close()
+}
+
+// conn - database/sql の 1 つの接続
+// database/sql は 1 つの接続を同時に 1 つのゴルーチンからしか使わない
+type conn struct {
+	db    *DB
+	tx    *Tx        // 実行中のトランザクション（なければ nil）
+	owner *connector // sqlDriver.Open で作った接続なら、閉じるときにデータベースも閉じる
+}
+
+var (
+	_ driver.Conn               = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext - パラメータのある文はプリペアド文にして返す（パラメータのない文は実行するときにそのまま実行する）
+// :name / @name は $1 の形に書き換えてから渡す
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	params, err := scanParams(query)
+	if err != nil {
+		return nil, err
+	}
+	s := &stmt{conn: c, query: query}
+	if len(params) == 0 {
+		return s, nil
+	}
+	rewritten, names := rewriteParams(query, params)
+	s.names = names
+	if c.tx != nil {
+		s.prep, err = c.tx.PrepareContext(ctx, rewritten)
+	} else {
+		s.prep, err = c.db.PrepareContext(ctx, rewritten)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close - 接続を閉じる（終わっていないトランザクションは取り消す）
+func (c *conn) Close() error {
+	var err error
+	if c.tx != nil {
+		err = c.tx.Rollback()
+		c.tx = nil
+	}
+	if c.owner != nil {
+		if cerr := c.owner.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.ReadOnly {
+		return nil, fmt.Errorf("読み取り専用のトランザクションには対応していません")
+	}
+	if c.tx != nil {
+		return nil, fmt.Errorf("トランザクションはすでに開始しています")
+	}
+	tx, err := c.db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.tx = tx
+	return &connTx{conn: c}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driverResult{rowsAffected: res.RowsAffected}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+// run - 文を実行する（パラメータがあればプリペアド文にして値を渡す）
+func (c *conn) run(ctx context.Context, query string, args []driver.NamedValue) (*Result, error) {
+	s, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return s.(*stmt).run(ctx, args)
+}
+
+// CheckNamedValue - DECIMAL・DATE・TIMESTAMP・JSON の値はそのまま受け取る（ほかは database/sql の既定の変換）
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch nv.Value.(type) {
+	case Decimal, Date, Timestamp, JSON:
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// Ping - データベースが開いているか確かめる（ほかの接続のトランザクションが終わるまで待つ）
+func (c *conn) Ping(ctx context.Context) error {
+	if c.tx != nil {
+		return nil // この接続がロックを持っている
+	}
+	if err := c.db.lock(ctx); err != nil {
+		if _, ok := err.(*ClosedError); ok {
+			return driver.ErrBadConn
+		}
+		return err
+	}
+	c.db.unlock()
+	return nil
+}
+
+// connTx - database/sql のトランザクション
+type connTx struct {
+	conn *conn
+}
+
+func (t *connTx) Commit() error {
+	tx := t.conn.tx
+	if tx == nil {
+		return &ClosedError{What: "トランザクション"}
+	}
+	t.conn.tx = nil
+	return tx.Commit()
+}
+
+func (t *connTx) Rollback() error {
+	tx := t.conn.tx
+	if tx == nil {
+		return &ClosedError{What: "トランザクション"}
+	}
+	t.conn.tx = nil
+	return tx.Rollback()
+}
+
+// stmt - PrepareContext で作った文
+type stmt struct {
+	conn  *conn
+	query string
+	prep  *Stmt    // プリペアド文（パラメータのない文は nil）
+	names []string // 番号ごとのパラメータの名前（:name / @name を書き換えた番号だけ。ほかは空）
+}
+
+var (
+	_ driver.StmtExecContext  = (*stmt)(nil)
+	_ driver.StmtQueryContext = (*stmt)(nil)
+)
+
+func (s *stmt) Close() error {
+	if s.prep == nil {
+		return nil
+	}
+	return s.prep.Close()
+}
+
+// NumInput - パラメータの数（:name / @name を使っていれば -1。database/sql は数を確かめない）
+func (s *stmt) NumInput() int {
+	for _, name := range s.names {
+		if name != "" {
+			return -1
+		}
+	}
+	return len(s.names)
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	res, err := s.run(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return driverResult{rowsAffected: res.RowsAffected}, nil
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := s.run(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+// run - パラメータに args の値を入れて文を実行する（接続がトランザクションの中ならその Tx で）
+func (s *stmt) run(ctx context.Context, args []driver.NamedValue) (*Result, error) {
+	tx := s.conn.tx
+	if s.prep == nil {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("パラメータのない文に値が %d 個渡されました", len(args))
+		}
+		if tx != nil {
+			return tx.ExecContext(ctx, s.query)
+		}
+		return s.conn.db.ExecContext(ctx, s.query)
+	}
+	values := make([]any, len(s.names))
+	for i, name := range s.names {
+		arg, ok := findArg(args, i+1, name)
+		if !ok {
+			if name != "" {
+				return nil, fmt.Errorf("パラメータ '%s' の値がありません", name)
+			}
+			return nil, fmt.Errorf("パラメータ %d 番目の値がありません（値は %d 個です）", i+1, len(args))
+		}
+		values[i] = arg.Value
+	}
+	// トランザクションの外で Prepare した文もトランザクションの中で実行する（その逆も）
+	prep := &Stmt{db: s.prep.db, tx: tx, prep: s.prep.prep, closed: s.prep.closed}
+	return prep.ExecContext(ctx, values...)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// driverResult - INSERT / UPDATE / DELETE の結果
+type driverResult struct {
+	rowsAffected int64
+}
+
+// LastInsertId - 対応しない（SERIAL のカラムの値は RETURNING で受け取る）
+func (r driverResult) LastInsertId() (int64, error) {
+	return 0, fmt.Errorf("LastInsertId には対応していません（INSERT ... RETURNING を使ってください）")
+}
+
+func (r driverResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// rows - 結果の行（Result をすべて読んだあとで返すので、読んでいる間も DB を占有しない）
+type rows struct {
+	res *Result
+}
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+	_ driver.RowsColumnTypeLength           = (*rows)(nil)
+	_ driver.RowsColumnTypePrecisionScale   = (*rows)(nil)
+)
+
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.res.Columns))
+	for i, col := range r.res.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if !r.res.Next() {
+		return io.EOF
+	}
+	for i, v := range r.res.Values() {
+		dest[i] = driverValue(v)
+	}
+	return nil
+}
+
+// driverValue - 値を database/sql に渡せる型にする
+func driverValue(v any) driver.Value {
+	switch v := v.(type) {
+	case Date:
+		return v.Time
+	case Timestamp:
+		return v.Time
+	case Decimal:
+		return v.String()
+	case JSON:
+		return string(v)
+	}
+	return v
+}
+
+// ColumnTypeDatabaseTypeName - 列の型名（VARCHAR(255) なら VARCHAR）
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	name, _, _ := strings.Cut(r.res.Columns[index].Type.String(), "(")
+	return name
+}
+
+var scanTypes = map[TypeKind]reflect.Type{
+	TypeInt:       reflect.TypeOf(int64(0)),
+	TypeBigInt:    reflect.TypeOf(int64(0)),
+	TypeFloat:     reflect.TypeOf(float64(0)),
+	TypeDecimal:   reflect.TypeOf(""),
+	TypeBoolean:   reflect.TypeOf(false),
+	TypeText:      reflect.TypeOf(""),
+	TypeVarchar:   reflect.TypeOf(""),
+	TypeDate:      reflect.TypeOf(time.Time{}),
+	TypeTimestamp: reflect.TypeOf(time.Time{}),
+	TypeBytea:     reflect.TypeOf([]byte(nil)),
+	TypeJSON:      reflect.TypeOf(""),
+}
+
+// ColumnTypeScanType - 列の値を受け取る Go の型
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return scanTypes[r.res.Columns[index].Type.Kind]
+}
+
+// ColumnTypeLength - VARCHAR(n) の n（長さ制限のない文字列・バイト列は math.MaxInt64）
+func (r *rows) ColumnTypeLength(index int) (int64, bool) {
+	t := r.res.Columns[index].Type
+	switch {
+	case t.Kind == TypeVarchar && t.Length > 0:
+		return int64(t.Length), true
+	case t.Kind == TypeVarchar, t.Kind == TypeText, t.Kind == TypeBytea, t.Kind == TypeJSON:
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale - DECIMAL(p, s) の p と s（制限のない DECIMAL と、DECIMAL 以外は false）
+func (r *rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	t := r.res.Columns[index].Type
+	if t.Kind != TypeDecimal || t.Precision == 0 {
+		return 0, 0, false
+	}
+	return int64(t.Precision), int64(t.Scale), true
+}
+
+// param - 文の中のパラメータ
+type param struct {
+	start, end int    // SQL 文字列の中の位置（query[start:end] が ? や $1）
+	ordinal    int    // 何番目の値か（1 から。:name / @name は 0）
+	name       string // :name / @name の名前
+}
+
+// scanParams - SQL 文字列の中のパラメータ（?・$1・:name・@name）を探す
+// 文字列リテラル・ダブルクォートの識別子・コメントの中と、:: のキャストは飛ばす
+// ? と $1 は混ぜて使えない
+func scanParams(query string) ([]param, error) {
+	params := []param{}
+	question, numbered := 0, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return params, nil // 閉じていないクォートは構文エラーとして実行時に報告する
+			}
+			i += end + 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			i++
+		case c == '?':
+			question++
+			params = append(params, param{start: i, end: i + 1, ordinal: question})
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(query[i+1 : j])
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("パラメータ '%s' の番号が不正です", query[i:j])
+			}
+			numbered = true
+			params = append(params, param{start: i, end: j, ordinal: n})
+			i = j - 1
+		case (c == ':' || c == '@') && i+1 < len(query) && isIdentStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isIdentPart(query[j]) {
+				j++
+			}
+			params = append(params, param{start: i, end: j, name: query[i+1 : j]})
+			i = j - 1
+		}
+	}
+	if question > 0 && numbered {
+		return nil, fmt.Errorf("パラメータの ? と $1 は混ぜて使えません")
+	}
+	return params, nil
+}
+
+// rewriteParams - パラメータを全部 $1 の形に書き換えた SQL 文字列と、番号ごとの名前を返す
+// ? は出てきた順の番号にし、:name / @name は名前ごとに ? / $1 の番号の後ろの番号を付ける（同じ名前は同じ番号）
+func rewriteParams(query string, params []param) (string, []string) {
+	n := 0
+	for _, p := range params {
+		n = max(n, p.ordinal)
+	}
+	names := make([]string, n)
+	numbers := map[string]int{}
+	var sb strings.Builder
+	last := 0
+	for _, p := range params {
+		number := p.ordinal
+		if p.name != "" {
+			if number = numbers[p.name]; number == 0 {
+				names = append(names, p.name)
+				number = len(names)
+				numbers[p.name] = number
+			}
+		}
+		sb.WriteString(query[last:p.start])
+		sb.WriteString("$" + strconv.Itoa(number))
+		last = p.end
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), names
+}
+
+// findArg - number 番目（名前があれば name）のパラメータの値を探す
+func findArg(args []driver.NamedValue, number int, name string) (driver.NamedValue, bool) {
+	for _, arg := range args {
+		if (name != "" && arg.Name == name) || (name == "" && arg.Ordinal == number) {
+			return arg, true
+		}
+	}
+	return driver.NamedValue{}, false
+}
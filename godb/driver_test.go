@@ -0,0 +1,520 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestSQL - データディレクトリを作って sql.Open("godb", ...) で開き、stmts を順に実行する（テストの終わりに閉じる）
+// options は DSN の ? の後ろ（空なら sync=off）
+func openTestSQL(t *testing.T, options string, stmts ...string) *sql.DB {
+	t.Helper()
+	if options == "" {
+		options = "sync=off"
+	}
+	db, err := sql.Open(DriverName, t.TempDir()+"?"+options)
+	if err != nil {
+		t.Fatalf("データベースを開けません: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+// sqlRows - 結果の行の値を文字列にして返す（NULL は "NULL"）
+func sqlRows(t *testing.T, rows *sql.Rows) [][]string {
+	t.Helper()
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("列を取れません: %v", err)
+	}
+	result := [][]string{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatalf("値を読めません: %v", err)
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = "NULL"
+			if v.Valid {
+				row[i] = v.String
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("行を読めません: %v", err)
+	}
+	return result
+}
+
+func TestDriverParams(t *testing.T) {
+	db := openTestSQL(t, "",
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"INSERT INTO users VALUES (1, 'Alice'), (2, 'Bob'), (3, '?'), (4, ':id')",
+	)
+
+	tests := []struct {
+		name     string
+		query    string
+		args     []any
+		expected [][]string
+		errorMsg string // エラーメッセージに含まれるはずの文字列（エラーにならないなら空）
+	}{
+		{
+			name:     "? は出てきた順",
+			query:    "SELECT id FROM users WHERE id > ? AND name <> ? ORDER BY id",
+			args:     []any{1, "Bob"},
+			expected: [][]string{{"3"}, {"4"}},
+		},
+		{
+			name:     "$1 は同じ番号を何度でも使える",
+			query:    "SELECT name FROM users WHERE id = $2 OR id = $1 + $2 ORDER BY id",
+			args:     []any{1, 1},
+			expected: [][]string{{"Alice"}, {"Bob"}},
+		},
+		{
+			name:     ":name と @name は sql.Named の名前",
+			query:    "SELECT id FROM users WHERE id = :id OR name = @name OR id = :id + 2 ORDER BY id",
+			args:     []any{sql.Named("name", "Bob"), sql.Named("id", 1)},
+			expected: [][]string{{"1"}, {"2"}, {"3"}},
+		},
+		{
+			name:     "文字列リテラルの中の ? はパラメータではない",
+			query:    "SELECT id FROM users WHERE name = '?' OR id = ? ORDER BY id",
+			args:     []any{1},
+			expected: [][]string{{"1"}, {"3"}},
+		},
+		{
+			name:     "文字列リテラルの中の $1・:name と、'' でエスケープしたクォートのあと",
+			query:    "SELECT id FROM users WHERE name = '$1' OR name = ':id' OR name = 'it''s ?' OR id = $1 ORDER BY id",
+			args:     []any{2},
+			expected: [][]string{{"2"}, {"4"}},
+		},
+		{
+			name:     "ダブルクォートの識別子の中の ? はパラメータではない",
+			query:    `SELECT id AS "id?" FROM users WHERE id = ?`,
+			args:     []any{1},
+			expected: [][]string{{"1"}},
+		},
+		{
+			name:     "コメントの中の ? はパラメータではない",
+			query:    "SELECT id FROM users -- id = ? の行\nWHERE id = ?",
+			args:     []any{4},
+			expected: [][]string{{"4"}},
+		},
+		{
+			name:     ":: のキャストは名前のパラメータではない",
+			query:    "SELECT id FROM users WHERE id = :id::INT",
+			args:     []any{sql.Named("id", "2")},
+			expected: [][]string{{"2"}},
+		},
+		{
+			name:     "パラメータのない文",
+			query:    "SELECT count(*) FROM users WHERE name = '?'",
+			expected: [][]string{{"1"}},
+		},
+		{
+			name:     "? と $1 は混ぜられない",
+			query:    "SELECT id FROM users WHERE id = ? OR id = $1",
+			args:     []any{1},
+			errorMsg: "混ぜて使えません",
+		},
+		{
+			name:     "名前のパラメータの値がない",
+			query:    "SELECT id FROM users WHERE id = :id",
+			args:     []any{sql.Named("other", 1)},
+			errorMsg: "パラメータ 'id' の値がありません",
+		},
+		{
+			name:     "値が足りない",
+			query:    "SELECT id FROM users WHERE id = ? OR id = ?",
+			args:     []any{1},
+			errorMsg: "パラメータ 2 番目の値がありません",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := db.Query(tt.query, tt.args...)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("エラーメッセージに %s が含まれていません: %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if result := sqlRows(t, rows); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("結果が一致しません。期待: %v, 実際: %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Prepare した文を値を変えて実行する", func(t *testing.T) {
+		stmt, err := db.Prepare("SELECT name FROM users WHERE id = ?")
+		if err != nil {
+			t.Fatalf("Prepare: %v", err)
+		}
+		defer stmt.Close()
+		for id, expected := range map[int]string{1: "Alice", 2: "Bob"} {
+			var name string
+			if err := stmt.QueryRow(id).Scan(&name); err != nil || name != expected {
+				t.Errorf("id = %d: %q, %v", id, name, err)
+			}
+		}
+	})
+}
+
+func TestDriverTx(t *testing.T) {
+	db := openTestSQL(t, "", "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	insert, err := db.Prepare("INSERT INTO users VALUES (?, ?)")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer insert.Close()
+
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM users").Scan(&n); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		return n
+	}
+
+	// Rollback した変更は消える
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO users VALUES (?, ?)", 1, "Alice"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err := tx.Stmt(insert).Exec(2, "Bob"); err != nil {
+		t.Fatalf("トランザクションの外で Prepare した文を実行できません: %v", err)
+	}
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM users").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("トランザクションの中で追加した行が見えません: %d, %v", n, err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("Rollback した行が残っています: %d 行", n)
+	}
+
+	// Commit した変更は残る
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	res, err := tx.Exec("INSERT INTO users VALUES ($1, $2), ($3, $4)", 1, "Alice", 2, "Bob")
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected != 2 {
+		t.Errorf("RowsAffected: %d, %v", affected, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("Commit した行が一致しません: %d 行", n)
+	}
+	if err := tx.Commit(); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("終わったトランザクションの Commit が ErrTxDone になりませんでした: %v", err)
+	}
+
+	// 読み取り専用のトランザクションには対応しない
+	if _, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true}); err == nil {
+		t.Errorf("読み取り専用のトランザクションを開始できました")
+	}
+}
+
+func TestDriverColumnTypes(t *testing.T) {
+	db := openTestSQL(t, "",
+		"CREATE TABLE items (id BIGINT, price DECIMAL(10, 2), name VARCHAR(20), note TEXT, data BYTEA, created DATE, updated TIMESTAMP, ok BOOLEAN, score FLOAT)",
+	)
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 3, 1, 12, 34, 56, 789000000, time.UTC)
+	if _, err := db.Exec("INSERT INTO items VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		int64(math.MaxInt64), "12.50", "pen", "メモ", []byte{0, 1, 0xff}, created, updated, true, 1.5); err != nil {
+		t.Fatalf("INSERT: %v", err)
+	}
+
+	rows, err := db.Query("SELECT * FROM items")
+	if err != nil {
+		t.Fatalf("SELECT: %v", err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("ColumnTypes: %v", err)
+	}
+	expected := []struct {
+		name      string
+		scanType  reflect.Type
+		length    int64 // 長さのない型は -1
+		precision int64 // DECIMAL(p, s) でない型は -1
+		scale     int64
+	}{
+		{"BIGINT", reflect.TypeOf(int64(0)), -1, -1, 0},
+		{"DECIMAL", reflect.TypeOf(""), -1, 10, 2},
+		{"VARCHAR", reflect.TypeOf(""), 20, -1, 0},
+		{"TEXT", reflect.TypeOf(""), math.MaxInt64, -1, 0},
+		{"BYTEA", reflect.TypeOf([]byte(nil)), math.MaxInt64, -1, 0},
+		{"DATE", reflect.TypeOf(time.Time{}), -1, -1, 0},
+		{"TIMESTAMP", reflect.TypeOf(time.Time{}), -1, -1, 0},
+		{"BOOLEAN", reflect.TypeOf(false), -1, -1, 0},
+		{"FLOAT", reflect.TypeOf(float64(0)), -1, -1, 0},
+	}
+	if len(types) != len(expected) {
+		t.Fatalf("列の数が一致しません: %d", len(types))
+	}
+	for i, ct := range types {
+		e := expected[i]
+		if ct.DatabaseTypeName() != e.name || ct.ScanType() != e.scanType {
+			t.Errorf("%s: 型が一致しません。期待: %s %v, 実際: %s %v", ct.Name(), e.name, e.scanType, ct.DatabaseTypeName(), ct.ScanType())
+		}
+		if length, ok := ct.Length(); (e.length >= 0) != ok || (ok && length != e.length) {
+			t.Errorf("%s: Length が一致しません: %d, %v", ct.Name(), length, ok)
+		}
+		if p, s, ok := ct.DecimalSize(); (e.precision >= 0) != ok || (ok && (p != e.precision || s != e.scale)) {
+			t.Errorf("%s: DecimalSize が一致しません: %d, %d, %v", ct.Name(), p, s, ok)
+		}
+	}
+
+	var (
+		id          int64
+		price, name string
+		note        string
+		data        []byte
+		c, u        time.Time
+		ok          bool
+		score       float64
+	)
+	if !rows.Next() {
+		t.Fatalf("行がありません: %v", rows.Err())
+	}
+	if err := rows.Scan(&id, &price, &name, &note, &data, &c, &u, &ok, &score); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if id != math.MaxInt64 || price != "12.50" || name != "pen" || note != "メモ" || !ok || score != 1.5 {
+		t.Errorf("値が一致しません: %v %v %v %v %v %v", id, price, name, note, ok, score)
+	}
+	if !reflect.DeepEqual(data, []byte{0, 1, 0xff}) {
+		t.Errorf("BYTEA の値が一致しません: %v", data)
+	}
+	if !c.Equal(created) || !u.Equal(updated) || c.Location() != time.UTC {
+		t.Errorf("日付・時刻の値が一致しません: %v, %v", c, u)
+	}
+}
+
+func TestDriverNull(t *testing.T) {
+	db := openTestSQL(t, "", "CREATE TABLE items (id INT PRIMARY KEY, n INT, s TEXT, b BYTEA, d DATE, ok BOOLEAN)")
+	if _, err := db.Exec("INSERT INTO items VALUES (?, ?, ?, ?, ?, ?)", 1, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("NULL を追加できません: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO items VALUES (?, ?, ?, ?, ?, ?)",
+		2, sql.NullInt64{Int64: 7, Valid: true}, sql.NullString{}, []byte("x"), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), false); err != nil {
+		t.Fatalf("追加できません: %v", err)
+	}
+
+	tests := []struct {
+		id                   int
+		n                    sql.NullInt64
+		s                    sql.NullString
+		b                    []byte
+		d                    sql.NullTime
+		ok                   sql.NullBool
+		nValid, sValid, bNil bool
+	}{
+		{id: 1, bNil: true},
+		{id: 2, n: sql.NullInt64{Int64: 7, Valid: true}, b: []byte("x"), d: sql.NullTime{Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Valid: true}, ok: sql.NullBool{Valid: true}},
+	}
+	for _, tt := range tests {
+		var (
+			n  sql.NullInt64
+			s  sql.NullString
+			b  []byte
+			d  sql.NullTime
+			ok sql.NullBool
+		)
+		if err := db.QueryRow("SELECT n, s, b, d, ok FROM items WHERE id = ?", tt.id).Scan(&n, &s, &b, &d, &ok); err != nil {
+			t.Fatalf("id = %d: %v", tt.id, err)
+		}
+		if n != tt.n || s != tt.s || !reflect.DeepEqual(b, tt.b) || !d.Time.Equal(tt.d.Time) || d.Valid != tt.d.Valid || ok != tt.ok {
+			t.Errorf("id = %d: 値が一致しません: %v %v %v %v %v", tt.id, n, s, b, d, ok)
+		}
+	}
+
+	// NULL のパラメータとの比較は NULL（どの行にも一致しない）
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM items WHERE n = ?", nil).Scan(&count); err != nil || count != 0 {
+		t.Errorf("= NULL に一致する行がありました: %d, %v", count, err)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM items WHERE n IS NULL").Scan(&count); err != nil || count != 1 {
+		t.Errorf("IS NULL の行の数が一致しません: %d, %v", count, err)
+	}
+}
+
+func TestDriverContext(t *testing.T) {
+	db := openTestSQL(t, "", "CREATE TABLE users (id INT)", "INSERT INTO users VALUES (1)")
+
+	// 取り消したコンテキストでは実行しない
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.ExecContext(ctx, "INSERT INTO users VALUES (2)"); !errors.Is(err, context.Canceled) {
+		t.Errorf("取り消したコンテキストで実行できました: %v", err)
+	}
+
+	// ほかの接続のトランザクションが終わるのを待つ間に期限が切れたらやめる
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.QueryContext(ctx, "SELECT * FROM users WHERE id = ?", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("トランザクションを待つ間に期限が切れませんでした: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	var n int
+	if err := db.QueryRowContext(context.Background(), "SELECT count(*) FROM users").Scan(&n); err != nil || n != 1 {
+		t.Errorf("取り消した文の行が追加されています: %d, %v", n, err)
+	}
+}
+
+func TestDriverDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		check    func(db *database) bool // 開いたデータベースの設定を確かめる
+		errorMsg string                  // エラーメッセージに含まれるはずの文字列（エラーにならないなら空）
+	}{
+		{
+			name:    "既定の設定",
+			options: "",
+			check: func(db *database) bool {
+				return db.pool.syncMode == SyncFull && db.pool.pageSize == defaultPageSize && db.autoAnalyzeScale == defaultAutoAnalyzeScale
+			},
+		},
+		{
+			name:    "sync=off",
+			options: "sync=off",
+			check:   func(db *database) bool { return db.pool.syncMode == SyncOff && db.wal.syncMode == SyncOff },
+		},
+		{
+			name:    "sync=full と page_size・buffer_pool",
+			options: "sync=full&page_size=4096&buffer_pool=16",
+			check: func(db *database) bool {
+				return db.wal.syncMode == SyncFull && db.pool.pageSize == 4096 && db.pool.capacity == 16
+			},
+		},
+		{
+			name:    "auto_analyze=0 は自動 ANALYZE しない",
+			options: "auto_analyze=0",
+			check:   func(db *database) bool { return db.autoAnalyzeScale < 0 },
+		},
+		{
+			name:    "auto_analyze の割合",
+			options: "auto_analyze=0.5",
+			check:   func(db *database) bool { return db.autoAnalyzeScale == 0.5 },
+		},
+		{name: "sync の値が不正", options: "sync=normal", errorMsg: "full か off"},
+		{name: "page_size が整数でない", options: "page_size=big", errorMsg: "page_size 'big'"},
+		{name: "page_size が範囲外", options: "page_size=100", errorMsg: "ページサイズ 100"},
+		{name: "auto_analyze が数値でない", options: "auto_analyze=yes", errorMsg: "auto_analyze 'yes'"},
+		{name: "知らないパラメータ", options: "cache=on", errorMsg: "'cache' は不明"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := t.TempDir()
+			if tt.options != "" {
+				dsn += "?" + tt.options
+			}
+			db, err := sql.Open(DriverName, dsn)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("エラーメッセージに %s が含まれていません: %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("データベースを開けません: %v", err)
+			}
+			defer db.Close()
+
+			c, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatalf("接続できません: %v", err)
+			}
+			defer c.Close()
+			err = c.Raw(func(driverConn any) error {
+				if !tt.check(driverConn.(*conn).db.engine) {
+					t.Errorf("設定が一致しません")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Raw: %v", err)
+			}
+		})
+	}
+
+	t.Run("自動 ANALYZE は DSN の設定に従う", func(t *testing.T) {
+		for options, analyzed := range map[string]bool{"sync=off": true, "sync=off&auto_analyze=0": false} {
+			db := openTestSQL(t, options, "CREATE TABLE items (id INT)")
+			for i := 0; i < 60; i++ {
+				if _, err := db.Exec("INSERT INTO items VALUES (?)", i); err != nil {
+					t.Fatalf("INSERT: %v", err)
+				}
+			}
+			var n int
+			if err := db.QueryRow("SELECT count(*) FROM pg_stats WHERE tablename = 'items'").Scan(&n); err != nil {
+				t.Fatalf("pg_stats: %v", err)
+			}
+			if (n > 0) != analyzed {
+				t.Errorf("%s: 統計情報の行の数が一致しません: %d", options, n)
+			}
+		}
+	})
+
+	t.Run("同じデータディレクトリは 2 つの sql.DB で開けない", func(t *testing.T) {
+		dir := t.TempDir()
+		first, _ := sql.Open(DriverName, dir)
+		defer first.Close()
+		if err := first.Ping(); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		second, _ := sql.Open(DriverName, dir)
+		defer second.Close()
+		var locked *DataDirLockedError
+		if err := second.Ping(); !errors.As(err, &locked) {
+			t.Errorf("DataDirLockedError になりませんでした: %v", err)
+		}
+	})
+}
@@ -0,0 +1,661 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 物理演算子（Volcano 型のイテレータ）
+//
+// SELECT はプラン（物理演算子の木。plan.go で作る）にしてから実行する
+// どの演算子も Open → Next を nil が返るまで繰り返す → Close の順に呼ぶ。親の演算子は子の Next を呼んで 1 行ずつ受け取る
+// Sort と Aggregate 以外は受け取った行をすぐに親に渡すので全件をメモリに持たない（ORDER BY のない LIMIT は途中で読むのをやめる）
+// どの演算子もオプティマイザが見積もった行数とコスト（estimate）を持ち、EXPLAIN で表示する（explain.go）
+//
+//	Limit
+//	 └ Sort
+//	    └ Project / Aggregate
+//	       └ Filter
+//	          └ nestedLoopJoin
+//	             ├ seqScan / indexScan / rowsScan
+//	             └ seqScan / indexScan / rowsScan
+
+// operator - 物理演算子の共通のインターフェース
+type operator interface {
+	Open() error
+	Next() (*tuple, error) // 次の行（もうなければ nil）
+	Close() error
+}
+
+// tuple - 演算子の間を流れる行
+type tuple struct {
+	rows     []tableRow // FROM 句の各テーブルの行（scope.sources と同じ並び。まだ結合していないテーブルと LEFT JOIN で対応する行がなかったテーブルは nil）
+	values   []any      // SELECT 句の値（Project / Aggregate が入れる）
+	sortKeys []any      // ORDER BY のキーの値（Project / Aggregate が入れる）
+}
+
+// scope - FROM 句のテーブルの並び。式のカラム参照がどのテーブルのどのカラムかを解決する
+type scope struct {
+	sources []source
+}
+
+// source - FROM 句の 1 つのテーブル
+type source struct {
+	alias    string // 式でテーブルを指す名前（別名。なければテーブル名で、information_schema.tables なら tables）
+	tableDef *tableSchema
+}
+
+// newTuple - i 番目のテーブルの行だけを持つ tuple を作る
+func (sc *scope) newTuple(i int, row tableRow) *tuple {
+	rows := make([]tableRow, len(sc.sources))
+	rows[i] = row
+	return &tuple{rows: rows}
+}
+
+// env - tuple の行で式を評価する環境
+func (sc *scope) env(rows []tableRow) evalEnv {
+	return func(ref *columnRef) (any, error) {
+		i, pos, err := sc.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		// LEFT JOIN で対応する行がなかったテーブルのカラムは NULL
+		if rows[i] == nil {
+			return nil, nil
+		}
+		return decodeRowField(sc.sources[i].tableDef, rows[i], pos)
+	}
+}
+
+// resolve - カラム参照が何番目のテーブルの何番目のカラムかを返す
+// テーブル名（別名）のないカラム参照は、そのカラムを持つテーブルが 1 つだけのときに解決できる
+func (sc *scope) resolve(ref *columnRef) (int, int, error) {
+	if ref.Table != "" {
+		for i, src := range sc.sources {
+			if src.alias != ref.Table {
+				continue
+			}
+			pos := src.tableDef.ColumnIndex(ref.Name)
+			if pos < 0 {
+				return 0, 0, fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", ref.Name, src.tableDef.Name)
+			}
+			return i, pos, nil
+		}
+		return 0, 0, fmt.Errorf("テーブル '%s' は参照できません", ref.Table)
+	}
+
+	found, foundPos := -1, -1
+	for i, src := range sc.sources {
+		pos := src.tableDef.ColumnIndex(ref.Name)
+		if pos < 0 {
+			continue
+		}
+		if found >= 0 {
+			return 0, 0, fmt.Errorf("カラム '%s' は複数のテーブルにあります（テーブル名を付けてください）", ref.Name)
+		}
+		found, foundPos = i, pos
+	}
+	if found < 0 {
+		if len(sc.sources) == 1 {
+			return 0, 0, fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", ref.Name, sc.sources[0].tableDef.Name)
+		}
+		return 0, 0, fmt.Errorf("カラム '%s' は FROM 句のどのテーブルにも存在しません", ref.Name)
+	}
+	return found, foundPos, nil
+}
+
+// seqScan - テーブルのデータファイルを先頭から 1 行ずつ読む（filter があれば条件が TRUE になる行だけを返す）
+type seqScan struct {
+	estimate
+	scope     *scope
+	source    int      // scope.sources の何番目のテーブルか
+	filter    exprNode // 絞り込みの条件（nil なら全行）
+	pool      *bufferPool
+	cancelled func() error // 実行中の文が取り消されていればそのエラーを返す（database.cancelled。取り消されたら読むのをやめる）
+	reader    *rowReader
+	buffers   bufferUsage // 読んだページの数（EXPLAIN ANALYZE で表示する。開き直した分も足していく）
+}
+
+func (s *seqScan) Open() error {
+	reader, err := s.pool.OpenRowReader(s.scope.sources[s.source].tableDef.path)
+	if os.IsNotExist(err) {
+		return nil // データファイルがなければ 0 行
+	}
+	if err != nil {
+		return fmt.Errorf("データ読み込みエラー: %v", err)
+	}
+	s.reader = reader
+	return nil
+}
+
+func (s *seqScan) Next() (*tuple, error) {
+	if s.reader == nil {
+		return nil, nil
+	}
+	tableDef := s.scope.sources[s.source].tableDef
+	for {
+		if err := s.cancelled(); err != nil {
+			return nil, err
+		}
+		row, err := s.reader.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("データ読み込みエラー: %v", err)
+		}
+		t := s.scope.newTuple(s.source, normalizeRow(tableDef, row))
+		match, err := evalCondition(s.filter, s.scope.env(t.rows))
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			return t, nil
+		}
+	}
+}
+
+func (s *seqScan) Close() error {
+	if s.reader == nil {
+		return nil
+	}
+	reader := s.reader
+	s.reader = nil
+	s.buffers.add(reader.Buffers())
+	return reader.Close()
+}
+
+// indexScan - B+Tree インデックスで条件に合うキーの行の位置を探して、その行を読む（filter で残りの条件を確かめる）
+// キーの先頭から順に等価条件の値（eq）で絞り、その次のキーは範囲（lower / upper）で絞る
+// nestedLoopJoin の内側では eq の値に外側のテーブルのカラムを使える（外側の行ごとに検索し直す）
+type indexScan struct {
+	estimate
+	scope     *scope
+	source    int
+	index     *btree
+	eq        []exprNode // 先頭のキーから順の等価条件の値（定数・パラメータか外側のテーブルのカラム）
+	full      bool       // eq がキーのすべてか（SearchAll で引く）
+	lower     *keyBound  // eq の次のキーの下限（nil なら下限なし）
+	upper     *keyBound  // eq の次のキーの上限（nil なら上限なし）
+	filter    exprNode
+	pool      *bufferPool
+	cancelled func() error
+	outer     *tuple // nestedLoopJoin の外側の今の行
+	rows      []tableRow
+	next      int
+	buffers   bufferUsage // 読んだページの数
+}
+
+// keyBound - 範囲検索の端
+type keyBound struct {
+	value     exprNode
+	inclusive bool // 端の値を含むか
+}
+
+// parameterizedScan - nestedLoopJoin の外側の行の値で検索するスキャン
+type parameterizedScan interface {
+	setOuter(outer *tuple)
+}
+
+func (s *indexScan) setOuter(outer *tuple) {
+	s.outer = outer
+}
+
+func (s *indexScan) Open() error {
+	s.rows, s.next = nil, 0
+	positions, err := s.search()
+	if err != nil || len(positions) == 0 {
+		return err
+	}
+	tableDef := s.scope.sources[s.source].tableDef
+	rows, usage, err := s.pool.ReadRowsAt(tableDef.path, positions)
+	s.buffers.add(usage)
+	if err != nil {
+		return fmt.Errorf("レコード取得エラー: %v", err)
+	}
+	for i, row := range rows {
+		rows[i] = normalizeRow(tableDef, row)
+	}
+	s.rows = rows
+	return nil
+}
+
+// search - インデックスを引いて、条件に合うキーの行の位置を返す
+// = NULL・< NULL などはどの行にも一致しないので、値が NULL なら何も返さない
+func (s *indexScan) search() ([]int, error) {
+	env := noColumnsEnv("インデックスの検索キー")
+	if s.outer != nil {
+		env = s.scope.env(s.outer.rows)
+	}
+	var prefix strings.Builder
+	for _, e := range s.eq {
+		v, err := evalExpr(e, env)
+		if v == nil || err != nil {
+			return nil, err
+		}
+		if err := encodeKeyValue(&prefix, v); err != nil {
+			return nil, err
+		}
+	}
+	if s.full {
+		return s.index.SearchAll(prefix.String()), nil
+	}
+
+	// キーの後ろに別の値が続いていても範囲の内側・外側を正しく判定できるように、端の値のすぐ後ろを表す 0xFF を使う
+	// （値の先頭の型タグは 0xFF より小さい）。NULL のキーは最後に並ぶので、上限がなくても NULL の手前で止める
+	from := prefix.String()
+	to := prefix.String() + string(keyTagNull)
+	for _, bound := range []*keyBound{s.lower, s.upper} {
+		if bound == nil {
+			continue
+		}
+		v, err := evalExpr(bound.value, env)
+		if v == nil || err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		sb.WriteString(prefix.String())
+		if err := encodeKeyValue(&sb, v); err != nil {
+			return nil, err
+		}
+		key := sb.String()
+		if bound == s.lower {
+			from = key
+			if !bound.inclusive {
+				from += "\xff"
+			}
+		} else {
+			to = key
+			if bound.inclusive {
+				to += "\xff"
+			}
+		}
+	}
+	return s.index.SearchRange(from, true, to, false), nil
+}
+
+func (s *indexScan) Next() (*tuple, error) {
+	for s.next < len(s.rows) {
+		if err := s.cancelled(); err != nil {
+			return nil, err
+		}
+		t := s.scope.newTuple(s.source, s.rows[s.next])
+		s.next++
+		match, err := evalCondition(s.filter, s.scope.env(t.rows))
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *indexScan) Close() error {
+	s.rows = nil
+	return nil
+}
+
+// rowsScan - メモリ上の行を順に返す（システムビューの行、RETURNING で返す行）
+// 行は現在のカラムの並びになっているものとする（normalizeRow しない）
+type rowsScan struct {
+	estimate
+	scope  *scope
+	source int
+	rows   []tableRow
+	filter exprNode
+	next   int
+}
+
+func (s *rowsScan) Open() error {
+	s.next = 0
+	return nil
+}
+
+func (s *rowsScan) Next() (*tuple, error) {
+	for s.next < len(s.rows) {
+		t := s.scope.newTuple(s.source, s.rows[s.next])
+		s.next++
+		match, err := evalCondition(s.filter, s.scope.env(t.rows))
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *rowsScan) Close() error {
+	return nil
+}
+
+// filter - 子の行のうち条件が TRUE になる行だけを返す
+type filter struct {
+	estimate
+	scope *scope
+	child operator
+	cond  exprNode
+}
+
+func (f *filter) Open() error {
+	return f.child.Open()
+}
+
+func (f *filter) Next() (*tuple, error) {
+	for {
+		t, err := f.child.Next()
+		if t == nil || err != nil {
+			return nil, err
+		}
+		match, err := evalCondition(f.cond, f.scope.env(t.rows))
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			return t, nil
+		}
+	}
+}
+
+func (f *filter) Close() error {
+	return f.child.Close()
+}
+
+// nestedLoopJoin - 外側（left）の 1 行ごとに内側（right）を開き直して最初から読み、on の条件が TRUE になる組み合わせを返す
+// LEFT JOIN では、内側に一致する行が 1 つもなかった外側の行を、内側のテーブルのカラムを NULL にして返す
+type nestedLoopJoin struct {
+	estimate
+	scope     *scope
+	kind      string // INNER / LEFT / CROSS
+	left      operator
+	right     operator
+	on        exprNode // 結合条件（CROSS JOIN は nil）
+	outer     *tuple   // 今の外側の行（nil なら次の外側の行を読む）
+	matched   bool     // 今の外側の行に一致する内側の行があったか
+	innerOpen bool
+}
+
+func (j *nestedLoopJoin) Open() error {
+	j.outer = nil
+	return j.left.Open()
+}
+
+func (j *nestedLoopJoin) Next() (*tuple, error) {
+	for {
+		if j.outer == nil {
+			outer, err := j.left.Next()
+			if outer == nil || err != nil {
+				return nil, err
+			}
+			j.outer, j.matched = outer, false
+			if p, ok := j.right.(parameterizedScan); ok {
+				p.setOuter(outer)
+			}
+			j.innerOpen = true
+			if err := j.right.Open(); err != nil {
+				return nil, err
+			}
+		}
+
+		inner, err := j.right.Next()
+		if err != nil {
+			return nil, err
+		}
+		if inner == nil {
+			j.innerOpen = false
+			if err := j.right.Close(); err != nil {
+				return nil, err
+			}
+			outer := j.outer
+			j.outer = nil
+			if j.kind == "LEFT" && !j.matched {
+				return outer, nil
+			}
+			continue
+		}
+
+		t := joinTuples(j.outer, inner)
+		match, err := evalCondition(j.on, j.scope.env(t.rows))
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			j.matched = true
+			return t, nil
+		}
+	}
+}
+
+func (j *nestedLoopJoin) Close() error {
+	if j.innerOpen {
+		j.innerOpen = false
+		j.right.Close()
+	}
+	return j.left.Close()
+}
+
+// joinTuples - 2 つの tuple の行を 1 つにまとめる（どちらにも同じテーブルの行はない）
+func joinTuples(left, right *tuple) *tuple {
+	rows := make([]tableRow, len(left.rows))
+	for i := range rows {
+		rows[i] = left.rows[i]
+		if right.rows[i] != nil {
+			rows[i] = right.rows[i]
+		}
+	}
+	return &tuple{rows: rows}
+}
+
+// project - 子の行ごとに SELECT 句の値と ORDER BY のキーを計算する（集約しない SELECT）
+type project struct {
+	estimate
+	scope          *scope
+	child          operator
+	items          []selectItem
+	orderBy        []orderByItem
+	orderPositions []int // ORDER BY の各項目が指す出力の列（式として評価する場合は -1）
+}
+
+func (p *project) Open() error {
+	return p.child.Open()
+}
+
+func (p *project) Next() (*tuple, error) {
+	t, err := p.child.Next()
+	if t == nil || err != nil {
+		return nil, err
+	}
+	env := p.scope.env(t.rows)
+	eval := func(e exprNode) (any, error) {
+		return evalExpr(e, env)
+	}
+	if err := setOutputValues(t, p.items, p.orderBy, p.orderPositions, eval); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (p *project) Close() error {
+	return p.child.Close()
+}
+
+// aggregate - 子の行を全部読んで GROUP BY の値ごとにまとめ、グループごとに SELECT 句の値と ORDER BY のキーを計算する
+type aggregate struct {
+	estimate
+	scope          *scope
+	child          operator
+	groupBy        []exprNode
+	items          []selectItem
+	orderBy        []orderByItem
+	orderPositions []int
+	out            []*tuple
+	next           int
+}
+
+func (a *aggregate) Open() error {
+	if err := a.child.Open(); err != nil {
+		return err
+	}
+
+	// GROUP BY の値が同じ行を 1 つのグループにまとめる（NULL 同士も同じグループ、グループの順番は最初に現れた順）
+	// グループのキーはインデックスと同じエンコードを使う
+	var groups [][]*tuple
+	groupIndex := make(map[string]int)
+	for {
+		t, err := a.child.Next()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			break
+		}
+		env := a.scope.env(t.rows)
+		var sb strings.Builder
+		for _, e := range a.groupBy {
+			v, err := evalExpr(e, env)
+			if err != nil {
+				return err
+			}
+			if err := encodeKeyValue(&sb, v); err != nil {
+				return err
+			}
+		}
+		key := sb.String()
+		i, ok := groupIndex[key]
+		if !ok {
+			i = len(groups)
+			groupIndex[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], t)
+	}
+	// GROUP BY がなければ、行が 0 件でも全体で 1 グループ（SELECT count(*) FROM t WHERE ... が 0 を返す）
+	if len(a.groupBy) == 0 && len(groups) == 0 {
+		groups = append(groups, nil)
+	}
+
+	a.out, a.next = nil, 0
+	for _, group := range groups {
+		env := noColumnsEnv("集約の結果")
+		if len(group) > 0 {
+			// GROUP BY のカラムはグループ内のどの行でも同じ値なので、先頭の行で評価する
+			env = a.scope.env(group[0].rows)
+		}
+		eval := func(e exprNode) (any, error) {
+			e, err := replaceAggregates(e, func(call *funcCall) (any, error) {
+				return evalAggregate(a.scope, call, group)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := checkGrouped(e, a.groupBy); err != nil {
+				return nil, err
+			}
+			return evalExpr(e, env)
+		}
+		t := &tuple{}
+		if err := setOutputValues(t, a.items, a.orderBy, a.orderPositions, eval); err != nil {
+			return err
+		}
+		a.out = append(a.out, t)
+	}
+	return nil
+}
+
+func (a *aggregate) Next() (*tuple, error) {
+	if a.next >= len(a.out) {
+		return nil, nil
+	}
+	t := a.out[a.next]
+	a.next++
+	return t, nil
+}
+
+func (a *aggregate) Close() error {
+	a.out = nil
+	return a.child.Close()
+}
+
+// sortOp - 子の行を全部読んで ORDER BY のキーで並べ替える
+type sortOp struct {
+	estimate
+	child   operator
+	orderBy []orderByItem
+	sorted  []*tuple
+	next    int
+}
+
+func (s *sortOp) Open() error {
+	if err := s.child.Open(); err != nil {
+		return err
+	}
+	s.sorted, s.next = nil, 0
+	for {
+		t, err := s.child.Next()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			break
+		}
+		s.sorted = append(s.sorted, t)
+	}
+	return sortTuples(s.sorted, s.orderBy)
+}
+
+func (s *sortOp) Next() (*tuple, error) {
+	if s.next >= len(s.sorted) {
+		return nil, nil
+	}
+	t := s.sorted[s.next]
+	s.next++
+	return t, nil
+}
+
+func (s *sortOp) Close() error {
+	s.sorted = nil
+	return s.child.Close()
+}
+
+// limit - 子の行の先頭 offset 行を読み飛ばし、limit 行を返したらそれ以上は子を読まない
+type limit struct {
+	estimate
+	child    operator
+	limit    *int64 // nil なら制限なし
+	offset   int64
+	skipped  int64
+	returned int64
+}
+
+func (l *limit) Open() error {
+	l.skipped, l.returned = 0, 0
+	return l.child.Open()
+}
+
+func (l *limit) Next() (*tuple, error) {
+	for l.skipped < l.offset {
+		t, err := l.child.Next()
+		if t == nil || err != nil {
+			return nil, err
+		}
+		l.skipped++
+	}
+	if l.limit != nil && l.returned >= *l.limit {
+		return nil, nil
+	}
+	t, err := l.child.Next()
+	if t == nil || err != nil {
+		return nil, err
+	}
+	l.returned++
+	return t, nil
+}
+
+func (l *limit) Close() error {
+	return l.child.Close()
+}
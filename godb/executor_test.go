@@ -0,0 +1,1085 @@
+package godb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dataFileLines - テーブルのデータファイルの各行（ファイルに書いたままの文字列）
+func dataFileLines(t *testing.T, dir, table string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, baseDirName, table+".db"))
+	if err != nil {
+		t.Fatalf("データファイルを読めません: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// rowVersions - テーブルのデータファイルの各行のスキーマの版（\V<n> の部分。版のない行は空）
+func rowVersions(t *testing.T, dir, table string) []string {
+	t.Helper()
+	versions := []string{}
+	for _, line := range dataFileLines(t, dir, table) {
+		version := ""
+		if strings.HasPrefix(line, rowVersionPrefix) {
+			version = strings.SplitN(line, ",", 2)[0]
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestExecuteSchemaVersions(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, &Options{SyncMode: SyncOff})
+	if err != nil {
+		t.Fatalf("データベースを開けません: %v", err)
+	}
+	defer func() { db.Close() }()
+
+	// 手順は順番に実行する（前の手順で作った行を次の手順で読む）
+	steps := []struct {
+		name     string
+		sql      string
+		expected [][]string // 実行後の SELECT * FROM items ORDER BY id
+		versions []string   // 実行後のデータファイルの各行の版（nil なら確かめない）
+		errorMsg string     // エラーメッセージに含まれるはずの文字列（エラーにならないなら空）
+	}{
+		{
+			name:     "版 1 の行",
+			sql:      "CREATE TABLE items (id INT, a TEXT); INSERT INTO items VALUES (1, 'x')",
+			expected: [][]string{{"1", "x"}},
+			versions: []string{`\V1`},
+		},
+		{
+			name:     "ADD COLUMN は既存の行を書き直さず DEFAULT で補う",
+			sql:      "ALTER TABLE items ADD COLUMN b INT DEFAULT 7; INSERT INTO items VALUES (2, 'y', 8)",
+			expected: [][]string{{"1", "x", "7"}, {"2", "y", "8"}},
+			versions: []string{`\V1`, `\V2`},
+		},
+		{
+			name:     "DROP COLUMN は既存の行を書き直さず読み飛ばす",
+			sql:      "ALTER TABLE items DROP COLUMN a; INSERT INTO items VALUES (3, 9)",
+			expected: [][]string{{"1", "7"}, {"2", "8"}, {"3", "9"}},
+			versions: []string{`\V1`, `\V2`, `\V3`},
+		},
+		{
+			name:     "同じ名前で追加し直しても削除したカラムの値は出てこない",
+			sql:      "ALTER TABLE items ADD COLUMN a TEXT; INSERT INTO items VALUES (4, 10, 'z')",
+			expected: [][]string{{"1", "7", "NULL"}, {"2", "8", "NULL"}, {"3", "9", "NULL"}, {"4", "10", "z"}},
+			versions: []string{`\V1`, `\V2`, `\V3`, `\V4`},
+		},
+		{
+			name:     "削除したカラムは参照できない",
+			sql:      "SELECT c FROM items",
+			errorMsg: "'c'",
+		},
+		{
+			name:     "UPDATE で全行を今の版で書き直す",
+			sql:      "UPDATE items SET b = b + 1 WHERE id = 1",
+			expected: [][]string{{"1", "8", "NULL"}, {"2", "8", "NULL"}, {"3", "9", "NULL"}, {"4", "10", "z"}},
+			versions: []string{`\V4`, `\V4`, `\V4`, `\V4`},
+		},
+		{
+			name:     "最後のカラムは削除できない",
+			sql:      "ALTER TABLE items DROP COLUMN a; ALTER TABLE items DROP COLUMN b; ALTER TABLE items DROP COLUMN id",
+			errorMsg: "最後のカラム",
+		},
+	}
+
+	for _, step := range steps {
+		for _, stmt := range strings.Split(step.sql, "; ") {
+			if _, err = db.Exec(stmt); err != nil {
+				break
+			}
+		}
+
+		if step.errorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), step.errorMsg) {
+				t.Fatalf("%s: エラーメッセージに %s が含まれていません: %v", step.name, step.errorMsg, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: 予期しないエラー: %v", step.name, err)
+		}
+		if rows := queryRows(t, db, "SELECT * FROM items ORDER BY id"); !reflect.DeepEqual(rows, step.expected) {
+			t.Errorf("%s: 結果が一致しません。期待: %v, 実際: %v", step.name, step.expected, rows)
+		}
+		if versions := rowVersions(t, dir, "items"); step.versions != nil && !reflect.DeepEqual(versions, step.versions) {
+			t.Errorf("%s: 行の版が一致しません。期待: %v, 実際: %v", step.name, step.versions, versions)
+		}
+	}
+}
+
+func TestExecuteUnversionedRows(t *testing.T) {
+	// 版を付ける前に書いた行（\V<n> のない行）は版 1 として読み、開き直しても同じ値になる
+	dir := t.TempDir()
+	db, err := Open(dir, &Options{SyncMode: SyncOff})
+	if err != nil {
+		t.Fatalf("データベースを開けません: %v", err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE items (id INT, a TEXT)",
+		"INSERT INTO items VALUES (1, 'x')",
+		"ALTER TABLE items ADD COLUMN b INT DEFAULT 7",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("閉じられません: %v", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, baseDirName, "items.db"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("データファイルを開けません: %v", err)
+	}
+	if _, err := f.WriteString("2,old\n"); err != nil {
+		t.Fatalf("データファイルに書けません: %v", err)
+	}
+	f.Close()
+
+	db, err = Open(dir, &Options{SyncMode: SyncOff})
+	if err != nil {
+		t.Fatalf("データベースを開き直せません: %v", err)
+	}
+	defer db.Close()
+	expected := [][]string{{"1", "x", "7"}, {"2", "old", "7"}}
+	if rows := queryRows(t, db, "SELECT * FROM items ORDER BY id"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("結果が一致しません。期待: %v, 実際: %v", expected, rows)
+	}
+	if versions := rowVersions(t, dir, "items"); !reflect.DeepEqual(versions, []string{`\V1`, ""}) {
+		t.Errorf("行の版が一致しません: %v", versions)
+	}
+}
+
+func TestExecuteAddColumnRewrite(t *testing.T) {
+	// DEFAULT が nextval のカラムを追加すると全行を書き直す
+	// 書き直した行は別のファイルに書き、カタログの変更と一緒にデータファイルと入れ替える（名前の重なるテーブルは壊さない）
+	dir := t.TempDir()
+	db := openTestDBAt(t, dir,
+		"CREATE TABLE items (id INT)",
+		"INSERT INTO items VALUES (1), (2)",
+		"CREATE TABLE other (id INT)",
+		"INSERT INTO other VALUES (9)",
+		`ALTER TABLE other RENAME TO "items.rewrite"`,
+		"CREATE SEQUENCE s",
+		"ALTER TABLE items ADD COLUMN n INT DEFAULT nextval('s')",
+	)
+	expected := [][]string{{"1", "1"}, {"2", "2"}}
+	if rows := queryRows(t, db, "SELECT * FROM items ORDER BY id"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("結果が一致しません。期待: %v, 実際: %v", expected, rows)
+	}
+	if versions := rowVersions(t, dir, "items"); !reflect.DeepEqual(versions, []string{`\V2`, `\V2`}) {
+		t.Errorf("行の版が一致しません: %v", versions)
+	}
+	if rows := queryRows(t, db, `SELECT * FROM "items.rewrite"`); !reflect.DeepEqual(rows, [][]string{{"9"}}) {
+		t.Errorf("名前の重なるテーブルが変わりました: %v", rows)
+	}
+	if fileExists(filepath.Join(dir, baseDirName, "items.rewrite_.db")) {
+		t.Errorf("書き直した行のファイルが残っています")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("閉じられません: %v", err)
+	}
+
+	db = openTestDBAt(t, dir)
+	if rows := queryRows(t, db, "SELECT * FROM items ORDER BY id"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("開き直したあとの結果が一致しません。期待: %v, 実際: %v", expected, rows)
+	}
+}
+
+func TestToastRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docs")
+	w := newToastWriter(path, 4)
+	row := tableRow{"abcd", "abcdefg", `\T9:1`, "xyz12"}
+	toasted, err := w.toastRow(row)
+	if err != nil {
+		t.Fatalf("toastRow: %v", err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// しきい値以下のフィールドと既にポインタのフィールドはそのまま。元の行は変えない
+	expected := tableRow{"abcd", `\T0:7`, `\T9:1`, `\T7:5`}
+	if !reflect.DeepEqual(toasted, expected) {
+		t.Errorf("ポインタが一致しません。期待: %v, 実際: %v", expected, toasted)
+	}
+	if !reflect.DeepEqual(row, tableRow{"abcd", "abcdefg", `\T9:1`, "xyz12"}) {
+		t.Errorf("元の行が変わりました: %v", row)
+	}
+
+	// 次の書き込みはサイドファイルの末尾から続ける
+	w = newToastWriter(path, 4)
+	again, err := w.toastRow(tableRow{"hello"})
+	if err != nil {
+		t.Fatalf("toastRow: %v", err)
+	}
+	w.close()
+	if again[0] != `\T12:5` {
+		t.Errorf("追記した位置が一致しません: %s", again[0])
+	}
+
+	tests := []struct {
+		field    string
+		expected string
+		hasError bool
+	}{
+		{field: "abcd", expected: "abcd"},
+		{field: `\T0:7`, expected: "abcdefg"},
+		{field: `\T7:5`, expected: "xyz12"},
+		{field: `\T12:5`, expected: "hello"},
+		{field: `\Tx:1`, hasError: true},
+		{field: `\T0`, hasError: true},
+		{field: `\T15:10`, hasError: true}, // サイドファイルの外
+	}
+	for _, tt := range tests {
+		value, err := detoast(path, tt.field)
+		if tt.hasError {
+			if err == nil {
+				t.Errorf("%s: エラーが期待されましたが、成功しました: %s", tt.field, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: 予期しないエラー: %v", tt.field, err)
+		} else if value != tt.expected {
+			t.Errorf("%s: 値が一致しません。期待: %s, 実際: %s", tt.field, tt.expected, value)
+		}
+	}
+}
+
+func TestExecuteToast(t *testing.T) {
+	// toastThreshold（ページの 1/4）を超える値は docs.toast に追い出し、データファイルには \T<オフセット>:<長さ> だけを書く
+	dir := t.TempDir()
+	toastFile := filepath.Join(dir, baseDirName, "docs.toast")
+	big := strings.Repeat("a", defaultPageSize/4+1)
+	pointer := fmt.Sprintf(`\T0:%d`, len(big))
+	db := openTestDBAt(t, dir,
+		"CREATE TABLE docs (id INT, title TEXT, body TEXT)",
+		"INSERT INTO docs VALUES (1, 'short', '"+big+"'), (2, '\\Tnot a pointer', 'small')",
+	)
+	// 本物の TEXT の値が \T で始まっていても、\ を足して保存するのでポインタとは区別できる
+	expected := []string{`\V1,1,short,` + pointer, `\V1,2,\\Tnot a pointer,small`}
+	if lines := dataFileLines(t, dir, "docs"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("データファイルが一致しません。期待: %v, 実際: %v", expected, lines)
+	}
+	toastSize := func() int64 {
+		t.Helper()
+		info, err := os.Stat(toastFile)
+		if err != nil {
+			t.Fatalf("サイドファイルがありません: %v", err)
+		}
+		return info.Size()
+	}
+	if size := toastSize(); size != int64(len(big)) {
+		t.Errorf("サイドファイルの大きさが一致しません: %d", size)
+	}
+
+	// 大きなカラムを変えない UPDATE はポインタのまま書き直す（本体をコピーしない）
+	if _, err := db.Exec("UPDATE docs SET title = 'long' WHERE id = 1"); err != nil {
+		t.Fatalf("UPDATE: %v", err)
+	}
+	if lines := dataFileLines(t, dir, "docs"); !strings.HasSuffix(lines[0], ",long,"+pointer) {
+		t.Errorf("更新した行がポインタを持っていません: %s", lines[0])
+	}
+	if size := toastSize(); size != int64(len(big)) {
+		t.Errorf("変えていない値がコピーされました（サイドファイルの大きさ: %d）", size)
+	}
+
+	// 取り消したトランザクションで追い出した値はサイドファイルから切り詰める
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("トランザクションを開始できません: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO docs VALUES (3, 'tx', '" + big + "')"); err != nil {
+		t.Fatalf("INSERT: %v", err)
+	}
+	if size := toastSize(); size != int64(2*len(big)) {
+		t.Errorf("サイドファイルに追記されていません（大きさ: %d）", size)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if size := toastSize(); size != int64(len(big)) {
+		t.Errorf("Rollback でサイドファイルが戻っていません（大きさ: %d）", size)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("閉じられません: %v", err)
+	}
+
+	db = openTestDBAt(t, dir)
+	expectedRows := [][]string{{"1", "long", big}, {"2", `\Tnot a pointer`, "small"}}
+	if rows := queryRows(t, db, "SELECT * FROM docs ORDER BY id"); !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("開き直したあとの結果が一致しません: %v", rows)
+	}
+
+	// 選ばないカラムの本体は読まない（サイドファイルを空にしても、大きなカラム以外は読める）
+	if err := os.Truncate(toastFile, 0); err != nil {
+		t.Fatalf("サイドファイルを切り詰められません: %v", err)
+	}
+	expectedRows = [][]string{{"1", "long"}}
+	if rows := queryRows(t, db, "SELECT id, title FROM docs WHERE title = 'long'"); !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("大きなカラムを選ばない結果が一致しません: %v", rows)
+	}
+	if _, err := db.Query("SELECT body FROM docs WHERE id = 1"); err == nil {
+		t.Errorf("空のサイドファイルから値を読めました")
+	}
+}
+
+func TestExplainIndexAndJoinConditions(t *testing.T) {
+	db := openTestDB(t,
+		"CREATE TABLE a (id INT PRIMARY KEY, x INT)",
+		"CREATE TABLE b (id INT PRIMARY KEY, a_id INT)",
+		"CREATE TABLE c (id INT PRIMARY KEY, b_id INT)",
+	)
+	for _, table := range []string{"a", "b", "c"} {
+		var values []string
+		for i := 0; i < 200; i++ {
+			values = append(values, fmt.Sprintf("(%d, %d)", i, i))
+		}
+		if _, err := db.Exec("INSERT INTO " + table + " VALUES " + strings.Join(values, ", ")); err != nil {
+			t.Fatalf("%s に追加できません: %v", table, err)
+		}
+	}
+	if _, err := db.Exec("ANALYZE"); err != nil {
+		t.Fatalf("ANALYZE: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		contains []string // EXPLAIN の結果に含まれるはずの行
+		excludes []string // EXPLAIN の結果に含まれないはずの文字列
+	}{
+		{
+			name:     "Index Cond の条件は Filter に出さない",
+			sql:      "SELECT * FROM a WHERE id = 1 AND x = 1",
+			contains: []string{"Index Cond: (id = 1)", "Filter: (x = 1)"},
+			excludes: []string{"Filter: ((id = 1)"},
+		},
+		{
+			name:     "インデックスを引くのに使った結合の条件は Join Filter に出さない",
+			sql:      "SELECT * FROM a JOIN b ON b.a_id = a.id",
+			contains: []string{"Index Cond: (id = b.a_id)"},
+			excludes: []string{"Join Filter"},
+		},
+		{
+			name:     "外側で評価済みの条件を結合でもう一度評価しない",
+			sql:      "SELECT * FROM a JOIN b ON b.a_id = a.id JOIN c ON c.b_id = b.id",
+			contains: []string{"rows=200)\n  Output:"}, // 結合した結果の行数の推定が 200 行（選択率を二重に掛けると 1 行になる）
+			excludes: []string{"Join Filter"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := ""
+			for _, row := range queryRows(t, db, "EXPLAIN "+tt.sql) {
+				plan += row[0] + "\n"
+			}
+			for _, line := range tt.contains {
+				if !strings.Contains(plan, line) {
+					t.Errorf("%s が含まれていません:\n%s", line, plan)
+				}
+			}
+			for _, text := range tt.excludes {
+				if strings.Contains(plan, text) {
+					t.Errorf("%s が含まれています:\n%s", text, plan)
+				}
+			}
+		})
+	}
+}
+
+func TestExplainIndexFetchCost(t *testing.T) {
+	// インデックスの値は行の位置で、データファイルを先頭からその位置まで読むので、後ろの行ほど高くなる
+	db := openTestDB(t, "CREATE TABLE items (id INT PRIMARY KEY, name TEXT)")
+	var values []string
+	for i := 0; i < 5000; i++ {
+		values = append(values, fmt.Sprintf("(%d, 'item %d')", i, i))
+	}
+	if _, err := db.Exec("INSERT INTO items VALUES " + strings.Join(values, ", ")); err != nil {
+		t.Fatalf("追加できません: %v", err)
+	}
+
+	cost := func(sql string) float64 {
+		t.Helper()
+		res, err := db.Query("EXPLAIN (FORMAT JSON) " + sql)
+		if err != nil || !res.Next() {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var plans []struct {
+			Plan struct {
+				TotalCost float64 `json:"Total Cost"`
+				Plans     []struct {
+					NodeType string `json:"Node Type"`
+				} `json:"Plans"`
+			}
+		}
+		if err := json.Unmarshal([]byte(FormatValue(res.Values()[0])), &plans); err != nil {
+			t.Fatalf("EXPLAIN の JSON を読めません: %v", err)
+		}
+		if len(plans[0].Plan.Plans) == 0 || plans[0].Plan.Plans[0].NodeType != "Index Scan" {
+			t.Fatalf("%s: Index Scan になりませんでした: %+v", sql, plans)
+		}
+		return plans[0].Plan.TotalCost
+	}
+	first, last := cost("SELECT * FROM items WHERE id = 0"), cost("SELECT * FROM items WHERE id = 4999")
+	if first >= 1 || last <= 10*first {
+		t.Errorf("先頭の行と最後の行のコストが一致しません: id = 0 は %v, id = 4999 は %v", first, last)
+	}
+}
+
+func TestExecuteInsert(t *testing.T) {
+	setup := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT NOT NULL, age INT DEFAULT 20 CHECK (age >= 0))",
+		"INSERT INTO users VALUES (1, 'Alice', 30), (2, 'Bob', 25)",
+	}
+	original := [][]string{{"1", "Alice", "30"}, {"2", "Bob", "25"}}
+	tests := []struct {
+		name     string
+		sql      string
+		expected [][]string // 実行後の users の全行（id 順）
+		hasError bool
+	}{
+		{
+			name:     "カラムを表の順と違う順に一部だけ指定する",
+			sql:      "INSERT INTO users (name, id) VALUES ('Carol', 3)",
+			expected: [][]string{{"1", "Alice", "30"}, {"2", "Bob", "25"}, {"3", "Carol", "20"}},
+		},
+		{
+			name:     "同じテーブルから SELECT して追加する（追加した行は読まない）",
+			sql:      "INSERT INTO users (id, name, age) SELECT id + 10, name, age + 1 FROM users",
+			expected: [][]string{{"1", "Alice", "30"}, {"2", "Bob", "25"}, {"11", "Alice", "31"}, {"12", "Bob", "26"}},
+		},
+		{
+			name:     "後ろの行が NOT NULL 制約に違反したら 1 行も追加しない",
+			sql:      "INSERT INTO users VALUES (3, 'Carol', 20), (4, NULL, 20)",
+			hasError: true,
+		},
+		{
+			name:     "後ろの行が CHECK 制約に違反したら 1 行も追加しない",
+			sql:      "INSERT INTO users VALUES (3, 'Carol', 20), (4, 'Dave', -1)",
+			hasError: true,
+		},
+		{
+			name:     "同じ文の中で主キーが重複したら 1 行も追加しない",
+			sql:      "INSERT INTO users VALUES (3, 'Carol', 20), (3, 'Dave', 20)",
+			hasError: true,
+		},
+		{
+			name:     "後ろの行が既存の行と主キーが重複したら 1 行も追加しない",
+			sql:      "INSERT INTO users VALUES (3, 'Carol', 20), (1, 'Dave', 20)",
+			hasError: true,
+		},
+		{
+			name:     "後ろの行の型が合わなければ 1 行も追加しない",
+			sql:      "INSERT INTO users VALUES (3, 'Carol', 20), (4, 'Dave', 'old')",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, setup...)
+			_, err := db.Exec(tt.sql)
+
+			expected := tt.expected
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				expected = original
+			} else if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, expected) {
+				t.Errorf("結果が一致しません。期待: %v, 実際: %v", expected, rows)
+			}
+			// 追加しなかった行のキーはインデックスにも残らない
+			if _, err := db.Exec("INSERT INTO users VALUES (3, 'Carol', 20)"); tt.hasError && err != nil {
+				t.Errorf("エラーになった文の行のキーが残っています: %v", err)
+			}
+		})
+	}
+}
+
+func TestExecuteOnConflict(t *testing.T) {
+	setup := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE, name TEXT, visits INT DEFAULT 0)",
+		"INSERT INTO users VALUES (1, 'a@example.com', 'Alice', 1), (2, 'b@example.com', 'Bob', 1)",
+	}
+	tests := []struct {
+		name     string
+		sql      string
+		expected [][]string // 実行後の users の全行（id 順）
+		returned [][]string // RETURNING の結果
+		hasError bool
+	}{
+		{
+			name:     "DO NOTHING で重複した行だけ追加しない",
+			sql:      "INSERT INTO users VALUES (1, 'x@example.com', 'X', 0), (3, 'c@example.com', 'Carol', 0) ON CONFLICT (id) DO NOTHING",
+			expected: [][]string{{"1", "a@example.com", "Alice", "1"}, {"2", "b@example.com", "Bob", "1"}, {"3", "c@example.com", "Carol", "0"}},
+		},
+		{
+			name:     "対象なしの DO NOTHING はすべての一意制約で判定",
+			sql:      "INSERT INTO users VALUES (3, 'b@example.com', 'Bob2', 0) ON CONFLICT DO NOTHING",
+			expected: [][]string{{"1", "a@example.com", "Alice", "1"}, {"2", "b@example.com", "Bob", "1"}},
+		},
+		{
+			name:     "DO UPDATE と EXCLUDED",
+			sql:      "INSERT INTO users (id, name) VALUES (1, 'Alicia') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, visits = users.visits + 1 RETURNING id, name, visits",
+			expected: [][]string{{"1", "a@example.com", "Alicia", "2"}, {"2", "b@example.com", "Bob", "1"}},
+			returned: [][]string{{"1", "Alicia", "2"}},
+		},
+		{
+			name:     "DO UPDATE の WHERE が偽なら更新しない",
+			sql:      "INSERT INTO users (id, name) VALUES (2, 'Bobby') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name WHERE users.visits > 1 RETURNING id",
+			expected: [][]string{{"1", "a@example.com", "Alice", "1"}, {"2", "b@example.com", "Bob", "1"}},
+		},
+		{
+			name:     "ON CONSTRAINT で一意制約を指定",
+			sql:      "INSERT INTO users VALUES (3, 'a@example.com', 'A', 0) ON CONFLICT ON CONSTRAINT users_email_key DO UPDATE SET visits = 9",
+			expected: [][]string{{"1", "a@example.com", "Alice", "9"}, {"2", "b@example.com", "Bob", "1"}},
+		},
+		{
+			name:     "対象でない一意制約との重複はエラー",
+			sql:      "INSERT INTO users VALUES (3, 'a@example.com', 'A', 0) ON CONFLICT (id) DO NOTHING",
+			hasError: true,
+		},
+		{
+			name:     "同じ文で同じ行を 2 回更新するとエラー",
+			sql:      "INSERT INTO users (id, name) VALUES (1, 'A'), (1, 'B') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name",
+			hasError: true,
+		},
+		{
+			name:     "一意制約のないカラムを対象にするとエラー",
+			sql:      "INSERT INTO users VALUES (1, 'x@example.com', 'X', 0) ON CONFLICT (name) DO NOTHING",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, setup...)
+			res, err := db.Exec(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				// エラーになった文は何も変えない
+				if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); len(rows) != 2 || rows[0][2] != "Alice" {
+					t.Errorf("エラーになった文で行が変わりました: %v", rows)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if returned := resultRows(res); !reflect.DeepEqual(returned, tt.returned) {
+				t.Errorf("RETURNING が一致しません。期待: %v, 実際: %v", tt.returned, returned)
+			}
+			if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, tt.expected) {
+				t.Errorf("結果が一致しません。期待: %v, 実際: %v", tt.expected, rows)
+			}
+		})
+	}
+}
+
+// openTestDB - 一時ディレクトリにデータベースを作り、stmts を順に実行する（テストの終わりに閉じる）
+func openTestDB(t *testing.T, stmts ...string) *DB {
+	t.Helper()
+	return openTestDBAt(t, t.TempDir(), stmts...)
+}
+
+// openTestDBAt - データディレクトリ dir のデータベースを開き、stmts を順に実行する（テストの終わりに閉じる）
+func openTestDBAt(t *testing.T, dir string, stmts ...string) *DB {
+	t.Helper()
+	db, err := Open(dir, &Options{SyncMode: SyncOff})
+	if err != nil {
+		t.Fatalf("データベースを開けません: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+// queryRows - SELECT を実行して、結果の行の値を FormatValue で文字列にして返す
+func queryRows(t *testing.T, db *DB, query string) [][]string {
+	t.Helper()
+	res, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return resultRows(res)
+}
+
+// resultRows - 結果の行の値を FormatValue で文字列にして返す
+func resultRows(res *Result) [][]string {
+	var rows [][]string
+	for res.Next() {
+		var row []string
+		for _, v := range res.Values() {
+			row = append(row, FormatValue(v))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestExecuteForeignKeys(t *testing.T) {
+	setup := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE posts (id INT PRIMARY KEY, user_id INT REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE)",
+		"CREATE TABLE likes (id INT PRIMARY KEY, user_id INT REFERENCES users(id) ON DELETE SET NULL ON UPDATE SET NULL)",
+		"CREATE TABLE follows (id INT PRIMARY KEY, user_id INT REFERENCES users(id) ON DELETE RESTRICT)",
+		"INSERT INTO users VALUES (1, 'Alice'), (2, 'Bob'), (3, 'Carol')",
+		"INSERT INTO posts VALUES (10, 1), (11, 1), (12, 2)",
+		"INSERT INTO likes VALUES (20, 1), (21, 2)",
+		"INSERT INTO follows VALUES (30, 3)",
+	}
+	tests := []struct {
+		name       string
+		sql        string
+		query      string     // 実行後に結果を確かめる SELECT
+		expected   [][]string // query の結果
+		constraint string     // 違反するはずの外部キー制約（エラーにならないなら空）
+		referenced bool       // 親側の削除・更新で、まだ参照されているエラーか
+	}{
+		{
+			name:     "参照先のある行の挿入",
+			sql:      "INSERT INTO posts VALUES (13, 3)",
+			query:    "SELECT id FROM posts WHERE user_id = 3",
+			expected: [][]string{{"13"}},
+		},
+		{
+			name:     "NULLの外部キーは確認しない",
+			sql:      "INSERT INTO posts VALUES (13, NULL)",
+			query:    "SELECT id FROM posts WHERE user_id IS NULL",
+			expected: [][]string{{"13"}},
+		},
+		{
+			name:       "参照先のない行の挿入",
+			sql:        "INSERT INTO posts VALUES (13, 99)",
+			constraint: "posts_user_id_fkey",
+		},
+		{
+			name:       "参照先のない値への更新",
+			sql:        "UPDATE likes SET user_id = 99 WHERE id = 20",
+			constraint: "likes_user_id_fkey",
+		},
+		{
+			name:     "ON DELETE CASCADE",
+			sql:      "DELETE FROM users WHERE id = 1",
+			query:    "SELECT id FROM posts ORDER BY id",
+			expected: [][]string{{"12"}},
+		},
+		{
+			name:     "ON DELETE SET NULL",
+			sql:      "DELETE FROM users WHERE id = 2",
+			query:    "SELECT id, user_id FROM likes ORDER BY id",
+			expected: [][]string{{"20", "1"}, {"21", "NULL"}},
+		},
+		{
+			name:     "ON UPDATE CASCADE と ON UPDATE SET NULL",
+			sql:      "UPDATE users SET id = 5 WHERE id = 2",
+			query:    "SELECT p.id, p.user_id, l.user_id FROM posts p JOIN likes l ON l.id = 21 ORDER BY p.id",
+			expected: [][]string{{"10", "1", "NULL"}, {"11", "1", "NULL"}, {"12", "5", "NULL"}},
+		},
+		{
+			name:       "ON DELETE RESTRICT",
+			sql:        "DELETE FROM users WHERE id = 3",
+			constraint: "follows_user_id_fkey",
+			referenced: true,
+		},
+		{
+			name:       "ON UPDATE の既定（NO ACTION）",
+			sql:        "UPDATE users SET id = 4 WHERE id = 3",
+			constraint: "follows_user_id_fkey",
+			referenced: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, setup...)
+			_, err := db.Exec(tt.sql)
+
+			if tt.constraint != "" {
+				var fkErr *ForeignKeyViolationError
+				if !errors.As(err, &fkErr) {
+					t.Fatalf("外部キー制約違反のエラーになりませんでした: %v", err)
+				}
+				if fkErr.Constraint != tt.constraint || fkErr.StillReferenced != tt.referenced {
+					t.Errorf("エラーが一致しません。期待: %s (StillReferenced=%v), 実際: %v", tt.constraint, tt.referenced, fkErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if rows := queryRows(t, db, tt.query); !reflect.DeepEqual(rows, tt.expected) {
+				t.Errorf("結果が一致しません。期待: %v, 実際: %v", tt.expected, rows)
+			}
+		})
+	}
+}
+
+func TestExecuteAlterTable(t *testing.T) {
+	setup := []string{
+		"CREATE TABLE teams (id INT PRIMARY KEY)",
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"INSERT INTO teams VALUES (1)",
+		"INSERT INTO users VALUES (1, 'Alice'), (2, 'Bob')",
+	}
+	tests := []struct {
+		name     string
+		sql      string
+		query    string     // 実行後に結果を確かめる SELECT
+		expected [][]string // query の結果
+		errorMsg string     // エラーメッセージに含まれるはずの文字列（エラーにならないなら空）
+	}{
+		{
+			name:     "ADD COLUMN の DEFAULT は既存の行にも入る",
+			sql:      "ALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 20",
+			query:    "SELECT id, age FROM users ORDER BY id",
+			expected: [][]string{{"1", "20"}, {"2", "20"}},
+		},
+		{
+			name:     "ADD COLUMN IF NOT EXISTS",
+			sql:      "ALTER TABLE users ADD COLUMN IF NOT EXISTS name TEXT",
+			query:    "SELECT name FROM users ORDER BY id",
+			expected: [][]string{{"Alice"}, {"Bob"}},
+		},
+		{
+			name:     "既存の行が NOT NULL を満たさない",
+			sql:      "ALTER TABLE users ADD COLUMN age INT NOT NULL",
+			errorMsg: "age",
+		},
+		{
+			name:     "既存の行が外部キー制約を満たさない",
+			sql:      "ALTER TABLE users ADD COLUMN team_id INT DEFAULT 2 REFERENCES teams(id)",
+			errorMsg: `"users_team_id_fkey"`,
+		},
+		{
+			name:     "既存の行が外部キー制約を満たす",
+			sql:      "ALTER TABLE users ADD COLUMN team_id INT DEFAULT 1 REFERENCES teams(id)",
+			query:    "SELECT id, team_id FROM users ORDER BY id",
+			expected: [][]string{{"1", "1"}, {"2", "1"}},
+		},
+		{
+			name:     "DROP COLUMN",
+			sql:      "ALTER TABLE users DROP COLUMN name",
+			query:    "SELECT * FROM users ORDER BY id",
+			expected: [][]string{{"1"}, {"2"}},
+		},
+		{
+			name:     "RENAME COLUMN",
+			sql:      "ALTER TABLE users RENAME COLUMN name TO full_name",
+			query:    "SELECT full_name FROM users WHERE id = 2",
+			expected: [][]string{{"Bob"}},
+		},
+		{
+			name:     "既存の行が CHECK 制約を満たさない",
+			sql:      "ALTER TABLE users ADD COLUMN age INT DEFAULT -1 CHECK (age >= 0)",
+			errorMsg: `"users_age_check"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, setup...)
+			_, err := db.Exec(tt.sql)
+
+			if tt.errorMsg != "" {
+				if err == nil {
+					t.Fatalf("期待されたエラーが発生しませんでした")
+				}
+				if !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("エラーメッセージに %s が含まれていません: %v", tt.errorMsg, err)
+				}
+				// 失敗した ALTER TABLE はテーブルを変えない
+				if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, [][]string{{"1", "Alice"}, {"2", "Bob"}}) {
+					t.Errorf("失敗した ALTER TABLE でテーブルが変わりました: %v", rows)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if rows := queryRows(t, db, tt.query); !reflect.DeepEqual(rows, tt.expected) {
+				t.Errorf("結果が一致しません。期待: %v, 実際: %v", tt.expected, rows)
+			}
+		})
+	}
+}
+
+func TestExecuteTypeCheck(t *testing.T) {
+	// 型の合わない式は行を読む前にエラーにするので、空のテーブルでもエラーになる
+	setup := []string{
+		"CREATE TABLE items (id INT, name VARCHAR(20), price DECIMAL(10,2), born DATE)",
+		"CREATE TABLE empty (id INT, name TEXT)",
+	}
+	tests := []struct {
+		name     string
+		sql      string
+		errorMsg string // エラーメッセージ（エラーにならないなら空）
+	}{
+		{
+			name:     "INT のカラムと読めない文字列",
+			sql:      "SELECT * FROM empty WHERE id = 'abc'",
+			errorMsg: "カラム 'id' は INT 型ですが、'abc' は INT 型の値として読めません: (id = 'abc')",
+		},
+		{
+			name:     "DATE のカラムと読めない文字列",
+			sql:      "SELECT * FROM items WHERE born < 'yesterday'",
+			errorMsg: "カラム 'born' は DATE 型ですが、'yesterday' は日付（YYYY-MM-DD）として読めません: (born < 'yesterday')",
+		},
+		{
+			name:     "INT のカラムと TEXT のカラム",
+			sql:      "SELECT * FROM empty WHERE id = name",
+			errorMsg: "カラム 'id' の INT 型と TEXT 型の値は比較・演算できません: (id = name)",
+		},
+		{
+			name:     "定数とカラムの比較ではカラムの型を表示",
+			sql:      "SELECT * FROM items WHERE 5 = born",
+			errorMsg: "カラム 'born' の DATE 型と INT 型の値は比較・演算できません: (5 = born)",
+		},
+		{
+			name:     "JOIN の ON 句",
+			sql:      "SELECT * FROM items JOIN empty ON items.born = empty.id",
+			errorMsg: "カラム 'born' の DATE 型と INT 型の値は比較・演算できません: (items.born = empty.id)",
+		},
+		{
+			name:     "UPDATE の WHERE 句",
+			sql:      "UPDATE empty SET name = 'x' WHERE id = 'abc'",
+			errorMsg: "カラム 'id' は INT 型ですが、'abc' は INT 型の値として読めません: (id = 'abc')",
+		},
+		{
+			name:     "DELETE の WHERE 句",
+			sql:      "DELETE FROM empty WHERE name > 1",
+			errorMsg: "カラム 'name' の TEXT 型と INT 型の値は比較・演算できません: (name > 1)",
+		},
+		{name: "文字列リテラルはカラムの型の表記として読む", sql: "SELECT * FROM items WHERE id = '5' AND born = '2024-01-31'"},
+		{name: "INT と DECIMAL は暗黙に変換できる", sql: "SELECT * FROM items WHERE id < price AND price = 1"},
+		{name: "VARCHAR と TEXT は比較できる", sql: "SELECT * FROM items JOIN empty ON items.name = empty.name"},
+		{name: "CAST で型を揃える", sql: "SELECT * FROM empty WHERE CAST(id AS TEXT) = name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, setup...)
+			_, err := db.Exec(tt.sql)
+
+			if tt.errorMsg != "" {
+				if err == nil {
+					t.Fatalf("期待されたエラーが発生しませんでした")
+				}
+				if err.Error() != tt.errorMsg {
+					t.Errorf("エラーメッセージが一致しません。期待: %s, 実際: %s", tt.errorMsg, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+			}
+		})
+	}
+}
+
+func TestExecuteSequenceRestart(t *testing.T) {
+	// nextval は sequenceBatchSize 個先までを払い出し済みとして保存する
+	// 閉じずに落ちたら払い出し済みの次から（値が飛ぶ）、正常に閉じたら使った値の次から続ける
+	tests := []struct {
+		name     string
+		sequence string
+		crash    bool
+		expected [][]string // 開き直す前の 3 行と、開き直したあとの 1 行の id
+	}{
+		{
+			name:     "落ちたら払い出し済みの次から",
+			sequence: "CREATE SEQUENCE s",
+			crash:    true,
+			expected: [][]string{{"1"}, {"2"}, {"3"}, {"33"}},
+		},
+		{
+			name:     "正常に閉じたら値は飛ばない",
+			sequence: "CREATE SEQUENCE s",
+			expected: [][]string{{"1"}, {"2"}, {"3"}, {"4"}},
+		},
+		{
+			name:     "減っていくシーケンスが落ちた",
+			sequence: "CREATE SEQUENCE s INCREMENT BY -1 MINVALUE -100 MAXVALUE 100 START WITH 10",
+			crash:    true,
+			expected: [][]string{{"10"}, {"9"}, {"8"}, {"-22"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, &Options{SyncMode: SyncOff})
+			if err != nil {
+				t.Fatalf("データベースを開けません: %v", err)
+			}
+			for _, stmt := range []string{
+				tt.sequence,
+				"CREATE TABLE items (id INT DEFAULT nextval('s'), seq INT)",
+				"INSERT INTO items (seq) VALUES (1), (2), (3)",
+			} {
+				if _, err := db.Exec(stmt); err != nil {
+					t.Fatalf("%s: %v", stmt, err)
+				}
+			}
+
+			reopen := dir
+			if tt.crash {
+				// 閉じる前のファイルを写して、落ちたあとのデータディレクトリとして開く
+				reopen = t.TempDir()
+				copyDir(t, dir, reopen)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("閉じられません: %v", err)
+			}
+
+			db = openTestDBAt(t, reopen, "INSERT INTO items (seq) VALUES (4)")
+			if rows := queryRows(t, db, "SELECT id FROM items ORDER BY seq"); !reflect.DeepEqual(rows, tt.expected) {
+				t.Errorf("結果が一致しません。期待: %v, 実際: %v", tt.expected, rows)
+			}
+		})
+	}
+}
+
+func TestExecuteAnalyzeStats(t *testing.T) {
+	// 200 行: id はすべて違う値、grp は 1 が半分・2 が 4 分の 1・残りは 1 行ずつ、kind は a が 60 行・b が 40 行・残りは NULL
+	var values []string
+	for i := 1; i <= 200; i++ {
+		grp, kind := i-148, "NULL"
+		switch {
+		case i <= 100:
+			grp = 1
+		case i <= 150:
+			grp = 2
+		}
+		switch {
+		case i <= 60:
+			kind = "'a'"
+		case i <= 100:
+			kind = "'b'"
+		}
+		values = append(values, fmt.Sprintf("(%d, %d, %s)", i, grp, kind))
+	}
+	// 一度に 200 行（autoAnalyzeBase を超える）を追加するので、自動で ANALYZE する
+	db := openTestDB(t,
+		"CREATE TABLE t (id INT, grp INT, kind TEXT)",
+		"INSERT INTO t VALUES "+strings.Join(values, ", "),
+	)
+
+	idBounds := []string{}
+	for b := 0; b <= 100; b++ {
+		idBounds = append(idBounds, fmt.Sprint(b*199/100+1))
+	}
+	grpBounds := []string{}
+	for v := 3; v <= 52; v++ {
+		grpBounds = append(grpBounds, fmt.Sprint(v))
+	}
+	expected := [][]string{
+		// 行数の 1 割を超える種類があれば n_distinct は行数に対する割合を負の値で持つ
+		{"grp", "0", "-0.26", "{1,2}", "{0.5,0.25}", "{" + strings.Join(grpBounds, ",") + "}"},
+		{"id", "0", "-1", "NULL", "NULL", "{" + strings.Join(idBounds, ",") + "}"},
+		// 種類が少なければすべて最頻値にして、ヒストグラムは作らない
+		{"kind", "0.5", "2", "{a,b}", "{0.3,0.2}", "NULL"},
+	}
+	query := "SELECT attname, null_frac, n_distinct, most_common_vals, most_common_freqs, histogram_bounds FROM pg_stats WHERE tablename = 't' ORDER BY attname"
+	if rows := queryRows(t, db, query); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("統計情報が一致しません。\n期待: %v\n実際: %v", expected, rows)
+	}
+
+	// ANALYZE したあとは autoAnalyzeBase + 0.1 × 200 = 70 行を超えて変更したら、もう一度 ANALYZE する
+	kindStats := "SELECT most_common_vals FROM pg_stats WHERE tablename = 't' AND attname = 'kind'"
+	if _, err := db.Exec("UPDATE t SET kind = 'c' WHERE id <= 70"); err != nil {
+		t.Fatalf("UPDATE: %v", err)
+	}
+	if rows := queryRows(t, db, kindStats); !reflect.DeepEqual(rows, [][]string{{"{a,b}"}}) {
+		t.Errorf("閾値以下の変更で ANALYZE しました: %v", rows)
+	}
+	if _, err := db.Exec("UPDATE t SET kind = 'c' WHERE id = 71"); err != nil {
+		t.Fatalf("UPDATE: %v", err)
+	}
+	if rows := queryRows(t, db, kindStats); !reflect.DeepEqual(rows, [][]string{{"{c,b}"}}) {
+		t.Errorf("閾値を超える変更で ANALYZE していません: %v", rows)
+	}
+}
+
+func TestExecutePrepared(t *testing.T) {
+	db := openTestDB(t,
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"PREPARE ins (INT, TEXT) AS INSERT INTO users VALUES ($1, $2)",
+		"PREPARE sel AS SELECT * FROM users WHERE id = $1",
+	)
+
+	// 手順は順番に実行する（前の手順で変えたテーブルやプリペアド文を次の手順で使う）
+	steps := []struct {
+		name     string
+		sql      string
+		expected [][]string // 結果の行（SELECT 以外は nil）
+		hasError bool
+	}{
+		{name: "実行する", sql: "EXECUTE ins(1, 'Alice')"},
+		{name: "INT のパラメータに INT として読めない値", sql: "EXECUTE ins('x', 'Bob')", hasError: true},
+		{name: "引数が足りない", sql: "EXECUTE ins(2)", hasError: true},
+		{name: "引数が多すぎる", sql: "EXECUTE ins(2, 'Bob', 3)", hasError: true},
+		{name: "同じ名前の PREPARE", sql: "PREPARE ins AS SELECT * FROM users", hasError: true},
+		{name: "エラーになった EXECUTE は何も変えていない", sql: "SELECT * FROM users ORDER BY id", expected: [][]string{{"1", "Alice"}}},
+		{name: "INT として読める文字列は変換する", sql: "EXECUTE ins('2', 'Bob')"},
+		{name: "SELECT を実行する", sql: "EXECUTE sel(2)", expected: [][]string{{"2", "Bob"}}},
+		{name: "カラムを追加する", sql: "ALTER TABLE users ADD COLUMN age INT DEFAULT 20"},
+		{name: "カラムを追加したあとはプランを作り直す", sql: "EXECUTE sel(2)", expected: [][]string{{"2", "Bob", "20"}}},
+		{name: "テーブルを削除する", sql: "DROP TABLE users"},
+		{name: "削除したテーブルの SELECT", sql: "EXECUTE sel(2)", hasError: true},
+		{name: "削除したテーブルの INSERT", sql: "EXECUTE ins(3, 'Carol')", hasError: true},
+		{name: "同じ名前で型の違うテーブルを作る", sql: "CREATE TABLE users (id TEXT, name TEXT)"},
+		{name: "追加する", sql: "INSERT INTO users VALUES ('a', 'Ann')"},
+		{name: "作り直したテーブルでパラメータの型を決め直す", sql: "EXECUTE sel('a')", expected: [][]string{{"a", "Ann"}}},
+		{name: "DEALLOCATE する", sql: "DEALLOCATE sel"},
+		{name: "DEALLOCATE したプリペアド文", sql: "EXECUTE sel('a')", hasError: true},
+		{name: "存在しないプリペアド文の DEALLOCATE", sql: "DEALLOCATE sel", hasError: true},
+		{name: "同じ名前でもう一度 PREPARE する", sql: "PREPARE sel AS SELECT name FROM users WHERE id = $1"},
+		{name: "PREPARE し直した文を実行する", sql: "EXECUTE sel('a')", expected: [][]string{{"Ann"}}},
+		{name: "DEALLOCATE ALL", sql: "DEALLOCATE ALL"},
+		{name: "DEALLOCATE ALL したプリペアド文", sql: "EXECUTE ins('b', 'Bob')", hasError: true},
+	}
+	for _, step := range steps {
+		res, err := db.Exec(step.sql)
+		if step.hasError {
+			if err == nil {
+				t.Errorf("%s: 期待されたエラーが発生しませんでした", step.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: 予期しないエラー: %v", step.name, err)
+		}
+		if rows := resultRows(res); !reflect.DeepEqual(rows, step.expected) {
+			t.Errorf("%s: 結果が一致しません。期待: %v, 実際: %v", step.name, step.expected, rows)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// EXPLAIN / EXPLAIN ANALYZE
+//
+// EXPLAIN SELECT ... は SELECT 文のプラン（物理演算子の木）を、演算子ごとのオプティマイザの見積もり（コストと行数）と一緒に表示する
+//   - cost=最初の行を返すまでのコスト..全部の行を返すまでのコスト（optimizer.go の単位）
+//   - rows=返す行数の見積もり（nestedLoopJoin の内側は外側の 1 行あたり）
+// EXPLAIN ANALYZE SELECT ... は実際に実行して（結果の行は捨てる）、演算子ごとに次も表示する
+//   - actual time=最初の行を返すまで..最後まで の時間（ミリ秒。子の演算子の時間を含む、1 回あたりの平均）
+//   - rows=返した行数（1 回あたりの平均）、loops=開いた回数（nestedLoopJoin の内側は外側の行の数だけ開き直す）
+//   - Buffers: データファイルのページの数（子の演算子の分を含む）。hit はバッファプール（bufpool.go）にあったもの、read はファイルから読んだもの
+// 形式は TEXT（postgres と同じ字下げの木を 1 行ずつ）と JSON（EXPLAIN (FORMAT JSON) ...。1 つの値）
+//
+//   Limit  (cost=1.52..1.53 rows=3)
+//     ->  Sort  (cost=1.52..1.55 rows=10)
+//           Sort Key: name DESC
+//           ->  Seq Scan on users  (cost=0.00..1.13 rows=10)
+//                 Filter: (age > 20)
+
+// estimate - オプティマイザが見積もった演算子の行数とコスト
+type estimate struct {
+	rows        float64 // 返す行数
+	startupCost float64 // 最初の行を返すまでのコスト
+	totalCost   float64 // 全部の行を返すまでのコスト
+}
+
+func (e *estimate) est() *estimate {
+	return e
+}
+
+// explainable - EXPLAIN で表示できる演算子（すべての演算子が実装する）
+type explainable interface {
+	est() *estimate
+	describe() (string, []explainDetail) // 演算子の名前と詳細（条件など）
+	children() []*operator               // 子の演算子（EXPLAIN ANALYZE で計測用のラッパーに差し替えられるよう、フィールドのポインタで返す）
+}
+
+// explainDetail - 演算子の詳細の 1 項目（TEXT では「Filter: (age > 20)」の 1 行、JSON では 1 つのキー）
+type explainDetail struct {
+	label string
+	value string
+}
+
+// relationName - スキャンするテーブルの表示名（別名があれば「users u」）
+func (sc *scope) relationName(i int) string {
+	src := sc.sources[i]
+	if src.alias != "" && src.alias != src.tableDef.Name && !strings.HasSuffix(src.tableDef.Name, "."+src.alias) {
+		return src.tableDef.Name + " " + src.alias
+	}
+	return src.tableDef.Name
+}
+
+// filterDetail - 条件があれば「Filter: 条件」の詳細を返す
+func filterDetail(label string, cond exprNode) []explainDetail {
+	if cond == nil {
+		return nil
+	}
+	return []explainDetail{{label, cond.String()}}
+}
+
+func (s *seqScan) describe() (string, []explainDetail) {
+	return "Seq Scan on " + s.scope.relationName(s.source), filterDetail("Filter", s.filter)
+}
+
+func (s *seqScan) children() []*operator {
+	return nil
+}
+
+func (s *indexScan) describe() (string, []explainDetail) {
+	conds := []string{}
+	for i, e := range s.eq {
+		conds = append(conds, "("+s.index.Columns[i]+" = "+e.String()+")")
+	}
+	for _, bound := range []*keyBound{s.lower, s.upper} {
+		if bound == nil {
+			continue
+		}
+		op := map[bool]string{true: "<", false: ">"}[bound == s.upper]
+		if bound.inclusive {
+			op += "="
+		}
+		conds = append(conds, "("+s.index.Columns[len(s.eq)]+" "+op+" "+bound.value.String()+")")
+	}
+	details := []explainDetail{{"Index Cond", strings.Join(conds, " AND ")}}
+	details = append(details, filterDetail("Filter", s.filter)...)
+	return "Index Scan using " + s.index.Name + " on " + s.scope.relationName(s.source), details
+}
+
+func (s *indexScan) children() []*operator {
+	return nil
+}
+
+func (s *rowsScan) describe() (string, []explainDetail) {
+	return "Rows Scan on " + s.scope.relationName(s.source), filterDetail("Filter", s.filter)
+}
+
+func (s *rowsScan) children() []*operator {
+	return nil
+}
+
+func (f *filter) describe() (string, []explainDetail) {
+	return "Filter", filterDetail("Filter", f.cond)
+}
+
+func (f *filter) children() []*operator {
+	return []*operator{&f.child}
+}
+
+func (j *nestedLoopJoin) describe() (string, []explainDetail) {
+	name := "Nested Loop"
+	if j.kind == "LEFT" {
+		name += " Left Join"
+	}
+	return name, filterDetail("Join Filter", j.on)
+}
+
+func (j *nestedLoopJoin) children() []*operator {
+	return []*operator{&j.left, &j.right}
+}
+
+func (p *project) describe() (string, []explainDetail) {
+	return "Project", []explainDetail{{"Output", formatSelectItems(p.items)}}
+}
+
+func (p *project) children() []*operator {
+	return []*operator{&p.child}
+}
+
+func (a *aggregate) describe() (string, []explainDetail) {
+	details := []explainDetail{{"Output", formatSelectItems(a.items)}}
+	if len(a.groupBy) == 0 {
+		return "Aggregate", details
+	}
+	keys := make([]string, len(a.groupBy))
+	for i, e := range a.groupBy {
+		keys[i] = e.String()
+	}
+	return "HashAggregate", append([]explainDetail{{"Group Key", strings.Join(keys, ", ")}}, details...)
+}
+
+func (a *aggregate) children() []*operator {
+	return []*operator{&a.child}
+}
+
+func (s *sortOp) describe() (string, []explainDetail) {
+	keys := make([]string, len(s.orderBy))
+	for i, item := range s.orderBy {
+		keys[i] = item.Expr.String()
+		if item.Desc {
+			keys[i] += " DESC"
+		}
+		// NULL の位置が省略時（ASC なら末尾、DESC なら先頭）と違うときだけ表示する
+		if item.NullsFirst != item.Desc {
+			keys[i] += map[bool]string{true: " NULLS FIRST", false: " NULLS LAST"}[item.NullsFirst]
+		}
+	}
+	return "Sort", []explainDetail{{"Sort Key", strings.Join(keys, ", ")}}
+}
+
+func (s *sortOp) children() []*operator {
+	return []*operator{&s.child}
+}
+
+func (l *limit) describe() (string, []explainDetail) {
+	return "Limit", nil
+}
+
+func (l *limit) children() []*operator {
+	return []*operator{&l.child}
+}
+
+// formatSelectItems - SELECT 句の式の並びを表示用にする
+func formatSelectItems(items []selectItem) string {
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = item.Expr.String()
+		if item.Alias != "" {
+			texts[i] += " AS " + item.Alias
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// instrument - EXPLAIN ANALYZE で演算子の実行を計測するラッパー
+type instrument struct {
+	operator
+	loops   int64         // 開いた回数
+	rows    int64         // 返した行の数（全部の回の合計）
+	startup time.Duration // 開いてから最初の行を返すまでの時間（全部の回の合計）
+	total   time.Duration // Open から Close までの時間（全部の回の合計）
+	opened  time.Time     // 今の回を開いた時刻
+	first   bool          // 今の回で最初の行をまだ返していないか
+}
+
+// instrumentPlan - プランのすべての演算子を計測用のラッパーで包む
+func instrumentPlan(op *operator) {
+	for _, child := range (*op).(explainable).children() {
+		instrumentPlan(child)
+	}
+	*op = &instrument{operator: *op}
+}
+
+func (in *instrument) Open() error {
+	in.loops++
+	in.opened, in.first = time.Now(), true
+	err := in.operator.Open()
+	in.total += time.Since(in.opened)
+	return err
+}
+
+func (in *instrument) Next() (*tuple, error) {
+	start := time.Now()
+	t, err := in.operator.Next()
+	in.total += time.Since(start)
+	if t != nil {
+		in.rows++
+		if in.first {
+			in.first = false
+			in.startup += time.Since(in.opened)
+		}
+	}
+	return t, err
+}
+
+func (in *instrument) Close() error {
+	start := time.Now()
+	err := in.operator.Close()
+	in.total += time.Since(start)
+	return err
+}
+
+// setOuter - nestedLoopJoin の内側のスキャンに外側の行を渡す（包んだ演算子が外側の行で検索するスキャンのとき）
+func (in *instrument) setOuter(outer *tuple) {
+	if p, ok := in.operator.(parameterizedScan); ok {
+		p.setOuter(outer)
+	}
+}
+
+// buffersUsed - 演算子が読んだデータファイルのページの数（子の演算子の分は含まない）
+func buffersUsed(op operator) bufferUsage {
+	switch op := op.(type) {
+	case *seqScan:
+		return op.buffers
+	case *indexScan:
+		return op.buffers
+	}
+	return bufferUsage{}
+}
+
+// explainNode - EXPLAIN の出力の 1 つの演算子
+type explainNode struct {
+	name     string
+	details  []explainDetail
+	est      estimate
+	analyzed bool // EXPLAIN ANALYZE で実行したか（以下の実測値があるか）
+	loops    int64
+	rows     float64     // 1 回あたりの返した行の数
+	startup  float64     // 1 回あたりの最初の行を返すまでの時間（ミリ秒）
+	total    float64     // 1 回あたりの時間（ミリ秒）
+	buffers  bufferUsage // 読んだページの数（子の演算子の分を含む）
+	children []*explainNode
+}
+
+// explainPlan - プランの木から EXPLAIN の出力の木を作る
+func explainPlan(op operator) *explainNode {
+	node := &explainNode{}
+	if in, ok := op.(*instrument); ok {
+		op = in.operator
+		node.analyzed, node.loops = true, in.loops
+		if in.loops > 0 {
+			loops := float64(in.loops)
+			node.rows = float64(in.rows) / loops
+			node.startup = float64(in.startup.Microseconds()) / 1000 / loops
+			node.total = float64(in.total.Microseconds()) / 1000 / loops
+		}
+	}
+	e := op.(explainable)
+	node.name, node.details = e.describe()
+	node.est = *e.est()
+	node.buffers = buffersUsed(op)
+	for _, child := range e.children() {
+		c := explainPlan(*child)
+		node.buffers.add(c.buffers)
+		node.children = append(node.children, c)
+	}
+	return node
+}
+
+// formatText - EXPLAIN の出力を TEXT 形式の行にする（postgres と同じく子は「->」で字下げする）
+func (n *explainNode) formatText(depth int, lines []string) []string {
+	line := ""
+	if depth > 0 {
+		line = strings.Repeat(" ", 6*(depth-1)+2) + "->  "
+	}
+	line += fmt.Sprintf("%s  (cost=%.2f..%.2f rows=%.0f)", n.name, n.est.startupCost, n.est.totalCost, n.est.rows)
+	if n.analyzed {
+		if n.loops == 0 {
+			line += " (never executed)"
+		} else {
+			line += fmt.Sprintf(" (actual time=%.3f..%.3f rows=%.0f loops=%d)", n.startup, n.total, n.rows, n.loops)
+		}
+	}
+	lines = append(lines, line)
+
+	indent := strings.Repeat(" ", 6*depth+2)
+	for _, d := range n.details {
+		lines = append(lines, indent+d.label+": "+d.value)
+	}
+	if n.analyzed && (n.buffers.hit > 0 || n.buffers.read > 0) {
+		// postgres と同じく 0 の項目は出さない
+		buffers := []string{}
+		if n.buffers.hit > 0 {
+			buffers = append(buffers, fmt.Sprintf("hit=%d", n.buffers.hit))
+		}
+		if n.buffers.read > 0 {
+			buffers = append(buffers, fmt.Sprintf("read=%d", n.buffers.read))
+		}
+		lines = append(lines, fmt.Sprintf("%sBuffers: shared %s", indent, strings.Join(buffers, " ")))
+	}
+	for _, c := range n.children {
+		lines = c.formatText(depth+1, lines)
+	}
+	return lines
+}
+
+// jsonObject - キーの順番を保ったまま JSON のオブジェクトを書く（encoding/json の map はキーを並べ替えてしまうので）
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value any
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// formatJSON - EXPLAIN の出力を JSON のオブジェクトにする（キーは postgres の EXPLAIN (FORMAT JSON) に合わせる）
+func (n *explainNode) formatJSON() jsonObject {
+	// TEXT 形式の「Index Scan using u_age on u」を、postgres と同じく種類・インデックス・テーブルの項目に分ける
+	nodeType, relation := n.name, ""
+	if i := strings.Index(nodeType, " on "); i >= 0 {
+		nodeType, relation = nodeType[:i], nodeType[i+len(" on "):]
+	}
+	index := ""
+	if i := strings.Index(nodeType, " using "); i >= 0 {
+		nodeType, index = nodeType[:i], nodeType[i+len(" using "):]
+	}
+	obj := jsonObject{{"Node Type", nodeType}}
+	if index != "" {
+		obj = append(obj, jsonField{"Index Name", index})
+	}
+	if relation != "" {
+		obj = append(obj, jsonField{"Relation Name", relation})
+	}
+	obj = append(obj,
+		jsonField{"Startup Cost", roundTo(n.est.startupCost, 2)},
+		jsonField{"Total Cost", roundTo(n.est.totalCost, 2)},
+		jsonField{"Plan Rows", roundTo(n.est.rows, 0)},
+	)
+	if n.analyzed {
+		obj = append(obj,
+			jsonField{"Actual Startup Time", roundTo(n.startup, 3)},
+			jsonField{"Actual Total Time", roundTo(n.total, 3)},
+			jsonField{"Actual Rows", roundTo(n.rows, 0)},
+			jsonField{"Actual Loops", n.loops},
+			jsonField{"Shared Hit Blocks", n.buffers.hit},
+			jsonField{"Shared Read Blocks", n.buffers.read},
+		)
+	}
+	for _, d := range n.details {
+		obj = append(obj, jsonField{d.label, d.value})
+	}
+	if len(n.children) > 0 {
+		plans := make([]jsonObject, len(n.children))
+		for i, c := range n.children {
+			plans[i] = c.formatJSON()
+		}
+		obj = append(obj, jsonField{"Plans", plans})
+	}
+	return obj
+}
+
+// roundTo - 小数点以下 digits 桁に丸める（JSON の数値を TEXT 形式と同じ桁にする）
+func roundTo(v float64, digits int) float64 {
+	scale := math.Pow(10, float64(digits))
+	return math.Round(v*scale) / scale
+}
+
+// Explain - EXPLAIN文を実行
+func (db *database) Explain(sql string) (*Result, error) {
+	def, err := parseExplain(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	result, err := db.explain(def)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsResult("EXPLAIN", result), nil
+}
+
+// explain - プランを作り（ANALYZE なら実行して）、EXPLAIN の出力を「QUERY PLAN」の 1 列の結果にする
+func (db *database) explain(def *explainDef) (*queryResult, error) {
+	db.bindQuery(def.Query)
+	start := time.Now()
+	plan, columns, err := db.planSelect(def.Query)
+	if err != nil {
+		return nil, err
+	}
+	planning := time.Since(start)
+
+	var execution time.Duration
+	if def.Analyze {
+		instrumentPlan(&plan)
+		start = time.Now()
+		if _, err := runPlan(plan, columns); err != nil {
+			return nil, err
+		}
+		execution = time.Since(start)
+	}
+	root := explainPlan(plan)
+	millis := func(d time.Duration) float64 {
+		return roundTo(float64(d.Microseconds())/1000, 3)
+	}
+
+	result := &queryResult{columns: []ResultColumn{{Name: "QUERY PLAN", Type: SQLType{Kind: TypeText}}}}
+	if def.Format == "JSON" {
+		result.columns[0].Type = SQLType{Kind: TypeJSON}
+		obj := jsonObject{{"Plan", root.formatJSON()}, {"Planning Time", millis(planning)}}
+		if def.Analyze {
+			obj = append(obj, jsonField{"Execution Time", millis(execution)})
+		}
+		data, err := json.MarshalIndent([]jsonObject{obj}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		result.rows = [][]any{{JSON(data)}}
+		return result, nil
+	}
+	lines := root.formatText(0, nil)
+	lines = append(lines, fmt.Sprintf("Planning Time: %.3f ms", millis(planning)))
+	if def.Analyze {
+		lines = append(lines, fmt.Sprintf("Execution Time: %.3f ms", millis(execution)))
+	}
+	for _, line := range lines {
+		result.rows = append(result.rows, []any{line})
+	}
+	return result, nil
+}
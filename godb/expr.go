@@ -0,0 +1,1003 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 式（CHECK 制約・DEFAULT 値など）の構文木と評価
+// 評価結果の値は Go の値で表す
+//   - INT / BIGINT     : int64
+//   - FLOAT            : float64
+//   - DECIMAL          : Decimal（decimal.go）
+//   - TEXT / VARCHAR   : string
+//   - BOOLEAN（真偽値）: bool
+//   - DATE / TIMESTAMP : Date / Timestamp（types.go）
+//   - NULL             : nil
+
+// exprNodeは式の構文木のノードを表す
+// String() は再度パースできる SQL のテキストを返す（.schema への保存に使う）
+type exprNode interface {
+	String() string
+}
+
+// literalはリテラル値（1, 'Alice', TRUE）を表す
+type literal struct {
+	Value any
+}
+
+// columnRefはカラム参照（name, users.name）を表す
+type columnRef struct {
+	Table string // テーブル名（省略時は空）
+	Name  string // カラム名
+}
+
+// unaryExprは単項演算（NOT x, -x）を表す
+type unaryExpr struct {
+	Op      string
+	Operand exprNode
+}
+
+// binaryExprは二項演算（a + b, a = b, a AND b）を表す
+type binaryExpr struct {
+	Op    string
+	Left  exprNode
+	Right exprNode
+}
+
+// isNullExprは NULL 判定（x IS NULL, x IS NOT NULL）を表す
+type isNullExpr struct {
+	Operand exprNode
+	Not     bool // IS NOT NULL かどうか
+}
+
+// castExprは型変換（CAST(x AS INT), x::INT）を表す
+type castExpr struct {
+	Operand exprNode
+	Type    SQLType
+}
+
+// paramExprはパラメータ（$1, ?）を表す
+// PREPARE した文の中で使い、EXECUTE のたびに値を入れ直す（prepare.go）
+type paramExpr struct {
+	Index int      // 何番目のパラメータか（1 から）
+	Type  *SQLType // 使われている場所から決めた型（決まらなければ nil）
+	value any      // EXECUTE で入れた値（Type の型に変換済み）
+	bound bool     // 値が入っているか
+}
+
+// funcCallは関数呼び出し（length(name), count(*)）を表す
+type funcCall struct {
+	Name string
+	Args []exprNode
+	Star bool // count(*) のように引数が * かどうか
+}
+
+func (e *literal) String() string {
+	switch v := e.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case float64:
+		// 指数表記にして、パースし直しても FLOAT のままになるようにする
+		return strconv.FormatFloat(v, 'e', -1, 64)
+	case Date:
+		return "DATE '" + v.String() + "'"
+	case Timestamp:
+		return "TIMESTAMP '" + v.String() + "'"
+	case []byte:
+		return "X'" + strings.ToUpper(hex.EncodeToString(v)) + "'"
+	case JSON:
+		return "CAST('" + strings.ReplaceAll(string(v), "'", "''") + "' AS JSON)"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (e *columnRef) String() string {
+	if e.Table != "" {
+		return e.Table + "." + e.Name
+	}
+	return e.Name
+}
+
+func (e *unaryExpr) String() string {
+	if e.Op == "NOT" {
+		return "(NOT " + e.Operand.String() + ")"
+	}
+	return "(" + e.Op + e.Operand.String() + ")"
+}
+
+func (e *binaryExpr) String() string {
+	return "(" + e.Left.String() + " " + e.Op + " " + e.Right.String() + ")"
+}
+
+func (e *isNullExpr) String() string {
+	if e.Not {
+		return "(" + e.Operand.String() + " IS NOT NULL)"
+	}
+	return "(" + e.Operand.String() + " IS NULL)"
+}
+
+func (e *castExpr) String() string {
+	return "CAST(" + e.Operand.String() + " AS " + e.Type.String() + ")"
+}
+
+func (e *paramExpr) String() string {
+	return "$" + strconv.Itoa(e.Index)
+}
+
+func (e *funcCall) String() string {
+	if e.Star {
+		return e.Name + "(*)"
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return e.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// parseExprは式のテキストをパースする（.schema に保存した CHECK / DEFAULT の読み込み用）
+func parseExpr(sql string) (exprNode, error) {
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// 演算子の優先順位（postgres と同じく、弱い順に）
+//   OR < AND < NOT < IS [NOT] NULL < 比較（= <> < > <= >=） < 加減算・文字列連結（+ - ||） < 乗除算（* / %） < JSON の取り出し（-> ->>） < 単項マイナス < ::
+//   （-> / ->> は SQLite と同じく乗除算より強くして、data->>'a' || 'x' や data->>'a' = 'x' を括弧なしで書けるようにしている）
+
+// parseExprは式をパースする
+func (p *sqlParser) parseExpr() (exprNode, error) {
+	return p.parseOr()
+}
+
+func (p *sqlParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (exprNode, error) {
+	if p.acceptKeyword("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{Op: "NOT", Operand: operand}, nil
+	}
+	return p.parseIs()
+}
+
+func (p *sqlParser) parseIs() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		left = &isNullExpr{Operand: left, Not: not}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "<>", "!=", "<=", ">=", "<", ">"} {
+		if p.acceptSymbol(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if op == "!=" {
+				op = "<>"
+			}
+			return &binaryExpr{Op: op, Left: left, Right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.acceptSymbol("+"):
+			op = "+"
+		case p.acceptSymbol("-"):
+			op = "-"
+		case p.acceptSymbol("||"):
+			op = "||"
+		default:
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseJSONAccess()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.acceptSymbol("*"):
+			op = "*"
+		case p.acceptSymbol("/"):
+			op = "/"
+		case p.acceptSymbol("%"):
+			op = "%"
+		default:
+			return left, nil
+		}
+		right, err := p.parseJSONAccess()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *sqlParser) parseJSONAccess() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.acceptSymbol("->>"):
+			op = "->>"
+		case p.acceptSymbol("->"):
+			op = "->"
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *sqlParser) parseUnary() (exprNode, error) {
+	if p.acceptSymbol("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// 数値リテラルの符号はその場で畳み込む（DEFAULT -1 を "(-1)" ではなく "-1" で保存するため）
+		if lit, ok := operand.(*literal); ok && isNumeric(lit.Value) {
+			if v, err := evalArithmetic("-", int64(0), lit.Value); err == nil {
+				return &literal{Value: v}, nil
+			}
+		}
+		return &unaryExpr{Op: "-", Operand: operand}, nil
+	}
+	p.acceptSymbol("+")
+	return p.parsePostfix()
+}
+
+// parsePostfixは式の後ろの ::型 をパースする（postgres と同じく単項マイナスより強く結合する）
+func (p *sqlParser) parsePostfix() (exprNode, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptSymbol("::") {
+		t, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		expr = &castExpr{Operand: expr, Type: t}
+	}
+	return expr, nil
+}
+
+// parseNumberは数値リテラルを値にする
+//   - 整数は int64（int64 に収まらなければ DECIMAL）
+//   - 小数点を含むものは DECIMAL（postgres と同じく 0.1 は誤差のない numeric 扱い）
+//   - 指数表記は FLOAT
+func parseNumber(text string) (any, error) {
+	if strings.ContainsAny(text, "eE") {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", text)
+		}
+		return f, nil
+	}
+	if !strings.Contains(text, ".") {
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	d, err := ParseDecimal(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number: %s", text)
+	}
+	return d, nil
+}
+
+func (p *sqlParser) parsePrimary() (exprNode, error) {
+	tok := p.peek()
+	switch tok.Kind {
+	case tokenNumber:
+		p.next()
+		v, err := parseNumber(tok.Text)
+		if err != nil {
+			return nil, err
+		}
+		return &literal{Value: v}, nil
+
+	case tokenString:
+		p.next()
+		return &literal{Value: tok.Text}, nil
+
+	case tokenParam:
+		if !p.allowParams {
+			return nil, p.errorf("parameters are not allowed here")
+		}
+		p.next()
+		if tok.Text == "?" {
+			if p.numbered {
+				return nil, p.errorf("cannot mix ? and $n parameters")
+			}
+			p.questions++
+			return &paramExpr{Index: p.questions}, nil
+		}
+		if p.questions > 0 {
+			return nil, p.errorf("cannot mix ? and $n parameters")
+		}
+		n, err := strconv.Atoi(tok.Text[1:])
+		if err != nil || n < 1 || n > maxParams {
+			return nil, fmt.Errorf("invalid parameter number: %s", tok.Text)
+		}
+		p.numbered = true
+		return &paramExpr{Index: n}, nil
+
+	case tokenSymbol:
+		if p.acceptSymbol("(") {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+
+	case tokenIdent:
+		if p.acceptKeyword("TRUE") {
+			return &literal{Value: true}, nil
+		}
+		if p.acceptKeyword("FALSE") {
+			return &literal{Value: false}, nil
+		}
+		if p.acceptKeyword("NULL") {
+			return &literal{Value: nil}, nil
+		}
+		// CAST(式 AS 型)
+		if strings.EqualFold(tok.Text, "CAST") && p.peekAt(1).Kind == tokenSymbol && p.peekAt(1).Text == "(" {
+			p.next()
+			p.next()
+			operand, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("AS"); err != nil {
+				return nil, err
+			}
+			t, err := p.parseTypeName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return &castExpr{Operand: operand, Type: t}, nil
+		}
+		// 型付きのリテラル（DATE '2024-01-31', TIMESTAMP '2024-01-31 12:00:00'）と 16 進のバイト列リテラル（X'DEADBEEF'）
+		if next := p.peekAt(1); next.Kind == tokenString {
+			if strings.EqualFold(tok.Text, "X") && !tok.Quoted && next.Pos == tok.Pos+1 {
+				p.next()
+				p.next()
+				b, err := hex.DecodeString(next.Text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid hexadecimal literal: X'%s'", next.Text)
+				}
+				return &literal{Value: b}, nil
+			}
+			switch strings.ToUpper(tok.Text) {
+			case "DATE":
+				p.next()
+				p.next()
+				d, err := parseDate(next.Text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid date literal: %s", next.Text)
+				}
+				return &literal{Value: d}, nil
+			case "TIMESTAMP":
+				p.next()
+				p.next()
+				ts, err := parseTimestamp(next.Text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid timestamp literal: %s", next.Text)
+				}
+				return &literal{Value: ts}, nil
+			}
+		}
+		p.next()
+
+		// 関数呼び出し
+		if p.acceptSymbol("(") {
+			call := &funcCall{Name: strings.ToLower(tok.Text)}
+			if p.acceptSymbol("*") {
+				if err := p.expectSymbol(")"); err != nil {
+					return nil, err
+				}
+				call.Star = true
+				return call, nil
+			}
+			if !p.acceptSymbol(")") {
+				for {
+					arg, err := p.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					call.Args = append(call.Args, arg)
+					if p.acceptSymbol(")") {
+						break
+					}
+					if err := p.expectSymbol(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return call, nil
+		}
+
+		// テーブル名付きのカラム参照
+		if p.acceptSymbol(".") {
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &columnRef{Table: tok.Text, Name: name}, nil
+		}
+		return &columnRef{Name: tok.Text}, nil
+	}
+	return nil, p.errorf("expected expression")
+}
+
+// evalEnvは式の評価中にカラム参照を値に解決する関数
+type evalEnv func(ref *columnRef) (any, error)
+
+// noColumnsEnvはカラムを参照できない文脈（DEFAULT 式など）で使う評価環境
+func noColumnsEnv(context string) evalEnv {
+	return func(ref *columnRef) (any, error) {
+		return nil, fmt.Errorf("%sではカラム '%s' を参照できません", context, ref.Name)
+	}
+}
+
+// walkExprは式の全ノードを順に visit に渡す
+func walkExpr(e exprNode, visit func(exprNode)) {
+	visit(e)
+	switch e := e.(type) {
+	case *unaryExpr:
+		walkExpr(e.Operand, visit)
+	case *isNullExpr:
+		walkExpr(e.Operand, visit)
+	case *castExpr:
+		walkExpr(e.Operand, visit)
+	case *binaryExpr:
+		walkExpr(e.Left, visit)
+		walkExpr(e.Right, visit)
+	case *funcCall:
+		for _, arg := range e.Args {
+			walkExpr(arg, visit)
+		}
+	case *sequenceCall:
+		walkExpr(e.call, visit)
+	}
+}
+
+// evalExprは式を評価して値を返す
+// どちらかのオペランドが NULL（nil）の演算は NULL になる
+// ただし AND / OR / NOT は SQL の三値論理（TRUE / FALSE / NULL）に従う
+//   - FALSE AND NULL = FALSE, TRUE AND NULL = NULL
+//   - TRUE OR NULL = TRUE, FALSE OR NULL = NULL
+//   - NOT NULL = NULL
+func evalExpr(e exprNode, env evalEnv) (any, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.Value, nil
+
+	case *columnRef:
+		return env(e)
+
+	case *paramExpr:
+		if !e.bound {
+			return nil, fmt.Errorf("パラメータ %s の値がありません（PREPARE した文を EXECUTE で実行してください）", e.String())
+		}
+		return e.value, nil
+
+	case *unaryExpr:
+		v, err := evalExpr(e.Operand, env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch e.Op {
+		case "NOT":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("NOT の引数は真偽値である必要があります: %v", v)
+			}
+			return !b, nil
+		case "-":
+			if !isNumeric(v) {
+				return nil, fmt.Errorf("単項マイナスの引数は数値である必要があります: %s", formatValue(v))
+			}
+			return evalArithmetic("-", int64(0), v)
+		}
+
+	case *isNullExpr:
+		v, err := evalExpr(e.Operand, env)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.Not, nil
+
+	case *binaryExpr:
+		left, err := evalExpr(e.Left, env)
+		if err != nil {
+			return nil, err
+		}
+		right, err := evalExpr(e.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == "AND" || e.Op == "OR" {
+			return evalLogical(e.Op, left, right)
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		// 型のない文字列リテラルは相手の型の表記として読む（id = '5' の '5' は整数）
+		// -> / ->> の右辺はキーなのでそのまま、左辺は JSON として読む
+		if e.Op == "->" || e.Op == "->>" {
+			if isUnknownLiteral(e.Left) {
+				if left, err = convertValue(left, SQLType{Kind: TypeJSON}); err != nil {
+					return nil, err
+				}
+			}
+		} else if e.Op != "||" {
+			if isUnknownLiteral(e.Left) {
+				if left, err = coerceUnknownLiteral(left.(string), right); err != nil {
+					return nil, fmt.Errorf("%v: %s", err, e.String())
+				}
+			}
+			if isUnknownLiteral(e.Right) {
+				if right, err = coerceUnknownLiteral(right.(string), left); err != nil {
+					return nil, fmt.Errorf("%v: %s", err, e.String())
+				}
+			}
+		}
+		v, err := evalBinary(e.Op, left, right)
+		return v, withExpr(err, e)
+
+	case *castExpr:
+		v, err := evalExpr(e.Operand, env)
+		if err != nil {
+			return nil, err
+		}
+		return castValue(v, e.Type, castExplicit)
+
+	case *funcCall:
+		if isAggregateFunc(e.Name) {
+			return nil, fmt.Errorf("集約関数 %s はここでは使えません", e.Name)
+		}
+		args := make([]any, len(e.Args))
+		for i, arg := range e.Args {
+			v, err := evalExpr(arg, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return evalFunc(e.Name, args)
+
+	case *sequenceCall:
+		args := make([]any, len(e.call.Args))
+		for i, arg := range e.call.Args {
+			v, err := evalExpr(arg, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return e.db.evalSequenceFunc(e.call.Name, args)
+	}
+	return nil, fmt.Errorf("評価できない式です: %s", e.String())
+}
+
+// evalLogicalは AND / OR を三値論理で評価する
+func evalLogical(op string, left, right any) (any, error) {
+	for _, v := range []any{left, right} {
+		if _, ok := v.(bool); v != nil && !ok {
+			return nil, fmt.Errorf("%s の引数は真偽値である必要があります: %v", op, v)
+		}
+	}
+	// AND は片方が FALSE なら、OR は片方が TRUE なら、もう片方が NULL でも結果が決まる
+	decisive := op == "OR"
+	if left == decisive || right == decisive {
+		return decisive, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
+// evalBinaryは二項演算を評価する
+func evalBinary(op string, left, right any) (any, error) {
+	switch op {
+	case "||":
+		// BYTEA どうしはバイト列の連結、それ以外は文字列として連結
+		if l, ok := left.([]byte); ok {
+			if r, ok := right.([]byte); ok {
+				return append(append([]byte{}, l...), r...), nil
+			}
+		}
+		return formatValue(left) + formatValue(right), nil
+
+	case "+", "-", "*", "/", "%":
+		return evalArithmetic(op, left, right)
+
+	case "->", "->>":
+		return evalJSONOp(op, left, right)
+
+	case "=", "<>", "<", ">", "<=", ">=":
+		cmp, err := compareValues(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "=":
+			return cmp == 0, nil
+		case "<>":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case ">":
+			return cmp > 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		}
+	}
+	return nil, fmt.Errorf("サポートされていない演算子です: %s", op)
+}
+
+// compareValuesは 2 つの値を比較する（-1, 0, 1）
+// 型が違う値は cast.go の表で暗黙に変換できる方に揃えてから比較する（INT と DECIMAL なら DECIMAL、DATE と TIMESTAMP なら TIMESTAMP）
+// 揃えられない組み合わせ（数値と TEXT など）は TypeMismatchError
+func compareValues(left, right any) (int, error) {
+	left, right, err := unifyValues(left, right)
+	if err != nil {
+		return 0, err
+	}
+	switch l := left.(type) {
+	case int64:
+		return compareOrdered(l, right.(int64)), nil
+	case float64:
+		return compareOrdered(l, right.(float64)), nil
+	case Decimal:
+		return l.Cmp(right.(Decimal)), nil
+	case string:
+		return strings.Compare(l, right.(string)), nil
+	case Date:
+		return l.Compare(right.(Date).Time), nil
+	case Timestamp:
+		return l.Compare(right.(Timestamp).Time), nil
+	case []byte:
+		return bytes.Compare(l, right.([]byte)), nil
+	case JSON:
+		// JSON は空白を詰めたテキストどうしで比較する（キーの順番が違えば別の値になる）
+		return strings.Compare(string(l), string(right.(JSON))), nil
+	case bool:
+		r := right.(bool)
+		switch {
+		case l == r:
+			return 0, nil
+		case !l:
+			return -1, nil
+		}
+		return 1, nil
+	}
+	return 0, fmt.Errorf("%s 型の値は比較できません: %s", valueTypeName(left), formatValue(left))
+}
+
+// compareOrderedは大小比較できる 2 つの値を比較する
+func compareOrdered[T int64 | float64](l, r T) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+// isNumericは数値（int64 / float64 / Decimal）かどうか
+func isNumeric(v any) bool {
+	switch v.(type) {
+	case int64, float64, Decimal:
+		return true
+	}
+	return false
+}
+
+// numericKindは 2 つの数値を演算するときの型（cast.go の表で、FLOAT > DECIMAL > 整数の順に揃う）
+func numericKind(left, right any) TypeKind {
+	lk, _ := valueKind(left)
+	rk, _ := valueKind(right)
+	kind, _ := commonKind(lk, rk)
+	return kind
+}
+
+// toFloatは数値を float64 に変換する
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case Decimal:
+		return v.Float64()
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// toDecimalは整数か Decimal を Decimal に変換する
+func toDecimal(v any) Decimal {
+	switch v := v.(type) {
+	case int64:
+		return NewDecimalFromInt(v)
+	case Decimal:
+		return v
+	}
+	return Decimal{}
+}
+
+// evalArithmeticは四則演算と剰余を評価する
+//   - 整数どうしは整数（オーバーフローはエラー、割り算は切り捨て）
+//   - DECIMAL が混ざれば DECIMAL（誤差なし）、FLOAT が混ざれば FLOAT
+//   - DATE + 整数 / DATE - 整数 は日数を足し引きした DATE、DATE - DATE は日数
+func evalArithmetic(op string, left, right any) (any, error) {
+	if d, ok := left.(Date); ok {
+		switch r := right.(type) {
+		case int64:
+			if op == "+" {
+				return Date{d.AddDate(0, 0, int(r))}, nil
+			}
+			if op == "-" {
+				return Date{d.AddDate(0, 0, -int(r))}, nil
+			}
+		case Date:
+			if op == "-" {
+				return int64(d.Sub(r.Time).Hours() / 24), nil
+			}
+		}
+	}
+	if d, ok := right.(Date); ok && op == "+" {
+		if n, ok := left.(int64); ok {
+			return Date{d.AddDate(0, 0, int(n))}, nil
+		}
+	}
+	if !isNumeric(left) || !isNumeric(right) {
+		return nil, fmt.Errorf("演算子 %s は %s 型と %s 型の値には使えません: %s, %s", op,
+			valueTypeName(left), valueTypeName(right), formatValue(left), formatValue(right))
+	}
+
+	switch numericKind(left, right) {
+	case TypeFloat:
+		l, r := toFloat(left), toFloat(right)
+		switch op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("ゼロ除算です")
+			}
+			if op == "/" {
+				return l / r, nil
+			}
+			return math.Mod(l, r), nil
+		}
+
+	case TypeDecimal:
+		l, r := toDecimal(left), toDecimal(right)
+		switch op {
+		case "+":
+			return l.Add(r), nil
+		case "-":
+			return l.Sub(r), nil
+		case "*":
+			return l.Mul(r), nil
+		case "/":
+			return l.Div(r)
+		case "%":
+			return l.Mod(r)
+		}
+
+	default:
+		l, r := left.(int64), right.(int64)
+		var result int64
+		overflow := false
+		switch op {
+		case "+":
+			result = l + r
+			overflow = (r > 0 && result < l) || (r < 0 && result > l)
+		case "-":
+			result = l - r
+			overflow = (r < 0 && result < l) || (r > 0 && result > l)
+		case "*":
+			result = l * r
+			overflow = l != 0 && (result/l != r || (l == -1 && r == math.MinInt64))
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("ゼロ除算です")
+			}
+			if l == math.MinInt64 && r == -1 {
+				overflow = op == "/"
+				break
+			}
+			if op == "/" {
+				result = l / r
+			} else {
+				result = l % r
+			}
+		}
+		if overflow {
+			return nil, fmt.Errorf("整数の範囲外です: %d %s %d", l, op, r)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("サポートされていない演算子です: %s", op)
+}
+
+// isAggregateFuncは集約関数の名前かどうか
+func isAggregateFunc(name string) bool {
+	switch name {
+	case "count", "sum", "avg", "min", "max":
+		return true
+	}
+	return false
+}
+
+// evalFuncは組み込み関数を評価する
+func evalFunc(name string, args []any) (any, error) {
+	// coalesce は最初の NULL でない引数を返す（引数の数は任意）
+	if name == "coalesce" {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}
+	if name == "json_extract" {
+		return jsonExtract(args)
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("関数 %s の引数の数が正しくありません", name)
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	switch name {
+	case "length":
+		switch v := args[0].(type) {
+		case string:
+			return int64(len([]rune(v))), nil
+		case []byte:
+			return int64(len(v)), nil
+		}
+	case "octet_length":
+		switch v := args[0].(type) {
+		case string:
+			return int64(len(v)), nil
+		case []byte:
+			return int64(len(v)), nil
+		}
+	case "upper":
+		if s, ok := args[0].(string); ok {
+			return strings.ToUpper(s), nil
+		}
+	case "lower":
+		if s, ok := args[0].(string); ok {
+			return strings.ToLower(s), nil
+		}
+	case "nextval", "currval":
+		return nil, fmt.Errorf("関数 %s はここでは使えません", name)
+	case "abs":
+		if isNumeric(args[0]) {
+			cmp, err := compareValues(args[0], int64(0))
+			if err != nil || cmp >= 0 {
+				return args[0], err
+			}
+			return evalArithmetic("-", int64(0), args[0])
+		}
+	default:
+		return nil, fmt.Errorf("関数 %s は存在しません", name)
+	}
+	return nil, fmt.Errorf("関数 %s の引数の型が正しくありません: %v", name, args[0])
+}
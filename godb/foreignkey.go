@@ -0,0 +1,174 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ForeignKeyViolationErrorはFOREIGN KEY制約違反を表す
+// 子テーブルへの INSERT / UPDATE で親の行が見つからない場合と、
+// 親テーブルの DELETE / UPDATE で子の行からまだ参照されている場合（StillReferenced）の 2 通りがある
+type ForeignKeyViolationError struct {
+	Constraint      string   // 違反した制約名
+	TableName       string   // 制約を持つ（子）テーブル
+	RefTable        string   // 参照先（親）テーブル
+	Columns         []string // キーのカラム
+	Values          []string // キーの値
+	StillReferenced bool     // 親側の削除・更新で、まだ参照されている場合 true
+}
+
+func (e *ForeignKeyViolationError) Error() string {
+	key := fmt.Sprintf("(%s)=(%s)", strings.Join(e.Columns, ", "), strings.Join(e.Values, ", "))
+	if e.StillReferenced {
+		return fmt.Sprintf("テーブル '%s' の更新または削除が外部キー制約 \"%s\" に違反しています: キー %s はまだテーブル '%s' から参照されています",
+			e.RefTable, e.Constraint, key, e.TableName)
+	}
+	return fmt.Sprintf("テーブル '%s' への挿入または更新が外部キー制約 \"%s\" に違反しています: キー %s はテーブル '%s' に存在しません",
+		e.TableName, e.Constraint, key, e.RefTable)
+}
+
+// validateForeignKeys - CREATE TABLE 時に参照先のテーブル・カラムを確認する
+// 参照先のカラムは親の主キーか UNIQUE 制約と一致している必要がある（親のインデックスで存在確認をするため）
+// 参照先のカラムが省略されている場合は親の主キーで補う
+func (db *database) validateForeignKeys(tableDef *tableSchema) error {
+	for i := range tableDef.ForeignKeys {
+		fk := &tableDef.ForeignKeys[i]
+
+		parent := db.catalog.Tables[fk.RefTable]
+		if fk.RefTable == tableDef.Name {
+			// 自分自身を参照する（親子関係を同じテーブルで表す）場合
+			parent = tableDef
+		}
+		if parent == nil {
+			return fmt.Errorf("外部キー制約 \"%s\" の参照先テーブル '%s' は存在しません", fk.Name, fk.RefTable)
+		}
+
+		if len(fk.RefColumns) == 0 {
+			if parent.PrimaryKey == nil {
+				return fmt.Errorf("参照先テーブル '%s' に主キーがないため、参照先のカラムを指定する必要があります", parent.Name)
+			}
+			fk.RefColumns = parent.PrimaryKey.Columns
+		}
+		if len(fk.RefColumns) != len(fk.Columns) {
+			return fmt.Errorf("外部キー制約 \"%s\" の参照元と参照先のカラム数が一致しません", fk.Name)
+		}
+		if findKeyConstraint(parent, fk.RefColumns) < 0 {
+			return fmt.Errorf("参照先テーブル '%s' に (%s) の主キーまたは UNIQUE 制約がありません",
+				parent.Name, strings.Join(fk.RefColumns, ", "))
+		}
+
+		for j, col := range fk.Columns {
+			childCol := tableDef.Columns[tableDef.ColumnIndex(col)]
+			parentCol := parent.Columns[parent.ColumnIndex(fk.RefColumns[j])]
+			if !sameKeyFamily(columnType(childCol), columnType(parentCol)) {
+				return fmt.Errorf("外部キー制約 \"%s\" のカラム '%s' (%s) と参照先 '%s' (%s) の型が一致しません",
+					fk.Name, childCol.Name, childCol.Type, parentCol.Name, parentCol.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// findKeyConstraint - カラムの並びが一致する主キー・UNIQUE制約の位置を返す（見つからなければ -1）
+// 位置は db.indexes[テーブル名] のインデックスの位置と同じ
+func findKeyConstraint(tableDef *tableSchema, columns []string) int {
+	for i, constraint := range tableDef.KeyConstraints() {
+		if len(constraint.Columns) != len(columns) {
+			continue
+		}
+		match := true
+		for j := range columns {
+			if !strings.EqualFold(constraint.Columns[j], columns[j]) {
+				match = false
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// referencingForeignKey - あるテーブルを参照している外部キー制約と、その制約を持つ子テーブルの組
+type referencingForeignKey struct {
+	child *tableSchema
+	fk    foreignKeyDef
+}
+
+// referencingForeignKeys - tableName を参照している外部キー制約の一覧（子テーブル名順）
+func (db *database) referencingForeignKeys(tableName string) []referencingForeignKey {
+	var refs []referencingForeignKey
+	for _, name := range db.catalog.tableNames() {
+		child := db.catalog.Tables[name]
+		for _, fk := range child.ForeignKeys {
+			if fk.RefTable == tableName {
+				refs = append(refs, referencingForeignKey{child: child, fk: fk})
+			}
+		}
+	}
+	return refs
+}
+
+// foreignKeyIsNull - 子の行の参照カラムのどれかが NULL か（MATCH SIMPLE：NULL を含むキーは検査しない）
+func foreignKeyIsNull(tableDef *tableSchema, fk foreignKeyDef, row tableRow) bool {
+	for _, col := range fk.Columns {
+		pos := tableDef.ColumnIndex(col)
+		if isNullField(tableDef.Columns[pos], row[pos]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentKeyExists - 子の行が参照しているキーが、親テーブルのインデックスに存在するか
+func (db *database) parentKeyExists(child *tableSchema, fk foreignKeyDef, row tableRow) (bool, error) {
+	parent, err := db.getTable(fk.RefTable)
+	if err != nil {
+		return false, err
+	}
+	key, err := encodeIndexKey(child, fk.Columns, row)
+	if err != nil {
+		return false, err
+	}
+	pos := findKeyConstraint(parent, fk.RefColumns)
+	if pos < 0 {
+		return false, fmt.Errorf("参照先テーブル '%s' に外部キー制約 \"%s\" 用のインデックスがありません", parent.Name, fk.Name)
+	}
+	_, found := db.indexes[parent.Name][pos].Search(key)
+	return found, nil
+}
+
+// checkForeignKeysOnInsert - INSERT する行の参照先が親テーブルに存在するか、親のインデックスで確認する
+func (db *database) checkForeignKeysOnInsert(tableDef *tableSchema, row tableRow) error {
+	for _, fk := range tableDef.ForeignKeys {
+		if foreignKeyIsNull(tableDef, fk, row) {
+			continue
+		}
+		found, err := db.parentKeyExists(tableDef, fk, row)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return newForeignKeyViolationError(tableDef.Name, fk, tableDef, fk.Columns, row, false)
+		}
+	}
+	return nil
+}
+
+// newForeignKeyViolationError - 行の値から外部キー制約違反エラーを作る
+// childName は制約を持つ子テーブル、keyTable / columns は値を取り出す側（子の行なら子、親の行なら親）のテーブルとカラム
+func newForeignKeyViolationError(childName string, fk foreignKeyDef, keyTable *tableSchema, columns []string, row tableRow, stillReferenced bool) *ForeignKeyViolationError {
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		pos := keyTable.ColumnIndex(col)
+		values[i] = formatField(keyTable, row, pos)
+	}
+	return &ForeignKeyViolationError{
+		Constraint:      fk.Name,
+		TableName:       childName,
+		RefTable:        fk.RefTable,
+		Columns:         columns,
+		Values:          values,
+		StillReferenced: stillReferenced,
+	}
+}
@@ -0,0 +1,391 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 埋め込み用の API
+//
+// ほかの Go のプログラムからデータベースを使うときの入口
+//
+//	db, err := godb.Open("data", nil) // nil なら既定の設定（DefaultOptions）
+//	if err != nil { ... }
+//	defer db.Close()
+//	res, err := db.Exec("INSERT INTO users (id, name) VALUES (1, 'Alice')")
+//	res, err = db.Query("SELECT * FROM users")
+//	for res.Next() { fmt.Println(res.Values()) }
+//
+// 文は 1 つずつ順番に実行する（DB のメソッドは同時に呼んでもよいが、実行するのは 1 つずつ）
+// Begin で始めたトランザクションの中の文は Tx のメソッドで実行する
+// トランザクションが終わるまで（Commit / Rollback）ほかの DB のメソッドは待たされる
+// 値は SQL 文に埋め込まず、Prepare で作ったプリペアド文（prepare.go）のパラメータ（$1 か ?）に渡す
+//
+//	stmt, err := db.Prepare("SELECT * FROM users WHERE id = $1")
+//	res, err = stmt.Query(1)
+//
+// ExecContext / QueryContext / BeginContext はコンテキストが取り消されたら、待つのや実行をやめて ctx.Err() を返す
+// （実行中の文はスキャンで行を読むたびと書き込む前に確かめるので、書き込みの途中でやめることはない）
+// database/sql からはドライバ（driver.go）を通して使う
+//
+// パッケージから公開するのは、このファイルと result.go の API、ドライバの登録名と NewConnector、
+// 結果の値の型（Decimal・Date・Timestamp・JSON と列の型の SQLType）、制約違反などのエラーの型だけ
+// パーサー・プランナー・ストレージなどのエンジン（database とその下の型）は公開しない
+
+// SyncMode - コミットしたときに WAL とデータファイルをディスクに書き出すか
+// 行の変更は WAL に書かず、文を実行したときにデータファイルに書くので、SyncFull ではデータファイルも書き出す
+type SyncMode int
+
+const (
+	SyncFull SyncMode = iota // コミットのたびにディスクに書き出す（既定。落ちてもコミットした変更は消えない）
+	SyncOff                  // OS に任せる（速いが、OS やマシンが落ちると直前のコミットが消えることがある）
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncFull:
+		return "full"
+	case SyncOff:
+		return "off"
+	}
+	return fmt.Sprintf("SyncMode(%d)", int(m))
+}
+
+// Options - データベースを開くときの設定（0 の項目は既定値になる）
+type Options struct {
+	SyncMode         SyncMode // WAL とデータファイルの書き出し（既定は SyncFull）
+	PageSize         int      // データファイルを読む 1 ページのバイト数（1024〜65536 の 2 のべき乗。既定は 8192）
+	BufferPoolSize   int      // バッファプールに置くページの数（既定は 1024）
+	AutoAnalyzeScale float64  // 変更した行が行数のこの割合を超えたら自動で ANALYZE する（既定は 0.1。負なら自動 ANALYZE しない）
+	Logger           Logger   // 情報メッセージ（テーブルを作成しました など）の出力先（既定は捨てる）
+}
+
+// DefaultOptions - 既定の設定
+func DefaultOptions() Options {
+	return Options{
+		SyncMode:         SyncFull,
+		PageSize:         defaultPageSize,
+		BufferPoolSize:   defaultBufferPoolSize,
+		AutoAnalyzeScale: defaultAutoAnalyzeScale,
+		Logger:           discardLogger,
+	}
+}
+
+const defaultAutoAnalyzeScale = 0.1 // 自動 ANALYZE の閾値の行数に対する割合の既定値
+
+// withDefaults - 0 の項目を既定値で埋め、値を検証する
+func (o Options) withDefaults() (Options, error) {
+	if o.PageSize == 0 {
+		o.PageSize = defaultPageSize
+	}
+	if o.PageSize < 1024 || o.PageSize > 65536 || o.PageSize&(o.PageSize-1) != 0 {
+		return o, fmt.Errorf("ページサイズ %d は使えません（1024〜65536 の 2 のべき乗を指定してください）", o.PageSize)
+	}
+	if o.BufferPoolSize == 0 {
+		o.BufferPoolSize = defaultBufferPoolSize
+	}
+	if o.BufferPoolSize < 0 {
+		return o, fmt.Errorf("バッファプールのページ数 %d は使えません", o.BufferPoolSize)
+	}
+	if o.AutoAnalyzeScale == 0 {
+		o.AutoAnalyzeScale = defaultAutoAnalyzeScale
+	}
+	if o.SyncMode != SyncFull && o.SyncMode != SyncOff {
+		return o, fmt.Errorf("WAL の書き出しモード %v は使えません", o.SyncMode)
+	}
+	if o.Logger == nil {
+		o.Logger = discardLogger
+	}
+	return o, nil
+}
+
+// DB - 開いたデータベース（Open で作る。ゼロ値の DB のメソッドはエラーを返す）
+type DB struct {
+	sem    chan struct{} // 文を 1 つずつ実行するためのロック（送れたら取った。トランザクションの間は Tx が持ったまま）
+	engine *database
+	closed bool
+}
+
+// Open - データディレクトリ dir のデータベースを開く（なければ作る。opts が nil なら既定の設定）
+// 同じデータディレクトリはほかのプロセスから同時に開けない（DataDirLockedError）
+func Open(dir string, opts *Options) (*DB, error) {
+	o := DefaultOptions()
+	if opts != nil {
+		var err error
+		if o, err = opts.withDefaults(); err != nil {
+			return nil, err
+		}
+	}
+	engine, err := openDatabase(dir, o)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{sem: make(chan struct{}, 1), engine: engine}, nil
+}
+
+// lock - 文を実行するロックを取る（ctx が取り消されたら待つのをやめる）
+func (db *DB) lock(ctx context.Context) error {
+	if db.engine == nil {
+		return errNotOpened
+	}
+	select {
+	case db.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if db.closed {
+		db.unlock()
+		return &ClosedError{What: "データベース"}
+	}
+	return nil
+}
+
+func (db *DB) unlock() {
+	<-db.sem
+}
+
+// execute - ロックを持った状態で、ctx のもとで SQL 文を 1 つ実行する
+func (db *DB) execute(ctx context.Context, sql string) (*Result, error) {
+	db.engine.ctx = ctx
+	defer func() { db.engine.ctx = context.Background() }()
+	return db.engine.ExecuteSQL(sql)
+}
+
+// executePrepared - ロックを持った状態で、ctx のもとでプリペアド文を実行する
+func (db *DB) executePrepared(ctx context.Context, prep *preparedStmt, args []any) (*Result, error) {
+	db.engine.ctx = ctx
+	defer func() { db.engine.ctx = context.Background() }()
+	return db.engine.executePrepared(prep, args)
+}
+
+// errNotOpened - Open で開いていない（ゼロ値の）DB を使った
+var errNotOpened = errors.New("データベースが開かれていません（Open で開いてください）")
+
+// ClosedError - 閉じたデータベース・終わったトランザクション・閉じたプリペアド文を使った
+type ClosedError struct {
+	What string // "データベース" / "トランザクション" / "プリペアド文"
+}
+
+func (e *ClosedError) Error() string {
+	return fmt.Sprintf("%sはすでに終了しています", e.What)
+}
+
+// Exec - SQL 文を 1 つ実行する
+func (db *DB) Exec(sql string) (*Result, error) {
+	return db.ExecContext(context.Background(), sql)
+}
+
+// ExecContext - ctx のもとで SQL 文を 1 つ実行する
+func (db *DB) ExecContext(ctx context.Context, sql string) (*Result, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+	return db.execute(ctx, sql)
+}
+
+// Query - 行を返す SQL 文（SELECT・RETURNING・EXPLAIN など）を実行する
+// 結果の行はすべて読んだあとで返すので、Result を読んでいる間に次の文を実行してよい
+func (db *DB) Query(sql string) (*Result, error) {
+	return db.ExecContext(context.Background(), sql)
+}
+
+// QueryContext - ctx のもとで行を返す SQL 文を実行する
+func (db *DB) QueryContext(ctx context.Context, sql string) (*Result, error) {
+	return db.ExecContext(ctx, sql)
+}
+
+// Prepare - パラメータ（$1, $2, ... か ?）を書いた SELECT / INSERT / UPDATE / DELETE 文をプリペアド文にする
+// 文はここで 1 回だけパースし（SELECT はプランも作り）、実行するたびにパラメータの値だけを渡す
+func (db *DB) Prepare(sql string) (*Stmt, error) {
+	return db.PrepareContext(context.Background(), sql)
+}
+
+// PrepareContext - ctx のもとで SQL 文をプリペアド文にする
+func (db *DB) PrepareContext(ctx context.Context, sql string) (*Stmt, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+	prep, err := db.engine.prepareStatement("", sql, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{db: db, prep: prep}, nil
+}
+
+// Begin - トランザクションを始める
+// Commit / Rollback するまで、文はすべて返した Tx で実行する（DB のメソッドは終わるまで待たされる）
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginContext(context.Background())
+}
+
+// BeginContext - トランザクションを始める（ほかのトランザクションが終わるのを待つ間に ctx が取り消されたらやめる）
+func (db *DB) BeginContext(ctx context.Context) (*Tx, error) {
+	if err := db.lock(ctx); err != nil {
+		return nil, err
+	}
+	if err := db.engine.takeSnapshot(); err != nil {
+		db.unlock()
+		return nil, fmt.Errorf("トランザクションを開始できません: %v", err)
+	}
+	modified := make(map[string]int64, len(db.engine.modified))
+	for name, rows := range db.engine.modified {
+		modified[name] = rows
+	}
+	return &Tx{db: db, modified: modified}, nil
+}
+
+// Close - データベースを閉じる
+func (db *DB) Close() error {
+	if db.engine == nil {
+		return errNotOpened
+	}
+	db.sem <- struct{}{}
+	defer db.unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	return db.engine.Close()
+}
+
+// Tx - DB.Begin で始めたトランザクション
+// 文は実行したときにファイルに反映し、Rollback したら始めた時点のファイルに戻す（snapshot.go）
+type Tx struct {
+	db       *DB
+	modified map[string]int64 // 始めた時点の変更した行の数（自動 ANALYZE 用。Rollback で戻す）
+	done     bool
+}
+
+// Exec - トランザクションの中で SQL 文を 1 つ実行する
+func (tx *Tx) Exec(sql string) (*Result, error) {
+	return tx.ExecContext(context.Background(), sql)
+}
+
+// ExecContext - トランザクションの中で、ctx のもとで SQL 文を 1 つ実行する
+func (tx *Tx) ExecContext(ctx context.Context, sql string) (*Result, error) {
+	if tx.done {
+		return nil, &ClosedError{What: "トランザクション"}
+	}
+	return tx.db.execute(ctx, sql)
+}
+
+// Query - トランザクションの中で行を返す SQL 文を実行する
+func (tx *Tx) Query(sql string) (*Result, error) {
+	return tx.ExecContext(context.Background(), sql)
+}
+
+// QueryContext - トランザクションの中で、ctx のもとで行を返す SQL 文を実行する
+func (tx *Tx) QueryContext(ctx context.Context, sql string) (*Result, error) {
+	return tx.ExecContext(ctx, sql)
+}
+
+// Prepare - トランザクションの中で SQL 文をプリペアド文にする（返した Stmt はこのトランザクションの中で実行する）
+func (tx *Tx) Prepare(sql string) (*Stmt, error) {
+	return tx.PrepareContext(context.Background(), sql)
+}
+
+// PrepareContext - トランザクションの中で、ctx のもとで SQL 文をプリペアド文にする
+func (tx *Tx) PrepareContext(ctx context.Context, sql string) (*Stmt, error) {
+	if tx.done {
+		return nil, &ClosedError{What: "トランザクション"}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	prep, err := tx.db.engine.prepareStatement("", sql, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{db: tx.db, tx: tx, prep: prep}, nil
+}
+
+// Stmt - DB.Prepare で作ったプリペアド文を、このトランザクションの中で実行する Stmt を返す
+func (tx *Tx) Stmt(s *Stmt) *Stmt {
+	return &Stmt{db: s.db, tx: tx, prep: s.prep}
+}
+
+// Commit - トランザクションの変更を確定する
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return &ClosedError{What: "トランザクション"}
+	}
+	tx.done = true
+	defer tx.db.unlock()
+	return tx.db.engine.dropSnapshot()
+}
+
+// Rollback - トランザクションの変更を取り消し、始めた時点に戻す
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return &ClosedError{What: "トランザクション"}
+	}
+	tx.done = true
+	defer tx.db.unlock()
+	if err := tx.db.engine.restoreSnapshot(); err != nil {
+		return fmt.Errorf("トランザクションの取り消しに失敗しました: %v", err)
+	}
+	tx.db.engine.modified = tx.modified
+	return nil
+}
+
+// Stmt - DB.Prepare / Tx.Prepare で作ったプリペアド文
+// パラメータの値は Go の値で渡す（整数・浮動小数点数・bool・string・[]byte・time.Time・Decimal・Date・Timestamp・JSON・nil）
+// 値はパラメータの型（使われている場所のカラムの型など）に変換する。文字列はその型の表記として読む
+type Stmt struct {
+	db     *DB
+	tx     *Tx // トランザクションの中で実行するなら、その Tx（Tx.Prepare / Tx.Stmt）
+	prep   *preparedStmt
+	closed bool
+}
+
+// NumInput - パラメータの数
+func (s *Stmt) NumInput() int {
+	return len(s.prep.params)
+}
+
+// Exec - パラメータに args の値を入れて文を実行する
+func (s *Stmt) Exec(args ...any) (*Result, error) {
+	return s.ExecContext(context.Background(), args...)
+}
+
+// ExecContext - ctx のもとで、パラメータに args の値を入れて文を実行する
+func (s *Stmt) ExecContext(ctx context.Context, args ...any) (*Result, error) {
+	if s.closed {
+		return nil, &ClosedError{What: "プリペアド文"}
+	}
+	if s.tx != nil {
+		if s.tx.done {
+			return nil, &ClosedError{What: "トランザクション"}
+		}
+		return s.db.executePrepared(ctx, s.prep, args)
+	}
+	if err := s.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.db.unlock()
+	return s.db.executePrepared(ctx, s.prep, args)
+}
+
+// Query - パラメータに args の値を入れて、行を返す文を実行する
+func (s *Stmt) Query(args ...any) (*Result, error) {
+	return s.ExecContext(context.Background(), args...)
+}
+
+// QueryContext - ctx のもとで、パラメータに args の値を入れて行を返す文を実行する
+func (s *Stmt) QueryContext(ctx context.Context, args ...any) (*Result, error) {
+	return s.ExecContext(ctx, args...)
+}
+
+// Close - プリペアド文を閉じる
+func (s *Stmt) Close() error {
+	s.closed = true
+	return nil
+}
+
+// FormatValue - 値を表示用の文字列にする（NULL は "NULL"。CLI の結果の表と同じ形）
+func FormatValue(v any) string {
+	return formatValue(v)
+}
@@ -0,0 +1,358 @@
+package godb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// copyDir - ディレクトリ src の中身を dst にコピーする（落ちた時点のデータディレクトリの代わり）
+func copyDir(t *testing.T, src, dst string) {
+	t.Helper()
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(filepath.Join(dst, rel))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		t.Fatalf("データディレクトリをコピーできません: %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *Options
+		pageSize int    // 開いたデータベースのページサイズ
+		errorMsg string // エラーメッセージに含まれるはずの文字列（エラーにならないなら空）
+	}{
+		{name: "nil なら既定の設定", opts: nil, pageSize: defaultPageSize},
+		{name: "0 の項目は既定値", opts: &Options{}, pageSize: defaultPageSize},
+		{name: "ページサイズを指定する", opts: &Options{PageSize: 4096, SyncMode: SyncOff}, pageSize: 4096},
+		{name: "2 のべき乗でないページサイズ", opts: &Options{PageSize: 3000}, errorMsg: "ページサイズ 3000"},
+		{name: "小さすぎるページサイズ", opts: &Options{PageSize: 512}, errorMsg: "ページサイズ 512"},
+		{name: "負のバッファプール", opts: &Options{BufferPoolSize: -1}, errorMsg: "バッファプールのページ数 -1"},
+		{name: "知らない書き出しモード", opts: &Options{SyncMode: SyncMode(9)}, errorMsg: "SyncMode(9)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Open(t.TempDir(), tt.opts)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("エラーメッセージに %s が含まれていません: %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("データベースを開けません: %v", err)
+			}
+			defer db.Close()
+			if db.engine.pool.pageSize != tt.pageSize {
+				t.Errorf("ページサイズが一致しません。期待: %d, 実際: %d", tt.pageSize, db.engine.pool.pageSize)
+			}
+		})
+	}
+}
+
+func TestOpenReopen(t *testing.T) {
+	// 既定の設定（SyncFull）で書いた行は、閉じて開き直しても読める
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("データベースを開けません: %v", err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE users (id SERIAL PRIMARY KEY, name TEXT)",
+		"INSERT INTO users (name) VALUES ('Alice'), ('Bob')",
+		"UPDATE users SET name = 'Carol' WHERE id = 2",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("閉じられません: %v", err)
+	}
+
+	db = openTestDBAt(t, dir, "INSERT INTO users (name) VALUES ('Dave')")
+	expected := [][]string{{"1", "Alice"}, {"2", "Carol"}, {"3", "Dave"}}
+	if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("結果が一致しません。期待: %v, 実際: %v", expected, rows)
+	}
+}
+
+func TestTx(t *testing.T) {
+	const setup = "CREATE TABLE users (id SERIAL PRIMARY KEY, name TEXT)"
+	tests := []struct {
+		name     string
+		stmts    []string   // トランザクションの中で実行する文
+		commit   bool       // Commit するか（false なら Rollback）
+		tables   [][]string // 終わったあとの public スキーマのテーブル
+		expected [][]string // 終わったあとの SELECT * FROM users ORDER BY id
+	}{
+		{
+			name:     "Commit した変更は残る",
+			stmts:    []string{"INSERT INTO users (name) VALUES ('Bob')", "UPDATE users SET name = 'Alicia' WHERE id = 1", "CREATE TABLE items (id INT)"},
+			commit:   true,
+			tables:   [][]string{{"items"}, {"users"}},
+			expected: [][]string{{"1", "Alicia"}, {"2", "Bob"}},
+		},
+		{
+			name:     "Rollback で追加・更新・削除を戻す",
+			stmts:    []string{"INSERT INTO users (name) VALUES ('Bob')", "UPDATE users SET name = 'Alicia' WHERE id = 1", "DELETE FROM users WHERE id = 1"},
+			tables:   [][]string{{"users"}},
+			expected: [][]string{{"1", "Alice"}},
+		},
+		{
+			name:     "Rollback で DDL を戻す",
+			stmts:    []string{"CREATE TABLE items (id INT)", "ALTER TABLE users ADD COLUMN age INT DEFAULT 20", "TRUNCATE users"},
+			tables:   [][]string{{"users"}},
+			expected: [][]string{{"1", "Alice"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := openTestDBAt(t, dir, setup, "INSERT INTO users (name) VALUES ('Alice')")
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("トランザクションを開始できません: %v", err)
+			}
+			for _, stmt := range tt.stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					t.Fatalf("%s: %v", stmt, err)
+				}
+			}
+			if tt.commit {
+				err = tx.Commit()
+			} else {
+				err = tx.Rollback()
+			}
+			if err != nil {
+				t.Fatalf("トランザクションを終了できません: %v", err)
+			}
+			if fileExists(filepath.Join(dir, snapshotDirName)) {
+				t.Errorf("スナップショットが残っています")
+			}
+
+			check := func(db *DB) {
+				t.Helper()
+				if rows := queryRows(t, db, "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name"); !reflect.DeepEqual(rows, tt.tables) {
+					t.Errorf("テーブルが一致しません。期待: %v, 実際: %v", tt.tables, rows)
+				}
+				if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, tt.expected) {
+					t.Errorf("結果が一致しません。期待: %v, 実際: %v", tt.expected, rows)
+				}
+			}
+			check(db)
+			// 開き直しても同じ
+			db.Close()
+			check(openTestDBAt(t, dir))
+		})
+	}
+}
+
+func TestTxRecoverSnapshot(t *testing.T) {
+	// トランザクションの途中で落ちたら（snapshot/ が残っていたら）、開いたときに始めた時点に戻す
+	dir := t.TempDir()
+	db := openTestDBAt(t, dir, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)", "INSERT INTO users VALUES (1, 'Alice')")
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("トランザクションを開始できません: %v", err)
+	}
+	for _, stmt := range []string{"INSERT INTO users VALUES (2, 'Bob')", "UPDATE users SET name = 'Alicia' WHERE id = 1", "CREATE TABLE items (id INT)"} {
+		if _, err := tx.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	crashed := t.TempDir()
+	copyDir(t, dir, crashed)
+	tx.Rollback()
+
+	db = openTestDBAt(t, crashed)
+	if fileExists(filepath.Join(crashed, snapshotDirName)) {
+		t.Errorf("スナップショットが残っています")
+	}
+	if rows := queryRows(t, db, "SELECT * FROM users ORDER BY id"); !reflect.DeepEqual(rows, [][]string{{"1", "Alice"}}) {
+		t.Errorf("始めた時点に戻っていません: %v", rows)
+	}
+	if _, err := db.Exec("SELECT * FROM items"); err == nil {
+		t.Errorf("トランザクションの中で作ったテーブルが残っています")
+	}
+	// 戻したあとのインデックスも使える
+	if _, err := db.Exec("INSERT INTO users VALUES (2, 'Bob')"); err != nil {
+		t.Errorf("戻したテーブルに追加できません: %v", err)
+	}
+}
+
+func TestClosedError(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, db *DB) error // db は開いたばかりのデータベース
+		what string                           // ClosedError.What
+	}{
+		{
+			name: "閉じたデータベースで実行する",
+			run: func(t *testing.T, db *DB) error {
+				db.Close()
+				_, err := db.Exec("SELECT 1 FROM users")
+				return err
+			},
+			what: "データベース",
+		},
+		{
+			name: "閉じたデータベースでトランザクションを始める",
+			run: func(t *testing.T, db *DB) error {
+				db.Close()
+				_, err := db.Begin()
+				return err
+			},
+			what: "データベース",
+		},
+		{
+			name: "閉じたデータベースのプリペアド文を実行する",
+			run: func(t *testing.T, db *DB) error {
+				stmt, err := db.Prepare("SELECT * FROM users WHERE id = $1")
+				if err != nil {
+					t.Fatalf("プリペアド文を作れません: %v", err)
+				}
+				db.Close()
+				_, err = stmt.Query(1)
+				return err
+			},
+			what: "データベース",
+		},
+		{
+			name: "Commit したトランザクションで実行する",
+			run: func(t *testing.T, db *DB) error {
+				tx, _ := db.Begin()
+				tx.Commit()
+				_, err := tx.Exec("INSERT INTO users VALUES (1)")
+				return err
+			},
+			what: "トランザクション",
+		},
+		{
+			name: "Rollback したトランザクションを Commit する",
+			run: func(t *testing.T, db *DB) error {
+				tx, _ := db.Begin()
+				tx.Rollback()
+				return tx.Commit()
+			},
+			what: "トランザクション",
+		},
+		{
+			name: "終わったトランザクションのプリペアド文を実行する",
+			run: func(t *testing.T, db *DB) error {
+				tx, _ := db.Begin()
+				stmt, err := tx.Prepare("INSERT INTO users VALUES ($1)")
+				if err != nil {
+					t.Fatalf("プリペアド文を作れません: %v", err)
+				}
+				tx.Commit()
+				_, err = stmt.Exec(1)
+				return err
+			},
+			what: "トランザクション",
+		},
+		{
+			name: "閉じたプリペアド文を実行する",
+			run: func(t *testing.T, db *DB) error {
+				stmt, err := db.Prepare("INSERT INTO users VALUES ($1)")
+				if err != nil {
+					t.Fatalf("プリペアド文を作れません: %v", err)
+				}
+				stmt.Close()
+				_, err = stmt.Exec(1)
+				return err
+			},
+			what: "プリペアド文",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, "CREATE TABLE users (id INT)")
+			err := tt.run(t, db)
+			var closed *ClosedError
+			if !errors.As(err, &closed) || closed.What != tt.what {
+				t.Fatalf("%s の ClosedError になりませんでした: %v", tt.what, err)
+			}
+		})
+	}
+
+	t.Run("閉じたデータベースはもう一度閉じてもよい", func(t *testing.T) {
+		db := openTestDB(t)
+		if err := db.Close(); err != nil {
+			t.Fatalf("閉じられません: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Errorf("2 回目の Close がエラーになりました: %v", err)
+		}
+	})
+
+	t.Run("ゼロ値の DB は止まらずにエラーを返す", func(t *testing.T) {
+		var db DB
+		if _, err := db.Exec("SELECT 1"); err != errNotOpened {
+			t.Errorf("Exec: %v", err)
+		}
+		if _, err := db.Begin(); err != errNotOpened {
+			t.Errorf("Begin: %v", err)
+		}
+		if err := db.Close(); err != errNotOpened {
+			t.Errorf("Close: %v", err)
+		}
+	})
+}
+
+func TestResultCursor(t *testing.T) {
+	db := openTestDB(t, "CREATE TABLE users (id INT)", "INSERT INTO users VALUES (1), (2)")
+	res, err := db.Query("SELECT id FROM users ORDER BY id")
+	if err != nil {
+		t.Fatalf("SELECT: %v", err)
+	}
+	if values := res.Values(); values != nil {
+		t.Errorf("Next を呼ぶ前に値がありました: %v", values)
+	}
+	// 行は読み終えているので、Result を読んでいる間にほかの文を実行してよい
+	if _, err := db.Exec("INSERT INTO users VALUES (3)"); err != nil {
+		t.Fatalf("Result を読んでいる間に実行できません: %v", err)
+	}
+	var ids []any
+	for res.Next() {
+		ids = append(ids, res.Values()[0])
+	}
+	if !reflect.DeepEqual(ids, []any{int64(1), int64(2)}) {
+		t.Errorf("行が一致しません: %v", ids)
+	}
+	if res.Next() || res.Values() != nil {
+		t.Errorf("最後の行のあとに Next が true になりました")
+	}
+}
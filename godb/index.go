@@ -0,0 +1,211 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// インデックス
+//
+// テーブルのインデックスは 2 種類ある
+//   - 主キー・UNIQUE 制約のインデックス（制約と同じ名前。キーはカラム）
+//   - CREATE INDEX で作ったインデックス（キーはカラムか式。UNIQUE を付ければ一意性も確認する）
+//
+// どちらも indexSpec にまとめて扱い、db.indexes[テーブル名] には indexSpecs() と同じ順番で B+Tree を並べる
+// （制約のインデックスが先頭なので、外部キーの確認などで KeyConstraints() の位置で引いても同じ B+Tree になる）
+//
+// 式のインデックスのキーは行ごとに式を評価した値で、WHERE 句に同じ式 = 定数 があればそのインデックスで検索する
+//   CREATE INDEX ON items ((attrs->>'color'));
+//   SELECT * FROM items WHERE attrs->>'color' = 'red'; -- インデックス検索
+
+// indexSpecは 1 つのインデックスのキーの作り方を表す
+type indexSpec struct {
+	Name   string     // インデックス名（制約のインデックスは制約名）
+	Keys   []exprNode // キーの式（カラムのキーは columnRef）
+	Labels []string   // キーの表記（エラーメッセージや SHOW INDEX に使う）
+	Unique bool       // 一意インデックスかどうか
+}
+
+// indexSpecsはテーブルのインデックスの一覧を返す（主キー・UNIQUE 制約が先、CREATE INDEX のインデックスが後）
+func (t *tableSchema) indexSpecs() ([]indexSpec, error) {
+	specs := []indexSpec{}
+	for _, constraint := range t.KeyConstraints() {
+		spec := indexSpec{Name: constraint.Name, Labels: constraint.Columns, Unique: true}
+		for _, col := range constraint.Columns {
+			spec.Keys = append(spec.Keys, &columnRef{Name: col})
+		}
+		specs = append(specs, spec)
+	}
+	for _, index := range t.Indexes {
+		spec := indexSpec{Name: index.Name, Labels: index.Exprs, Unique: index.Unique}
+		for _, text := range index.Exprs {
+			expr, err := parseExpr(text)
+			if err != nil {
+				return nil, fmt.Errorf("インデックス \"%s\" の式が不正です: %v", index.Name, err)
+			}
+			spec.Keys = append(spec.Keys, expr)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// encodeKeyExprsは行に対してキーの式を評価し、インデックスキーに変換する
+func encodeKeyExprs(tableDef *tableSchema, keys []exprNode, row tableRow) (string, error) {
+	env := rowEnv(tableDef, row)
+	var sb strings.Builder
+	for _, key := range keys {
+		value, err := evalExpr(key, env)
+		if err != nil {
+			return "", err
+		}
+		if err := encodeKeyValue(&sb, value); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+// CreateIndex - CREATE INDEX文を実行
+// 既存の行からインデックスを作り、UNIQUE インデックスで重複があれば作らない
+func (db *database) CreateIndex(sql string) (*Result, error) {
+	def, err := parseCreateIndex(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	tableDef, err := db.getTable(def.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// インデックス名はデータベース全体で重ならないようにする（postgres と同じく制約のインデックスとも）
+	for _, other := range db.catalog.Tables {
+		specs, err := other.indexSpecs()
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			if strings.EqualFold(spec.Name, def.Index.Name) {
+				return nil, fmt.Errorf("インデックス '%s' は既に存在します", def.Index.Name)
+			}
+		}
+	}
+
+	// キーの式のカラムが存在し、集約関数を含まないか確認する
+	for _, text := range def.Index.Exprs {
+		expr, err := parseExpr(text)
+		if err != nil {
+			return nil, err
+		}
+		var invalid error
+		walkExpr(expr, func(e exprNode) {
+			if invalid != nil {
+				return
+			}
+			switch e := e.(type) {
+			case *columnRef:
+				if (e.Table != "" && e.Table != tableDef.Name) || tableDef.ColumnIndex(e.Name) < 0 {
+					invalid = fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", e.String(), tableDef.Name)
+				}
+			case *funcCall:
+				if isAggregateFunc(e.Name) {
+					invalid = fmt.Errorf("インデックスのキーに集約関数 %s は使えません", e.Name)
+				}
+			}
+		})
+		if invalid != nil {
+			return nil, invalid
+		}
+	}
+
+	// 既存の行からインデックスを作る（重複や式の評価エラーがあれば元に戻す）
+	tableDef.Indexes = append(tableDef.Indexes, def.Index)
+	if err := db.rebuildIndexes(tableDef.Name); err != nil {
+		tableDef.Indexes = tableDef.Indexes[:len(tableDef.Indexes)-1]
+		if rerr := db.rebuildIndexes(tableDef.Name); rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+	if err := db.commitCatalog(catalogChange{Tables: []*tableSchema{tableDef}}); err != nil {
+		tableDef.Indexes = tableDef.Indexes[:len(tableDef.Indexes)-1]
+		if rerr := db.rebuildIndexes(tableDef.Name); rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+
+	kind := "インデックス"
+	if def.Index.Unique {
+		kind = "一意インデックス"
+	}
+	db.logf("%s '%s' (%s) をテーブル '%s' に作成しました", kind, def.Index.Name, strings.Join(def.Index.Exprs, ", "), tableDef.Name)
+	return newResult("CREATE INDEX"), nil
+}
+
+// staticKindはキーの式の値の型を、行を見ずに決められれば返す
+// WHERE 句の定数をキーの型に合わせてからインデックスを引くのに使う（決められない式ではインデックスを使わない）
+func staticKind(tableDef *tableSchema, e exprNode) (TypeKind, bool) {
+	switch e := e.(type) {
+	case *columnRef:
+		pos := tableDef.ColumnIndex(e.Name)
+		if pos < 0 {
+			return 0, false
+		}
+		return columnType(tableDef.Columns[pos]).Kind, true
+	case *castExpr:
+		return e.Type.Kind, true
+	case *binaryExpr:
+		switch e.Op {
+		case "->>", "||":
+			return TypeText, true
+		case "->":
+			return TypeJSON, true
+		}
+	case *funcCall:
+		switch e.Name {
+		case "json_extract", "upper", "lower":
+			return TypeText, true
+		case "length", "octet_length":
+			return TypeBigInt, true
+		}
+	}
+	return 0, false
+}
+
+// sameExprは 2 つの式が同じ式か（カラムのテーブル名の有無と大文字・小文字の違いは同じとみなす）
+func sameExpr(tableDef *tableSchema, a, b exprNode) bool {
+	switch a := a.(type) {
+	case *columnRef:
+		b, ok := b.(*columnRef)
+		return ok && strings.EqualFold(a.Name, b.Name) &&
+			(a.Table == "" || a.Table == tableDef.Name) && (b.Table == "" || b.Table == tableDef.Name)
+	case *literal:
+		b, ok := b.(*literal)
+		return ok && a.String() == b.String()
+	case *unaryExpr:
+		b, ok := b.(*unaryExpr)
+		return ok && a.Op == b.Op && sameExpr(tableDef, a.Operand, b.Operand)
+	case *binaryExpr:
+		b, ok := b.(*binaryExpr)
+		return ok && a.Op == b.Op && sameExpr(tableDef, a.Left, b.Left) && sameExpr(tableDef, a.Right, b.Right)
+	case *isNullExpr:
+		b, ok := b.(*isNullExpr)
+		return ok && a.Not == b.Not && sameExpr(tableDef, a.Operand, b.Operand)
+	case *castExpr:
+		b, ok := b.(*castExpr)
+		return ok && a.Type == b.Type && sameExpr(tableDef, a.Operand, b.Operand)
+	case *funcCall:
+		b, ok := b.(*funcCall)
+		if !ok || !strings.EqualFold(a.Name, b.Name) || a.Star != b.Star || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i := range a.Args {
+			if !sameExpr(tableDef, a.Args[i], b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package godb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// インデックスのキーは、カラム値の組を「バイト列として比較すると値として比較したのと同じ順序になる」文字列に変換して持つ
+// （MySQL/TiDB などで memcomparable format と呼ばれている方式）
+// こうしておくと B+Tree 側は型を知らなくても文字列の大小比較だけでよく、複合キーも連結するだけで済む
+//
+// 1 つの値は「型タグ 1 バイト + 本体」で表す
+//   - INT  : 符号ビットを反転した 8 バイトのビッグエンディアン（負数が正数より前に並ぶ）
+//   - TEXT : 0x00 を 0x00 0xFF にエスケープし、末尾に 0x00 0x00 を付ける（"a" < "ab" になる）
+//   - BYTEA / JSON: TEXT と同じ（JSON はテキスト表現で比較する）
+//   - BOOL : 0x00 / 0x01 の 1 バイト
+//   - FLOAT: IEEE 754 のビット列を、正数は符号ビットだけ、負数は全ビット反転した 8 バイト
+//   - DECIMAL: 符号 1 バイト + 指数 + 数字の並び（下の encodeDecimal 参照）
+//   - DATE / TIMESTAMP: UNIX 時刻のマイクロ秒を INT と同じ形式で 8 バイト
+//   - NULL : タグのみ。postgres の B-tree と同じく昇順で最後に並ぶよう、他の型より大きいタグにする
+const (
+	keyTagBool      byte = 0x08
+	keyTagInt       byte = 0x10
+	keyTagFloat     byte = 0x11
+	keyTagDecimal   byte = 0x12
+	keyTagText      byte = 0x20
+	keyTagBytes     byte = 0x28
+	keyTagJSON      byte = 0x29
+	keyTagDate      byte = 0x30
+	keyTagTimestamp byte = 0x31
+	keyTagNull      byte = 0xF0
+)
+
+// encodeIndexKey - 行から指定カラムの値を取り出してインデックスキーに変換する
+func encodeIndexKey(tableDef *tableSchema, columns []string, row tableRow) (string, error) {
+	var sb strings.Builder
+	for _, name := range columns {
+		pos := tableDef.ColumnIndex(name)
+		if pos < 0 {
+			return "", fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", name, tableDef.Name)
+		}
+		value, err := decodeRowField(tableDef, row, pos)
+		if err != nil {
+			return "", err
+		}
+		if err := encodeKeyValue(&sb, value); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+// encodeKeyValue - 1 つの値を型に応じてエンコードして sb に追記する
+func encodeKeyValue(sb *strings.Builder, value any) error {
+	switch v := value.(type) {
+	case nil:
+		sb.WriteByte(keyTagNull)
+	case bool:
+		sb.WriteByte(keyTagBool)
+		if v {
+			sb.WriteByte(0x01)
+		} else {
+			sb.WriteByte(0x00)
+		}
+	case int64:
+		sb.WriteByte(keyTagInt)
+		writeKeyUint64(sb, uint64(v)^(1<<63))
+	case float64:
+		bits := math.Float64bits(v)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		sb.WriteByte(keyTagFloat)
+		writeKeyUint64(sb, bits)
+	case Decimal:
+		sb.WriteByte(keyTagDecimal)
+		encodeDecimal(sb, v)
+	case Date:
+		sb.WriteByte(keyTagDate)
+		writeKeyUint64(sb, uint64(v.UnixMicro())^(1<<63))
+	case Timestamp:
+		sb.WriteByte(keyTagTimestamp)
+		writeKeyUint64(sb, uint64(v.UnixMicro())^(1<<63))
+	case string:
+		sb.WriteByte(keyTagText)
+		writeKeyBytes(sb, v)
+	case []byte:
+		sb.WriteByte(keyTagBytes)
+		writeKeyBytes(sb, string(v))
+	case JSON:
+		sb.WriteByte(keyTagJSON)
+		writeKeyBytes(sb, string(v))
+	default:
+		return fmt.Errorf("インデックスのキーにできない値です: %v", value)
+	}
+	return nil
+}
+
+// writeKeyBytes - 0x00 を 0x00 0xFF にエスケープし、終端の 0x00 0x00 を付けて sb に追記する
+func writeKeyBytes(sb *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		sb.WriteByte(s[i])
+		if s[i] == 0x00 {
+			sb.WriteByte(0xFF)
+		}
+	}
+	sb.WriteByte(0x00)
+	sb.WriteByte(0x00)
+}
+
+// writeKeyUint64 - 8 バイトのビッグエンディアンで sb に追記する
+func writeKeyUint64(sb *strings.Builder, n uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	sb.Write(buf[:])
+}
+
+// encodeDecimal - DECIMAL の値を、値の大小とバイト列の大小が一致するようにエンコードする
+// 値を 0.d1d2...dn × 10^exp（d1 は 0 以外）と表して
+//   - 先頭 1 バイト: 負数 0x01 / ゼロ 0x02 / 正数 0x03
+//   - 指数: 符号ビットを反転した 4 バイト（桁数の多い方が大きい）
+//   - 数字: 各桁を '0'〜'9' の 1 バイトで並べ、終端に 0x00
+//
+// 負数は絶対値が大きいほど小さいので、指数と数字のバイトをすべて反転する（終端は 0xFF になる）
+// 1.5 と 1.50 は同じキーになる
+func encodeDecimal(sb *strings.Builder, d Decimal) {
+	sign, digits, exp := d.normalize()
+	if sign == 0 {
+		sb.WriteByte(0x02)
+		return
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(int32(exp))^(1<<31))
+	body := append(buf[:], digits...)
+	body = append(body, 0x00)
+	if sign < 0 {
+		sb.WriteByte(0x01)
+		for i := range body {
+			body[i] = ^body[i]
+		}
+	} else {
+		sb.WriteByte(0x03)
+	}
+	sb.Write(body)
+}
+
+// decodeDecimal - encodeDecimal の逆変換。読んだバイト数も返す
+func decodeDecimal(key string) (Decimal, int, bool) {
+	if len(key) == 0 {
+		return Decimal{}, 0, false
+	}
+	if key[0] == 0x02 {
+		return NewDecimalFromInt(0), 1, true
+	}
+	if len(key) < 5 {
+		return Decimal{}, 0, false
+	}
+	neg := key[0] == 0x01
+	body := []byte(key[1:])
+	terminator := byte(0x00)
+	if neg {
+		terminator = 0xFF
+	}
+	end := -1
+	for i := 4; i < len(body); i++ {
+		if body[i] == terminator {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return Decimal{}, 0, false
+	}
+	body = body[:end]
+	if neg {
+		for i := range body {
+			body[i] = ^body[i]
+		}
+	}
+	exp := int(int32(binary.BigEndian.Uint32(body[:4]) ^ (1 << 31)))
+	digits := string(body[4:])
+	// 0.digits × 10^exp = digits × 10^(exp - len(digits))
+	text := digits + fmt.Sprintf("e%d", exp-len(digits))
+	if neg {
+		text = "-" + text
+	}
+	d, err := ParseDecimal(text)
+	if err != nil {
+		return Decimal{}, 0, false
+	}
+	return d, 1 + end + 1, true
+}
+
+// decodeKeyValues - インデックスキーを値のリストに戻す（壊れたキーは読めたところまで）
+func decodeKeyValues(key string) ([]any, bool) {
+	var values []any
+	for i := 0; i < len(key); {
+		switch key[i] {
+		case keyTagNull:
+			values = append(values, nil)
+			i++
+		case keyTagBool:
+			if i+2 > len(key) {
+				return values, false
+			}
+			values = append(values, key[i+1] == 0x01)
+			i += 2
+		case keyTagInt:
+			if i+9 > len(key) {
+				return values, false
+			}
+			n := int64(binary.BigEndian.Uint64([]byte(key[i+1:i+9])) ^ (1 << 63))
+			values = append(values, n)
+			i += 9
+		case keyTagFloat:
+			if i+9 > len(key) {
+				return values, false
+			}
+			bits := binary.BigEndian.Uint64([]byte(key[i+1 : i+9]))
+			if bits&(1<<63) != 0 {
+				bits &^= 1 << 63
+			} else {
+				bits = ^bits
+			}
+			values = append(values, math.Float64frombits(bits))
+			i += 9
+		case keyTagDecimal:
+			d, n, ok := decodeDecimal(key[i+1:])
+			if !ok {
+				return values, false
+			}
+			values = append(values, d)
+			i += 1 + n
+		case keyTagDate, keyTagTimestamp:
+			if i+9 > len(key) {
+				return values, false
+			}
+			micros := int64(binary.BigEndian.Uint64([]byte(key[i+1:i+9])) ^ (1 << 63))
+			t := time.UnixMicro(micros).UTC()
+			if key[i] == keyTagDate {
+				values = append(values, Date{t})
+			} else {
+				values = append(values, Timestamp{t})
+			}
+			i += 9
+		case keyTagText, keyTagBytes, keyTagJSON:
+			tag := key[i]
+			var sb strings.Builder
+			i++
+			for i < len(key) {
+				if key[i] == 0x00 {
+					if i+1 < len(key) && key[i+1] == 0xFF {
+						sb.WriteByte(0x00)
+						i += 2
+						continue
+					}
+					i += 2
+					break
+				}
+				sb.WriteByte(key[i])
+				i++
+			}
+			switch tag {
+			case keyTagBytes:
+				values = append(values, []byte(sb.String()))
+			case keyTagJSON:
+				values = append(values, JSON(sb.String()))
+			default:
+				values = append(values, sb.String())
+			}
+		default:
+			return values, false
+		}
+	}
+	return values, true
+}
+
+// decodeIndexKey - インデックスキーを人が読める値のリストに戻す（デバッグ表示・エラーメッセージ用）
+func decodeIndexKey(key string) []string {
+	values, ok := decodeKeyValues(key)
+	result := make([]string, 0, len(values)+1)
+	for _, v := range values {
+		result = append(result, formatValue(v))
+	}
+	if !ok {
+		result = append(result, "?")
+	}
+	return result
+}
+
+// keyHasNull - キーに NULL が含まれるか
+// NULL は他のどの値とも（NULL 同士でも）等しくないので、NULL を含むキーは一意性制約の対象外になる
+func keyHasNull(key string) bool {
+	values, _ := decodeKeyValues(key)
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// formatIndexKey - インデックスキーを "(1, Alice)" の形式で表示する
+func formatIndexKey(key string) string {
+	return "(" + strings.Join(decodeIndexKey(key), ", ") + ")"
+}
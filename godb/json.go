@@ -0,0 +1,183 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSON 型
+//
+// 値は JSON のテキストをそのまま持つ（postgres の json 型と同じく、キーの順番や重複はそのまま）
+// INSERT / UPDATE のときに JSON として正しいか確認し、空白を詰めた形にして保存する
+//
+// 取り出しの演算子と関数
+//   - data -> 'key' / data -> 0     : オブジェクトのキー・配列の要素を JSON のまま取り出す
+//   - data ->> 'key' / data ->> 0   : 取り出した値を TEXT にする（文字列は引用符を外し、null は NULL）
+//   - json_extract(data, '$.a.b[0]') : パスで取り出した値を ->> と同じく TEXT にする
+//
+// 見つからないキー・範囲外の要素・オブジェクトでも配列でもない値からの取り出しは NULL になる
+
+// JSONは JSON 型の値（空白を詰めた JSON のテキスト）
+type JSON string
+
+// parseJSONは文字列を JSON として検証し、空白を詰めた JSON の値にする
+func parseJSON(s string) (JSON, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		return "", fmt.Errorf("'%s' は JSON として読めません: %v", s, err)
+	}
+	return JSON(buf.String()), nil
+}
+
+// jsonGetはオブジェクトのキー（string）か配列の要素番号（int64、負数は末尾から）で値を取り出す
+func jsonGet(doc JSON, key any) (JSON, bool, error) {
+	switch k := key.(type) {
+	case string:
+		if !strings.HasPrefix(string(doc), "{") {
+			return "", false, nil
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(doc), &obj); err != nil {
+			return "", false, err
+		}
+		v, ok := obj[k]
+		return JSON(v), ok, nil
+	case int64:
+		if !strings.HasPrefix(string(doc), "[") {
+			return "", false, nil
+		}
+		var arr []json.RawMessage
+		if err := json.Unmarshal([]byte(doc), &arr); err != nil {
+			return "", false, err
+		}
+		if k < 0 {
+			k += int64(len(arr))
+		}
+		if k < 0 || k >= int64(len(arr)) {
+			return "", false, nil
+		}
+		return JSON(arr[k]), true, nil
+	}
+	return "", false, fmt.Errorf("JSON のキーは文字列か整数である必要があります: %s", formatValue(key))
+}
+
+// jsonTextは JSON の値を TEXT にする（文字列は引用符を外す。null は NULL）
+func jsonText(v JSON) (any, error) {
+	switch {
+	case v == "null":
+		return nil, nil
+	case strings.HasPrefix(string(v), `"`):
+		var s string
+		if err := json.Unmarshal([]byte(v), &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return string(v), nil
+}
+
+// evalJSONOpは -> / ->> を評価する
+func evalJSONOp(op string, left, right any) (any, error) {
+	doc, ok := left.(JSON)
+	if !ok {
+		return nil, fmt.Errorf("演算子 %s の左辺は JSON である必要があります: %s 型", op, valueTypeName(left))
+	}
+	v, found, err := jsonGet(doc, right)
+	if err != nil || !found {
+		return nil, err
+	}
+	if op == "->>" {
+		return jsonText(v)
+	}
+	return v, nil
+}
+
+// parseJSONPathは '$.a.b[0]' の形のパスをキー（string）と要素番号（int64）の並びにする
+// キーに . や [ を含む場合は $."a.b" のように二重引用符で囲む
+func parseJSONPath(path string) ([]any, error) {
+	invalid := fmt.Errorf("JSON のパス '%s' が不正です（例: $.a.b[0]）", path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid
+	}
+	var steps []any
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.Index(rest[1:], `"`)
+				if end < 0 {
+					return nil, invalid
+				}
+				steps = append(steps, rest[1:1+end])
+				rest = rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, invalid
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, invalid
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(rest[1:end]), 10, 64)
+			if err != nil {
+				return nil, invalid
+			}
+			steps = append(steps, n)
+			rest = rest[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+	return steps, nil
+}
+
+// jsonExtractは json_extract(data, path) を評価する
+func jsonExtract(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("関数 json_extract の引数の数が正しくありません")
+	}
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	var doc JSON
+	switch v := args[0].(type) {
+	case JSON:
+		doc = v
+	case string:
+		// json_extract('{"a": 1}', '$.a') のように文字列を直接渡した場合
+		var err error
+		if doc, err = parseJSON(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("関数 json_extract の第 1 引数は JSON である必要があります: %s 型", valueTypeName(args[0]))
+	}
+	path, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("関数 json_extract の第 2 引数はパスの文字列である必要があります")
+	}
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		v, found, err := jsonGet(doc, step)
+		if err != nil || !found {
+			return nil, err
+		}
+		doc = v
+	}
+	return jsonText(doc)
+}
@@ -0,0 +1,286 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 字句解析（SQL 文字列 → トークン列）
+// postgres では scan.l（flex）が担当している部分を、手書きの簡単なループで実装する
+// CREATE TABLE のカラム定義や CHECK / DEFAULT の式のように、正規表現では括弧の対応が取れないところで使う
+
+// tokenKindはトークンの種類を表す
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota // 入力の終わり
+	tokenIdent                   // 識別子・キーワード（例: users, SELECT）
+	tokenNumber                  // 数値リテラル（例: 1, 3.14, 1e-3）
+	tokenString                  // 文字列リテラル（例: 'Alice'、クォートは除去済み）
+	tokenSymbol                  // 記号・演算子（例: (, ), ,, =, <=, ||）
+	tokenParam                   // パラメータ（例: $1, ?。prepare.go）
+)
+
+// tokenは字句解析の結果の 1 トークンを表す
+type token struct {
+	Kind   tokenKind // トークンの種類
+	Text   string    // トークンの文字列
+	Pos    int       // SQL 文字列中の開始位置（エラーメッセージ用）
+	Quoted bool      // ダブルクォートで囲まれた識別子かどうか（キーワードとして扱わない）
+}
+
+// 複数文字の記号（長いものから順にマッチさせる）
+var multiCharSymbols = []string{"->>", "->", "<=", ">=", "<>", "!=", "||", "::"}
+
+// tokenizeはSQL文字列をトークン列に分割する
+func tokenize(sql string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			// -- から行末まではコメント
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+
+		case isIdentStart(c):
+			start := i
+			for i < len(sql) && isIdentPart(sql[i]) {
+				i++
+			}
+			tokens = append(tokens, token{Kind: tokenIdent, Text: sql[start:i], Pos: start})
+
+		case c == '"':
+			// ダブルクォートで囲まれた識別子
+			start := i
+			end := strings.IndexByte(sql[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted identifier at position %d", start)
+			}
+			tokens = append(tokens, token{Kind: tokenIdent, Text: sql[i+1 : i+1+end], Pos: start, Quoted: true})
+			i += end + 2
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			start := i
+			for i < len(sql) && (sql[i] >= '0' && sql[i] <= '9' || sql[i] == '.') {
+				i++
+			}
+			// 指数部（1.5e3, 2E-4）
+			if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+				j := i + 1
+				if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+					j++
+				}
+				if j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+					for i = j; i < len(sql) && sql[i] >= '0' && sql[i] <= '9'; i++ {
+					}
+				}
+			}
+			tokens = append(tokens, token{Kind: tokenNumber, Text: sql[start:i], Pos: start})
+
+		case c == '\'':
+			// 文字列リテラル（'' はクォート 1 つのエスケープ）
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(sql) {
+					return nil, fmt.Errorf("unterminated string literal at position %d", start)
+				}
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(sql[i])
+				i++
+			}
+			tokens = append(tokens, token{Kind: tokenString, Text: sb.String(), Pos: start})
+
+		case c == '?':
+			tokens = append(tokens, token{Kind: tokenParam, Text: "?", Pos: i})
+			i++
+
+		case c == '$' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			start := i
+			for i++; i < len(sql) && sql[i] >= '0' && sql[i] <= '9'; i++ {
+			}
+			tokens = append(tokens, token{Kind: tokenParam, Text: sql[start:i], Pos: start})
+
+		default:
+			matched := false
+			for _, sym := range multiCharSymbols {
+				if strings.HasPrefix(sql[i:], sym) {
+					tokens = append(tokens, token{Kind: tokenSymbol, Text: sym, Pos: i})
+					i += len(sym)
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if !strings.ContainsRune("(),;=<>+-*/%.", rune(c)) {
+				return nil, fmt.Errorf("syntax error at or near %q (position %d)", string(c), i)
+			}
+			tokens = append(tokens, token{Kind: tokenSymbol, Text: string(c), Pos: i})
+			i++
+		}
+	}
+	tokens = append(tokens, token{Kind: tokenEOF, Pos: len(sql)})
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// sqlParserはトークン列を先頭から読み進める構文解析器（再帰下降）
+type sqlParser struct {
+	tokens []token
+	pos    int
+
+	allowParams bool // パラメータ（$1, ?）を書いてよい文か（SELECT / INSERT / UPDATE / DELETE）
+	questions   int  // ここまでの ? の数（? は出てきた順に $1, $2, ... になる）
+	numbered    bool // $1 の形のパラメータがあったか（? と混ぜて使えない）
+}
+
+// newSQLParserはSQL文字列をトークンに分割して構文解析器を作る
+func newSQLParser(sql string) (*sqlParser, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlParser{tokens: tokens}, nil
+}
+
+// peekは現在のトークンを返す（読み進めない）
+func (p *sqlParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// peekAtは n 個先のトークンを返す
+func (p *sqlParser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+// nextは現在のトークンを返して 1 つ読み進める
+func (p *sqlParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeywordは現在のトークンが指定キーワードかどうか（大文字小文字は区別しない）
+func (p *sqlParser) isKeyword(keyword string) bool {
+	return isKeywordToken(p.peek(), keyword)
+}
+
+func isKeywordToken(tok token, keyword string) bool {
+	return tok.Kind == tokenIdent && !tok.Quoted && strings.EqualFold(tok.Text, keyword)
+}
+
+// acceptKeywordは指定キーワードの並びが続いていれば読み進めて true を返す
+func (p *sqlParser) acceptKeyword(keywords ...string) bool {
+	for i, keyword := range keywords {
+		if !isKeywordToken(p.peekAt(i), keyword) {
+			return false
+		}
+	}
+	p.pos += len(keywords)
+	return true
+}
+
+// expectKeywordは指定キーワードの並びを読み進める（なければエラー）
+func (p *sqlParser) expectKeyword(keywords ...string) error {
+	if !p.acceptKeyword(keywords...) {
+		return p.errorf("expected %s", strings.Join(keywords, " "))
+	}
+	return nil
+}
+
+// isSymbolは現在のトークンが指定記号かどうか
+func (p *sqlParser) isSymbol(symbol string) bool {
+	tok := p.peek()
+	return tok.Kind == tokenSymbol && tok.Text == symbol
+}
+
+// acceptSymbolは指定記号があれば読み進めて true を返す
+func (p *sqlParser) acceptSymbol(symbol string) bool {
+	if p.isSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expectSymbolは指定記号を読み進める（なければエラー）
+func (p *sqlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("expected %q", symbol)
+	}
+	return nil
+}
+
+// expectIdentは識別子を読み進めてその名前を返す
+func (p *sqlParser) expectIdent() (string, error) {
+	tok := p.peek()
+	if tok.Kind != tokenIdent {
+		return "", p.errorf("expected identifier")
+	}
+	p.pos++
+	return tok.Text, nil
+}
+
+// parseTableNameはテーブル名を読む（information_schema.tables のようにスキーマ名を付けてもよい）
+func (p *sqlParser) parseTableName() (string, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	if !p.acceptSymbol(".") {
+		return name, nil
+	}
+	table, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	return name + "." + table, nil
+}
+
+// expectEOFは入力の終わり（末尾のセミコロンは許可）であることを確認する
+func (p *sqlParser) expectEOF() error {
+	p.acceptSymbol(";")
+	if p.peek().Kind != tokenEOF {
+		return p.errorf("unexpected token")
+	}
+	return nil
+}
+
+// errorfは現在位置を含む構文エラーを作る
+func (p *sqlParser) errorf(format string, args ...any) error {
+	tok := p.peek()
+	near := tok.Text
+	if tok.Kind == tokenEOF {
+		near = "end of input"
+	}
+	return fmt.Errorf("syntax error at or near %q: %s", near, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// lockDataDir - ロックファイルを新規作成できたらロックを取れたものとする（flock のない環境用）
+// クラッシュしてロックファイルが残った場合は、他のプロセスが使っていないことを確かめてから手で消す
+func lockDataDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if os.IsExist(err) {
+		return nil, &DataDirLockedError{Dir: dir}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("データディレクトリ '%s' をロックできません: %v", dir, err)
+	}
+	f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	return f, nil
+}
+
+// unlockDataDir - ロックファイルを閉じて削除する
+func unlockDataDir(f *os.File) error {
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
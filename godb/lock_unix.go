@@ -0,0 +1,38 @@
+//go:build unix
+
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// lockDataDir - データディレクトリのロックファイルに排他ロック（flock）を取る
+// プロセスが終了すればロックは OS が外すので、クラッシュしたあとにロックファイルが残っていても開ける
+func lockDataDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("ロックファイルを開けません: %v", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, &DataDirLockedError{Dir: dir}
+		}
+		return nil, fmt.Errorf("データディレクトリ '%s' をロックできません: %v", dir, err)
+	}
+	// どのプロセスが使っているか分かるように PID を書いておく（ロックそのものは flock）
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return f, nil
+}
+
+// unlockDataDir - ロックを外してロックファイルを閉じる
+func unlockDataDir(f *os.File) error {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return f.Close()
+}
@@ -0,0 +1,27 @@
+package godb
+
+type opType string
+
+// 以下のような状況で、どこまで適用したかを判断するために必要
+// wal がディスクにさえのれば復元できるから、実装としては wal を fsync した時点で、commit 完了になる
+// ディスク上の wal は必ずしもトランザクションが完了したものとは限らず、トランザクションの途中でクラッシュしてしまう場合もある
+// [./study.md](./study.md) を参照
+
+const (
+	opTypeInsert     opType = "INSERT"
+	opTypeUpdate     opType = "UPDATE"
+	opTypeDelete     opType = "DELETE"
+	opTypeBegin      opType = "BEGIN"
+	opTypeCommit     opType = "COMMIT"
+	opTypeRollback   opType = "ROLLBACK"
+	opTypeCheckpoint opType = "CHECKPOINT" // ここまでのトランザクションは反映済み
+)
+
+// カタログの変更（catalog.go）で WAL に記録する操作
+const (
+	opTypeCatalog      opType = "CATALOG"       // カタログ全体の新しい内容（Data に JSON）
+	opTypeCreateFile   opType = "CREATE_FILE"   // テーブルのデータファイルを空で作る（CREATE TABLE / TRUNCATE）
+	opTypeRemoveFiles  opType = "REMOVE_FILES"  // テーブルのデータファイルを消す（DROP TABLE）
+	opTypeRenameFiles  opType = "RENAME_FILES"  // テーブルのデータファイルの名前を変える（Data に新しい名前。ALTER TABLE RENAME TO）
+	opTypeDropSequence opType = "DROP_SEQUENCE" // シーケンスのファイルを消す（DROP TABLE）
+)
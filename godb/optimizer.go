@@ -0,0 +1,855 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+)
+
+// コストに基づくオプティマイザ
+//
+// FROM 句のテーブルの読み方（アクセスパス）と結合の順番の候補を並べて、推定のコストが一番小さいプランを選ぶ
+//   - アクセスパス: seqScan と、インデックスごとの indexScan（キーの先頭から順の等価条件と、その次のキーの範囲条件 < <= > >= で引く）
+//   - 結合: nestedLoopJoin。内側のテーブルのインデックスのキーに「= 外側のテーブルのカラム」の条件があれば、外側の行ごとにインデックスを引く
+//   - 結合の順番: INNER / CROSS JOIN だけなら、テーブルの組み合わせごとに一番安いプランを覚えておく動的計画法で左深の木を選ぶ（System R の方式）
+//     LEFT JOIN があるときと、テーブルが maxJoinSearch より多いときは FROM 句に書いた順のまま
+//
+// WHERE と ON の条件は AND で分けて、1 つのテーブルだけを参照する条件はそのテーブルのスキャンで、
+// 複数のテーブルを参照する条件はそのテーブルが全部そろった結合で評価する
+//
+// コストの単位は postgres と同じく「データファイルの 1 ページを順に読む時間」
+// データファイルはまだページ単位では読めないが、indexScan が行の位置から読むのはページを飛び飛びに読むものとして見積もる
+// 行数と条件の選択率は ANALYZE で集めた統計情報（stats.go）から見積もる
+// 統計情報がなければ、行数はデータファイルの大きさを型から見積もった 1 行の大きさで割って見積もり、選択率は postgres の既定値を使う
+// （一意なカラム（主キー・UNIQUE・一意インデックス）の等価条件だけは 1 / 行数 にする）
+
+const (
+	seqPageCost       = 1.0    // 1 ページを順に読むコスト
+	randomPageCost    = 4.0    // 1 ページを飛び飛びに読むコスト
+	cpuTupleCost      = 0.01   // 1 行を処理するコスト
+	cpuIndexTupleCost = 0.005  // インデックスの 1 エントリを処理するコスト
+	cpuOperatorCost   = 0.0025 // 1 つの条件（演算子）を評価するコスト
+
+	defaultEqSel   = 0.005     // 等価条件の選択率
+	defaultIneqSel = 1.0 / 3.0 // 範囲条件の選択率
+	defaultNullSel = 0.005     // IS NULL の選択率
+	defaultSel     = 0.5       // それ以外の条件の選択率
+
+	defaultNumGroups = 200 // GROUP BY のグループの数の既定値（postgres の DEFAULT_NUM_DISTINCT）
+
+	maxJoinSearch = 8 // 結合の順番を探すテーブルの数の上限（組み合わせが 2^n 通りあるので）
+)
+
+// relation - オプティマイザから見た FROM 句の 1 つのテーブル
+type relation struct {
+	rows     float64    // 推定の行数
+	pages    float64    // データファイルのページ数
+	isView   bool       // システムビューか
+	viewRows []tableRow // システムビューの行
+}
+
+// predicate - WHERE / ON の条件を AND で分けた 1 つの条件
+type predicate struct {
+	expr    exprNode
+	sources uint64  // 参照しているテーブル（scope.sources の番号のビット）
+	sel     float64 // 選択率（条件が TRUE になる行の割合の推定）
+}
+
+// planPath - プランの候補
+type planPath struct {
+	op   operator
+	rows float64 // 返す行数の推定（nestedLoopJoin の内側で外側の値で引くスキャンは、外側の 1 行あたり）
+	cost float64 // 全部の行を返すまでのコストの推定
+
+	keyConds []predicate // 外側の行の値でインデックスを引くのに使った結合の条件（引いた行では必ず成り立つ）
+}
+
+// optimizer - 1 つの SELECT 文のプランを選ぶ
+type optimizer struct {
+	db   *database
+	sc   *scope
+	rels []relation
+}
+
+func newOptimizer(db *database, sc *scope) (*optimizer, error) {
+	o := &optimizer{db: db, sc: sc}
+	for _, src := range sc.sources {
+		// システムビュー（information_schema.tables など）はカタログから作った行を返す
+		if view, ok := lookupSystemView(src.tableDef.Name); ok {
+			rows, err := db.scanSystemView(view)
+			if err != nil {
+				return nil, err
+			}
+			o.rels = append(o.rels, relation{rows: float64(len(rows)), isView: true, viewRows: rows})
+			continue
+		}
+		o.rels = append(o.rels, estimateRelation(src.tableDef, db.pool.pageSize))
+	}
+	return o, nil
+}
+
+// estimateRelation - データファイルの大きさからテーブルの行数とページ数を見積もる
+// 統計情報があれば、ANALYZE したときの 1 バイトあたりの行数が今も同じとして見積もる
+func estimateRelation(tableDef *tableSchema, pageSize int) relation {
+	var size int64
+	if info, err := os.Stat(tableFileName(tableDef.path)); err == nil {
+		size = info.Size()
+	}
+	rel := relation{
+		rows:  float64(size) / float64(estimatedRowWidth(tableDef)),
+		pages: math.Ceil(float64(size) / float64(pageSize)),
+	}
+	if stats := tableDef.Stats; stats != nil && stats.FileSize > 0 {
+		rel.rows = stats.RowCount * float64(size) / float64(stats.FileSize)
+	}
+	return rel
+}
+
+// estimatedRowWidth - データファイルの 1 行の大きさの見積もり（バイト。版のフィールドと区切りの文字を含む）
+func estimatedRowWidth(tableDef *tableSchema) int {
+	width := len(rowVersionPrefix) + 2
+	for _, col := range tableDef.Columns {
+		width += 1 + estimatedFieldWidth(columnType(col).Kind)
+	}
+	return width
+}
+
+// estimatedFieldWidth - 型ごとのフィールドの大きさの見積もり（バイト）
+func estimatedFieldWidth(kind TypeKind) int {
+	switch kind {
+	case TypeBoolean:
+		return 1
+	case TypeInt, TypeBigInt:
+		return 4
+	case TypeFloat, TypeDecimal:
+		return 8
+	case TypeDate:
+		return 10
+	case TypeTimestamp:
+		return 19
+	}
+	return 16 // TEXT / VARCHAR / BYTEA / JSON
+}
+
+// clampRows - 行数の推定を 1 以上の整数にする（postgres の clamp_row_est と同じ）
+func clampRows(rows float64) float64 {
+	if rows <= 1 {
+		return 1
+	}
+	return math.Round(rows)
+}
+
+// annotate - プランの候補の見積もりを演算子に記録する（EXPLAIN で表示する）
+// FROM 句の演算子は読んだ行をすぐに返すので、最初の行までのコストは 0 とする
+func (p planPath) annotate() planPath {
+	e := p.op.(explainable).est()
+	e.rows, e.totalCost = p.rows, p.cost
+	return p
+}
+
+// estimateOutput - SELECT 句・集約・ORDER BY・LIMIT の演算子の行数とコストを、子の演算子の見積もりから見積もる（plan.go の planOutput で使う）
+//   - Aggregate と Sort は子の行を全部読んでから最初の行を返すので、最初の行までのコストに子の全部のコストが入る
+//   - Sort の比較の回数は n log2 n（postgres の cost_sort と同じく、1 回の比較のコストを 2 × cpuOperatorCost とする）
+//   - Limit は子のコストのうち、読む行の割合の分だけかかるとする
+func estimateOutput(op operator) {
+	switch op := op.(type) {
+	case *project:
+		in := op.child.(explainable).est()
+		op.rows, op.startupCost = in.rows, in.startupCost
+		op.totalCost = in.totalCost + in.rows*float64(len(op.items))*cpuOperatorCost
+	case *aggregate:
+		in := op.child.(explainable).est()
+		groups := 1.0
+		if len(op.groupBy) > 0 {
+			groups = clampRows(math.Min(in.rows, defaultNumGroups))
+		}
+		op.rows = groups
+		op.startupCost = in.totalCost + in.rows*float64(len(op.groupBy)+len(op.items))*cpuOperatorCost
+		op.totalCost = op.startupCost + groups*cpuTupleCost
+	case *sortOp:
+		in := op.child.(explainable).est()
+		n := math.Max(in.rows, 2)
+		op.rows = in.rows
+		op.startupCost = in.totalCost + 2*cpuOperatorCost*n*math.Log2(n)
+		op.totalCost = op.startupCost + in.rows*cpuOperatorCost
+	case *limit:
+		in := op.child.(explainable).est()
+		offset := math.Min(float64(op.offset), in.rows)
+		rows := in.rows - offset
+		if op.limit != nil {
+			rows = math.Min(rows, float64(*op.limit))
+		}
+		op.rows = clampRows(rows)
+		op.startupCost, op.totalCost = in.startupCost, in.totalCost
+		if in.rows > 0 {
+			run := in.totalCost - in.startupCost
+			op.startupCost = in.startupCost + run*offset/in.rows
+			op.totalCost = in.startupCost + run*(offset+rows)/in.rows
+		}
+	}
+}
+
+// planFrom - FROM 句のテーブルを読んで結合し、WHERE 句で絞り込むプランを選ぶ
+func (o *optimizer) planFrom(selectDef *selectDef) (operator, error) {
+	if len(o.sc.sources) == 1 {
+		path, err := o.bestScan(0, o.predicates(selectDef.Where), nil, 0)
+		return path.op, err
+	}
+	reorder := len(o.sc.sources) <= maxJoinSearch
+	for _, join := range selectDef.Joins {
+		if join.Kind == "LEFT" {
+			reorder = false
+		}
+	}
+	if reorder {
+		return o.searchJoinOrder(selectDef)
+	}
+	return o.fixedJoinOrder(selectDef)
+}
+
+// searchJoinOrder - INNER / CROSS JOIN だけの FROM 句で、一番安い結合の順番を探す
+// best[テーブルの集合] にその集合を結合する一番安いプランを、小さい集合から順に作っていく
+func (o *optimizer) searchJoinOrder(selectDef *selectDef) (operator, error) {
+	n := len(o.sc.sources)
+	preds := o.predicates(selectDef.Where)
+	for _, join := range selectDef.Joins {
+		preds = append(preds, o.predicates(join.On)...)
+	}
+
+	// 定数だけの条件は最後に、1 つのテーブルの条件はスキャンで、それ以外は結合で評価する
+	var top, joinPreds []predicate
+	filters := make([][]predicate, n)
+	for _, p := range preds {
+		switch {
+		case p.sources == 0:
+			top = append(top, p)
+		case bits.OnesCount64(p.sources) == 1:
+			i := bits.TrailingZeros64(p.sources)
+			filters[i] = append(filters[i], p)
+		default:
+			joinPreds = append(joinPreds, p)
+		}
+	}
+
+	best := make(map[uint64]planPath)
+	for i := 0; i < n; i++ {
+		path, err := o.bestScan(i, filters[i], nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		best[1<<i] = path
+	}
+	// 集合から 1 つのテーブルを除いた集合（数としては必ず小さい）のプランは先に作ってある
+	all := uint64(1)<<n - 1
+	for set := uint64(1); set <= all; set++ {
+		if bits.OnesCount64(set) < 2 {
+			continue
+		}
+		for j := 0; j < n; j++ {
+			if set&(1<<j) == 0 {
+				continue
+			}
+			outerSet := set &^ (1 << j)
+			path, err := o.joinPath(best[outerSet], outerSet, j, filters[j], joinConds(joinPreds, outerSet, j), "")
+			if err != nil {
+				return nil, err
+			}
+			if cur, ok := best[set]; !ok || path.cost < cur.cost {
+				best[set] = path
+			}
+		}
+	}
+	return o.withFilter(best[all], top).op, nil
+}
+
+// fixedJoinOrder - FROM 句に書いた順に結合する（LEFT JOIN があるとき、テーブルが多いとき）
+// WHERE の条件のうち最初のテーブルだけを参照するものはスキャンで評価する（LEFT JOIN でも最初のテーブルの行は必ず残る）
+// ON の条件のうち内側のテーブルだけを参照するものは内側のスキャンで評価する
+func (o *optimizer) fixedJoinOrder(selectDef *selectDef) (operator, error) {
+	var top, first []predicate
+	for _, p := range o.predicates(selectDef.Where) {
+		if p.sources == 1 {
+			first = append(first, p)
+		} else {
+			top = append(top, p)
+		}
+	}
+	path, err := o.bestScan(0, first, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	outerSet := uint64(1)
+	for k, join := range selectDef.Joins {
+		j := k + 1
+		var filters, conds []predicate
+		for _, p := range o.predicates(join.On) {
+			if p.sources>>(j+1) != 0 {
+				return nil, fmt.Errorf("JOIN の ON 句で後ろの JOIN のテーブルは参照できません: %s", p.expr.String())
+			}
+			if p.sources == 1<<j {
+				filters = append(filters, p)
+			} else {
+				conds = append(conds, p)
+			}
+		}
+		if path, err = o.joinPath(path, outerSet, j, filters, conds, join.Kind); err != nil {
+			return nil, err
+		}
+		outerSet |= 1 << j
+	}
+	return o.withFilter(path, top).op, nil
+}
+
+// joinConds - 外側のテーブル（outerSet）に j 番目のテーブルをつないだところで評価する結合の条件
+// j 番目のテーブルを参照し、ほかには外側のテーブルだけを参照する条件（外側だけを参照する条件は外側のプランで評価済み）
+func joinConds(joinPreds []predicate, outerSet uint64, j int) []predicate {
+	set := outerSet | 1<<j
+	var conds []predicate
+	for _, p := range joinPreds {
+		if p.sources&(1<<j) != 0 && p.sources&^set == 0 {
+			conds = append(conds, p)
+		}
+	}
+	return conds
+}
+
+// joinPath - outer のプランに j 番目のテーブルを nestedLoopJoin でつなぐ
+// conds を結合の条件にする（kind が空なら条件があるかどうかで INNER / CROSS）
+func (o *optimizer) joinPath(outer planPath, outerSet uint64, j int, filters, conds []predicate, kind string) (planPath, error) {
+	if kind == "" {
+		kind = "INNER"
+		if len(conds) == 0 {
+			kind = "CROSS"
+		}
+	}
+
+	inner, err := o.bestScan(j, filters, conds, outerSet)
+	if err != nil {
+		return planPath{}, err
+	}
+	rows := outer.rows * o.rels[j].rows * selectivityOf(filters) * selectivityOf(conds)
+	if kind == "LEFT" {
+		rows = math.Max(rows, outer.rows)
+	}
+	// 内側のインデックスを引くのに使った条件は、結合でもう一度評価しない
+	var rest []predicate
+	for _, p := range conds {
+		if !containsPredicate(inner.keyConds, p) {
+			rest = append(rest, p)
+		}
+	}
+	// 内側は外側の行の数だけ読み直す
+	cost := outer.cost + outer.rows*inner.cost + outer.rows*inner.rows*(cpuTupleCost+float64(len(rest))*cpuOperatorCost)
+	return planPath{
+		op:   &nestedLoopJoin{scope: o.sc, kind: kind, left: outer.op, right: inner.op, on: andPredicates(rest)},
+		rows: clampRows(rows),
+		cost: cost,
+	}.annotate(), nil
+}
+
+// withFilter - プランの上に残りの条件の Filter を重ねる
+func (o *optimizer) withFilter(path planPath, preds []predicate) planPath {
+	if len(preds) == 0 {
+		return path
+	}
+	return planPath{
+		op:   &filter{scope: o.sc, child: path.op, cond: andPredicates(preds)},
+		rows: clampRows(path.rows * selectivityOf(preds)),
+		cost: path.cost + path.rows*float64(len(preds))*cpuOperatorCost,
+	}.annotate()
+}
+
+// bestScan - i 番目のテーブルを読む一番安いスキャンを選ぶ
+// filters はスキャンで評価する条件。joinPreds は外側のテーブル（outer のビット）とこのテーブルを結ぶ条件で、
+// インデックスのキーの等価条件なら外側の行の値でインデックスを引くのに使う
+func (o *optimizer) bestScan(i int, filters, joinPreds []predicate, outer uint64) (planPath, error) {
+	rel := o.rels[i]
+	filter := andPredicates(filters)
+	rows := clampRows(rel.rows * selectivityOf(filters))
+	if rel.isView {
+		return planPath{
+			op:   &rowsScan{scope: o.sc, source: i, rows: rel.viewRows, filter: filter},
+			rows: rows,
+			cost: rel.rows * (cpuTupleCost + float64(len(filters))*cpuOperatorCost),
+		}.annotate(), nil
+	}
+
+	best := planPath{
+		op:   &seqScan{scope: o.sc, source: i, filter: filter, pool: o.db.pool, cancelled: o.db.cancelled},
+		rows: rows,
+		cost: rel.pages*seqPageCost + rel.rows*(cpuTupleCost+float64(len(filters))*cpuOperatorCost),
+	}
+	tableDef := o.sc.sources[i].tableDef
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return planPath{}, err
+	}
+	indexes := o.db.indexes[tableDef.Name]
+	for k, spec := range specs {
+		if k >= len(indexes) {
+			break
+		}
+		path, ok := o.indexPath(i, spec, indexes[k], filters, joinPreds, outer)
+		if ok && path.cost < best.cost {
+			best = path
+		}
+	}
+	return best.annotate(), nil
+}
+
+// indexPath - インデックスで引く indexScan を作る（キーに使える条件がなければ false）
+func (o *optimizer) indexPath(i int, spec indexSpec, btree *btree, filters, joinPreds []predicate, outer uint64) (planPath, bool) {
+	rel := o.rels[i]
+	scan := &indexScan{scope: o.sc, source: i, index: btree, pool: o.db.pool, cancelled: o.db.cancelled}
+
+	// キーの先頭から順に、等価条件（= 定数、= 外側のテーブルのカラム）で引けるだけ引く
+	// インデックスで引いた条件（Index Cond）は、引いた行では必ず成り立つので filter からは除く
+	keySel, joinSel := 1.0, 1.0
+	var conds, joinConds []predicate
+	for _, key := range spec.Keys {
+		value, p, isJoin, ok := o.keyEquality(i, key, filters, joinPreds, outer)
+		if !ok {
+			break
+		}
+		scan.eq = append(scan.eq, value)
+		keySel *= p.sel
+		if isJoin {
+			joinSel *= p.sel
+			joinConds = append(joinConds, p)
+		} else {
+			conds = append(conds, p)
+		}
+	}
+	scan.full = len(scan.eq) == len(spec.Keys)
+
+	// その次のキーは範囲条件で絞る
+	if !scan.full {
+		key := spec.Keys[len(scan.eq)]
+		for _, p := range filters {
+			bound, lower, ok := o.keyRange(i, key, p)
+			switch {
+			case !ok:
+				continue
+			case lower && scan.lower == nil:
+				scan.lower = bound
+			case !lower && scan.upper == nil:
+				scan.upper = bound
+			default:
+				continue
+			}
+			keySel *= p.sel
+			conds = append(conds, p)
+		}
+	}
+	if len(scan.eq) == 0 && scan.lower == nil && scan.upper == nil {
+		return planPath{}, false
+	}
+	var rest []predicate
+	for _, p := range filters {
+		if !containsPredicate(conds, p) {
+			rest = append(rest, p)
+		}
+	}
+	scan.filter = andPredicates(rest)
+
+	matched := rel.rows * keySel
+	if scan.full && spec.Unique {
+		matched = math.Min(matched, 1)
+	}
+	matched = clampRows(matched)
+	// B+Tree を根から降りて、一致したエントリごとに残りの filter の条件を評価する。行はデータファイルの前の部分を順に読んで取り出す
+	descent := math.Ceil(math.Log(rel.rows+1)/math.Log(btreeOrder)) * cpuOperatorCost
+	cost := descent + matched*(cpuIndexTupleCost+float64(len(rest))*cpuOperatorCost) +
+		fetchCost(rel, o.lastPosition(scan, rel, matched, outer))
+	return planPath{
+		op:       scan,
+		rows:     clampRows(rel.rows * selectivityOf(filters) * joinSel),
+		cost:     cost,
+		keyConds: joinConds,
+	}, true
+}
+
+// fetchCost - indexScan がインデックスで引いた行をデータファイルから読むコスト
+// インデックスの値は行の位置（データファイルの何行目か）で、位置からページを直接は読めないので、
+// ReadRowsAt はデータファイルを先頭から一番後ろの位置 last まで順に読む（storage.go）
+// そのため、行を飛び飛びに読むのではなく、データファイルの last 行目までの部分を seqScan と同じく順に読むコストになる
+func fetchCost(rel relation, last float64) float64 {
+	frac := math.Min(last/math.Max(rel.rows, 1), 1)
+	return frac * (math.Max(rel.pages, 1)*seqPageCost + rel.rows*cpuTupleCost)
+}
+
+// lastPosition - インデックスで引く行のうち一番後ろの位置（先頭からその行までの行数）の見積もり
+// キーがすべて定数の等価条件ならインデックスを引いて確かめる（id = 1 は先頭の 1 ページだけ、id = 19999 はほぼ全部を読む）
+// それ以外（範囲条件・パラメータ・外側のテーブルのカラムで引く場合）は、一致する matched 行が
+// データファイルに一様に散らばっているとして、一番後ろの位置の期待値 rows × matched / (matched + 1) にする
+func (o *optimizer) lastPosition(scan *indexScan, rel relation, matched float64, outer uint64) float64 {
+	probe := scan.full && outer == 0
+	for _, e := range scan.eq {
+		if _, ok := e.(*paramExpr); ok {
+			probe = false
+		}
+	}
+	if probe {
+		if positions, err := scan.search(); err == nil {
+			last := 0
+			for _, pos := range positions {
+				last = max(last, pos+1)
+			}
+			return float64(last)
+		}
+	}
+	return rel.rows * matched / (matched + 1)
+}
+
+// containsPredicate - preds に p と同じ条件があるか
+func containsPredicate(preds []predicate, p predicate) bool {
+	for _, q := range preds {
+		if q.expr == p.expr {
+			return true
+		}
+	}
+	return false
+}
+
+// keyEquality - インデックスのキーの式との等価条件を探して、キーの値の式を返す
+// 定数との比較（filters）はキーの型に変換した定数を、外側のテーブルのカラムとの比較（joinPreds）はそのカラムを返す
+func (o *optimizer) keyEquality(i int, key exprNode, filters, joinPreds []predicate, outer uint64) (exprNode, predicate, bool, bool) {
+	tableDef := o.keyTable(i)
+	for _, p := range filters {
+		bin, ok := p.expr.(*binaryExpr)
+		if !ok || bin.Op != "=" {
+			continue
+		}
+		expr, lit := exprAndLiteral(bin)
+		if expr == nil || !sameExpr(tableDef, key, expr) {
+			continue
+		}
+		if value, ok := keyValue(tableDef, key, lit); ok {
+			return value, p, false, true
+		}
+	}
+	// プリペアド文のパラメータも定数と同じく使う（値は実行するたびにスキャンを開くときに評価する）
+	for _, p := range filters {
+		bin, ok := p.expr.(*binaryExpr)
+		if !ok || bin.Op != "=" {
+			continue
+		}
+		expr, param := exprAndParam(bin)
+		if expr != nil && sameExpr(tableDef, key, expr) && keyParam(tableDef, key, param) {
+			return param, p, false, true
+		}
+	}
+
+	kind, ok := staticKind(tableDef, key)
+	if !ok {
+		return nil, predicate{}, false, false
+	}
+	for _, p := range joinPreds {
+		bin, ok := p.expr.(*binaryExpr)
+		if !ok || bin.Op != "=" {
+			continue
+		}
+		for _, pair := range [][2]exprNode{{bin.Left, bin.Right}, {bin.Right, bin.Left}} {
+			self, other := pair[0], pair[1]
+			if o.sourcesOf(self) != 1<<i || !sameExpr(tableDef, key, self) {
+				continue
+			}
+			// 外側のテーブルのカラムで、キーと同じ型のものだけ（型が違うと値の変換が要るので使わない）
+			ref, ok := other.(*columnRef)
+			if !ok {
+				continue
+			}
+			src, pos, err := o.sc.resolve(ref)
+			if err != nil || outer&(1<<src) == 0 {
+				continue
+			}
+			if sameKeyKind(kind, columnType(o.sc.sources[src].tableDef.Columns[pos]).Kind) {
+				return ref, p, true, true
+			}
+		}
+	}
+	return nil, predicate{}, false, false
+}
+
+// keyRange - 条件がインデックスのキーの式と定数の範囲条件なら、範囲の端を返す（下限なら lower が true）
+func (o *optimizer) keyRange(i int, key exprNode, p predicate) (*keyBound, bool, bool) {
+	bin, ok := p.expr.(*binaryExpr)
+	if !ok {
+		return nil, false, false
+	}
+	op := bin.Op
+	// 5 < col は col > 5 として扱う（$1 < col も同じ）
+	_, litLeft := bin.Left.(*literal)
+	_, paramLeft := bin.Left.(*paramExpr)
+	if litLeft || paramLeft {
+		op = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}[op]
+	}
+	if op != "<" && op != "<=" && op != ">" && op != ">=" {
+		return nil, false, false
+	}
+	tableDef := o.keyTable(i)
+	var value exprNode
+	if expr, lit := exprAndLiteral(bin); expr != nil && sameExpr(tableDef, key, expr) {
+		value, ok = keyValue(tableDef, key, lit)
+	} else if expr, param := exprAndParam(bin); expr != nil && sameExpr(tableDef, key, expr) {
+		value, ok = param, keyParam(tableDef, key, param)
+	} else {
+		ok = false
+	}
+	if !ok {
+		return nil, false, false
+	}
+	return &keyBound{value: value, inclusive: op == "<=" || op == ">="}, op == ">" || op == ">=", true
+}
+
+// keyTable - sameExpr でキーの式と条件の式を比べるためのテーブル定義（別名で書いたカラム参照も同じカラムとみなす）
+func (o *optimizer) keyTable(i int) *tableSchema {
+	src := o.sc.sources[i]
+	if src.alias == src.tableDef.Name {
+		return src.tableDef
+	}
+	aliased := *src.tableDef
+	aliased.Name = src.alias
+	return &aliased
+}
+
+// keyValue - 定数をキーの型に合わせた値の式にする（NULL や変換できない定数なら false）
+// 比較のときと同じく、型のない文字列リテラルはキーの型の表記として読み、それ以外は暗黙の変換だけを使う
+// 暗黙に変換できない場合（INT のカラムと 1.5 の比較など）はインデックスを使わず全件を評価する
+func keyValue(tableDef *tableSchema, key exprNode, lit *literal) (exprNode, bool) {
+	kind, ok := staticKind(tableDef, key)
+	if !ok || lit.Value == nil {
+		return nil, false
+	}
+	ctx := castImplicit
+	if isUnknownLiteral(lit) {
+		ctx = castExplicit
+	}
+	value, err := castValue(lit.Value, SQLType{Kind: kind}, ctx)
+	if err != nil {
+		return nil, false
+	}
+	return valueExpr(value), true
+}
+
+// keyParam - パラメータをそのままキーの値に使えるか（パラメータの型がキーの型と同じエンコードになるときだけ）
+// 型の決まらなかったパラメータは値の型がわからないので使わない
+func keyParam(tableDef *tableSchema, key exprNode, param *paramExpr) bool {
+	kind, ok := staticKind(tableDef, key)
+	return ok && param.Type != nil && sameKeyKind(kind, param.Type.Kind)
+}
+
+// sameKeyKind - 2 つの型の値がインデックスのキーとして同じエンコードになるか
+func sameKeyKind(a, b TypeKind) bool {
+	integer := func(k TypeKind) bool { return k == TypeInt || k == TypeBigInt }
+	text := func(k TypeKind) bool { return k == TypeText || k == TypeVarchar }
+	return a == b || (integer(a) && integer(b)) || (text(a) && text(b))
+}
+
+// predicates - 条件を AND で分ける
+func (o *optimizer) predicates(e exprNode) []predicate {
+	if e == nil {
+		return nil
+	}
+	preds := []predicate{}
+	for _, cond := range splitConjuncts(e) {
+		preds = append(preds, predicate{expr: cond, sources: o.sourcesOf(cond), sel: o.selectivity(cond)})
+	}
+	return preds
+}
+
+// sourcesOf - 式が参照しているテーブルのビット
+// 解決できないカラム参照（存在しないカラムなど）や nextval を含む式は、全部のテーブルがそろってから評価する
+func (o *optimizer) sourcesOf(e exprNode) uint64 {
+	all := uint64(1)<<len(o.sc.sources) - 1
+	var set uint64
+	walkExpr(e, func(e exprNode) {
+		switch e := e.(type) {
+		case *columnRef:
+			i, _, err := o.sc.resolve(e)
+			if err != nil {
+				set = all
+				return
+			}
+			set |= 1 << i
+		case *sequenceCall:
+			set = all
+		}
+	})
+	return set
+}
+
+// selectivity - 条件が TRUE になる行の割合を見積もる
+func (o *optimizer) selectivity(e exprNode) float64 {
+	switch e := e.(type) {
+	case *binaryExpr:
+		switch e.Op {
+		case "AND":
+			return o.selectivity(e.Left) * o.selectivity(e.Right)
+		case "OR":
+			left, right := o.selectivity(e.Left), o.selectivity(e.Right)
+			return left + right - left*right
+		case "=":
+			return o.eqSelectivity(e)
+		case "<>":
+			// NULL の行は <> でも TRUE にならない
+			if stats, _, _, ok := o.columnStats(e.Left); ok {
+				return math.Max(1-o.eqSelectivity(e)-stats.NullFrac, 0)
+			}
+			if stats, _, _, ok := o.columnStats(e.Right); ok {
+				return math.Max(1-o.eqSelectivity(e)-stats.NullFrac, 0)
+			}
+			return 1 - o.eqSelectivity(e)
+		case "<", "<=", ">", ">=":
+			return o.rangeSelectivity(e)
+		}
+	case *unaryExpr:
+		if e.Op == "NOT" {
+			return 1 - o.selectivity(e.Operand)
+		}
+	case *isNullExpr:
+		nullFrac := defaultNullSel
+		if stats, _, _, ok := o.columnStats(e.Operand); ok {
+			nullFrac = stats.NullFrac
+		}
+		if e.Not {
+			return 1 - nullFrac
+		}
+		return nullFrac
+	case *literal:
+		if e.Value == true {
+			return 1
+		}
+		return 0
+	}
+	return defaultSel
+}
+
+// eqSelectivity - a = b の選択率
+// カラム = 定数で統計情報があれば最頻値と値の種類の数から、それ以外は値の種類の数が分かるカラムがあれば 1 / 種類の数、なければ既定値
+func (o *optimizer) eqSelectivity(bin *binaryExpr) float64 {
+	if expr, lit := exprAndLiteral(bin); expr != nil {
+		if stats, col, rows, ok := o.columnStats(expr); ok {
+			if v, ok := literalAs(col, lit); ok {
+				return stats.eqSelectivity(col, v, rows)
+			}
+		}
+	}
+	distinct := 0.0
+	for _, e := range []exprNode{bin.Left, bin.Right} {
+		if n, ok := o.distinctValues(e); ok {
+			distinct = math.Max(distinct, n)
+		}
+	}
+	if distinct == 0 {
+		return defaultEqSel
+	}
+	return 1 / distinct
+}
+
+// rangeSelectivity - カラムと定数の大小比較（< <= > >=）の選択率（統計情報がなければ既定値）
+func (o *optimizer) rangeSelectivity(bin *binaryExpr) float64 {
+	expr, lit := exprAndLiteral(bin)
+	if expr == nil {
+		return defaultIneqSel
+	}
+	stats, col, _, ok := o.columnStats(expr)
+	if !ok {
+		return defaultIneqSel
+	}
+	v, ok := literalAs(col, lit)
+	if !ok {
+		return defaultIneqSel
+	}
+	op := bin.Op
+	// 5 < col は col > 5 として扱う
+	if expr == bin.Right {
+		op = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}[op]
+	}
+	switch op {
+	case "<", "<=":
+		return stats.ltSelectivity(col, v, op == "<=")
+	}
+	// col > v は NULL でも col <= v でもない行
+	return math.Max(1-stats.NullFrac-stats.ltSelectivity(col, v, op == ">"), 0)
+}
+
+// columnStats - 式が統計情報のあるテーブルのカラムなら、その統計情報とカラムとテーブルの推定の行数を返す
+func (o *optimizer) columnStats(e exprNode) (*columnStats, columnDef, float64, bool) {
+	ref, ok := e.(*columnRef)
+	if !ok {
+		return nil, columnDef{}, 0, false
+	}
+	i, pos, err := o.sc.resolve(ref)
+	if err != nil || o.rels[i].isView {
+		return nil, columnDef{}, 0, false
+	}
+	col := o.sc.sources[i].tableDef.Columns[pos]
+	stats := o.sc.sources[i].tableDef.Stats.columnStats(col)
+	if stats == nil {
+		return nil, columnDef{}, 0, false
+	}
+	return stats, col, o.rels[i].rows, true
+}
+
+// literalAs - 定数をカラムの型の値にする（比較のときと同じ規則。変換できなければ false）
+func literalAs(col columnDef, lit *literal) (any, bool) {
+	ctx := castImplicit
+	if isUnknownLiteral(lit) {
+		ctx = castExplicit
+	}
+	v, err := castValue(lit.Value, columnType(col), ctx)
+	return v, err == nil
+}
+
+// distinctValues - 式がカラムで、値の種類の数が分かれば返す（統計情報の n_distinct、なければ一意なカラムなら行数）
+func (o *optimizer) distinctValues(e exprNode) (float64, bool) {
+	if stats, _, rows, ok := o.columnStats(e); ok {
+		return stats.distinctValues(rows), true
+	}
+	ref, ok := e.(*columnRef)
+	if !ok {
+		return 0, false
+	}
+	i, pos, err := o.sc.resolve(ref)
+	if err != nil || o.rels[i].isView {
+		return 0, false
+	}
+	tableDef := o.sc.sources[i].tableDef
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return 0, false
+	}
+	for _, spec := range specs {
+		if !spec.Unique || len(spec.Keys) != 1 {
+			continue
+		}
+		if key, ok := spec.Keys[0].(*columnRef); ok && tableDef.ColumnIndex(key.Name) == pos {
+			return clampRows(o.rels[i].rows), true
+		}
+	}
+	return 0, false
+}
+
+// selectivityOf - 条件を全部満たす行の割合（条件どうしは独立とみなす）
+func selectivityOf(preds []predicate) float64 {
+	sel := 1.0
+	for _, p := range preds {
+		sel *= p.sel
+	}
+	return sel
+}
+
+// andPredicates - 条件を AND でつないだ式にする（条件がなければ nil）
+func andPredicates(preds []predicate) exprNode {
+	var e exprNode
+	for _, p := range preds {
+		if e == nil {
+			e = p.expr
+			continue
+		}
+		e = &binaryExpr{Op: "AND", Left: e, Right: p.expr}
+	}
+	return e
+}
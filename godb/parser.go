@@ -0,0 +1,1563 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// columnDefはカラム名と型を表す
+type columnDef struct {
+	Name     string  // カラム名
+	Type     string  // 型（正規化した型名。例: INT, TEXT, VARCHAR(255), DECIMAL(10,2)）
+	NotNull  bool    `json:",omitempty"` // NOT NULL 制約
+	Default  string  `json:",omitempty"` // DEFAULT 式（SQL のテキスト、空の場合はデフォルトなし）
+	Sequence string  `json:",omitempty"` // SERIAL / AUTO_INCREMENT のカラムが値を採番するシーケンス（テーブルと一緒に作る）
+	Missing  *string `json:",omitempty"` // ALTER TABLE ADD COLUMN より前に書いた行（このカラムがない版の行）でのこのカラムの値（nilの場合は NULL）
+	ID       int     `json:",omitempty"` // カラム番号（postgres の attnum。名前を変えても変わらず、削除したカラムの番号は使い回さない）
+}
+
+// keyConstraintはPRIMARY KEY / UNIQUE 制約を表す
+type keyConstraint struct {
+	Name    string   // 制約名（例: users_pkey, users_email_key）
+	Columns []string // 対象カラム（複合キーの場合は複数）
+}
+
+// checkConstraintはCHECK制約を表す
+// カラム制約として書いた CHECK も、postgres と同じくテーブルの制約として持つ
+type checkConstraint struct {
+	Name string // 制約名（例: users_age_check）
+	Expr string // 条件式（SQL のテキスト）
+}
+
+// 参照元の行を削除・更新したときの参照先（子テーブル）側の動作
+const (
+	fkActionNoAction = "NO ACTION" // 参照されていればエラー（このDBでは RESTRICT と同じく即時に確認する）
+	fkActionRestrict = "RESTRICT"  // 参照されていればエラー
+	fkActionCascade  = "CASCADE"   // 子の行も一緒に削除・更新する
+	fkActionSetNull  = "SET NULL"  // 子の参照カラムを空にする
+)
+
+// foreignKeyDefはFOREIGN KEY制約を表す
+type foreignKeyDef struct {
+	Name       string   // 制約名（例: orders_user_id_fkey）
+	Columns    []string // 参照する側（このテーブル）のカラム
+	RefTable   string   // 参照先（親）テーブル
+	RefColumns []string // 参照先のカラム（親の主キーまたはUNIQUE制約と一致する必要がある）
+	OnDelete   string   // 親の行を削除したときの動作
+	OnUpdate   string   // 親の行のキーを更新したときの動作
+}
+
+// tableSchemaはテーブル名とカラム定義のリストを表す
+type tableSchema struct {
+	Name        string            // テーブル名
+	Columns     []columnDef       // カラム定義
+	PrimaryKey  *keyConstraint    `json:",omitempty"` // 主キー制約（nilの場合は主キーなし）
+	Uniques     []keyConstraint   `json:",omitempty"` // UNIQUE制約
+	Checks      []checkConstraint `json:",omitempty"` // CHECK制約
+	ForeignKeys []foreignKeyDef   `json:",omitempty"` // FOREIGN KEY制約
+	Indexes     []indexDef        `json:",omitempty"` // CREATE INDEX で作ったインデックス
+	Version     int               `json:",omitempty"` // スキーマの版（カラムを追加・削除するたびに増える。行にはその行を書いたときの版を記録する）
+	History     []tableVersion    `json:",omitempty"` // 以前の版のカラムの並び（古い版で書いた行を読むのに使う）
+	Stats       *tableStats       `json:",omitempty"` // ANALYZE で集めた統計情報（nilの場合はまだ集めていない。stats.go）
+	IfNotExists bool              `json:"-"`          // CREATE TABLE IF NOT EXISTS が指定されたか
+
+	path string // データファイルのパス（拡張子なし。カタログに登録したときに決まる。catalog.tablePath）
+}
+
+// tableVersionはテーブルの以前の版でのカラムの並び（その版で書いた行のフィールドの並び）を表す
+type tableVersion struct {
+	Version int         // 版
+	Columns []columnDef // その版のカラム（名前・型・カラム番号）
+}
+
+// indexDefはCREATE INDEX で作ったインデックスを表す
+// キーにはカラムだけでなく式も書ける（例: CREATE INDEX ON items ((attrs->>'color'))）
+type indexDef struct {
+	Name   string   // インデックス名（例: items_color_idx）
+	Exprs  []string // キーの式（SQL のテキスト。カラムだけの場合はカラム名）
+	Unique bool     `json:",omitempty"` // UNIQUE インデックスかどうか
+}
+
+// createIndexDefはCREATE INDEX文の内容を表す
+type createIndexDef struct {
+	TableName string   // テーブル名
+	Index     indexDef // 作るインデックス（名前を省略した場合は空）
+}
+
+// dropTableDefはDROP TABLE文の内容を表す
+type dropTableDef struct {
+	TableNames []string // 削除するテーブル名
+	IfExists   bool     // IF EXISTS が指定されたか（存在しないテーブルは何もしない）
+}
+
+// truncateDefはTRUNCATE文の内容を表す
+type truncateDef struct {
+	TableNames      []string // 空にするテーブル名
+	RestartIdentity bool     // RESTART IDENTITY が指定されたか（SERIAL / AUTO_INCREMENT のシーケンスも最初の値に戻す）
+}
+
+// analyzeDefはANALYZE文の内容を表す
+type analyzeDef struct {
+	TableNames []string // 統計情報を集めるテーブル名（空の場合は全テーブル）
+}
+
+// explainDefはEXPLAIN文の内容を表す
+type explainDef struct {
+	Analyze bool       // ANALYZE が指定されたか（実際に実行して、演算子ごとの実際の行数と時間も表示する）
+	Format  string     // 出力の形式（TEXT / JSON）
+	Query   *selectDef // プランを表示する SELECT 文
+}
+
+// prepareDefはPREPARE文の内容を表す
+type prepareDef struct {
+	Name      string    // プリペアド文の名前
+	Types     []SQLType // パラメータの型（$1 から順に。省略したものは使われている場所から決める）
+	Statement string    // AS の後ろの文（SELECT / INSERT / UPDATE / DELETE）のテキスト
+}
+
+// executeDefはEXECUTE文の内容を表す
+type executeDef struct {
+	Name string     // プリペアド文の名前
+	Args []exprNode // パラメータの値の式（$1 から順に）
+}
+
+// deallocateDefはDEALLOCATE文の内容を表す
+type deallocateDef struct {
+	Name string // 捨てるプリペアド文の名前
+	All  bool   // DEALLOCATE ALL かどうか（全部捨てる）
+}
+
+// ALTER TABLE の操作の種類
+const (
+	alterAddColumn    = "ADD COLUMN"
+	alterDropColumn   = "DROP COLUMN"
+	alterRenameColumn = "RENAME COLUMN"
+	alterRenameTable  = "RENAME TO"
+)
+
+// alterTableDefはALTER TABLE文の内容を表す
+type alterTableDef struct {
+	TableName   string       // テーブル名
+	Action      string       // 操作の種類（alterAddColumn など）
+	Added       *tableSchema // ADD COLUMN のカラム定義とカラム制約（カラムが 1 つだけのテーブル定義として持つ）
+	Column      string       // DROP COLUMN / RENAME COLUMN の対象カラム
+	NewName     string       // RENAME COLUMN / RENAME TO の新しい名前
+	IfExists    bool         // DROP COLUMN IF EXISTS（カラムがなければ何もしない）
+	IfNotExists bool         // ADD COLUMN IF NOT EXISTS（カラムが既にあれば何もしない）
+}
+
+// ColumnIndexはカラム名からカラムの位置を返す（存在しない場合は-1）
+func (t *tableSchema) ColumnIndex(name string) int {
+	for i, col := range t.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// KeyConstraintsは主キー制約とUNIQUE制約をまとめて返す（主キーが先頭）
+func (t *tableSchema) KeyConstraints() []keyConstraint {
+	var keys []keyConstraint
+	if t.PrimaryKey != nil {
+		keys = append(keys, *t.PrimaryKey)
+	}
+	return append(keys, t.Uniques...)
+}
+
+// sequenceDefはCREATE SEQUENCE文の内容を表す
+type sequenceDef struct {
+	Name        string // シーケンス名
+	Start       int64  // 最初の値
+	Increment   int64  // 増分（負なら減っていく）
+	MinValue    int64  // 最小値
+	MaxValue    int64  // 最大値
+	IfNotExists bool   `json:"-"` // IF NOT EXISTS が指定されたか
+}
+
+// insertDefはINSERT文の内容を表す
+type insertDef struct {
+	TableName  string            // テーブル名
+	Columns    []string          // カラム名のリスト（省略時は空で、テーブルの全カラムを定義順に指定したものとして扱う）
+	Rows       [][]exprNode      // VALUES の行ごとの値の式のリスト（INSERT ... SELECT の場合は空）
+	Select     *selectDef        // INSERT ... SELECT の SELECT 文（VALUES の場合は nil）
+	OnConflict *onConflictClause // ON CONFLICT 句（nilの場合は重複をエラーにする）
+	Returning  *returningClause  // RETURNING 句（nilの場合は結果を返さない）
+}
+
+// onConflictClauseはINSERT文の ON CONFLICT 句を表す
+// 例: ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name
+type onConflictClause struct {
+	Columns    []string    // 重複を判定する一意制約のカラム（省略時は空）
+	Constraint string      // ON CONFLICT ON CONSTRAINT の制約名（省略時は空）
+	DoNothing  bool        // DO NOTHING かどうか（false なら DO UPDATE）
+	Sets       []setClause // DO UPDATE の SET 句（EXCLUDED.カラム で追加しようとした行の値を参照できる）
+	Where      exprNode    // DO UPDATE の WHERE 句（nilの場合は常に更新する）
+}
+
+// updateDefはUPDATE文の内容を表す
+type updateDef struct {
+	TableName string           // テーブル名
+	Sets      []setClause      // SET句（カラム = 式 のリスト）
+	Where     exprNode         // WHERE句の条件式（nilの場合は全行が対象）
+	Returning *returningClause // RETURNING 句（nilの場合は結果を返さない）
+}
+
+// deleteDefはDELETE文の内容を表す
+type deleteDef struct {
+	TableName string           // テーブル名
+	Where     exprNode         // WHERE句の条件式（nilの場合は全行が対象）
+	Returning *returningClause // RETURNING 句（nilの場合は結果を返さない）
+}
+
+// returningClauseはINSERT / UPDATE / DELETE文の RETURNING 句を表す
+// 追加・更新した行は変更後の値、削除した行は削除前の値で評価する
+type returningClause struct {
+	Items []selectItem // 返す式（RETURNING * の場合は空）
+	All   bool         // RETURNING * かどうか
+}
+
+// setClauseはUPDATE文のSET句の1項目を表す
+type setClause struct {
+	Column string   // カラム名
+	Value  exprNode // 設定する値の式（更新前の行のカラムを参照できる）
+}
+
+// selectDefはSELECT文の内容を表す
+type selectDef struct {
+	TableName   string        // テーブル名（JOIN がある場合は FROM 句の最初のテーブル）
+	Alias       string        // テーブルの別名（省略時は空）
+	Joins       []joinClause  // JOIN 句（FROM a, b は CROSS JOIN と同じ）
+	Items       []selectItem  // 選択する式（SELECT * の場合は空）
+	IsSelectAll bool          // SELECT * かどうか
+	Where       exprNode      // WHERE句の条件式（nilの場合は条件なし）
+	GroupBy     []exprNode    // GROUP BY句の式
+	OrderBy     []orderByItem // ORDER BY句
+	Limit       *int64        // LIMIT（nilの場合は制限なし）
+	Offset      int64         // OFFSET
+}
+
+// joinClauseはFROM句で結合するテーブル（JOIN 句）を表す
+type joinClause struct {
+	Kind      string   // INNER / LEFT / CROSS
+	TableName string   // テーブル名
+	Alias     string   // テーブルの別名（省略時は空）
+	On        exprNode // 結合条件（CROSS JOIN は nil）
+}
+
+// selectItemはSELECT句の1項目（式 [AS 別名]）を表す
+type selectItem struct {
+	Expr  exprNode // 式
+	Alias string   // 別名（省略時は空）
+}
+
+// orderByItemはORDER BY句の1項目を表す
+type orderByItem struct {
+	Expr       exprNode // 並べ替えのキー（出力カラム名・別名・1 始まりの列番号も指定できる）
+	Desc       bool     // 降順かどうか
+	NullsFirst bool     // NULL を先頭に並べるか（省略時は postgres と同じく ASC なら末尾、DESC なら先頭）
+}
+
+// parseCreateTableはCREATE TABLE文をパースし、tableSchemaを返す
+func parseCreateTable(sql string) (*tableSchema, error) {
+	// 例: CREATE TABLE users (id INT, name TEXT);
+	// 例: CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE NOT NULL, age INT DEFAULT 0 CHECK (age >= 0));
+	// 例: CREATE TABLE follows (user_id INT, target_id INT, PRIMARY KEY (user_id, target_id));
+	// 例: CREATE TABLE orders (id INT PRIMARY KEY, user_id INT REFERENCES users(id) ON DELETE CASCADE);
+	// 例: CREATE TABLE IF NOT EXISTS logs (id SERIAL PRIMARY KEY, message TEXT);
+	re := regexp.MustCompile(`(?i)^CREATE\s+TABLE\s+(IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\((.+)\)\s*;?$`)
+	matches := re.FindStringSubmatch(strings.TrimSpace(sql))
+	if len(matches) != 4 {
+		return nil, fmt.Errorf("invalid CREATE TABLE syntax")
+	}
+	tableName := matches[2]
+	columnsStr := matches[3]
+	tableDef := &tableSchema{
+		Name:        tableName,
+		Columns:     []columnDef{},
+		IfNotExists: matches[1] != "",
+	}
+
+	// カラム定義・テーブル制約の並びはトークン単位でパースする
+	// （DEFAULT や CHECK の式、PRIMARY KEY (a, b) の中にもカンマや括弧が出てくるので正規表現では区切れない）
+	p, err := newSQLParser(columnsStr)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.parseTableElement(tableDef); err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.peek().Kind != tokenEOF {
+		return nil, p.errorf("expected \",\" or \")\"")
+	}
+	if len(tableDef.Columns) == 0 {
+		return nil, fmt.Errorf("no columns defined")
+	}
+	if err := tableDef.resolveConstraints(); err != nil {
+		return nil, err
+	}
+	return tableDef, nil
+}
+
+// resolveConstraintsは制約で指定されたカラムが存在するか確認し、名前のない制約の名前を決める（postgres と同じ命名規則）
+// CREATE TABLE と ALTER TABLE ADD COLUMN で使う
+func (t *tableSchema) resolveConstraints() error {
+	tableName := t.Name
+	for _, constraint := range t.KeyConstraints() {
+		for _, col := range constraint.Columns {
+			if t.ColumnIndex(col) < 0 {
+				return fmt.Errorf("column %s named in key does not exist", col)
+			}
+		}
+	}
+	if t.PrimaryKey != nil && t.PrimaryKey.Name == "" {
+		t.PrimaryKey.Name = tableName + "_pkey"
+	}
+	for i := range t.Uniques {
+		if t.Uniques[i].Name == "" {
+			t.Uniques[i].Name = tableName + "_" + strings.Join(t.Uniques[i].Columns, "_") + "_key"
+		}
+	}
+	for i, fk := range t.ForeignKeys {
+		for _, col := range fk.Columns {
+			if t.ColumnIndex(col) < 0 {
+				return fmt.Errorf("column %s referenced in foreign key constraint does not exist", col)
+			}
+		}
+		if fk.Name == "" {
+			t.ForeignKeys[i].Name = tableName + "_" + strings.Join(fk.Columns, "_") + "_fkey"
+		}
+	}
+	for i, check := range t.Checks {
+		expr, err := parseExpr(check.Expr)
+		if err != nil {
+			return err
+		}
+		var missing error
+		walkExpr(expr, func(e exprNode) {
+			if ref, ok := e.(*columnRef); ok && missing == nil && t.ColumnIndex(ref.Name) < 0 {
+				missing = fmt.Errorf("column %s named in check constraint does not exist", ref.Name)
+			}
+		})
+		if missing != nil {
+			return missing
+		}
+		if check.Name == "" {
+			t.Checks[i].Name = t.uniqueConstraintName(tableName + "_check")
+		}
+	}
+
+	return nil
+}
+
+// parseTableElementはカラム定義またはテーブル制約を 1 つパースして tableDef に追加する
+func (p *sqlParser) parseTableElement(tableDef *tableSchema) error {
+	// テーブル制約（[CONSTRAINT name] PRIMARY KEY (...) / UNIQUE (...) / CHECK (...) / FOREIGN KEY (...) REFERENCES ...）
+	if p.isKeyword("CONSTRAINT") || p.isKeyword("PRIMARY") || p.isKeyword("UNIQUE") || p.isKeyword("CHECK") || p.isKeyword("FOREIGN") {
+		return p.parseTableConstraint(tableDef)
+	}
+
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if p.peek().Kind != tokenIdent {
+		return fmt.Errorf("column %s: type is required", name)
+	}
+	column := columnDef{Name: name}
+	// SERIAL / BIGSERIAL は postgres と同じく、整数のカラム + NOT NULL + シーケンスの nextval を DEFAULT にしたもの
+	if serial, ok := serialTypes[strings.ToUpper(p.peek().Text)]; ok {
+		p.next()
+		column.Type = SQLType{Kind: serial}.String()
+		column.NotNull = true
+		column.Sequence = serialSequenceName(tableDef.Name, name)
+	} else {
+		typ, err := p.parseTypeName()
+		if err != nil {
+			return err
+		}
+		column.Type = typ.String()
+	}
+
+	// カラム制約（PRIMARY KEY / UNIQUE / NOT NULL / NULL / DEFAULT 式 / CHECK (式) / REFERENCES 親テーブル）
+	for !p.isSymbol(",") && p.peek().Kind != tokenEOF {
+		constraintName := ""
+		if p.acceptKeyword("CONSTRAINT") {
+			if constraintName, err = p.expectIdent(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case p.acceptKeyword("PRIMARY", "KEY"):
+			err = tableDef.addKeyConstraint(keyConstraint{Name: constraintName, Columns: []string{name}}, true)
+		case p.acceptKeyword("UNIQUE"):
+			err = tableDef.addKeyConstraint(keyConstraint{Name: constraintName, Columns: []string{name}}, false)
+		case p.acceptKeyword("NOT", "NULL"):
+			column.NotNull = true
+		case p.acceptKeyword("NULL"):
+			column.NotNull = false
+		case p.acceptKeyword("DEFAULT"):
+			var expr exprNode
+			if expr, err = p.parseExpr(); err == nil {
+				column.Default = expr.String()
+			}
+		case p.acceptKeyword("AUTO_INCREMENT"):
+			// MySQL の AUTO_INCREMENT も SERIAL と同じくシーケンスで採番する
+			column.Sequence = serialSequenceName(tableDef.Name, name)
+			column.NotNull = true
+		case p.acceptKeyword("CHECK"):
+			var expr exprNode
+			if expr, err = p.parseParenExpr(); err == nil {
+				if constraintName == "" {
+					constraintName = tableDef.uniqueConstraintName(tableDef.Name + "_" + name + "_check")
+				}
+				tableDef.Checks = append(tableDef.Checks, checkConstraint{Name: constraintName, Expr: expr.String()})
+			}
+		case p.isKeyword("REFERENCES"):
+			var fk foreignKeyDef
+			if fk, err = p.parseReferences([]string{name}); err == nil {
+				fk.Name = constraintName
+				tableDef.ForeignKeys = append(tableDef.ForeignKeys, fk)
+			}
+		default:
+			return p.errorf("unsupported column constraint")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if column.Sequence != "" {
+		if column.Default != "" {
+			return fmt.Errorf("multiple default values specified for column %s", name)
+		}
+		if !columnType(column).isInteger() {
+			return fmt.Errorf("column %s: AUTO_INCREMENT requires an integer type", name)
+		}
+		column.Default = fmt.Sprintf("nextval('%s')", column.Sequence)
+	}
+
+	tableDef.Columns = append(tableDef.Columns, column)
+	return nil
+}
+
+// serialTypesは SERIAL 系の型名と、実際のカラムの型
+var serialTypes = map[string]TypeKind{
+	"SMALLSERIAL": TypeInt,
+	"SERIAL":      TypeInt,
+	"BIGSERIAL":   TypeBigInt,
+}
+
+// parseTableConstraintはテーブル制約をパースして tableDef に追加する
+func (p *sqlParser) parseTableConstraint(tableDef *tableSchema) error {
+	constraintName := ""
+	if p.acceptKeyword("CONSTRAINT") {
+		var err error
+		if constraintName, err = p.expectIdent(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p.acceptKeyword("PRIMARY", "KEY"):
+		columns, err := p.parseColumnList()
+		if err != nil {
+			return err
+		}
+		return tableDef.addKeyConstraint(keyConstraint{Name: constraintName, Columns: columns}, true)
+	case p.acceptKeyword("UNIQUE"):
+		columns, err := p.parseColumnList()
+		if err != nil {
+			return err
+		}
+		return tableDef.addKeyConstraint(keyConstraint{Name: constraintName, Columns: columns}, false)
+	case p.acceptKeyword("CHECK"):
+		expr, err := p.parseParenExpr()
+		if err != nil {
+			return err
+		}
+		tableDef.Checks = append(tableDef.Checks, checkConstraint{Name: constraintName, Expr: expr.String()})
+		return nil
+	case p.acceptKeyword("FOREIGN", "KEY"):
+		columns, err := p.parseColumnList()
+		if err != nil {
+			return err
+		}
+		fk, err := p.parseReferences(columns)
+		if err != nil {
+			return err
+		}
+		fk.Name = constraintName
+		tableDef.ForeignKeys = append(tableDef.ForeignKeys, fk)
+		return nil
+	}
+	return p.errorf("invalid table constraint")
+}
+
+// parseReferencesは REFERENCES 親テーブル [(カラム, ...)] [ON DELETE 動作] [ON UPDATE 動作] をパースする
+// 親のカラムを省略した場合は、CREATE TABLE の実行時に親の主キーで補う
+func (p *sqlParser) parseReferences(columns []string) (foreignKeyDef, error) {
+	fk := foreignKeyDef{
+		Columns:  columns,
+		OnDelete: fkActionNoAction,
+		OnUpdate: fkActionNoAction,
+	}
+	if err := p.expectKeyword("REFERENCES"); err != nil {
+		return fk, err
+	}
+	refTable, err := p.expectIdent()
+	if err != nil {
+		return fk, err
+	}
+	fk.RefTable = refTable
+	if p.isSymbol("(") {
+		if fk.RefColumns, err = p.parseColumnList(); err != nil {
+			return fk, err
+		}
+		if len(fk.RefColumns) != len(columns) {
+			return fk, fmt.Errorf("number of referencing and referenced columns for foreign key disagree")
+		}
+	}
+
+	for p.acceptKeyword("ON") {
+		var target *string
+		switch {
+		case p.acceptKeyword("DELETE"):
+			target = &fk.OnDelete
+		case p.acceptKeyword("UPDATE"):
+			target = &fk.OnUpdate
+		default:
+			return fk, p.errorf("expected DELETE or UPDATE")
+		}
+		switch {
+		case p.acceptKeyword("CASCADE"):
+			*target = fkActionCascade
+		case p.acceptKeyword("RESTRICT"):
+			*target = fkActionRestrict
+		case p.acceptKeyword("SET", "NULL"):
+			*target = fkActionSetNull
+		case p.acceptKeyword("NO", "ACTION"):
+			*target = fkActionNoAction
+		default:
+			return fk, p.errorf("unsupported referential action")
+		}
+	}
+	return fk, nil
+}
+
+// parseColumnListは (a, b, ...) 形式のカラム名のリストをパースする
+func (p *sqlParser) parseColumnList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	columns := []string{}
+	for {
+		col, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+		if p.acceptSymbol(")") {
+			return columns, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseParenExprは (式) をパースする
+func (p *sqlParser) parseParenExpr() (exprNode, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// uniqueConstraintNameは他の CHECK 制約と名前が重ならないように、必要なら末尾に番号を付ける（users_check, users_check1, ...）
+func (t *tableSchema) uniqueConstraintName(base string) string {
+	name := base
+	for n := 1; ; n++ {
+		used := false
+		for _, check := range t.Checks {
+			if check.Name == name {
+				used = true
+			}
+		}
+		if !used {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, n)
+	}
+}
+
+// addKeyConstraintはPRIMARY KEY / UNIQUE 制約をテーブル定義に追加する
+func (t *tableSchema) addKeyConstraint(constraint keyConstraint, isPrimary bool) error {
+	if isPrimary {
+		if t.PrimaryKey != nil {
+			return fmt.Errorf("multiple primary keys for table %s are not allowed", t.Name)
+		}
+		t.PrimaryKey = &constraint
+		return nil
+	}
+	t.Uniques = append(t.Uniques, constraint)
+	return nil
+}
+
+// parseCreateIndexはCREATE INDEX文をパースし、createIndexDefを返す
+func parseCreateIndex(sql string) (*createIndexDef, error) {
+	// 例: CREATE INDEX users_name_idx ON users (name);
+	// 例: CREATE UNIQUE INDEX ON users (lower(email));
+	// 例: CREATE INDEX ON items USING BTREE ((attrs->>'color'));
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("CREATE"); err != nil {
+		return nil, err
+	}
+	def := &createIndexDef{}
+	def.Index.Unique = p.acceptKeyword("UNIQUE")
+	if err := p.expectKeyword("INDEX"); err != nil {
+		return nil, err
+	}
+	if !p.isKeyword("ON") {
+		if def.Index.Name, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	if def.TableName, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	// インデックスの種類は B+Tree だけ
+	if p.acceptKeyword("USING") {
+		if !p.acceptKeyword("BTREE") {
+			return nil, p.errorf("unsupported index method (only BTREE is supported)")
+		}
+	}
+
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	exprs, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+
+	// 名前を省略した場合は postgres と同じく テーブル名_カラム名_idx（式の場合は expr）にする
+	nameParts := []string{def.TableName}
+	for _, expr := range exprs {
+		def.Index.Exprs = append(def.Index.Exprs, expr.String())
+		if ref, ok := expr.(*columnRef); ok {
+			nameParts = append(nameParts, ref.Name)
+		} else {
+			nameParts = append(nameParts, "expr")
+		}
+	}
+	if def.Index.Name == "" {
+		def.Index.Name = strings.Join(nameParts, "_") + "_idx"
+	}
+	return def, nil
+}
+
+// parseCreateSequenceはCREATE SEQUENCE文をパースし、sequenceDefを返す
+func parseCreateSequence(sql string) (*sequenceDef, error) {
+	// 例: CREATE SEQUENCE order_no;
+	// 例: CREATE SEQUENCE IF NOT EXISTS countdown START WITH 10 INCREMENT BY -1 MINVALUE 0;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("CREATE", "SEQUENCE"); err != nil {
+		return nil, err
+	}
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	var start, increment, minValue, maxValue *int64
+	for p.peek().Kind != tokenEOF && !p.isSymbol(";") {
+		var target **int64
+		switch {
+		case p.acceptKeyword("START"):
+			p.acceptKeyword("WITH")
+			target = &start
+		case p.acceptKeyword("INCREMENT"):
+			p.acceptKeyword("BY")
+			target = &increment
+		case p.acceptKeyword("MINVALUE"):
+			target = &minValue
+		case p.acceptKeyword("MAXVALUE"):
+			target = &maxValue
+		default:
+			return nil, p.errorf("unsupported sequence option")
+		}
+		n, err := p.parseSignedInteger()
+		if err != nil {
+			return nil, err
+		}
+		*target = &n
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+
+	// 省略時は postgres と同じく、増分が正なら 1 から最大値まで、負なら -1 から最小値まで
+	def := newSequenceDef(name)
+	def.IfNotExists = ifNotExists
+	if increment != nil {
+		if *increment == 0 {
+			return nil, fmt.Errorf("INCREMENT must not be zero")
+		}
+		def.Increment = *increment
+	}
+	if def.Increment < 0 {
+		def.MinValue, def.MaxValue = math.MinInt64, -1
+	}
+	if minValue != nil {
+		def.MinValue = *minValue
+	}
+	if maxValue != nil {
+		def.MaxValue = *maxValue
+	}
+	if def.MinValue >= def.MaxValue {
+		return nil, fmt.Errorf("MINVALUE (%d) must be less than MAXVALUE (%d)", def.MinValue, def.MaxValue)
+	}
+	def.Start = def.MinValue
+	if def.Increment < 0 {
+		def.Start = def.MaxValue
+	}
+	if start != nil {
+		def.Start = *start
+	}
+	if def.Start < def.MinValue || def.Start > def.MaxValue {
+		return nil, fmt.Errorf("START value (%d) must be between MINVALUE (%d) and MAXVALUE (%d)", def.Start, def.MinValue, def.MaxValue)
+	}
+	return &def, nil
+}
+
+// parseSignedIntegerは符号付きの整数をパースする
+func (p *sqlParser) parseSignedInteger() (int64, error) {
+	negative := p.acceptSymbol("-")
+	tok := p.peek()
+	if tok.Kind != tokenNumber {
+		return 0, p.errorf("expected an integer")
+	}
+	p.next()
+	text := tok.Text
+	if negative {
+		text = "-" + text
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer: %s", text)
+	}
+	return n, nil
+}
+
+// parseDropTableはDROP TABLE文をパースし、dropTableDefを返す
+func parseDropTable(sql string) (*dropTableDef, error) {
+	// 例: DROP TABLE users;
+	// 例: DROP TABLE IF EXISTS orders, users;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("DROP", "TABLE"); err != nil {
+		return nil, err
+	}
+	def := &dropTableDef{IfExists: p.acceptKeyword("IF", "EXISTS")}
+	if def.TableNames, err = p.parseNameList(); err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parseTruncateはTRUNCATE文をパースし、truncateDefを返す
+func parseTruncate(sql string) (*truncateDef, error) {
+	// 例: TRUNCATE users;
+	// 例: TRUNCATE TABLE orders, users RESTART IDENTITY;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("TRUNCATE"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("TABLE")
+	def := &truncateDef{}
+	if def.TableNames, err = p.parseNameList(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.acceptKeyword("RESTART", "IDENTITY"):
+		def.RestartIdentity = true
+	case p.acceptKeyword("CONTINUE", "IDENTITY"):
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parseAnalyzeはANALYZE文をパースし、analyzeDefを返す
+func parseAnalyze(sql string) (*analyzeDef, error) {
+	// 例: ANALYZE;
+	// 例: ANALYZE users, orders;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("ANALYZE"); err != nil {
+		return nil, err
+	}
+	def := &analyzeDef{}
+	if p.peek().Kind == tokenIdent {
+		if def.TableNames, err = p.parseNameList(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parseExplainはEXPLAIN文をパースし、explainDefを返す
+func parseExplain(sql string) (*explainDef, error) {
+	// 例: EXPLAIN SELECT * FROM users WHERE id = 1;
+	// 例: EXPLAIN ANALYZE SELECT u.name, o.total FROM users u JOIN orders o ON o.user_id = u.id;
+	// 例: EXPLAIN (ANALYZE, FORMAT JSON) SELECT * FROM users;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("EXPLAIN"); err != nil {
+		return nil, err
+	}
+	def := &explainDef{Format: "TEXT"}
+	if p.acceptSymbol("(") {
+		for {
+			switch {
+			case p.acceptKeyword("ANALYZE"):
+				def.Analyze = true
+				switch {
+				case p.acceptKeyword("TRUE"), p.acceptKeyword("ON"):
+				case p.acceptKeyword("FALSE"), p.acceptKeyword("OFF"):
+					def.Analyze = false
+				}
+			case p.acceptKeyword("FORMAT"):
+				switch {
+				case p.acceptKeyword("TEXT"):
+					def.Format = "TEXT"
+				case p.acceptKeyword("JSON"):
+					def.Format = "JSON"
+				default:
+					return nil, p.errorf("expected TEXT or JSON")
+				}
+			default:
+				return nil, p.errorf("unknown EXPLAIN option")
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	} else if p.acceptKeyword("ANALYZE") {
+		def.Analyze = true
+	}
+	if !p.isKeyword("SELECT") {
+		return nil, p.errorf("EXPLAIN supports only SELECT")
+	}
+	if def.Query, err = p.parseSelect(); err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parsePrepareはPREPARE文をパースし、prepareDefを返す
+// AS の後ろの文はテキストのまま返す（プリペアド文を作るときにパラメータを許してパースする）
+func parsePrepare(sql string) (*prepareDef, error) {
+	// 例: PREPARE find_user (INT) AS SELECT * FROM users WHERE id = $1;
+	// 例: PREPARE add_user AS INSERT INTO users (id, name) VALUES ($1, $2);
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("PREPARE"); err != nil {
+		return nil, err
+	}
+	def := &prepareDef{}
+	if def.Name, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("(") {
+		for {
+			t, err := p.parseTypeName()
+			if err != nil {
+				return nil, err
+			}
+			def.Types = append(def.Types, t)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if !p.isKeyword("SELECT") && !p.isKeyword("INSERT") && !p.isKeyword("UPDATE") && !p.isKeyword("DELETE") {
+		return nil, p.errorf("PREPARE supports only SELECT, INSERT, UPDATE and DELETE")
+	}
+	def.Statement = strings.TrimSpace(sql[tok.Pos:])
+	return def, nil
+}
+
+// parseExecuteはEXECUTE文をパースし、executeDefを返す
+func parseExecute(sql string) (*executeDef, error) {
+	// 例: EXECUTE find_user(1);
+	// 例: EXECUTE add_user(2, 'Bob');
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("EXECUTE"); err != nil {
+		return nil, err
+	}
+	def := &executeDef{}
+	if def.Name, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("(") {
+		if def.Args, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parseDeallocateはDEALLOCATE文をパースし、deallocateDefを返す
+func parseDeallocate(sql string) (*deallocateDef, error) {
+	// 例: DEALLOCATE find_user;
+	// 例: DEALLOCATE PREPARE ALL;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("DEALLOCATE"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("PREPARE")
+	def := &deallocateDef{}
+	if p.acceptKeyword("ALL") {
+		def.All = true
+	} else if def.Name, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parseAlterTableはALTER TABLE文をパースし、alterTableDefを返す
+func parseAlterTable(sql string) (*alterTableDef, error) {
+	// 例: ALTER TABLE users ADD COLUMN age INT DEFAULT 0 CHECK (age >= 0);
+	// 例: ALTER TABLE users DROP COLUMN IF EXISTS age;
+	// 例: ALTER TABLE users RENAME COLUMN name TO full_name;
+	// 例: ALTER TABLE users RENAME TO members;
+	// カラム定義は CREATE TABLE と同じくカンマか入力の終わりまで読むので、末尾のセミコロンは先に取り除く
+	p, err := newSQLParser(strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("ALTER", "TABLE"); err != nil {
+		return nil, err
+	}
+	def := &alterTableDef{}
+	if def.TableName, err = p.expectIdent(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.acceptKeyword("ADD"):
+		def.Action = alterAddColumn
+		p.acceptKeyword("COLUMN")
+		def.IfNotExists = p.acceptKeyword("IF", "NOT", "EXISTS")
+		def.Added = &tableSchema{Name: def.TableName}
+		if err := p.parseTableElement(def.Added); err != nil {
+			return nil, err
+		}
+		if len(def.Added.Columns) != 1 {
+			return nil, fmt.Errorf("ALTER TABLE ADD supports only column definitions")
+		}
+	case p.acceptKeyword("DROP"):
+		def.Action = alterDropColumn
+		p.acceptKeyword("COLUMN")
+		def.IfExists = p.acceptKeyword("IF", "EXISTS")
+		if def.Column, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("RENAME", "TO"):
+		def.Action = alterRenameTable
+		if def.NewName, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("RENAME"):
+		def.Action = alterRenameColumn
+		p.acceptKeyword("COLUMN")
+		if def.Column, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("TO"); err != nil {
+			return nil, err
+		}
+		if def.NewName, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected ADD, DROP or RENAME")
+	}
+
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// parseNameListは「名前, 名前, ...」をパースする（DROP TABLE / TRUNCATE / ANALYZE のテーブル名）
+func (p *sqlParser) parseNameList() ([]string, error) {
+	names := []string{}
+	for {
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptSymbol(",") {
+			return names, nil
+		}
+	}
+}
+
+// parseInsertはINSERT文をパースし、insertDefを返す
+func parseInsert(sql string) (*insertDef, error) {
+	// 例: INSERT INTO users (id, name) VALUES (1, 'Alice');
+	// 例: INSERT INTO users VALUES (2, NULL);
+	// 例: INSERT INTO users (name) VALUES ('Carol') RETURNING id;
+	// 例: INSERT INTO users (name, id) VALUES ('Dave', 4), ('Eve', 5);
+	// 例: INSERT INTO archive (id, name) SELECT id, name FROM users WHERE id < 3;
+	// 例: INSERT INTO users (id, name) VALUES (1, 'Alice') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	p.allowParams = true
+	if err := p.expectKeyword("INSERT", "INTO"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+
+	// カラム名のリスト（省略可）
+	var columns []string
+	if p.isSymbol("(") {
+		if columns, err = p.parseColumnList(); err != nil {
+			return nil, err
+		}
+	}
+
+	insertDef := &insertDef{
+		TableName: tableName,
+		Columns:   columns,
+	}
+	switch {
+	case p.acceptKeyword("VALUES"):
+		// VALUES (...), (...), ... の各行
+		for {
+			if err := p.expectSymbol("("); err != nil {
+				return nil, err
+			}
+			values, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			if columns != nil && len(columns) != len(values) {
+				return nil, fmt.Errorf("column count does not match value count")
+			}
+			if len(insertDef.Rows) > 0 && len(insertDef.Rows[0]) != len(values) {
+				return nil, fmt.Errorf("VALUES lists must all be the same length")
+			}
+			insertDef.Rows = append(insertDef.Rows, values)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	case p.isKeyword("SELECT"):
+		if insertDef.Select, err = p.parseSelect(); err != nil {
+			return nil, err
+		}
+		if columns != nil && !insertDef.Select.IsSelectAll && len(columns) != len(insertDef.Select.Items) {
+			return nil, fmt.Errorf("column count does not match value count")
+		}
+	default:
+		return nil, p.errorf("expected VALUES or SELECT")
+	}
+
+	if insertDef.OnConflict, err = p.parseOnConflict(); err != nil {
+		return nil, err
+	}
+	if insertDef.Returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return insertDef, nil
+}
+
+// parseUpdateはUPDATE文をパースし、updateDefを返す
+func parseUpdate(sql string) (*updateDef, error) {
+	// 例: UPDATE users SET name = 'Bob' WHERE id = 1;
+	// 例: UPDATE users SET id = id + 1, name = NULL;
+	// 例: UPDATE users SET name = upper(name) WHERE id = 1 RETURNING *;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	p.allowParams = true
+	if err := p.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+
+	sets, err := p.parseSetClauses()
+	if err != nil {
+		return nil, err
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+
+	return &updateDef{
+		TableName: tableName,
+		Sets:      sets,
+		Where:     where,
+		Returning: returning,
+	}, nil
+}
+
+// parseSetClausesは SET 句の「カラム = 式, ...」をパースする（UPDATE と ON CONFLICT DO UPDATE で使う）
+func (p *sqlParser) parseSetClauses() ([]setClause, error) {
+	sets := []setClause{}
+	for {
+		column, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, setClause{Column: column, Value: value})
+		if !p.acceptSymbol(",") {
+			return sets, nil
+		}
+	}
+}
+
+// parseOnConflictは INSERT 文の ON CONFLICT 句があればパースする（なければ nil）
+//
+//	ON CONFLICT [(カラム, ...) | ON CONSTRAINT 制約名] DO NOTHING
+//	ON CONFLICT (カラム, ...) DO UPDATE SET カラム = 式, ... [WHERE 条件]
+func (p *sqlParser) parseOnConflict() (*onConflictClause, error) {
+	if !p.acceptKeyword("ON", "CONFLICT") {
+		return nil, nil
+	}
+	var err error
+	clause := &onConflictClause{}
+	switch {
+	case p.isSymbol("("):
+		if clause.Columns, err = p.parseColumnList(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("ON", "CONSTRAINT"):
+		if clause.Constraint, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("DO"); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.acceptKeyword("NOTHING"):
+		clause.DoNothing = true
+	case p.acceptKeyword("UPDATE", "SET"):
+		if clause.Columns == nil && clause.Constraint == "" {
+			return nil, fmt.Errorf("ON CONFLICT DO UPDATE requires a conflict target")
+		}
+		if clause.Sets, err = p.parseSetClauses(); err != nil {
+			return nil, err
+		}
+		if clause.Where, err = p.parseWhere(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected NOTHING or UPDATE SET")
+	}
+	return clause, nil
+}
+
+// parseDeleteはDELETE文をパースし、deleteDefを返す
+func parseDelete(sql string) (*deleteDef, error) {
+	// 例: DELETE FROM users WHERE id = 1;
+	// 例: DELETE FROM users;
+	// 例: DELETE FROM users WHERE id = 1 RETURNING id, name AS deleted_name;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	p.allowParams = true
+	if err := p.expectKeyword("DELETE", "FROM"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+
+	return &deleteDef{
+		TableName: tableName,
+		Where:     where,
+		Returning: returning,
+	}, nil
+}
+
+// parseSelectはSELECT文をパースし、selectDefを返す
+func parseSelect(sql string) (*selectDef, error) {
+	// 例: SELECT * FROM users;
+	// 例: SELECT id, name AS n FROM users WHERE age IS NOT NULL ORDER BY name DESC NULLS LAST LIMIT 10;
+	// 例: SELECT dept, count(*), avg(salary) FROM employees GROUP BY dept;
+	// 例: SELECT u.name, o.total FROM users u JOIN orders o ON o.user_id = u.id;
+	p, err := newSQLParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	p.allowParams = true
+	selectDef, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return selectDef, nil
+}
+
+// parseSelectは SELECT 文をパースする（文の終わりは確認しないので、INSERT ... SELECT の中でも使える）
+func (p *sqlParser) parseSelect() (*selectDef, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	var err error
+
+	selectDef := &selectDef{}
+	if p.acceptSymbol("*") {
+		selectDef.IsSelectAll = true
+	} else {
+		for {
+			item, err := p.parseSelectItem()
+			if err != nil {
+				return nil, err
+			}
+			selectDef.Items = append(selectDef.Items, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if selectDef.TableName, err = p.parseTableName(); err != nil {
+		return nil, err
+	}
+	if selectDef.Alias, err = p.parseTableAlias(); err != nil {
+		return nil, err
+	}
+	for {
+		join, ok, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		selectDef.Joins = append(selectDef.Joins, join)
+	}
+
+	if selectDef.Where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("GROUP", "BY") {
+		if selectDef.GroupBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER", "BY") {
+		for {
+			item, err := p.parseOrderByItem()
+			if err != nil {
+				return nil, err
+			}
+			selectDef.OrderBy = append(selectDef.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		limit, err := p.parseCount("LIMIT")
+		if err != nil {
+			return nil, err
+		}
+		selectDef.Limit = &limit
+	}
+	if p.acceptKeyword("OFFSET") {
+		if selectDef.Offset, err = p.parseCount("OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+	return selectDef, nil
+}
+
+// parseSelectItemはSELECT句の 1 項目（式 [[AS] 別名]）をパースする
+func (p *sqlParser) parseSelectItem() (selectItem, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return selectItem{}, err
+	}
+	item := selectItem{Expr: expr}
+	if p.acceptKeyword("AS") {
+		if item.Alias, err = p.expectIdent(); err != nil {
+			return selectItem{}, err
+		}
+	} else if tok := p.peek(); tok.Kind == tokenIdent && !isKeywordToken(tok, "FROM") {
+		item.Alias = p.next().Text
+	}
+	return item, nil
+}
+
+// parseTableAliasはFROM句のテーブル名の後の別名（[AS] 別名）を読む（なければ空）
+func (p *sqlParser) parseTableAlias() (string, error) {
+	if p.acceptKeyword("AS") {
+		return p.expectIdent()
+	}
+	tok := p.peek()
+	if tok.Kind != tokenIdent {
+		return "", nil
+	}
+	// テーブル名の後に続くキーワードは別名ではない
+	for _, keyword := range []string{"WHERE", "GROUP", "ORDER", "LIMIT", "OFFSET", "JOIN", "INNER", "LEFT", "CROSS", "ON", "RETURNING"} {
+		if isKeywordToken(tok, keyword) {
+			return "", nil
+		}
+	}
+	return p.next().Text, nil
+}
+
+// parseJoinはJOIN句（[INNER] JOIN t ON 条件、LEFT [OUTER] JOIN t ON 条件、CROSS JOIN t、, t）を 1 つ読む
+// JOIN 句がなければ false を返す
+func (p *sqlParser) parseJoin() (joinClause, bool, error) {
+	join := joinClause{}
+	switch {
+	case p.acceptSymbol(","), p.acceptKeyword("CROSS", "JOIN"):
+		join.Kind = "CROSS"
+	case p.acceptKeyword("JOIN"), p.acceptKeyword("INNER", "JOIN"):
+		join.Kind = "INNER"
+	case p.acceptKeyword("LEFT", "JOIN"), p.acceptKeyword("LEFT", "OUTER", "JOIN"):
+		join.Kind = "LEFT"
+	default:
+		return joinClause{}, false, nil
+	}
+	var err error
+	if join.TableName, err = p.parseTableName(); err != nil {
+		return joinClause{}, false, err
+	}
+	if join.Alias, err = p.parseTableAlias(); err != nil {
+		return joinClause{}, false, err
+	}
+	if join.Kind == "CROSS" {
+		return join, true, nil
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return joinClause{}, false, err
+	}
+	if join.On, err = p.parseExpr(); err != nil {
+		return joinClause{}, false, err
+	}
+	return join, true, nil
+}
+
+// parseOrderByItemはORDER BY句の 1 項目（式 [ASC|DESC] [NULLS FIRST|LAST]）をパースする
+func (p *sqlParser) parseOrderByItem() (orderByItem, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return orderByItem{}, err
+	}
+	item := orderByItem{Expr: expr}
+	if p.acceptKeyword("DESC") {
+		item.Desc = true
+	} else {
+		p.acceptKeyword("ASC")
+	}
+	// NULL は「どの値よりも大きい」ものとして扱うので、省略時は ASC なら末尾、DESC なら先頭になる
+	item.NullsFirst = item.Desc
+	if p.acceptKeyword("NULLS") {
+		switch {
+		case p.acceptKeyword("FIRST"):
+			item.NullsFirst = true
+		case p.acceptKeyword("LAST"):
+			item.NullsFirst = false
+		default:
+			return orderByItem{}, p.errorf("expected FIRST or LAST")
+		}
+	}
+	return item, nil
+}
+
+// parseReturningは RETURNING 句があればパースする（なければ nil）
+func (p *sqlParser) parseReturning() (*returningClause, error) {
+	if !p.acceptKeyword("RETURNING") {
+		return nil, nil
+	}
+	if p.acceptSymbol("*") {
+		return &returningClause{All: true}, nil
+	}
+	returning := &returningClause{}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		returning.Items = append(returning.Items, item)
+		if !p.acceptSymbol(",") {
+			return returning, nil
+		}
+	}
+}
+
+// parseWhereは WHERE 句があればその条件式をパースする（なければ nil）
+func (p *sqlParser) parseWhere() (exprNode, error) {
+	if !p.acceptKeyword("WHERE") {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+// parseExprListはカンマ区切りの式の並びをパースする
+func (p *sqlParser) parseExprList() ([]exprNode, error) {
+	exprs := []exprNode{}
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.acceptSymbol(",") {
+			return exprs, nil
+		}
+	}
+}
+
+// parseCountは LIMIT / OFFSET の件数（0 以上の整数）をパースする
+func (p *sqlParser) parseCount(clause string) (int64, error) {
+	tok := p.peek()
+	if tok.Kind != tokenNumber {
+		return 0, p.errorf("%s must be a non-negative integer", clause)
+	}
+	p.next()
+	n, err := strconv.ParseInt(tok.Text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", tok.Text)
+	}
+	return n, nil
+}
@@ -0,0 +1,1514 @@
+package godb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *tableSchema
+		hasError bool
+	}{
+		{
+			name: "基本的なCREATE TABLE",
+			sql:  "CREATE TABLE users (id INT, name TEXT);",
+			expected: &tableSchema{
+				Name: "users",
+				Columns: []columnDef{
+					{Name: "id", Type: "INT"},
+					{Name: "name", Type: "TEXT"},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name: "セミコロンなし",
+			sql:  "CREATE TABLE products (price DECIMAL, category TEXT)",
+			expected: &tableSchema{
+				Name: "products",
+				Columns: []columnDef{
+					{Name: "price", Type: "DECIMAL"},
+					{Name: "category", Type: "TEXT"},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name: "大文字小文字混在",
+			sql:  "create table Orders (order_id INT, user_id INT);",
+			expected: &tableSchema{
+				Name: "Orders",
+				Columns: []columnDef{
+					{Name: "order_id", Type: "INT"},
+					{Name: "user_id", Type: "INT"},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name:     "無効な構文",
+			sql:      "CREATE users (id INT);",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name:     "カラムなし",
+			sql:      "CREATE TABLE empty ();",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name: "型名の正規化",
+			sql:  "CREATE TABLE items (id BIGINT, name varchar(255), price NUMERIC(10, 2), rate DOUBLE PRECISION, active BOOL, born DATE, created_at TIMESTAMP, photo BLOB)",
+			expected: &tableSchema{
+				Name: "items",
+				Columns: []columnDef{
+					{Name: "id", Type: "BIGINT"},
+					{Name: "name", Type: "VARCHAR(255)"},
+					{Name: "price", Type: "DECIMAL(10,2)"},
+					{Name: "rate", Type: "FLOAT"},
+					{Name: "active", Type: "BOOLEAN"},
+					{Name: "born", Type: "DATE"},
+					{Name: "created_at", Type: "TIMESTAMP"},
+					{Name: "photo", Type: "BYTEA"},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name:     "存在しない型",
+			sql:      "CREATE TABLE t (id INTT)",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name:     "DECIMAL のスケールが精度より大きい",
+			sql:      "CREATE TABLE t (price DECIMAL(2, 3))",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name:     "VARCHAR の長さが 0",
+			sql:      "CREATE TABLE t (name VARCHAR(0))",
+			expected: nil,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCreateTable(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+
+			if result.Name != tt.expected.Name {
+				t.Errorf("テーブル名が一致しません。期待: %s, 実際: %s", tt.expected.Name, result.Name)
+			}
+
+			if len(result.Columns) != len(tt.expected.Columns) {
+				t.Errorf("カラム数が一致しません。期待: %d, 実際: %d", len(tt.expected.Columns), len(result.Columns))
+				return
+			}
+
+			for i, col := range result.Columns {
+				expected := tt.expected.Columns[i]
+				if col.Name != expected.Name || col.Type != expected.Type {
+					t.Errorf("カラム[%d]が一致しません。期待: %+v, 実際: %+v", i, expected, col)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *insertDef
+		hasError bool
+	}{
+		{
+			name: "基本的なINSERT",
+			sql:  "INSERT INTO users (id, name) VALUES (1, 'Alice');",
+			expected: &insertDef{
+				TableName: "users",
+				Columns:   []string{"id", "name"},
+				Rows:      [][]exprNode{{&literal{Value: int64(1)}, &literal{Value: "Alice"}}},
+			},
+			hasError: false,
+		},
+		{
+			name: "セミコロンなし",
+			sql:  "INSERT INTO products (price, category) VALUES (100, 'book')",
+			expected: &insertDef{
+				TableName: "products",
+				Columns:   []string{"price", "category"},
+				Rows:      [][]exprNode{{&literal{Value: int64(100)}, &literal{Value: "book"}}},
+			},
+			hasError: false,
+		},
+		{
+			name: "大文字小文字混在",
+			sql:  "insert into Orders (order_id, user_id) values (1, 10);",
+			expected: &insertDef{
+				TableName: "Orders",
+				Columns:   []string{"order_id", "user_id"},
+				Rows:      [][]exprNode{{&literal{Value: int64(1)}, &literal{Value: int64(10)}}},
+			},
+			hasError: false,
+		},
+		{
+			name: "NULLとカラム名の省略",
+			sql:  "INSERT INTO users VALUES (2, NULL);",
+			expected: &insertDef{
+				TableName: "users",
+				Rows:      [][]exprNode{{&literal{Value: int64(2)}, &literal{Value: nil}}},
+			},
+			hasError: false,
+		},
+		{
+			name: "複数行のVALUES",
+			sql:  "INSERT INTO users (name, id) VALUES ('Alice', 1), ('Bob', 2);",
+			expected: &insertDef{
+				TableName: "users",
+				Columns:   []string{"name", "id"},
+				Rows: [][]exprNode{
+					{&literal{Value: "Alice"}, &literal{Value: int64(1)}},
+					{&literal{Value: "Bob"}, &literal{Value: int64(2)}},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name: "INSERT ... SELECT",
+			sql:  "INSERT INTO archive (id, name) SELECT id, name FROM users WHERE id > 1;",
+			expected: &insertDef{
+				TableName: "archive",
+				Columns:   []string{"id", "name"},
+				Select: &selectDef{
+					TableName: "users",
+					Items: []selectItem{
+						{Expr: &columnRef{Name: "id"}},
+						{Expr: &columnRef{Name: "name"}},
+					},
+					Where: &binaryExpr{Op: ">", Left: &columnRef{Name: "id"}, Right: &literal{Value: int64(1)}},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name: "ON CONFLICT DO NOTHING",
+			sql:  "INSERT INTO users (id, name) VALUES (1, 'Alice') ON CONFLICT (id) DO NOTHING;",
+			expected: &insertDef{
+				TableName:  "users",
+				Columns:    []string{"id", "name"},
+				Rows:       [][]exprNode{{&literal{Value: int64(1)}, &literal{Value: "Alice"}}},
+				OnConflict: &onConflictClause{Columns: []string{"id"}, DoNothing: true},
+			},
+			hasError: false,
+		},
+		{
+			name: "ON CONFLICT DO UPDATE と EXCLUDED",
+			sql:  "INSERT INTO users (id, name) VALUES (1, 'Alice') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name WHERE users.name <> EXCLUDED.name RETURNING id;",
+			expected: &insertDef{
+				TableName: "users",
+				Columns:   []string{"id", "name"},
+				Rows:      [][]exprNode{{&literal{Value: int64(1)}, &literal{Value: "Alice"}}},
+				OnConflict: &onConflictClause{
+					Columns: []string{"id"},
+					Sets:    []setClause{{Column: "name", Value: &columnRef{Table: "EXCLUDED", Name: "name"}}},
+					Where: &binaryExpr{Op: "<>",
+						Left:  &columnRef{Table: "users", Name: "name"},
+						Right: &columnRef{Table: "EXCLUDED", Name: "name"}},
+				},
+			},
+			hasError: false,
+		},
+		{
+			name: "ON CONFLICT ON CONSTRAINT",
+			sql:  "INSERT INTO users VALUES (1, 'Alice') ON CONFLICT ON CONSTRAINT users_pkey DO NOTHING",
+			expected: &insertDef{
+				TableName:  "users",
+				Rows:       [][]exprNode{{&literal{Value: int64(1)}, &literal{Value: "Alice"}}},
+				OnConflict: &onConflictClause{Constraint: "users_pkey", DoNothing: true},
+			},
+			hasError: false,
+		},
+		{
+			name:     "DO UPDATE に対象の指定がない",
+			sql:      "INSERT INTO users VALUES (1, 'Alice') ON CONFLICT DO UPDATE SET name = 'x';",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name:     "行ごとの値の数が不一致",
+			sql:      "INSERT INTO users VALUES (1, 'Alice'), (2);",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name:     "カラム数と値の数が不一致",
+			sql:      "INSERT INTO users (id, name) VALUES (1);",
+			expected: nil,
+			hasError: true,
+		},
+		{
+			name:     "無効な構文",
+			sql:      "INSERT users VALUES (1, 'Alice');",
+			expected: nil,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseInsert(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+
+			if result.TableName != tt.expected.TableName {
+				t.Errorf("テーブル名が一致しません。期待: %s, 実際: %s", tt.expected.TableName, result.TableName)
+			}
+
+			if len(result.Columns) != len(tt.expected.Columns) {
+				t.Errorf("カラム数が一致しません。期待: %d, 実際: %d", len(tt.expected.Columns), len(result.Columns))
+				return
+			}
+
+			for i, col := range result.Columns {
+				if col != tt.expected.Columns[i] {
+					t.Errorf("カラム[%d]が一致しません。期待: %s, 実際: %s", i, tt.expected.Columns[i], col)
+				}
+			}
+
+			if !reflect.DeepEqual(result.OnConflict, tt.expected.OnConflict) {
+				t.Errorf("ON CONFLICTが一致しません。期待: %+v, 実際: %+v", tt.expected.OnConflict, result.OnConflict)
+			}
+
+			if !reflect.DeepEqual(result.Select, tt.expected.Select) {
+				t.Errorf("SELECTが一致しません。期待: %+v, 実際: %+v", tt.expected.Select, result.Select)
+			}
+
+			if len(result.Rows) != len(tt.expected.Rows) {
+				t.Errorf("行数が一致しません。期待: %d, 実際: %d", len(tt.expected.Rows), len(result.Rows))
+				return
+			}
+
+			for r, values := range result.Rows {
+				if len(values) != len(tt.expected.Rows[r]) {
+					t.Errorf("行[%d]の値の数が一致しません。期待: %d, 実際: %d", r, len(tt.expected.Rows[r]), len(values))
+					continue
+				}
+				for i, val := range values {
+					if !reflect.DeepEqual(val, tt.expected.Rows[r][i]) {
+						t.Errorf("値[%d][%d]が一致しません。期待: %s, 実際: %s", r, i, tt.expected.Rows[r][i], val)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseCreateTableConstraints(t *testing.T) {
+	tests := []struct {
+		name       string
+		sql        string
+		primaryKey *keyConstraint
+		uniques    []keyConstraint
+		hasError   bool
+	}{
+		{
+			name:       "カラム制約のPRIMARY KEYとUNIQUE",
+			sql:        "CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE, name TEXT);",
+			primaryKey: &keyConstraint{Name: "users_pkey", Columns: []string{"id"}},
+			uniques:    []keyConstraint{{Name: "users_email_key", Columns: []string{"email"}}},
+		},
+		{
+			name:       "テーブル制約の複合主キー",
+			sql:        "CREATE TABLE follows (user_id INT, target_id INT, PRIMARY KEY (user_id, target_id));",
+			primaryKey: &keyConstraint{Name: "follows_pkey", Columns: []string{"user_id", "target_id"}},
+		},
+		{
+			name:    "制約名付きのUNIQUE",
+			sql:     "CREATE TABLE users (id INT, email TEXT, CONSTRAINT uq_email UNIQUE (email))",
+			uniques: []keyConstraint{{Name: "uq_email", Columns: []string{"email"}}},
+		},
+		{
+			name: "主キーなし",
+			sql:  "CREATE TABLE logs (message TEXT);",
+		},
+		{
+			name:     "主キーが2つ",
+			sql:      "CREATE TABLE users (id INT PRIMARY KEY, email TEXT, PRIMARY KEY (email));",
+			hasError: true,
+		},
+		{
+			name:     "存在しないカラムの制約",
+			sql:      "CREATE TABLE users (id INT, UNIQUE (email));",
+			hasError: true,
+		},
+		{
+			name:     "未対応のカラム制約",
+			sql:      "CREATE TABLE users (id INT PRIMARY, name TEXT);",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCreateTable(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(result.PrimaryKey, tt.primaryKey) {
+				t.Errorf("主キーが一致しません。期待: %+v, 実際: %+v", tt.primaryKey, result.PrimaryKey)
+			}
+			if !reflect.DeepEqual(result.Uniques, tt.uniques) {
+				t.Errorf("UNIQUE制約が一致しません。期待: %+v, 実際: %+v", tt.uniques, result.Uniques)
+			}
+		})
+	}
+}
+
+func TestParseUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *updateDef
+		hasError bool
+	}{
+		{
+			name: "WHERE句あり",
+			sql:  "UPDATE users SET name = 'Bob' WHERE id = 1;",
+			expected: &updateDef{
+				TableName: "users",
+				Sets:      []setClause{{Column: "name", Value: &literal{Value: "Bob"}}},
+				Where:     &binaryExpr{Op: "=", Left: &columnRef{Name: "id"}, Right: &literal{Value: int64(1)}},
+			},
+		},
+		{
+			name: "複数カラム・WHERE句なし",
+			sql:  "update users set id = 2, name = 'Carol, Jr.'",
+			expected: &updateDef{
+				TableName: "users",
+				Sets: []setClause{
+					{Column: "id", Value: &literal{Value: int64(2)}},
+					{Column: "name", Value: &literal{Value: "Carol, Jr."}},
+				},
+			},
+		},
+		{
+			name: "式とNULLの代入",
+			sql:  "UPDATE users SET age = age + 1, name = NULL WHERE age IS NOT NULL",
+			expected: &updateDef{
+				TableName: "users",
+				Sets: []setClause{
+					{Column: "age", Value: &binaryExpr{Op: "+", Left: &columnRef{Name: "age"}, Right: &literal{Value: int64(1)}}},
+					{Column: "name", Value: &literal{Value: nil}},
+				},
+				Where: &isNullExpr{Operand: &columnRef{Name: "age"}, Not: true},
+			},
+		},
+		{
+			name:     "SET句なし",
+			sql:      "UPDATE users WHERE id = 1;",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseUpdate(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("UPDATE文が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseCreateTableColumnConstraints(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		columns  []columnDef
+		checks   []checkConstraint
+		hasError bool
+	}{
+		{
+			name: "NOT NULL と DEFAULT",
+			sql:  "CREATE TABLE users (id INT PRIMARY KEY, name TEXT NOT NULL DEFAULT 'anonymous', age INT DEFAULT -1 NULL);",
+			columns: []columnDef{
+				{Name: "id", Type: "INT"},
+				{Name: "name", Type: "TEXT", NotNull: true, Default: "'anonymous'"},
+				{Name: "age", Type: "INT", Default: "-1"},
+			},
+		},
+		{
+			name: "カラム制約とテーブル制約のCHECK",
+			sql:  "CREATE TABLE items (price INT CHECK (price >= 0), stock INT, CHECK (stock < 100 OR price = 0), CONSTRAINT positive CHECK (stock >= 0));",
+			columns: []columnDef{
+				{Name: "price", Type: "INT"},
+				{Name: "stock", Type: "INT"},
+			},
+			checks: []checkConstraint{
+				{Name: "items_price_check", Expr: "(price >= 0)"},
+				{Name: "items_check", Expr: "((stock < 100) OR (price = 0))"},
+				{Name: "positive", Expr: "(stock >= 0)"},
+			},
+		},
+		{
+			name: "DEFAULT 式に関数と演算",
+			sql:  "CREATE TABLE t (label TEXT DEFAULT upper('a' || 'b'), n INT DEFAULT 1 + 2 * 3)",
+			columns: []columnDef{
+				{Name: "label", Type: "TEXT", Default: "upper(('a' || 'b'))"},
+				{Name: "n", Type: "INT", Default: "(1 + (2 * 3))"},
+			},
+		},
+		{
+			name: "SERIAL と AUTO_INCREMENT",
+			sql:  "CREATE TABLE orders (id BIGSERIAL PRIMARY KEY, no INT AUTO_INCREMENT, item TEXT)",
+			columns: []columnDef{
+				{Name: "id", Type: "BIGINT", NotNull: true, Default: "nextval('orders_id_seq')", Sequence: "orders_id_seq"},
+				{Name: "no", Type: "INT", NotNull: true, Default: "nextval('orders_no_seq')", Sequence: "orders_no_seq"},
+				{Name: "item", Type: "TEXT"},
+			},
+		},
+		{
+			name:     "SERIAL に DEFAULT",
+			sql:      "CREATE TABLE orders (id SERIAL DEFAULT 1)",
+			hasError: true,
+		},
+		{
+			name:     "整数でないカラムの AUTO_INCREMENT",
+			sql:      "CREATE TABLE orders (id TEXT AUTO_INCREMENT)",
+			hasError: true,
+		},
+		{
+			name:     "型のないカラム定義",
+			sql:      "CREATE TABLE users (id, name TEXT);",
+			hasError: true,
+		},
+		{
+			name:     "CHECK 式に存在しないカラム",
+			sql:      "CREATE TABLE users (id INT CHECK (age > 0));",
+			hasError: true,
+		},
+		{
+			name:     "閉じていない CHECK",
+			sql:      "CREATE TABLE users (id INT CHECK (id > 0);",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCreateTable(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(result.Columns, tt.columns) {
+				t.Errorf("カラムが一致しません。期待: %+v, 実際: %+v", tt.columns, result.Columns)
+			}
+			if !reflect.DeepEqual(result.Checks, tt.checks) {
+				t.Errorf("CHECK制約が一致しません。期待: %+v, 実際: %+v", tt.checks, result.Checks)
+			}
+		})
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	tableDef := &tableSchema{
+		Name: "users",
+		Columns: []columnDef{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "age", Type: "INT"},
+		},
+	}
+	row := tableRow{"3", "alice", ""}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected any
+		hasError bool
+	}{
+		{name: "算術と比較", expr: "id * 2 + 1 = 7", expected: true},
+		{name: "AND と OR", expr: "id > 5 OR name = 'alice' AND NOT id = 4", expected: true},
+		{name: "文字列関数", expr: "upper(name) || '!'", expected: "ALICE!"},
+		{name: "値のないカラム", expr: "age >= 0", expected: nil},
+		{name: "FALSE AND NULL", expr: "age > 0 AND id = 4", expected: false},
+		{name: "TRUE AND NULL", expr: "age > 0 AND id = 3", expected: nil},
+		{name: "TRUE OR NULL", expr: "age > 0 OR id = 3", expected: true},
+		{name: "NOT NULL", expr: "NOT age > 0", expected: nil},
+		{name: "NULLとの等価比較", expr: "age = NULL", expected: nil},
+		{name: "IS NULL", expr: "age IS NULL", expected: true},
+		{name: "IS NOT NULL と coalesce", expr: "name IS NOT NULL AND coalesce(age, 0) = 0", expected: true},
+		{name: "数値と文字列リテラルの比較", expr: "id = '3'", expected: true},
+		{name: "型の違う比較", expr: "id = name", hasError: true},
+		{name: "ゼロ除算", expr: "id / 0", hasError: true},
+		{name: "存在しないカラム", expr: "email = 'x'", hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("パースエラー: %v", err)
+			}
+			result, err := evalExpr(expr, rowEnv(tableDef, row))
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("評価結果が一致しません。期待: %v, 実際: %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseCreateTableForeignKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		sql         string
+		foreignKeys []foreignKeyDef
+		hasError    bool
+	}{
+		{
+			name: "カラム制約のREFERENCES",
+			sql:  "CREATE TABLE orders (id INT PRIMARY KEY, user_id INT REFERENCES users(id) ON DELETE CASCADE);",
+			foreignKeys: []foreignKeyDef{
+				{Name: "orders_user_id_fkey", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}, OnDelete: fkActionCascade, OnUpdate: fkActionNoAction},
+			},
+		},
+		{
+			name: "テーブル制約のFOREIGN KEY（参照先カラム省略）",
+			sql:  "CREATE TABLE items (order_id INT, line INT, CONSTRAINT fk_order FOREIGN KEY (order_id) REFERENCES orders ON UPDATE SET NULL ON DELETE RESTRICT);",
+			foreignKeys: []foreignKeyDef{
+				{Name: "fk_order", Columns: []string{"order_id"}, RefTable: "orders", OnDelete: fkActionRestrict, OnUpdate: fkActionSetNull},
+			},
+		},
+		{
+			name:     "参照元と参照先のカラム数が違う",
+			sql:      "CREATE TABLE items (a INT, b INT, FOREIGN KEY (a, b) REFERENCES orders(id));",
+			hasError: true,
+		},
+		{
+			name:     "未対応の動作",
+			sql:      "CREATE TABLE items (a INT REFERENCES orders(id) ON DELETE SET DEFAULT);",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCreateTable(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(result.ForeignKeys, tt.foreignKeys) {
+				t.Errorf("外部キー制約が一致しません。期待: %+v, 実際: %+v", tt.foreignKeys, result.ForeignKeys)
+			}
+		})
+	}
+}
+
+func TestParseCreateIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *createIndexDef
+		hasError bool
+	}{
+		{
+			name:     "カラムのインデックス",
+			sql:      "CREATE INDEX users_name_idx ON users (name);",
+			expected: &createIndexDef{TableName: "users", Index: indexDef{Name: "users_name_idx", Exprs: []string{"name"}}},
+		},
+		{
+			name:     "名前の省略と UNIQUE",
+			sql:      "CREATE UNIQUE INDEX ON users (lower(email), id)",
+			expected: &createIndexDef{TableName: "users", Index: indexDef{Name: "users_expr_id_idx", Exprs: []string{"lower(email)", "id"}, Unique: true}},
+		},
+		{
+			name:     "JSON のパスの式と USING BTREE",
+			sql:      "CREATE INDEX ON items USING BTREE ((attrs->>'color'))",
+			expected: &createIndexDef{TableName: "items", Index: indexDef{Name: "items_expr_idx", Exprs: []string{"(attrs ->> 'color')"}}},
+		},
+		{
+			name:     "未対応のインデックスの種類",
+			sql:      "CREATE INDEX ON items USING HASH (id)",
+			hasError: true,
+		},
+		{
+			name:     "キーがない",
+			sql:      "CREATE INDEX ON items ()",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCreateIndex(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("CREATE INDEX の内容が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseCreateSequence(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *sequenceDef
+		hasError bool
+	}{
+		{
+			name:     "省略時は 1 から 1 ずつ増える",
+			sql:      "CREATE SEQUENCE order_no;",
+			expected: &sequenceDef{Name: "order_no", Start: 1, Increment: 1, MinValue: 1, MaxValue: math.MaxInt64},
+		},
+		{
+			name:     "減っていくシーケンス",
+			sql:      "CREATE SEQUENCE IF NOT EXISTS countdown INCREMENT BY -1 MINVALUE 0 MAXVALUE 10",
+			expected: &sequenceDef{Name: "countdown", Start: 10, Increment: -1, MinValue: 0, MaxValue: 10, IfNotExists: true},
+		},
+		{
+			name:     "START WITH と INCREMENT",
+			sql:      "CREATE SEQUENCE s START WITH 100 INCREMENT 10",
+			expected: &sequenceDef{Name: "s", Start: 100, Increment: 10, MinValue: 1, MaxValue: math.MaxInt64},
+		},
+		{
+			name:     "増分が 0",
+			sql:      "CREATE SEQUENCE s INCREMENT BY 0",
+			hasError: true,
+		},
+		{
+			name:     "開始値が範囲外",
+			sql:      "CREATE SEQUENCE s START WITH 0",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCreateSequence(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("CREATE SEQUENCE の内容が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *alterTableDef
+		hasError bool
+	}{
+		{
+			name: "ADD COLUMN とカラム制約",
+			sql:  "ALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 0 CHECK (age >= 0);",
+			expected: &alterTableDef{
+				TableName: "users",
+				Action:    alterAddColumn,
+				Added: &tableSchema{
+					Name:    "users",
+					Columns: []columnDef{{Name: "age", Type: "INT", NotNull: true, Default: "0"}},
+					Checks:  []checkConstraint{{Name: "users_age_check", Expr: "(age >= 0)"}},
+				},
+			},
+		},
+		{
+			name: "ADD IF NOT EXISTS（COLUMN は省略可）",
+			sql:  "ALTER TABLE users ADD IF NOT EXISTS email TEXT",
+			expected: &alterTableDef{
+				TableName:   "users",
+				Action:      alterAddColumn,
+				Added:       &tableSchema{Name: "users", Columns: []columnDef{{Name: "email", Type: "TEXT"}}},
+				IfNotExists: true,
+			},
+		},
+		{
+			name:     "DROP COLUMN IF EXISTS",
+			sql:      "ALTER TABLE users DROP COLUMN IF EXISTS age;",
+			expected: &alterTableDef{TableName: "users", Action: alterDropColumn, Column: "age", IfExists: true},
+		},
+		{
+			name:     "RENAME COLUMN",
+			sql:      "ALTER TABLE users RENAME COLUMN name TO full_name;",
+			expected: &alterTableDef{TableName: "users", Action: alterRenameColumn, Column: "name", NewName: "full_name"},
+		},
+		{
+			name:     "RENAME TO",
+			sql:      "ALTER TABLE users RENAME TO members;",
+			expected: &alterTableDef{TableName: "users", Action: alterRenameTable, NewName: "members"},
+		},
+		{
+			name:     "ADD でテーブル制約",
+			sql:      "ALTER TABLE users ADD PRIMARY KEY (id);",
+			hasError: true,
+		},
+		{
+			name:     "サポートされていない操作",
+			sql:      "ALTER TABLE users ALTER COLUMN age TYPE BIGINT;",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseAlterTable(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ALTER TABLE の内容が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseDropTableAndTruncate(t *testing.T) {
+	drop, err := parseDropTable("DROP TABLE IF EXISTS orders, users;")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if expected := (&dropTableDef{TableNames: []string{"orders", "users"}, IfExists: true}); !reflect.DeepEqual(drop, expected) {
+		t.Errorf("DROP TABLE の内容が一致しません。期待: %+v, 実際: %+v", expected, drop)
+	}
+
+	truncate, err := parseTruncate("TRUNCATE TABLE users RESTART IDENTITY")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if expected := (&truncateDef{TableNames: []string{"users"}, RestartIdentity: true}); !reflect.DeepEqual(truncate, expected) {
+		t.Errorf("TRUNCATE の内容が一致しません。期待: %+v, 実際: %+v", expected, truncate)
+	}
+
+	if _, err := parseDropTable("DROP TABLE;"); err == nil {
+		t.Errorf("期待されたエラーが発生しませんでした")
+	}
+}
+
+func TestParseAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *analyzeDef
+		hasError bool
+	}{
+		{
+			name:     "テーブル指定なし",
+			sql:      "ANALYZE;",
+			expected: &analyzeDef{},
+		},
+		{
+			name:     "複数のテーブル",
+			sql:      "analyze users, orders",
+			expected: &analyzeDef{TableNames: []string{"users", "orders"}},
+		},
+		{
+			name:     "テーブル名のあとのカンマ",
+			sql:      "ANALYZE users,",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseAnalyze(tt.sql)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ANALYZE の内容が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected *deleteDef
+		hasError bool
+	}{
+		{
+			name: "WHERE句あり",
+			sql:  "DELETE FROM users WHERE id >= 10;",
+			expected: &deleteDef{
+				TableName: "users",
+				Where:     &binaryExpr{Op: ">=", Left: &columnRef{Name: "id"}, Right: &literal{Value: int64(10)}},
+			},
+		},
+		{
+			name:     "WHERE句なし",
+			sql:      "delete from users",
+			expected: &deleteDef{TableName: "users"},
+		},
+		{
+			name: "RETURNING",
+			sql:  "DELETE FROM users WHERE id = 1 RETURNING id, upper(name) AS n;",
+			expected: &deleteDef{
+				TableName: "users",
+				Where:     &binaryExpr{Op: "=", Left: &columnRef{Name: "id"}, Right: &literal{Value: int64(1)}},
+				Returning: &returningClause{Items: []selectItem{
+					{Expr: &columnRef{Name: "id"}},
+					{Expr: &funcCall{Name: "upper", Args: []exprNode{&columnRef{Name: "name"}}}, Alias: "n"},
+				}},
+			},
+		},
+		{
+			name:     "RETURNING *",
+			sql:      "DELETE FROM users RETURNING *",
+			expected: &deleteDef{TableName: "users", Returning: &returningClause{All: true}},
+		},
+		{
+			name:     "RETURNING の式がない",
+			sql:      "DELETE FROM users RETURNING",
+			hasError: true,
+		},
+		{
+			name:     "FROMなし",
+			sql:      "DELETE users WHERE id = 1;",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseDelete(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("DELETE文が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseSelect(t *testing.T) {
+	limit := int64(10)
+	tests := []struct {
+		name     string
+		sql      string
+		expected *selectDef
+		hasError bool
+	}{
+		{
+			name:     "SELECT *",
+			sql:      "SELECT * FROM users;",
+			expected: &selectDef{TableName: "users", IsSelectAll: true},
+		},
+		{
+			name:     "スキーマ名付きのテーブル名",
+			sql:      "SELECT table_name FROM information_schema.tables",
+			expected: &selectDef{TableName: "information_schema.tables", Items: []selectItem{{Expr: &columnRef{Name: "table_name"}}}},
+		},
+		{
+			name: "WHERE・ORDER BY・LIMIT",
+			sql:  "SELECT id, name AS n FROM users WHERE age IS NULL ORDER BY name DESC, id NULLS FIRST LIMIT 10 OFFSET 5",
+			expected: &selectDef{
+				TableName: "users",
+				Items: []selectItem{
+					{Expr: &columnRef{Name: "id"}},
+					{Expr: &columnRef{Name: "name"}, Alias: "n"},
+				},
+				Where: &isNullExpr{Operand: &columnRef{Name: "age"}},
+				OrderBy: []orderByItem{
+					{Expr: &columnRef{Name: "name"}, Desc: true, NullsFirst: true},
+					{Expr: &columnRef{Name: "id"}, NullsFirst: true},
+				},
+				Limit:  &limit,
+				Offset: 5,
+			},
+		},
+		{
+			name: "集約関数とGROUP BY",
+			sql:  "select dept, count(*), avg(salary) from employees group by dept",
+			expected: &selectDef{
+				TableName: "employees",
+				Items: []selectItem{
+					{Expr: &columnRef{Name: "dept"}},
+					{Expr: &funcCall{Name: "count", Star: true}},
+					{Expr: &funcCall{Name: "avg", Args: []exprNode{&columnRef{Name: "salary"}}}},
+				},
+				GroupBy: []exprNode{&columnRef{Name: "dept"}},
+			},
+		},
+		{
+			name: "JOINと別名",
+			sql:  "SELECT u.name, o.total FROM users AS u JOIN orders o ON o.user_id = u.id LEFT OUTER JOIN items ON items.order_id = o.id",
+			expected: &selectDef{
+				TableName: "users",
+				Alias:     "u",
+				Items: []selectItem{
+					{Expr: &columnRef{Table: "u", Name: "name"}},
+					{Expr: &columnRef{Table: "o", Name: "total"}},
+				},
+				Joins: []joinClause{
+					{Kind: "INNER", TableName: "orders", Alias: "o", On: &binaryExpr{Op: "=", Left: &columnRef{Table: "o", Name: "user_id"}, Right: &columnRef{Table: "u", Name: "id"}}},
+					{Kind: "LEFT", TableName: "items", On: &binaryExpr{Op: "=", Left: &columnRef{Table: "items", Name: "order_id"}, Right: &columnRef{Table: "o", Name: "id"}}},
+				},
+			},
+		},
+		{
+			name: "カンマ区切りのFROMとCROSS JOIN",
+			sql:  "SELECT * FROM a, b CROSS JOIN c WHERE a.id = b.id",
+			expected: &selectDef{
+				TableName:   "a",
+				IsSelectAll: true,
+				Joins: []joinClause{
+					{Kind: "CROSS", TableName: "b"},
+					{Kind: "CROSS", TableName: "c"},
+				},
+				Where: &binaryExpr{Op: "=", Left: &columnRef{Table: "a", Name: "id"}, Right: &columnRef{Table: "b", Name: "id"}},
+			},
+		},
+		{
+			name:     "ONのないJOIN",
+			sql:      "SELECT * FROM users JOIN orders",
+			hasError: true,
+		},
+		{
+			name:     "NULLSの後がない",
+			sql:      "SELECT * FROM users ORDER BY id NULLS",
+			hasError: true,
+		},
+		{
+			name:     "FROMなし",
+			sql:      "SELECT id users",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseSelect(tt.sql)
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("SELECT文が一致しません。期待: %+v, 実際: %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvalTypedExpr(t *testing.T) {
+	tableDef := &tableSchema{
+		Name: "items",
+		Columns: []columnDef{
+			{Name: "price", Type: "DECIMAL(10,2)"},
+			{Name: "rate", Type: "FLOAT"},
+			{Name: "active", Type: "BOOLEAN"},
+			{Name: "born", Type: "DATE"},
+			{Name: "created_at", Type: "TIMESTAMP"},
+			{Name: "attrs", Type: "JSON"},
+		},
+	}
+	row := tableRow{"19.99", "0.5", "true", "2024-02-28", "2024-02-28 12:00:00", `{"color":"red","size":{"w":10},"tags":["a","b"],"note":null}`}
+
+	// DECIMAL や DATE の値は == で比較できないので、表示用の文字列で比較する
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+		hasError bool
+	}{
+		{name: "DECIMAL の足し算は誤差がない", expr: "0.1 + 0.2", expected: "0.3"},
+		{name: "DECIMAL と整数の掛け算", expr: "price * 3", expected: "59.97"},
+		{name: "DECIMAL の割り算", expr: "1.0 / 3", expected: "0.3333333333333333"},
+		{name: "DECIMAL の比較", expr: "price = 19.990", expected: "true"},
+		{name: "FLOAT が混ざると FLOAT", expr: "rate + 1", expected: "1.5"},
+		{name: "指数表記は FLOAT", expr: "1.5e3", expected: "1500"},
+		{name: "負の DECIMAL", expr: "-price", expected: "-19.99"},
+		{name: "整数のオーバーフロー", expr: "9223372036854775807 + 1", hasError: true},
+		{name: "BOOLEAN のカラム", expr: "active AND TRUE", expected: "true"},
+		{name: "DATE に日数を足す", expr: "born + 2", expected: "2024-03-01"},
+		{name: "DATE の差は日数", expr: "DATE '2024-03-01' - born", expected: "2"},
+		{name: "DATE と TIMESTAMP の比較", expr: "born < created_at", expected: "true"},
+		{name: "TIMESTAMP リテラル", expr: "created_at = TIMESTAMP '2024-02-28 12:00:00'", expected: "true"},
+		{name: "不正な DATE リテラル", expr: "DATE '2024-02-30'", hasError: true},
+		{name: "DECIMAL のゼロ除算", expr: "price / 0", hasError: true},
+		{name: "DATE と数値の比較", expr: "born > 1", hasError: true},
+		{name: "文字列リテラルは相手の型で読む", expr: "born = '2024-02-28' AND price < '20'", expected: "true"},
+		{name: "文字列リテラルが相手の型で読めない", expr: "born = 'yesterday'", hasError: true},
+		{name: "CAST", expr: "CAST(price AS INT) + 1", expected: "21"},
+		{name: ":: による CAST", expr: "'42'::INT * 2", expected: "84"},
+		{name: ":: は単項マイナスより強く結合する", expr: "-'1.5'::DECIMAL(3,1)", expected: "-1.5"},
+		{name: "CAST で TEXT にする", expr: "born::TEXT || '!'", expected: "2024-02-28!"},
+		{name: "TIMESTAMP を DATE に CAST", expr: "created_at::DATE = born", expected: "true"},
+		{name: "DATE は INT に CAST できない", expr: "CAST(born AS INT)", hasError: true},
+		{name: "存在しない型への CAST", expr: "CAST(price AS MONEY)", hasError: true},
+		{name: "16 進のバイト列リテラル", expr: "X'DEADbeef'", expected: `\xdeadbeef`},
+		{name: "バイト列の連結と長さ", expr: "length(X'00FF' || X'10')", expected: "3"},
+		{name: "バイト列の比較", expr: "X'00FF' < X'01'", expected: "true"},
+		{name: "文字列からバイト列への CAST", expr: "'\\x0a0b'::BYTEA = X'0A0B'", expected: "true"},
+		{name: "不正な 16 進リテラル", expr: "X'ABC'", hasError: true},
+		{name: "-> は JSON のまま取り出す", expr: "attrs -> 'size'", expected: `{"w":10}`},
+		{name: "->> は TEXT にする", expr: "attrs ->> 'color' || '!'", expected: "red!"},
+		{name: "-> と ->> をつなげる", expr: "attrs -> 'tags' ->> -1", expected: "b"},
+		{name: "JSON の null は NULL", expr: "attrs ->> 'note'", expected: "NULL"},
+		{name: "存在しないキーは NULL", expr: "attrs -> 'missing' -> 'x'", expected: "NULL"},
+		{name: "json_extract", expr: "json_extract(attrs, '$.size.w')::INT + 1", expected: "11"},
+		{name: "json_extract の配列の要素", expr: "json_extract(attrs, '$.tags[0]')", expected: "a"},
+		{name: "不正な JSON のパス", expr: "json_extract(attrs, 'size')", hasError: true},
+		{name: "文字列リテラルは JSON として読む", expr: "'{\"a\": [1, 2]}' -> 'a' -> 1", expected: "2"},
+		{name: "JSON でない値に ->", expr: "price -> 'a'", hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseExpr(tt.expr)
+			if err == nil {
+				var result any
+				result, err = evalExpr(expr, rowEnv(tableDef, row))
+				if err == nil && !tt.hasError {
+					if got := formatValue(result); got != tt.expected {
+						t.Errorf("評価結果が一致しません。期待: %s, 実際: %s", tt.expected, got)
+					}
+					return
+				}
+			}
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+			t.Errorf("予期しないエラー: %v", err)
+		})
+	}
+}
+
+func TestEvalAssignment(t *testing.T) {
+	tests := []struct {
+		name     string
+		colType  string
+		expr     string
+		expected string
+		hasError bool
+	}{
+		{name: "DECIMAL はスケールに丸める", colType: "DECIMAL(5,2)", expr: "1.005", expected: "1.01"},
+		{name: "DECIMAL の整数はスケールを揃える", colType: "DECIMAL(5,2)", expr: "3", expected: "3.00"},
+		{name: "DECIMAL の精度を超える", colType: "DECIMAL(5,2)", expr: "1000", hasError: true},
+		{name: "VARCHAR の長さ以内", colType: "VARCHAR(3)", expr: "'あいう'", expected: "あいう"},
+		{name: "VARCHAR の長さを超える", colType: "VARCHAR(3)", expr: "'abcd'", hasError: true},
+		{name: "INT の範囲を超える", colType: "INT", expr: "1099511627776", hasError: true},
+		{name: "BIGINT は 64 ビット", colType: "BIGINT", expr: "1099511627776", expected: "1099511627776"},
+		{name: "FLOAT を INT に丸める", colType: "INT", expr: "2.5e0", expected: "2"},
+		{name: "数値を TEXT に代入する", colType: "TEXT", expr: "1.5", expected: "1.5"},
+		{name: "文字列リテラルの真偽値", colType: "BOOLEAN", expr: "'yes'", expected: "true"},
+		{name: "不正な真偽値", colType: "BOOLEAN", expr: "'maybe'", hasError: true},
+		{name: "文字列リテラルの DATE", colType: "DATE", expr: "'2024-01-31'", expected: "2024-01-31"},
+		{name: "TIMESTAMP を DATE にする", colType: "DATE", expr: "TIMESTAMP '2024-01-31 23:00:00'", expected: "2024-01-31"},
+		{name: "数値は DATE にできない", colType: "DATE", expr: "1", hasError: true},
+		{name: "TEXT の値は BOOLEAN に代入できない", colType: "BOOLEAN", expr: "'ye' || 's'", hasError: true},
+		{name: "CAST すれば代入できる", colType: "BOOLEAN", expr: "CAST('ye' || 's' AS BOOLEAN)", expected: "true"},
+		{name: "真偽値は INT に代入できない", colType: "INT", expr: "TRUE", hasError: true},
+		{name: "真偽値の CAST", colType: "INT", expr: "TRUE::INT", expected: "1"},
+		{name: "16 進のバイト列", colType: "BYTEA", expr: "X'CAFE'", expected: `\xcafe`},
+		{name: "文字列リテラルのバイト列", colType: "BYTEA", expr: "'\\xCAFE'", expected: `\xcafe`},
+		{name: "バイト列は INT に代入できない", colType: "INT", expr: "X'01'", hasError: true},
+		{name: "JSON は空白を詰めて保存する", colType: "JSON", expr: "'{\"a\": [1, 2]}'", expected: `{"a":[1,2]}`},
+		{name: "不正な JSON", colType: "JSON", expr: "'{\"a\": }'", hasError: true},
+		{name: "NULL", colType: "DECIMAL(5,2)", expr: "NULL", expected: nullField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("パースエラー: %v", err)
+			}
+			result, err := evalAssignment(columnDef{Name: "c", Type: tt.colType}, expr, noColumnsEnv("VALUES"))
+
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("保存する値が一致しません。期待: %s, 実際: %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func mustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestParseExplain(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		analyze  bool
+		format   string
+		table    string
+		hasError bool
+	}{
+		{
+			name:   "EXPLAIN のみ",
+			sql:    "EXPLAIN SELECT * FROM users WHERE id = 1",
+			format: "TEXT",
+			table:  "users",
+		},
+		{
+			name:    "EXPLAIN ANALYZE",
+			sql:     "explain analyze SELECT name FROM users;",
+			analyze: true,
+			format:  "TEXT",
+			table:   "users",
+		},
+		{
+			name:    "括弧のオプション",
+			sql:     "EXPLAIN (ANALYZE, FORMAT JSON) SELECT * FROM orders",
+			analyze: true,
+			format:  "JSON",
+			table:   "orders",
+		},
+		{
+			name:   "ANALYZE OFF",
+			sql:    "EXPLAIN (ANALYZE OFF) SELECT * FROM orders",
+			format: "TEXT",
+			table:  "orders",
+		},
+		{
+			name:     "SELECT 以外",
+			sql:      "EXPLAIN DELETE FROM users",
+			hasError: true,
+		},
+		{
+			name:     "不明な形式",
+			sql:      "EXPLAIN (FORMAT XML) SELECT * FROM users",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseExplain(tt.sql)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if result.Analyze != tt.analyze || result.Format != tt.format {
+				t.Errorf("オプションが一致しません。期待: ANALYZE=%v FORMAT=%s, 実際: ANALYZE=%v FORMAT=%s", tt.analyze, tt.format, result.Analyze, result.Format)
+			}
+			if result.Query == nil || result.Query.TableName != tt.table {
+				t.Errorf("SELECT 文が一致しません。期待: %s, 実際: %+v", tt.table, result.Query)
+			}
+		})
+	}
+}
+
+func TestParsePrepare(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		prepName  string
+		types     []string
+		statement string
+		hasError  bool
+	}{
+		{
+			name:      "型の指定なし",
+			sql:       "PREPARE add_user AS INSERT INTO users (id, name) VALUES ($1, $2)",
+			prepName:  "add_user",
+			statement: "INSERT INTO users (id, name) VALUES ($1, $2)",
+		},
+		{
+			name:      "型の指定あり",
+			sql:       "prepare find (INT, VARCHAR(10)) as SELECT * FROM users WHERE id = $1 AND name = $2;",
+			prepName:  "find",
+			types:     []string{"INT", "VARCHAR(10)"},
+			statement: "SELECT * FROM users WHERE id = $1 AND name = $2;",
+		},
+		{
+			name:     "SELECT / INSERT / UPDATE / DELETE 以外",
+			sql:      "PREPARE p AS CREATE TABLE t (id INT)",
+			hasError: true,
+		},
+		{
+			name:     "AS がない",
+			sql:      "PREPARE p SELECT 1 FROM users",
+			hasError: true,
+		},
+		{
+			name:     "不明な型",
+			sql:      "PREPARE p (FOO) AS SELECT * FROM users",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parsePrepare(tt.sql)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if result.Name != tt.prepName {
+				t.Errorf("名前が一致しません。期待: %s, 実際: %s", tt.prepName, result.Name)
+			}
+			var types []string
+			for _, typ := range result.Types {
+				types = append(types, typ.String())
+			}
+			if !reflect.DeepEqual(types, tt.types) {
+				t.Errorf("型が一致しません。期待: %v, 実際: %v", tt.types, types)
+			}
+			if result.Statement != tt.statement {
+				t.Errorf("文が一致しません。期待: %s, 実際: %s", tt.statement, result.Statement)
+			}
+		})
+	}
+}
+
+func TestParseExecuteAndDeallocate(t *testing.T) {
+	execute, err := parseExecute("EXECUTE find(1, 'Alice', -2.5);")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if execute.Name != "find" || len(execute.Args) != 3 {
+		t.Errorf("EXECUTE が一致しません: %+v", execute)
+	}
+	if execute, err = parseExecute("EXECUTE list"); err != nil || len(execute.Args) != 0 {
+		t.Errorf("引数のない EXECUTE が一致しません: %+v, %v", execute, err)
+	}
+	if _, err := parseExecute("EXECUTE find($1)"); err == nil {
+		t.Errorf("EXECUTE の引数のパラメータでエラーが発生しませんでした")
+	}
+
+	dealloc, err := parseDeallocate("DEALLOCATE PREPARE find")
+	if err != nil || dealloc.Name != "find" || dealloc.All {
+		t.Errorf("DEALLOCATE が一致しません: %+v, %v", dealloc, err)
+	}
+	if dealloc, err = parseDeallocate("deallocate all;"); err != nil || !dealloc.All {
+		t.Errorf("DEALLOCATE ALL が一致しません: %+v, %v", dealloc, err)
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		indexes  []int
+		hasError bool
+	}{
+		{
+			name:    "番号のパラメータ",
+			sql:     "SELECT * FROM users WHERE id = $2 AND name = $1",
+			indexes: []int{2, 1},
+		},
+		{
+			name:    "? は出てきた順の番号",
+			sql:     "SELECT * FROM users WHERE id = ? AND name = ?",
+			indexes: []int{1, 2},
+		},
+		{
+			name:    "文字列の中の ? と $1 はパラメータではない",
+			sql:     "SELECT * FROM users WHERE name = '?' OR name = '$1' OR id = ?",
+			indexes: []int{1},
+		},
+		{
+			name:     "? と $1 を混ぜる",
+			sql:      "SELECT * FROM users WHERE id = ? AND name = $2",
+			hasError: true,
+		},
+		{
+			name:     "番号が 0",
+			sql:      "SELECT * FROM users WHERE id = $0",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseSelect(tt.sql)
+			if tt.hasError {
+				if err == nil {
+					t.Errorf("期待されたエラーが発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			var indexes []int
+			walkExpr(result.Where, func(e exprNode) {
+				if param, ok := e.(*paramExpr); ok {
+					indexes = append(indexes, param.Index)
+				}
+			})
+			if !reflect.DeepEqual(indexes, tt.indexes) {
+				t.Errorf("パラメータの番号が一致しません。期待: %v, 実際: %v", tt.indexes, indexes)
+			}
+		})
+	}
+
+	// DDL の式にはパラメータを書けない
+	if _, err := parseCreateTable("CREATE TABLE t (id INT DEFAULT $1)"); err == nil {
+		t.Errorf("CREATE TABLE のパラメータでエラーが発生しませんでした")
+	}
+}
@@ -0,0 +1,165 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SELECT 文のプラン（物理演算子の木）を作る
+//
+// FROM 句のテーブルの読み方と結合の順番はオプティマイザ（optimizer.go）が推定のコストで選ぶ
+//   - テーブルごとに seqScan か indexScan（システムビューはカタログから作った行を返す rowsScan）
+//   - テーブルどうしは nestedLoopJoin でつなぎ、WHERE / ON の条件は参照するテーブルがそろったところで評価する
+// その上に Project（集約するなら Aggregate）、ORDER BY があれば Sort、LIMIT / OFFSET があれば Limit を重ねる
+
+// planSelect - SELECT 文のプランと結果の列を作る
+func (db *database) planSelect(selectDef *selectDef) (operator, []ResultColumn, error) {
+	sc, err := db.selectScope(selectDef)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkSelectTypes(sc, selectDef); err != nil {
+		return nil, nil, err
+	}
+	o, err := newOptimizer(db, sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := o.planFrom(selectDef)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return planOutput(sc, selectDef, input)
+}
+
+// selectScope - FROM 句のテーブルのスコープを作る（式のカラムはこのスコープで解決する）
+func (db *database) selectScope(selectDef *selectDef) (*scope, error) {
+	refs := append([]joinClause{{TableName: selectDef.TableName, Alias: selectDef.Alias}}, selectDef.Joins...)
+
+	sc := &scope{}
+	for _, ref := range refs {
+		tableDef, err := db.sourceTable(ref.TableName)
+		if err != nil {
+			return nil, err
+		}
+		alias := ref.Alias
+		if alias == "" {
+			// スキーマ名付きのテーブル（information_schema.tables）はテーブル名の部分で参照する
+			alias = ref.TableName[strings.LastIndex(ref.TableName, ".")+1:]
+		}
+		for _, src := range sc.sources {
+			if src.alias == alias {
+				return nil, fmt.Errorf("テーブル名 '%s' が FROM 句に 2 回以上出てきます（別名を付けてください）", alias)
+			}
+		}
+		sc.sources = append(sc.sources, source{alias: alias, tableDef: tableDef})
+	}
+	return sc, nil
+}
+
+// checkSelectTypes - SELECT 文の式の比較・演算の型を、行を読む前に確かめる（cast.go）
+func checkSelectTypes(sc *scope, selectDef *selectDef) error {
+	exprs := []exprNode{selectDef.Where}
+	for _, item := range selectDef.Items {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, join := range selectDef.Joins {
+		exprs = append(exprs, join.On)
+	}
+	exprs = append(exprs, selectDef.GroupBy...)
+	for _, item := range selectDef.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, e := range exprs {
+		if err := checkExprTypes(sc, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceTable - FROM 句のテーブル名からテーブル定義を取得する（システムビューも含む）
+func (db *database) sourceTable(name string) (*tableSchema, error) {
+	if view, ok := lookupSystemView(name); ok {
+		return view.tableDef(), nil
+	}
+	return db.getTable(name)
+}
+
+// planOutput - FROM / WHERE の結果の行（input）に、SELECT 句・集約・ORDER BY・LIMIT の演算子を重ねる
+func planOutput(sc *scope, selectDef *selectDef, input operator) (operator, []ResultColumn, error) {
+	items := selectDef.Items
+	if selectDef.IsSelectAll {
+		items = nil
+		for _, src := range sc.sources {
+			for _, col := range src.tableDef.Columns {
+				ref := &columnRef{Name: col.Name}
+				// 複数のテーブルに同じ名前のカラムがあってもよいように、テーブルを指定する
+				if len(sc.sources) > 1 {
+					ref.Table = src.alias
+				}
+				items = append(items, selectItem{Expr: ref})
+			}
+		}
+	}
+
+	columns := []ResultColumn{}
+	names := []string{}
+	for _, item := range items {
+		columns = append(columns, ResultColumn{Name: selectItemName(item), Type: exprType(sc, item.Expr)})
+		names = append(names, selectItemName(item))
+	}
+
+	// ORDER BY に出力カラム名・別名・列番号が書かれていれば、その列の値で並べる
+	orderPositions := make([]int, len(selectDef.OrderBy))
+	for i, item := range selectDef.OrderBy {
+		pos, err := resolveOrderBy(item, names)
+		if err != nil {
+			return nil, nil, err
+		}
+		orderPositions[i] = pos
+	}
+
+	// 演算子を重ねるたびに、子の見積もりから行数とコストを見積もる（EXPLAIN で表示する）
+	var plan operator
+	if isAggregateQuery(selectDef, items) {
+		plan = &aggregate{scope: sc, child: input, groupBy: selectDef.GroupBy, items: items, orderBy: selectDef.OrderBy, orderPositions: orderPositions}
+	} else {
+		plan = &project{scope: sc, child: input, items: items, orderBy: selectDef.OrderBy, orderPositions: orderPositions}
+	}
+	estimateOutput(plan)
+	if len(selectDef.OrderBy) > 0 {
+		plan = &sortOp{child: plan, orderBy: selectDef.OrderBy}
+		estimateOutput(plan)
+	}
+	if selectDef.Limit != nil || selectDef.Offset > 0 {
+		plan = &limit{child: plan, limit: selectDef.Limit, offset: selectDef.Offset}
+		estimateOutput(plan)
+	}
+	return plan, columns, nil
+}
+
+// runPlan - プランを実行して、SELECT 句の値の行を全部集める
+func runPlan(plan operator, columns []ResultColumn) (*queryResult, error) {
+	result := &queryResult{columns: columns}
+	if err := plan.Open(); err != nil {
+		plan.Close()
+		return nil, err
+	}
+	for {
+		t, err := plan.Next()
+		if err != nil {
+			plan.Close()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		result.rows = append(result.rows, t.values)
+	}
+	if err := plan.Close(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,586 @@
+package godb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// プリペアド文（PREPARE / EXECUTE / DEALLOCATE と DB.Prepare）
+//
+// 文は 1 回だけパースして、値を書くところにパラメータ（$1, $2, ... か、出てきた順に番号が付く ?）を書いておき、実行するたびに値だけを入れる
+//   - パラメータの型は PREPARE name (INT, TEXT) AS ... で指定するか、使われている場所から決める
+//     （INSERT の VALUES・SET 句ならカラムの型、比較・演算なら相手の式の型、CAST ならその型、AND / OR / WHERE なら BOOLEAN）
+//     決まらなかったパラメータは値の型のまま使う
+//   - 値は実行するときにパラメータの型に変換する（文字列は CAST と同じくその型の表記として読む。変換できなければエラー）
+//     値を SQL の文字列に埋め込まないので、値で文の意味が変わることはない
+//   - SELECT はプランもキャッシュして使い回す（型の決まったパラメータは定数と同じくインデックスの検索キーにもなる）
+//     テーブルの定義かインデックスが変わったら（database.planVersion）、型を決め直してプランを作り直す
+//     システムビューを読む SELECT はプランを作るときにビューの行を作るので、毎回プランを作る
+//   - プリペアド文はデータベースを開いている間だけ使える（ファイルには保存しない）。PREPARE した名前は DEALLOCATE で捨てる
+
+const maxParams = 65535 // パラメータの番号の上限（postgres と同じ）
+
+// preparedStmt - パースしたプリペアド文
+// パースした文の式のパラメータ（*paramExpr）に実行するたびに値を入れて、文を実行する
+type preparedStmt struct {
+	name     string     // PREPARE した名前（DB.Prepare のものは空）
+	command  string     // SELECT / INSERT / UPDATE / DELETE
+	query    *selectDef // SELECT 文（command が SELECT のとき）
+	insert   *insertDef
+	update   *updateDef
+	delete   *deleteDef
+	explicit []SQLType      // PREPARE で指定したパラメータの型（$1 から順に）
+	params   [][]*paramExpr // 番号ごとの文の中のパラメータ（params[0] が $1 の全部）
+	types    []*SQLType     // 番号ごとのパラメータの型（nil なら決まらなかった）
+	plan     operator       // SELECT のキャッシュしたプラン（システムビューを読むなら nil）
+	columns  []ResultColumn
+	version  int64 // 型を決めてプランを作ったときの database.planVersion
+}
+
+// Prepare - PREPARE文を実行
+func (db *database) Prepare(sql string) (*Result, error) {
+	def, err := parsePrepare(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	if _, exists := db.prepared[def.Name]; exists {
+		return nil, fmt.Errorf("プリペアド文 '%s' は既に存在します", def.Name)
+	}
+	ps, err := db.prepareStatement(def.Name, def.Statement, def.Types)
+	if err != nil {
+		return nil, err
+	}
+	db.prepared[def.Name] = ps
+	db.logf("プリペアド文 '%s' を作成しました（パラメータ %d 個）", def.Name, len(ps.params))
+	return newResult("PREPARE"), nil
+}
+
+// Execute - EXECUTE文を実行
+// 引数の式は行のない場所で評価する（型のない文字列リテラルはパラメータの型の表記として読む）
+func (db *database) Execute(sql string) (*Result, error) {
+	def, err := parseExecute(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	ps, exists := db.prepared[def.Name]
+	if !exists {
+		return nil, fmt.Errorf("プリペアド文 '%s' は存在しません", def.Name)
+	}
+	args := make([]any, len(def.Args))
+	for i, arg := range def.Args {
+		if args[i], err = evalExpr(db.bindSequences(arg), noColumnsEnv("EXECUTE の引数")); err != nil {
+			return nil, err
+		}
+	}
+	return db.executePrepared(ps, args)
+}
+
+// Deallocate - DEALLOCATE文を実行
+func (db *database) Deallocate(sql string) (*Result, error) {
+	def, err := parseDeallocate(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	if def.All {
+		db.prepared = make(map[string]*preparedStmt)
+		db.logf("プリペアド文をすべて削除しました")
+		return newResult("DEALLOCATE ALL"), nil
+	}
+	if _, exists := db.prepared[def.Name]; !exists {
+		return nil, fmt.Errorf("プリペアド文 '%s' は存在しません", def.Name)
+	}
+	delete(db.prepared, def.Name)
+	db.logf("プリペアド文 '%s' を削除しました", def.Name)
+	return newResult("DEALLOCATE"), nil
+}
+
+// prepareStatement - SQL 文をパースしてプリペアド文を作る（types は PREPARE で指定したパラメータの型）
+// テーブルやカラムがなければここでエラーになる（SELECT はプランも作る）
+func (db *database) prepareStatement(name, sql string, types []SQLType) (*preparedStmt, error) {
+	ps := &preparedStmt{name: name, explicit: types}
+	var err error
+	upper := strings.ToUpper(strings.TrimSpace(sql))
+	switch {
+	case strings.HasPrefix(upper, "SELECT"):
+		ps.command = "SELECT"
+		ps.query, err = parseSelect(sql)
+	case strings.HasPrefix(upper, "INSERT"):
+		ps.command = "INSERT"
+		ps.insert, err = parseInsert(sql)
+	case strings.HasPrefix(upper, "UPDATE"):
+		ps.command = "UPDATE"
+		ps.update, err = parseUpdate(sql)
+	case strings.HasPrefix(upper, "DELETE"):
+		ps.command = "DELETE"
+		ps.delete, err = parseDelete(sql)
+	default:
+		return nil, fmt.Errorf("プリペアド文にできるのは SELECT / INSERT / UPDATE / DELETE 文だけです")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+
+	// パラメータを番号ごとに集める（PREPARE で型だけ指定した番号も数に入れる）
+	for _, e := range ps.exprs() {
+		walkExpr(e, func(e exprNode) {
+			if param, ok := e.(*paramExpr); ok {
+				for len(ps.params) < param.Index {
+					ps.params = append(ps.params, nil)
+				}
+				ps.params[param.Index-1] = append(ps.params[param.Index-1], param)
+			}
+		})
+	}
+	for len(ps.params) < len(types) {
+		ps.params = append(ps.params, nil)
+	}
+	for i, params := range ps.params {
+		if len(params) == 0 && i >= len(types) {
+			return nil, fmt.Errorf("パラメータ $%d が使われていません（型を決められません）", i+1)
+		}
+	}
+
+	if err := db.resolvePrepared(ps); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// exprs - 文の中の式を全部返す（パラメータを集めるのに使う）
+func (ps *preparedStmt) exprs() []exprNode {
+	exprs := []exprNode{}
+	returning := func(r *returningClause) {
+		if r != nil {
+			for _, item := range r.Items {
+				exprs = append(exprs, item.Expr)
+			}
+		}
+	}
+	sets := func(sets []setClause) {
+		for _, set := range sets {
+			exprs = append(exprs, set.Value)
+		}
+	}
+	var query func(q *selectDef)
+	query = func(q *selectDef) {
+		for _, item := range q.Items {
+			exprs = append(exprs, item.Expr)
+		}
+		for _, join := range q.Joins {
+			exprs = append(exprs, join.On)
+		}
+		exprs = append(exprs, q.Where)
+		exprs = append(exprs, q.GroupBy...)
+		for _, item := range q.OrderBy {
+			exprs = append(exprs, item.Expr)
+		}
+	}
+	switch ps.command {
+	case "SELECT":
+		query(ps.query)
+	case "INSERT":
+		for _, row := range ps.insert.Rows {
+			exprs = append(exprs, row...)
+		}
+		if ps.insert.Select != nil {
+			query(ps.insert.Select)
+		}
+		if ps.insert.OnConflict != nil {
+			sets(ps.insert.OnConflict.Sets)
+			exprs = append(exprs, ps.insert.OnConflict.Where)
+		}
+		returning(ps.insert.Returning)
+	case "UPDATE":
+		sets(ps.update.Sets)
+		exprs = append(exprs, ps.update.Where)
+		returning(ps.update.Returning)
+	case "DELETE":
+		exprs = append(exprs, ps.delete.Where)
+		returning(ps.delete.Returning)
+	}
+	return exprs
+}
+
+// resolvePrepared - パラメータの型を決め直し、SELECT ならプランを作ってキャッシュする
+// 作ったとき・テーブルの定義かインデックスが変わったあとに最初に実行するときに呼ぶ
+func (db *database) resolvePrepared(ps *preparedStmt) error {
+	for i, params := range ps.params {
+		for _, param := range params {
+			param.Type = nil
+			if i < len(ps.explicit) {
+				param.Type = &ps.explicit[i]
+			}
+		}
+	}
+	if err := db.inferPrepared(ps); err != nil {
+		return err
+	}
+	// 同じ番号のパラメータは、最初に型が決まったところの型にそろえる
+	ps.types = make([]*SQLType, len(ps.params))
+	for i, params := range ps.params {
+		if i < len(ps.explicit) {
+			ps.types[i] = &ps.explicit[i]
+		}
+		for _, param := range params {
+			if ps.types[i] == nil {
+				ps.types[i] = param.Type
+			}
+		}
+		for _, param := range params {
+			param.Type = ps.types[i]
+		}
+	}
+
+	ps.plan, ps.columns = nil, nil
+	if ps.command == "SELECT" {
+		db.bindQuery(ps.query)
+		plan, columns, err := db.planSelect(ps.query)
+		if err != nil {
+			return err
+		}
+		if !readsSystemView(ps.query) {
+			ps.plan, ps.columns = plan, columns
+		}
+	}
+	ps.version = db.planVersion
+	return nil
+}
+
+// readsSystemView - SELECT 文の FROM 句にシステムビューがあるか
+func readsSystemView(selectDef *selectDef) bool {
+	if _, ok := lookupSystemView(selectDef.TableName); ok {
+		return true
+	}
+	for _, join := range selectDef.Joins {
+		if _, ok := lookupSystemView(join.TableName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inferPrepared - 文のパラメータに、使われている場所から型を付ける
+func (db *database) inferPrepared(ps *preparedStmt) error {
+	boolean := &SQLType{Kind: TypeBoolean}
+	query := func(q *selectDef, targets []*SQLType) error {
+		sc, err := db.selectScope(q)
+		if err != nil {
+			return err
+		}
+		for i, item := range q.Items {
+			var want *SQLType
+			if i < len(targets) {
+				want = targets[i]
+			}
+			inferParamTypes(sc, item.Expr, want)
+		}
+		for _, join := range q.Joins {
+			inferParamTypes(sc, join.On, boolean)
+		}
+		inferParamTypes(sc, q.Where, boolean)
+		for _, e := range q.GroupBy {
+			inferParamTypes(sc, e, nil)
+		}
+		for _, item := range q.OrderBy {
+			inferParamTypes(sc, item.Expr, nil)
+		}
+		return nil
+	}
+	if ps.command == "SELECT" {
+		return query(ps.query, nil)
+	}
+
+	var tableName string
+	switch ps.command {
+	case "INSERT":
+		tableName = ps.insert.TableName
+	case "UPDATE":
+		tableName = ps.update.TableName
+	case "DELETE":
+		tableName = ps.delete.TableName
+	}
+	tableDef, err := db.getTable(tableName)
+	if err != nil {
+		return err
+	}
+	sc := &scope{sources: []source{{alias: tableDef.Name, tableDef: tableDef}}}
+	columnTypeOf := func(name string) *SQLType {
+		if pos := tableDef.ColumnIndex(name); pos >= 0 {
+			t := columnType(tableDef.Columns[pos])
+			return &t
+		}
+		return nil
+	}
+	sets := func(sc *scope, sets []setClause) {
+		for _, set := range sets {
+			inferParamTypes(sc, set.Value, columnTypeOf(set.Column))
+		}
+	}
+	returning := func(r *returningClause) {
+		if r != nil {
+			for _, item := range r.Items {
+				inferParamTypes(sc, item.Expr, nil)
+			}
+		}
+	}
+
+	switch ps.command {
+	case "INSERT":
+		def := ps.insert
+		columns := def.Columns
+		if columns == nil {
+			for _, col := range tableDef.Columns {
+				columns = append(columns, col.Name)
+			}
+		}
+		targets := make([]*SQLType, len(columns))
+		for i, name := range columns {
+			targets[i] = columnTypeOf(name)
+		}
+		for _, row := range def.Rows {
+			for i, e := range row {
+				var want *SQLType
+				if i < len(targets) {
+					want = targets[i]
+				}
+				inferParamTypes(sc, e, want)
+			}
+		}
+		if def.Select != nil {
+			if err := query(def.Select, targets); err != nil {
+				return err
+			}
+		}
+		if def.OnConflict != nil {
+			// DO UPDATE の式では EXCLUDED.カラム で追加しようとした行を参照できる
+			excluded := &scope{sources: append(sc.sources, source{alias: "EXCLUDED", tableDef: tableDef})}
+			sets(excluded, def.OnConflict.Sets)
+			inferParamTypes(excluded, def.OnConflict.Where, boolean)
+		}
+		returning(def.Returning)
+	case "UPDATE":
+		sets(sc, ps.update.Sets)
+		inferParamTypes(sc, ps.update.Where, boolean)
+		returning(ps.update.Returning)
+	case "DELETE":
+		inferParamTypes(sc, ps.delete.Where, boolean)
+		returning(ps.delete.Returning)
+	}
+	return nil
+}
+
+// inferParamTypes - 式の中の型の決まっていないパラメータに、使われている場所から型を付ける
+// want は式の値を入れる先の型（INSERT の VALUES・SET 句ならカラムの型、条件なら BOOLEAN。なければ nil）
+func inferParamTypes(sc *scope, e exprNode, want *SQLType) {
+	switch e := e.(type) {
+	case *paramExpr:
+		if e.Type == nil && want != nil {
+			t := paramType(*want)
+			e.Type = &t
+		}
+	case *castExpr:
+		inferParamTypes(sc, e.Operand, &e.Type)
+	case *unaryExpr:
+		if e.Op == "NOT" {
+			inferParamTypes(sc, e.Operand, &SQLType{Kind: TypeBoolean})
+		} else {
+			inferParamTypes(sc, e.Operand, nil)
+		}
+	case *isNullExpr:
+		inferParamTypes(sc, e.Operand, nil)
+	case *funcCall:
+		for _, arg := range e.Args {
+			inferParamTypes(sc, arg, nil)
+		}
+	case *sequenceCall:
+		inferParamTypes(sc, e.call, nil)
+	case *binaryExpr:
+		var left, right *SQLType
+		switch e.Op {
+		case "AND", "OR":
+			left, right = &SQLType{Kind: TypeBoolean}, &SQLType{Kind: TypeBoolean}
+		case "||":
+			left, right = &SQLType{Kind: TypeText}, &SQLType{Kind: TypeText}
+		case "->", "->>":
+			left = &SQLType{Kind: TypeJSON}
+		default:
+			// 比較・演算は相手の式の型にする（DATE ± 整数の整数の側は INT、DATE - DATE の左の DATE はそのまま）
+			if t, ok := knownType(sc, e.Right); ok {
+				left = &t
+				if t.Kind == TypeDate && e.Op == "+" {
+					left = &SQLType{Kind: TypeInt}
+				}
+			}
+			if t, ok := knownType(sc, e.Left); ok {
+				right = &t
+				if t.Kind == TypeDate && (e.Op == "+" || e.Op == "-") {
+					right = &SQLType{Kind: TypeInt}
+				}
+			}
+		}
+		inferParamTypes(sc, e.Left, left)
+		inferParamTypes(sc, e.Right, right)
+	}
+}
+
+// knownType - 式の型が行を見ずに決まれば返す（型の決まっていないパラメータ・型のない文字列リテラル・NULL を含む式は false）
+func knownType(sc *scope, e exprNode) (SQLType, bool) {
+	switch e := e.(type) {
+	case *paramExpr:
+		if e.Type != nil {
+			return *e.Type, true
+		}
+	case *literal:
+		if e.Value != nil && !isUnknownLiteral(e) {
+			return exprType(sc, e), true
+		}
+	case *columnRef:
+		if i, pos, err := sc.resolve(e); err == nil {
+			return columnType(sc.sources[i].tableDef.Columns[pos]), true
+		}
+	case *castExpr:
+		return e.Type, true
+	case *sequenceCall:
+		return SQLType{Kind: TypeBigInt}, true
+	case *unaryExpr, *binaryExpr, *funcCall:
+		known := true
+		walkExpr(e, func(sub exprNode) {
+			switch sub := sub.(type) {
+			case *paramExpr, *literal, *columnRef:
+				if _, ok := knownType(sc, sub); !ok {
+					known = false
+				}
+			}
+		})
+		if known {
+			return exprType(sc, e), true
+		}
+	}
+	return SQLType{}, false
+}
+
+// paramType - 使われている場所の型からパラメータの型を決める
+// VARCHAR(n) の長さや DECIMAL(p, s) の桁は付けない（値を入れる先のカラムで確かめる）
+func paramType(t SQLType) SQLType {
+	return SQLType{Kind: t.Kind}
+}
+
+// executePrepared - プリペアド文にパラメータの値を入れて実行する
+// テーブルの定義かインデックスが変わっていれば、先に型を決め直してプランを作り直す
+func (db *database) executePrepared(ps *preparedStmt, args []any) (*Result, error) {
+	if err := db.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ps.version != db.planVersion {
+		if err := db.resolvePrepared(ps); err != nil {
+			return nil, err
+		}
+	}
+	if err := ps.bind(args); err != nil {
+		return nil, err
+	}
+	defer ps.unbind()
+
+	switch ps.command {
+	case "INSERT":
+		return db.insert(ps.insert)
+	case "UPDATE":
+		return db.update(ps.update)
+	case "DELETE":
+		return db.delete(ps.delete)
+	}
+	var result *queryResult
+	var err error
+	if ps.plan != nil {
+		result, err = runPlan(ps.plan, ps.columns)
+	} else {
+		result, err = db.query(ps.query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newRowsResult("SELECT", result), nil
+}
+
+// bind - パラメータに値を入れる（値はパラメータの型に変換する）
+func (ps *preparedStmt) bind(args []any) error {
+	if len(args) != len(ps.params) {
+		return fmt.Errorf("パラメータは %d 個ですが、値が %d 個あります", len(ps.params), len(args))
+	}
+	for i, arg := range args {
+		v, err := paramValue(arg)
+		if err == nil && v != nil && ps.types[i] != nil {
+			// 文字列は型のない文字列リテラルと同じく、パラメータの型の表記として読む
+			ctx := castAssignment
+			if _, isString := v.(string); isString {
+				ctx = castExplicit
+			}
+			v, err = castValue(v, *ps.types[i], ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("パラメータ $%d: %v", i+1, err)
+		}
+		for _, param := range ps.params[i] {
+			param.value, param.bound = v, true
+		}
+	}
+	return nil
+}
+
+// unbind - パラメータの値を消す（実行し終わったら値を持ったままにしない）
+func (ps *preparedStmt) unbind() {
+	for _, params := range ps.params {
+		for _, param := range params {
+			param.value, param.bound = nil, false
+		}
+	}
+}
+
+// paramValue - Go の値をパラメータの値（エンジンの値の型）にする
+// 整数は int64、浮動小数点数は float64、time.Time は時刻の表記（壁時計の時刻）の TIMESTAMP にする
+func paramValue(v any) (any, error) {
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return nil, err
+		}
+		v = dv
+	}
+	switch v := v.(type) {
+	case nil, int64, float64, bool, string, []byte, Decimal, Date, Timestamp, JSON:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return nil, fmt.Errorf("値 %d は BIGINT の範囲を超えています", v)
+		}
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("値 %d は BIGINT の範囲を超えています", v)
+		}
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case time.Time:
+		wall := time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC)
+		return Timestamp{wall.Truncate(time.Microsecond)}, nil
+	}
+	return nil, fmt.Errorf("値の型 %T には対応していません", v)
+}
@@ -0,0 +1,345 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SELECT の WHERE 以降の処理
+// SELECT 句の式の評価・GROUP BY と集約関数・ORDER BY・LIMIT / OFFSET
+// それぞれの処理を行う演算子は executor.go、演算子の組み立ては plan.go
+
+// queryResult - SELECT の結果（列の名前と型、値の行）
+type queryResult struct {
+	columns []ResultColumn
+	rows    [][]any
+}
+
+// evalSelect - メモリ上の行（WHERE で絞り込む前）から SELECT の結果を作る（RETURNING 用）
+func evalSelect(tableDef *tableSchema, selectDef *selectDef, rows []tableRow) (*queryResult, error) {
+	sc := &scope{sources: []source{{alias: tableDef.Name, tableDef: tableDef}}}
+	scan := &rowsScan{scope: sc, source: 0, rows: rows, filter: selectDef.Where}
+	plan, columns, err := planOutput(sc, selectDef, scan)
+	if err != nil {
+		return nil, err
+	}
+	return runPlan(plan, columns)
+}
+
+// evalReturning - INSERT / UPDATE / DELETE の RETURNING 句を、追加・更新・削除した行に対して評価する
+// SELECT 句と同じく式を評価して列名を決める（集約関数は使えない）
+func evalReturning(tableDef *tableSchema, returning *returningClause, rows []tableRow) (*queryResult, error) {
+	for _, item := range returning.Items {
+		if containsAggregate(item.Expr) {
+			return nil, fmt.Errorf("RETURNING 句では集約関数は使えません")
+		}
+	}
+	selectDef := &selectDef{TableName: tableDef.Name, Items: returning.Items, IsSelectAll: returning.All}
+	return evalSelect(tableDef, selectDef, rows)
+}
+
+// selectItemName - 結果の列名（別名 > カラム名 > 関数名 > CAST の型名、それ以外は postgres と同じく ?column?）
+func selectItemName(item selectItem) string {
+	if item.Alias != "" {
+		return item.Alias
+	}
+	switch e := item.Expr.(type) {
+	case *columnRef:
+		return e.Name
+	case *funcCall:
+		return e.Name
+	case *sequenceCall:
+		return e.call.Name
+	case *castExpr:
+		// CAST(id AS TEXT) は id、CAST('1' AS INT) のように名前のないものは型名
+		if name := selectItemName(selectItem{Expr: e.Operand}); name != "?column?" {
+			return name
+		}
+		return strings.ToLower(SQLType{Kind: e.Type.Kind}.String())
+	}
+	return "?column?"
+}
+
+// resolveOrderBy - ORDER BY の項目が出力の列を指していればその位置を返す（式として評価する場合は -1）
+func resolveOrderBy(item orderByItem, columns []string) (int, error) {
+	switch e := item.Expr.(type) {
+	case *literal:
+		n, ok := e.Value.(int64)
+		if !ok {
+			return -1, nil
+		}
+		if n < 1 || n > int64(len(columns)) {
+			return 0, fmt.Errorf("ORDER BY の位置 %d は SELECT の列の範囲外です", n)
+		}
+		return int(n - 1), nil
+	case *columnRef:
+		if e.Table != "" {
+			return -1, nil
+		}
+		for i, name := range columns {
+			if strings.EqualFold(name, e.Name) {
+				return i, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// setOutputValues - SELECT 句の値と ORDER BY のキーを eval で評価して t に入れる
+func setOutputValues(t *tuple, items []selectItem, orderBy []orderByItem, orderPositions []int, eval func(exprNode) (any, error)) error {
+	t.values = make([]any, 0, len(items))
+	for _, item := range items {
+		v, err := eval(item.Expr)
+		if err != nil {
+			return err
+		}
+		t.values = append(t.values, v)
+	}
+	t.sortKeys = make([]any, 0, len(orderBy))
+	for i, item := range orderBy {
+		if orderPositions[i] >= 0 {
+			t.sortKeys = append(t.sortKeys, t.values[orderPositions[i]])
+			continue
+		}
+		v, err := eval(item.Expr)
+		if err != nil {
+			return err
+		}
+		t.sortKeys = append(t.sortKeys, v)
+	}
+	return nil
+}
+
+// isAggregateQuery - GROUP BY があるか、SELECT 句・ORDER BY に集約関数が含まれているか
+func isAggregateQuery(selectDef *selectDef, items []selectItem) bool {
+	if len(selectDef.GroupBy) > 0 {
+		return true
+	}
+	exprs := []exprNode{}
+	for _, item := range items {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, item := range selectDef.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	return containsAggregate(exprs...)
+}
+
+// containsAggregate - 式に集約関数の呼び出しが含まれているか
+func containsAggregate(exprs ...exprNode) bool {
+	found := false
+	for _, e := range exprs {
+		walkExpr(e, func(e exprNode) {
+			if call, ok := e.(*funcCall); ok && isAggregateFunc(call.Name) {
+				found = true
+			}
+		})
+	}
+	return found
+}
+
+// replaceAggregates - 式の中の集約関数の呼び出しを、compute で計算した値のリテラルに置き換えた式を返す
+func replaceAggregates(e exprNode, compute func(*funcCall) (any, error)) (exprNode, error) {
+	switch e := e.(type) {
+	case *funcCall:
+		if isAggregateFunc(e.Name) {
+			if containsAggregate(e.Args...) {
+				return nil, fmt.Errorf("集約関数 %s の引数に集約関数は使えません", e.Name)
+			}
+			v, err := compute(e)
+			if err != nil {
+				return nil, err
+			}
+			return valueExpr(v), nil
+		}
+		args := make([]exprNode, len(e.Args))
+		for i, arg := range e.Args {
+			replaced, err := replaceAggregates(arg, compute)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = replaced
+		}
+		return &funcCall{Name: e.Name, Args: args, Star: e.Star}, nil
+
+	case *unaryExpr:
+		operand, err := replaceAggregates(e.Operand, compute)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{Op: e.Op, Operand: operand}, nil
+
+	case *isNullExpr:
+		operand, err := replaceAggregates(e.Operand, compute)
+		if err != nil {
+			return nil, err
+		}
+		return &isNullExpr{Operand: operand, Not: e.Not}, nil
+
+	case *castExpr:
+		operand, err := replaceAggregates(e.Operand, compute)
+		if err != nil {
+			return nil, err
+		}
+		return &castExpr{Operand: operand, Type: e.Type}, nil
+
+	case *binaryExpr:
+		left, err := replaceAggregates(e.Left, compute)
+		if err != nil {
+			return nil, err
+		}
+		right, err := replaceAggregates(e.Right, compute)
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{Op: e.Op, Left: left, Right: right}, nil
+	}
+	return e, nil
+}
+
+// valueExpr - 計算済みの値を式にする
+// 文字列の値は型のない文字列リテラルではなく TEXT の値として扱う（min(name) の結果や INSERT ... SELECT の値）
+func valueExpr(v any) exprNode {
+	if _, ok := v.(string); ok {
+		return &castExpr{Operand: &literal{Value: v}, Type: SQLType{Kind: TypeText}}
+	}
+	return &literal{Value: v}
+}
+
+// checkGrouped - 集約した結果の式で、集約関数の外のカラム参照が GROUP BY に含まれているか確認する
+func checkGrouped(e exprNode, groupBy []exprNode) error {
+	for _, g := range groupBy {
+		if strings.EqualFold(g.String(), e.String()) {
+			return nil
+		}
+	}
+	switch e := e.(type) {
+	case *columnRef:
+		return fmt.Errorf("カラム '%s' は GROUP BY 句に含めるか、集約関数の中で使う必要があります", e.Name)
+	case *unaryExpr:
+		return checkGrouped(e.Operand, groupBy)
+	case *isNullExpr:
+		return checkGrouped(e.Operand, groupBy)
+	case *castExpr:
+		return checkGrouped(e.Operand, groupBy)
+	case *binaryExpr:
+		if err := checkGrouped(e.Left, groupBy); err != nil {
+			return err
+		}
+		return checkGrouped(e.Right, groupBy)
+	case *funcCall:
+		for _, arg := range e.Args {
+			if err := checkGrouped(arg, groupBy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evalAggregate - グループの行に対して集約関数を計算する
+// count(*) 以外は引数が NULL の行を無視する。対象の値が 1 つもなければ count は 0、それ以外は NULL
+func evalAggregate(sc *scope, call *funcCall, group []*tuple) (any, error) {
+	if call.Star {
+		if call.Name != "count" {
+			return nil, fmt.Errorf("%s(*) は使えません", call.Name)
+		}
+		return int64(len(group)), nil
+	}
+	if len(call.Args) != 1 {
+		return nil, fmt.Errorf("関数 %s の引数の数が正しくありません", call.Name)
+	}
+
+	values := []any{}
+	for _, t := range group {
+		v, err := evalExpr(call.Args[0], sc.env(t.rows))
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+
+	if call.Name == "count" {
+		return int64(len(values)), nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	switch call.Name {
+	case "sum", "avg":
+		var sum any = int64(0)
+		for _, v := range values {
+			if !isNumeric(v) {
+				return nil, fmt.Errorf("関数 %s の引数は数値である必要があります: %s", call.Name, formatValue(v))
+			}
+			var err error
+			if sum, err = evalArithmetic("+", sum, v); err != nil {
+				return nil, err
+			}
+		}
+		if call.Name == "sum" {
+			return sum, nil
+		}
+		// 整数の平均は postgres と同じく DECIMAL で返す（AVG(1, 2) = 1.5000000000000000）
+		if n, ok := sum.(int64); ok {
+			sum = NewDecimalFromInt(n)
+		}
+		return evalArithmetic("/", sum, int64(len(values)))
+
+	case "min", "max":
+		best := values[0]
+		for _, v := range values[1:] {
+			cmp, err := compareValues(v, best)
+			if err != nil {
+				return nil, err
+			}
+			if (call.Name == "min" && cmp < 0) || (call.Name == "max" && cmp > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	}
+	return nil, fmt.Errorf("関数 %s は存在しません", call.Name)
+}
+
+// sortTuples - ORDER BY のキーで行を並べ替える（キーが同じ行は元の順番のまま）
+// NULL の位置は ASC / DESC に関係なく NULLS FIRST / LAST で決まる
+func sortTuples(out []*tuple, orderBy []orderByItem) error {
+	if len(orderBy) == 0 {
+		return nil
+	}
+	var sortErr error
+	sort.SliceStable(out, func(i, j int) bool {
+		for k, item := range orderBy {
+			a, b := out[i].sortKeys[k], out[j].sortKeys[k]
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				return item.NullsFirst
+			case b == nil:
+				return !item.NullsFirst
+			}
+			cmp, err := compareValues(a, b)
+			if err != nil {
+				if sortErr == nil {
+					sortErr = err
+				}
+				return false
+			}
+			if cmp == 0 {
+				continue
+			}
+			if item.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	return sortErr
+}
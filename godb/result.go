@@ -0,0 +1,208 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+)
+
+// SQL 文の実行結果（Result）と、情報メッセージの出力先（Logger）
+//
+// ExecuteSQL は結果を表示せずに Result で返す（表示は CLI（cmd/godb/cli.go）が行う）
+//   - 行を返す文（SELECT・RETURNING 付きの INSERT / UPDATE / DELETE・EXPLAIN・SHOW INDEX）は列（名前と型）と行
+//   - INSERT / UPDATE / DELETE で追加・更新・削除した行の数
+//   - 通知: 「既に存在するためスキップしました」のような、文は成功したが利用者に伝えること（postgres の NOTICE）
+// 「テーブル 'users' を作成しました」のような情報メッセージは Logger に出す（既定では捨てる。CLI は標準出力に出す）
+
+// Result - SQL 文の実行結果
+// 行は文を実行し終えたときにすべて読んで持っている（読んでいる間に DB を占有しないように）
+// Next / Values はその行を 1 行ずつたどるカーソルで、読むたびに演算子を動かすわけではない:
+//
+//	for res.Next() {
+//		values := res.Values()
+//	}
+type Result struct {
+	Command      string         // 実行した文の種類（"SELECT"・"INSERT"・"CREATE TABLE" など）
+	Columns      []ResultColumn // 結果の列（行を返さない文では空）
+	RowsAffected int64          // 追加・更新・削除した行の数（INSERT / UPDATE / DELETE 以外は 0）
+	Notices      []string       // 通知のメッセージ
+
+	rows    [][]any // 全部の行（実行し終えたときに読んだもの）
+	current int     // 今の行の番号（Next を呼ぶ前は -1）
+}
+
+// ResultColumn - 結果の列の名前と型
+// 型は式から決める（SELECT 句のカラムはカラムの型、CAST はその型、集約関数と演算子は引数の型から。NULL の定数は TEXT）
+type ResultColumn struct {
+	Name string
+	Type SQLType
+}
+
+// newResult - 行を返さない文の結果
+func newResult(command string) *Result {
+	return &Result{Command: command, current: -1}
+}
+
+// newRowsResult - 行を返す文の結果（qr は SELECT・RETURNING・EXPLAIN の結果）
+func newRowsResult(command string, qr *queryResult) *Result {
+	res := newResult(command)
+	res.setRows(qr)
+	return res
+}
+
+// setRows - 結果に列と行を入れる（RETURNING の結果を INSERT / UPDATE / DELETE の結果に入れる）
+func (r *Result) setRows(qr *queryResult) {
+	if qr == nil {
+		return
+	}
+	r.Columns, r.rows = qr.columns, qr.rows
+}
+
+// notice - 通知を追加する
+func (r *Result) notice(format string, args ...any) {
+	r.Notices = append(r.Notices, fmt.Sprintf(format, args...))
+}
+
+// Next - 次の行に進む（もう行がなければ false）
+func (r *Result) Next() bool {
+	if r.current+1 >= len(r.rows) {
+		r.current = len(r.rows)
+		return false
+	}
+	r.current++
+	return true
+}
+
+// Values - 今の行の値（列の順番）
+// 値の Go の型は int64（INT / BIGINT）・float64・Decimal・bool・string（TEXT / VARCHAR）・Date・Timestamp・[]byte・JSON で、NULL は nil
+func (r *Result) Values() []any {
+	if r.current < 0 || r.current >= len(r.rows) {
+		return nil
+	}
+	return r.rows[r.current]
+}
+
+// Logger - 情報メッセージの出力先（標準ライブラリの *log.Logger をそのまま使える）
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// discardLogger - 情報メッセージを捨てる（Logger を指定しなかったとき）
+var discardLogger Logger = log.New(io.Discard, "", 0)
+
+// logf - 情報メッセージを出す
+func (db *database) logf(format string, args ...any) {
+	db.logger.Printf(format, args...)
+}
+
+// exprType - 結果の列の型を式から決める（sc は式のカラムを解決するスコープ）
+// 実行時の値の型（INT のカラムの値も int64）ではなく、postgres と同じく式の型（INT のカラムは INT）を返す
+func exprType(sc *scope, e exprNode) SQLType {
+	switch e := e.(type) {
+	case *literal:
+		if n, ok := e.Value.(int64); ok {
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return SQLType{Kind: TypeInt}
+			}
+			return SQLType{Kind: TypeBigInt}
+		}
+		if kind, ok := valueKind(e.Value); ok {
+			return SQLType{Kind: kind}
+		}
+	case *columnRef:
+		if i, pos, err := sc.resolve(e); err == nil {
+			return columnType(sc.sources[i].tableDef.Columns[pos])
+		}
+	case *sequenceCall:
+		return SQLType{Kind: TypeBigInt}
+	case *paramExpr:
+		// 型の決まらなかったパラメータは postgres と同じく TEXT
+		if e.Type != nil {
+			return *e.Type
+		}
+	case *castExpr:
+		return e.Type
+	case *isNullExpr:
+		return SQLType{Kind: TypeBoolean}
+	case *unaryExpr:
+		if e.Op == "NOT" {
+			return SQLType{Kind: TypeBoolean}
+		}
+		return exprType(sc, e.Operand)
+	case *binaryExpr:
+		switch e.Op {
+		case "AND", "OR", "=", "<>", "<", ">", "<=", ">=":
+			return SQLType{Kind: TypeBoolean}
+		case "||":
+			if exprType(sc, e.Left).Kind == TypeBytea && exprType(sc, e.Right).Kind == TypeBytea {
+				return SQLType{Kind: TypeBytea}
+			}
+			return SQLType{Kind: TypeText}
+		case "->":
+			return SQLType{Kind: TypeJSON}
+		case "->>":
+			return SQLType{Kind: TypeText}
+		}
+		return arithmeticType(e.Op, exprType(sc, e.Left), exprType(sc, e.Right))
+	case *funcCall:
+		return funcType(sc, e)
+	}
+	return SQLType{Kind: TypeText}
+}
+
+// arithmeticType - 算術演算の結果の型（evalArithmetic と同じ規則）
+//   - DATE ± 整数は DATE、DATE - DATE は INT（日数）
+//   - 数値どうしは FLOAT > DECIMAL > BIGINT > INT の順で広い方
+func arithmeticType(op string, left, right SQLType) SQLType {
+	if left.Kind == TypeDate || right.Kind == TypeDate {
+		if op == "-" && left.Kind == TypeDate && right.Kind == TypeDate {
+			return SQLType{Kind: TypeInt}
+		}
+		return SQLType{Kind: TypeDate}
+	}
+	for _, kind := range []TypeKind{TypeFloat, TypeDecimal, TypeBigInt} {
+		if left.Kind == kind || right.Kind == kind {
+			return SQLType{Kind: kind}
+		}
+	}
+	return SQLType{Kind: TypeInt}
+}
+
+// funcType - 関数の結果の型（集約関数は aggregateCall、それ以外は evalFunc の値の型）
+func funcType(sc *scope, call *funcCall) SQLType {
+	var arg SQLType
+	if len(call.Args) > 0 {
+		arg = exprType(sc, call.Args[0])
+	}
+	switch call.Name {
+	case "count":
+		return SQLType{Kind: TypeBigInt}
+	case "sum":
+		// 整数の合計は BIGINT
+		if arg.isInteger() {
+			return SQLType{Kind: TypeBigInt}
+		}
+		return SQLType{Kind: arg.Kind}
+	case "avg":
+		// 整数の平均は DECIMAL
+		if arg.isInteger() {
+			return SQLType{Kind: TypeDecimal}
+		}
+		return SQLType{Kind: arg.Kind}
+	case "min", "max", "abs":
+		return arg
+	case "length", "octet_length":
+		return SQLType{Kind: TypeInt}
+	case "json_extract":
+		return SQLType{Kind: TypeJSON}
+	case "coalesce":
+		// NULL でない最初の引数の型
+		for _, a := range call.Args {
+			if lit, ok := a.(*literal); !ok || lit.Value != nil {
+				return exprType(sc, a)
+			}
+		}
+	}
+	return SQLType{Kind: TypeText}
+}
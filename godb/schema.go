@@ -0,0 +1,84 @@
+package godb
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// スキーマの版
+//
+// データファイルの各行の先頭には、その行を書いたときのスキーマの版（\V1 など）を記録する
+// カラムを追加・削除したときは版を上げて以前のカラムの並びを tableSchema.History に残し、既存の行は書き直さない
+// 読むときは行の版のカラムの並びから、カラム番号（columnDef.ID）が同じフィールドを現在のカラムの位置に移す
+//   - 行の版にないカラム（あとから追加したカラム）は columnDef.Missing か NULL
+//   - 現在の版にないカラム（削除したカラム）のフィールドは読み飛ばす
+// 版を記録する前に書いた行は版 1 として読む
+
+// initVersionはカラム番号と版のないテーブル定義（作ったばかりのテーブル・版を記録する前に作ったテーブル）に番号を振る
+func (t *tableSchema) initVersion() {
+	if t.Version == 0 {
+		t.Version = 1
+	}
+	for i := range t.Columns {
+		if t.Columns[i].ID == 0 {
+			t.Columns[i].ID = t.nextColumnID()
+		}
+	}
+}
+
+// nextColumnIDはまだ使っていないカラム番号を返す（削除したカラムの番号も使わない）
+func (t *tableSchema) nextColumnID() int {
+	maxID := 0
+	for _, col := range t.Columns {
+		maxID = max(maxID, col.ID)
+	}
+	for _, version := range t.History {
+		for _, col := range version.Columns {
+			maxID = max(maxID, col.ID)
+		}
+	}
+	return maxID + 1
+}
+
+// newVersionは今のカラムの並びを履歴に残して版を 1 つ上げる（カラムを追加・削除する前に呼ぶ）
+func (t *tableSchema) newVersion() {
+	columns := make([]columnDef, len(t.Columns))
+	for i, col := range t.Columns {
+		columns[i] = columnDef{Name: col.Name, Type: col.Type, ID: col.ID}
+	}
+	t.History = append(t.History, tableVersion{Version: t.Version, Columns: columns})
+	t.Version++
+}
+
+// columnsAtは版 version で書いた行のカラムの並びを返す（履歴にない版は現在の並びとみなす）
+func (t *tableSchema) columnsAt(version int) []columnDef {
+	for _, v := range t.History {
+		if v.Version == version {
+			return v.Columns
+		}
+	}
+	return t.Columns
+}
+
+// loadTableSchemaは .schema ファイル（カタログより前の形式）からテーブル定義を読み込む（catalog.go の移行で使う）
+// 例: data/users.schema
+func loadTableSchema(filename string) (*tableSchema, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var def tableSchema
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// removeTableSchemaは .schema ファイルを削除する（カタログに移したあと）
+func removeTableSchema(filename string) error {
+	err := os.Remove(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// シーケンス（CREATE SEQUENCE / SERIAL / AUTO_INCREMENT）
+//
+// nextval('名前') で次の値を、currval('名前') でこのセッションで最後に nextval が返した値を返す
+// SERIAL / AUTO_INCREMENT のカラムは postgres と同じく「テーブル名_カラム名_seq」のシーケンスを作り、
+// カラムの DEFAULT を nextval('テーブル名_カラム名_seq') にしたものとして扱う
+//
+// 状態はシーケンスごとのファイル（データディレクトリの base/users_id_seq.sequence）に保存する
+// nextval のたびに書くと遅いので、postgres の SEQ_LOG_VALS と同じく sequenceBatchSize 個先までを「払い出し済み」として先に書き、
+// ファイルをディスクに書き出してから値を返す
+// 再起動後は払い出し済みの次の値から始めるので、クラッシュしても同じ値を 2 度返すことはない（そのかわり値が飛ぶことはある）
+// 正常に終了するとき（database.Close）は、実際に使った値まで戻して保存するので値は飛ばない
+//
+// nextval はトランザクションに含めない（postgres と同じく、INSERT がエラーになっても進めた値は戻さない）
+
+const sequenceBatchSize = 32 // 1 回のファイル書き込みで払い出し済みにする値の数
+
+// sequenceはシーケンスの定義と状態を表す（ファイルにはこの形で保存する）
+type sequence struct {
+	Def      sequenceDef
+	Logged   int64 // 払い出し済みとしてファイルに書いた最後の値
+	IsCalled bool  // 一度でも nextval を呼んだか（false なら次の値は Start）
+
+	last    int64 // 最後に払い出した値（メモリ上）
+	called  bool  // メモリ上で一度でも払い出したか
+	currval int64 // このセッションで最後に nextval が返した値
+	hasCurr bool  // このセッションで nextval を呼んだか
+
+	path string // 保存するファイルのパス
+}
+
+// SequenceLimitErrorはシーケンスが最大値（最小値）に達したことを表す
+type SequenceLimitError struct {
+	Name    string // シーケンス名
+	Limit   int64  // 達した値
+	Minimum bool   // 最小値に達したか（増分が負の場合）
+}
+
+func (e *SequenceLimitError) Error() string {
+	if e.Minimum {
+		return fmt.Sprintf("シーケンス '%s' は最小値 %d に達しました", e.Name, e.Limit)
+	}
+	return fmt.Sprintf("シーケンス '%s' は最大値 %d に達しました", e.Name, e.Limit)
+}
+
+// sequenceFileNameはシーケンスを保存するファイル名を返す
+// 例: data, users_id_seq → data/base/users_id_seq.sequence
+func sequenceFileName(dir, name string) string {
+	return filepath.Join(dir, baseDirName, name+".sequence")
+}
+
+// serialSequenceNameは SERIAL / AUTO_INCREMENT のカラムが使うシーケンスの名前を返す
+func serialSequenceName(tableName, column string) string {
+	return tableName + "_" + column + "_seq"
+}
+
+// newSequenceDefは項目を省略したときのシーケンスの定義を返す（1 から 1 ずつ増える）
+func newSequenceDef(name string) sequenceDef {
+	return sequenceDef{Name: name, Start: 1, Increment: 1, MinValue: 1, MaxValue: math.MaxInt64}
+}
+
+// saveSequenceはシーケンスをファイルに保存する
+// 一時ファイルに書いてディスクに書き出してから置き換えるので、途中でクラッシュしても前の状態か新しい状態のどちらかが残る
+func saveSequence(seq *sequence) error {
+	data, err := json.MarshalIndent(seq, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := seq.path
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// loadSequencesはデータディレクトリの保存済みのシーケンスを読み込む
+func loadSequences(dir string) (map[string]*sequence, error) {
+	files, err := filepath.Glob(sequenceFileName(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sequences := make(map[string]*sequence, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var seq sequence
+		if err := json.Unmarshal(data, &seq); err != nil {
+			return nil, fmt.Errorf("シーケンス '%s' の読み込みに失敗しました: %v", file, err)
+		}
+		// 払い出し済みの値までは前回使った可能性があるので、その次から払い出す
+		seq.last, seq.called = seq.Logged, seq.IsCalled
+		seq.path = file
+		sequences[seq.Def.Name] = &seq
+	}
+	return sequences, nil
+}
+
+// nextValueは last の次の値を返す（範囲を超える場合は false）
+func (seq *sequence) nextValue(last int64) (int64, bool) {
+	inc := seq.Def.Increment
+	if (inc > 0 && last > seq.Def.MaxValue-inc) || (inc < 0 && last < seq.Def.MinValue-inc) {
+		return 0, false
+	}
+	return last + inc, true
+}
+
+// nextvalは次の値を払い出す
+// 払い出し済みとして保存した範囲を使い切ったら、次の sequenceBatchSize 個を保存してから返す
+func (seq *sequence) nextval() (int64, error) {
+	value := seq.Def.Start
+	if seq.called {
+		var ok bool
+		if value, ok = seq.nextValue(seq.last); !ok {
+			if seq.Def.Increment < 0 {
+				return 0, &SequenceLimitError{Name: seq.Def.Name, Limit: seq.Def.MinValue, Minimum: true}
+			}
+			return 0, &SequenceLimitError{Name: seq.Def.Name, Limit: seq.Def.MaxValue}
+		}
+	}
+
+	inc := seq.Def.Increment
+	if !seq.IsCalled || (inc > 0 && value > seq.Logged) || (inc < 0 && value < seq.Logged) {
+		logged := value
+		for i := 1; i < sequenceBatchSize; i++ {
+			next, ok := seq.nextValue(logged)
+			if !ok {
+				break
+			}
+			logged = next
+		}
+		seq.Logged, seq.IsCalled = logged, true
+		if err := saveSequence(seq); err != nil {
+			return 0, fmt.Errorf("シーケンス '%s' の保存に失敗しました: %v", seq.Def.Name, err)
+		}
+	}
+
+	seq.last, seq.called = value, true
+	seq.currval, seq.hasCurr = value, true
+	return value, nil
+}
+
+// releaseはメモリ上で使わなかった払い出し済みの値を戻して保存する（正常に終了するとき）
+// クラッシュした場合は払い出し済みの範囲の分だけ値が飛ぶ
+func (seq *sequence) release() error {
+	if !seq.called || seq.Logged == seq.last {
+		return nil
+	}
+	seq.Logged = seq.last
+	return saveSequence(seq)
+}
+
+// getSequence - シーケンスを取得（存在しない場合はエラー）
+func (db *database) getSequence(name string) (*sequence, error) {
+	seq, exists := db.sequences[name]
+	if !exists {
+		return nil, fmt.Errorf("シーケンス '%s' は存在しません", name)
+	}
+	return seq, nil
+}
+
+// createSequence - シーケンスを作成して保存する
+func (db *database) createSequence(def sequenceDef) error {
+	if _, exists := db.sequences[def.Name]; exists {
+		return fmt.Errorf("シーケンス '%s' は既に存在します", def.Name)
+	}
+	if _, exists := db.catalog.Tables[def.Name]; exists {
+		return fmt.Errorf("'%s' は既にテーブルの名前として使われています", def.Name)
+	}
+	seq := &sequence{Def: def, Logged: def.Start, path: sequenceFileName(db.dir, def.Name)}
+	if err := saveSequence(seq); err != nil {
+		return fmt.Errorf("シーケンス保存エラー: %v", err)
+	}
+	db.sequences[def.Name] = seq
+	return nil
+}
+
+// dropSequence - シーケンスを削除する（SERIAL / AUTO_INCREMENT のカラムやテーブルを削除したとき）
+func (db *database) dropSequence(name string) error {
+	if err := os.Remove(sequenceFileName(db.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(db.sequences, name)
+	return nil
+}
+
+// restartはシーケンスを最初の値に戻す（TRUNCATE ... RESTART IDENTITY）
+func (seq *sequence) restart() error {
+	seq.Logged, seq.IsCalled = seq.Def.Start, false
+	seq.last, seq.called = 0, false
+	return saveSequence(seq)
+}
+
+// CreateSequence - CREATE SEQUENCE文を実行
+func (db *database) CreateSequence(sql string) (*Result, error) {
+	def, err := parseCreateSequence(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	res := newResult("CREATE SEQUENCE")
+	if _, exists := db.sequences[def.Name]; exists && def.IfNotExists {
+		res.notice("シーケンス '%s' は既に存在するためスキップしました", def.Name)
+		return res, nil
+	}
+	if err := db.createSequence(*def); err != nil {
+		return nil, err
+	}
+	db.logf("シーケンス '%s' を作成しました（開始 %d、増分 %d）", def.Name, def.Start, def.Increment)
+	return res, nil
+}
+
+// createOwnedSequences - SERIAL / AUTO_INCREMENT のカラムのシーケンスを作成する（CREATE TABLE の実行時）
+func (db *database) createOwnedSequences(tableDef *tableSchema) error {
+	for _, col := range tableDef.Columns {
+		if col.Sequence == "" {
+			continue
+		}
+		def := newSequenceDef(col.Sequence)
+		if columnType(col).Kind == TypeInt {
+			def.MaxValue = math.MaxInt32
+		}
+		if err := db.createSequence(def); err != nil {
+			return err
+		}
+		db.logf("シーケンス '%s' を作成しました（カラム '%s' の値を自動採番）", def.Name, col.Name)
+	}
+	return nil
+}
+
+// checkSequenceCalls - DEFAULT 式などで nextval / currval の引数が既存のシーケンスの名前になっているか確認する
+func (db *database) checkSequenceCalls(e exprNode) error {
+	var err error
+	walkExpr(e, func(e exprNode) {
+		call, ok := e.(*funcCall)
+		if !ok || !isSequenceFunc(call.Name) || err != nil {
+			return
+		}
+		if len(call.Args) != 1 {
+			err = fmt.Errorf("関数 %s の引数の数が正しくありません", call.Name)
+			return
+		}
+		if lit, ok := call.Args[0].(*literal); ok {
+			if name, ok := lit.Value.(string); ok {
+				_, err = db.getSequence(name)
+			}
+		}
+	})
+	return err
+}
+
+// usesSequenceは式が nextval / currval を呼んでいるか
+func usesSequence(e exprNode) bool {
+	found := false
+	walkExpr(e, func(e exprNode) {
+		if call, ok := e.(*funcCall); ok && isSequenceFunc(call.Name) {
+			found = true
+		}
+	})
+	return found
+}
+
+// isSequenceFuncはシーケンスを操作する関数かどうか
+// これらは実行のたびに値が変わり、データベースの状態が必要なので、evalFunc ではなく sequenceCall として評価する
+func isSequenceFunc(name string) bool {
+	return name == "nextval" || name == "currval"
+}
+
+// sequenceCallは実行中のデータベースに結び付けた nextval / currval の呼び出し
+// 文を実行する前に bindSequences で funcCall から置き換える
+type sequenceCall struct {
+	call *funcCall
+	db   *database
+}
+
+func (e *sequenceCall) String() string {
+	return e.call.String()
+}
+
+// bindSequencesは式の中の nextval / currval の呼び出しを、db で評価できる sequenceCall に置き換えた式を返す
+func (db *database) bindSequences(e exprNode) exprNode {
+	switch e := e.(type) {
+	case *funcCall:
+		args := make([]exprNode, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = db.bindSequences(arg)
+		}
+		call := &funcCall{Name: e.Name, Args: args, Star: e.Star}
+		if isSequenceFunc(e.Name) {
+			return &sequenceCall{call: call, db: db}
+		}
+		return call
+	case *unaryExpr:
+		return &unaryExpr{Op: e.Op, Operand: db.bindSequences(e.Operand)}
+	case *isNullExpr:
+		return &isNullExpr{Operand: db.bindSequences(e.Operand), Not: e.Not}
+	case *castExpr:
+		return &castExpr{Operand: db.bindSequences(e.Operand), Type: e.Type}
+	case *binaryExpr:
+		return &binaryExpr{Op: e.Op, Left: db.bindSequences(e.Left), Right: db.bindSequences(e.Right)}
+	}
+	return e
+}
+
+// bindReturningは RETURNING 句の式の nextval / currval を db に結び付ける（RETURNING 句がなければ nil）
+func (db *database) bindReturning(returning *returningClause) *returningClause {
+	if returning == nil {
+		return nil
+	}
+	bound := &returningClause{All: returning.All}
+	for _, item := range returning.Items {
+		bound.Items = append(bound.Items, selectItem{Expr: db.bindSequences(item.Expr), Alias: item.Alias})
+	}
+	return bound
+}
+
+// evalSequenceFuncは nextval / currval を評価する
+func (db *database) evalSequenceFunc(name string, args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("関数 %s の引数の数が正しくありません", name)
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	seqName, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("関数 %s の引数はシーケンス名の文字列である必要があります", name)
+	}
+	seq, err := db.getSequence(strings.TrimSpace(seqName))
+	if err != nil {
+		return nil, err
+	}
+	if name == "currval" {
+		if !seq.hasCurr {
+			return nil, fmt.Errorf("シーケンス '%s' の currval はこのセッションではまだ定義されていません（先に nextval を呼んでください）", seq.Def.Name)
+		}
+		return seq.currval, nil
+	}
+	return seq.nextval()
+}
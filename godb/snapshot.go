@@ -0,0 +1,167 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// トランザクションのスナップショット（DB.Begin / Tx.Rollback）
+//
+// 文はそれぞれ実行したときにファイルに反映するので、トランザクションを取り消せるように、
+// 開始した時点のデータディレクトリのファイルをスナップショットとして取っておく
+//   - スナップショットは snapshot/ の下に、catalog.json と base/ のファイルのハードリンクを作り、そのときの大きさを sizes.json に書く
+//   - ファイルを書き換えるときは一時ファイルに書いて rename するか（WriteAllRows・カタログ・シーケンス）、末尾に追記する（AppendRows・サイドファイル）。
+//     rename したファイルはハードリンクが元の中身を持っているので戻せる。追記したファイルは元の大きさに切り詰めれば戻る
+//     （ファイルの中身をその場で書き換えることはないので、元の大きさまでの中身は変わっていない）
+//   - 戻すときは、スナップショットにないファイル（開始したあとに作ったもの）を消し、ファイルを元に戻してから、カタログ・インデックス・シーケンスを読み込み直す
+//   - コミットしたらスナップショットを消す。スナップショットが残ったまま起動したら（トランザクションの途中で落ちた）、起動時に戻す
+// シーケンスの値も開始した時点に戻る（postgres と違って、取り消したトランザクションで使った値をもう一度払い出すことがある）
+
+const (
+	snapshotDirName   = "snapshot"   // スナップショットを置くディレクトリ
+	snapshotSizesName = "sizes.json" // スナップショットを取ったときのファイルの大きさ（データディレクトリからの相対パス → バイト数）
+)
+
+// snapshotFiles - スナップショットに取るファイル（データディレクトリからの相対パス）
+// 書き込み途中の一時ファイル（.tmp）は入れない
+func snapshotFiles(dir string) ([]string, error) {
+	files := []string{}
+	if _, err := os.Stat(filepath.Join(dir, catalogFileName)); err == nil {
+		files = append(files, catalogFileName)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, baseDirName))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			files = append(files, filepath.Join(baseDirName, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// takeSnapshot - 今のファイルのスナップショットを取る
+// snapshot.tmp/ に作ってから snapshot/ に名前を変えるので、snapshot/ があればスナップショットは全部そろっている
+func (db *database) takeSnapshot() error {
+	snapshot := filepath.Join(db.dir, snapshotDirName)
+	tmp := snapshot + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(tmp, baseDirName), 0755); err != nil {
+		return err
+	}
+	files, err := snapshotFiles(db.dir)
+	if err != nil {
+		return err
+	}
+	sizes := make(map[string]int64, len(files))
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(db.dir, file))
+		if err != nil {
+			return err
+		}
+		if err := os.Link(filepath.Join(db.dir, file), filepath.Join(tmp, file)); err != nil {
+			return fmt.Errorf("スナップショットを作成できません（ハードリンクを作れないファイルシステムです）: %v", err)
+		}
+		sizes[file] = info.Size()
+	}
+	data, err := json.Marshal(sizes)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, snapshotSizesName), data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, snapshot)
+}
+
+// dropSnapshot - スナップショットを消す（コミットしたとき）
+func (db *database) dropSnapshot() error {
+	return os.RemoveAll(filepath.Join(db.dir, snapshotDirName))
+}
+
+// restoreSnapshot - ファイルをスナップショットを取った時点に戻し、カタログ・インデックス・シーケンスを読み込み直す
+func (db *database) restoreSnapshot() error {
+	snapshot := filepath.Join(db.dir, snapshotDirName)
+	data, err := os.ReadFile(filepath.Join(snapshot, snapshotSizesName))
+	if err != nil {
+		return err
+	}
+	sizes := map[string]int64{}
+	if err := json.Unmarshal(data, &sizes); err != nil {
+		return err
+	}
+
+	// スナップショットを取ったあとに作ったファイルを消す
+	files, err := snapshotFiles(db.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if _, ok := sizes[file]; !ok {
+			if err := os.Remove(filepath.Join(db.dir, file)); err != nil {
+				return err
+			}
+		}
+	}
+	// 置き換わっていたら（消していたら）ハードリンクを戻し、元の大きさに切り詰める
+	// （置き換える前に追記していれば、ハードリンクのほうにも追記した分が残っている）
+	for file, size := range sizes {
+		current, saved := filepath.Join(db.dir, file), filepath.Join(snapshot, file)
+		currentInfo, err := os.Stat(current)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		savedInfo, err := os.Stat(saved)
+		if err != nil {
+			return err
+		}
+		if currentInfo == nil || !os.SameFile(currentInfo, savedInfo) {
+			if err := os.Rename(saved, current); err != nil {
+				return err
+			}
+		}
+		if err := os.Truncate(current, size); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(snapshot); err != nil {
+		return err
+	}
+
+	// 戻したファイルを読み込み直す（WAL のやり直しで戻したカタログを上書きしないように、チェックポイントを書いておく）
+	if err := db.wal.checkpoint(); err != nil {
+		return err
+	}
+	db.pool.clear()
+	if err := db.loadTables(); err != nil {
+		return fmt.Errorf("テーブル読み込みエラー: %v", err)
+	}
+	sequences, err := loadSequences(db.dir)
+	if err != nil {
+		return fmt.Errorf("シーケンス読み込みエラー: %v", err)
+	}
+	db.sequences = sequences
+	return nil
+}
+
+// recoverSnapshot - 起動時に、終わっていないトランザクションのスナップショットがあれば、その時点に戻す
+func (db *database) recoverSnapshot() error {
+	snapshot := filepath.Join(db.dir, snapshotDirName)
+	if err := os.RemoveAll(snapshot + ".tmp"); err != nil {
+		return err
+	}
+	if _, err := os.Stat(snapshot); os.IsNotExist(err) {
+		return nil
+	}
+	if err := db.restoreSnapshot(); err != nil {
+		return fmt.Errorf("終わっていないトランザクションの取り消しに失敗しました: %v", err)
+	}
+	db.logf("終わっていないトランザクションを取り消しました")
+	return nil
+}
@@ -0,0 +1,290 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+)
+
+// stmtState - 1 つの文（UPDATE / DELETE / INSERT ... ON CONFLICT）の実行中の変更をメモリ上に溜めておく
+// 外部キーの CASCADE などで複数のテーブルにまたがって変更しても、途中でエラーになったら何も書き込まない
+// すべての検証が通ってから commit でまとめてファイルに書く
+// （ただし複数ファイルの書き込みの途中でクラッシュした場合までは守れない。それには WAL が必要）
+type stmtState struct {
+	db      *database
+	rows    map[string][]tableRow // テーブルごとの行（スライスの添字がレコード位置、削除した行は nil）
+	changed []string              // 変更したテーブル（変更した順）
+	counts  map[string]int        // テーブルごとの変更した行の数（自動 ANALYZE 用）
+}
+
+// newStmtState - 文の実行状態を作る
+func (db *database) newStmtState() *stmtState {
+	return &stmtState{
+		db:     db,
+		rows:   make(map[string][]tableRow),
+		counts: make(map[string]int),
+	}
+}
+
+// load - テーブルの全行を読み込む（2 回目以降は文の中での変更を反映した行を返す）
+func (st *stmtState) load(tableDef *tableSchema) ([]tableRow, error) {
+	if rows, ok := st.rows[tableDef.Name]; ok {
+		return rows, nil
+	}
+
+	rows, err := st.db.pool.ReadAllRows(tableDef.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("データ読み込みエラー: %v", err)
+	}
+	for i, row := range rows {
+		rows[i] = normalizeRow(tableDef, row)
+	}
+	st.rows[tableDef.Name] = rows
+	return rows, nil
+}
+
+// markChanged - テーブルを変更済みとして記録する（行を 1 つ変更するたびに呼ぶ）
+func (st *stmtState) markChanged(tableName string) {
+	st.counts[tableName]++
+	for _, name := range st.changed {
+		if name == tableName {
+			return
+		}
+	}
+	st.changed = append(st.changed, tableName)
+}
+
+// insertRow - 行を末尾に追加して、そのレコード位置を返す（INSERT ... ON CONFLICT 用）
+// 行の制約は追加する前に確認済みなので、ここでは外部キーの参照先だけを確認する
+func (st *stmtState) insertRow(tableDef *tableSchema, row tableRow) (int, error) {
+	rows, err := st.load(tableDef)
+	if err != nil {
+		return 0, err
+	}
+	// 自分自身を参照する行もあるので、先に追加してから参照先を探す
+	pos := len(rows)
+	st.rows[tableDef.Name] = append(rows, row)
+	st.markChanged(tableDef.Name)
+
+	for _, fk := range tableDef.ForeignKeys {
+		if foreignKeyIsNull(tableDef, fk, row) {
+			continue
+		}
+		found, err := st.parentKeyExists(tableDef, fk, row)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, newForeignKeyViolationError(tableDef.Name, fk, tableDef, fk.Columns, row, false)
+		}
+	}
+	return pos, nil
+}
+
+// updateRow - pos の行を newRow に置き換える
+// 行の制約（NOT NULL / CHECK / 外部キーの参照先）を確認し、この行を参照している子の行に ON UPDATE の動作を適用する
+func (st *stmtState) updateRow(tableDef *tableSchema, pos int, newRow tableRow) error {
+	rows, err := st.load(tableDef)
+	if err != nil {
+		return err
+	}
+	oldRow := rows[pos]
+	if oldRow == nil {
+		return nil // 同じ文の中で既に削除された行
+	}
+
+	if err := checkPrimaryKeyValues(tableDef, newRow); err != nil {
+		return err
+	}
+	if err := checkRowConstraints(tableDef, newRow); err != nil {
+		return err
+	}
+	rows[pos] = newRow
+	st.markChanged(tableDef.Name)
+
+	// この行が参照している親の行が存在するか（参照カラムが変わった場合のみ）
+	for _, fk := range tableDef.ForeignKeys {
+		if !columnsChanged(tableDef, fk.Columns, oldRow, newRow) || foreignKeyIsNull(tableDef, fk, newRow) {
+			continue
+		}
+		found, err := st.parentKeyExists(tableDef, fk, newRow)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return newForeignKeyViolationError(tableDef.Name, fk, tableDef, fk.Columns, newRow, false)
+		}
+	}
+
+	// この行を参照している子の行（参照されているキーが変わった場合のみ）
+	for _, ref := range st.db.referencingForeignKeys(tableDef.Name) {
+		if !columnsChanged(tableDef, ref.fk.RefColumns, oldRow, newRow) {
+			continue
+		}
+		if err := st.applyReferentialAction(tableDef, ref, oldRow, newRow, ref.fk.OnUpdate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRow - pos の行を削除し、この行を参照している子の行に ON DELETE の動作を適用する
+func (st *stmtState) deleteRow(tableDef *tableSchema, pos int) error {
+	rows, err := st.load(tableDef)
+	if err != nil {
+		return err
+	}
+	oldRow := rows[pos]
+	if oldRow == nil {
+		return nil // 同じ文の中で既に削除された行（CASCADE で自分自身のテーブルを消した場合など）
+	}
+	rows[pos] = nil
+	st.markChanged(tableDef.Name)
+
+	for _, ref := range st.db.referencingForeignKeys(tableDef.Name) {
+		if err := st.applyReferentialAction(tableDef, ref, oldRow, nil, ref.fk.OnDelete); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyReferentialAction - 親の行 oldRow を参照している子の行に RESTRICT / CASCADE / SET NULL を適用する
+// newRow が nil なら削除、そうでなければキーの更新
+func (st *stmtState) applyReferentialAction(parent *tableSchema, ref referencingForeignKey, oldRow, newRow tableRow, action string) error {
+	child, fk := ref.child, ref.fk
+	parentKey, err := encodeIndexKey(parent, fk.RefColumns, oldRow)
+	if err != nil {
+		return err
+	}
+
+	childRows, err := st.load(child)
+	if err != nil {
+		return err
+	}
+	for pos, childRow := range childRows {
+		if childRow == nil || foreignKeyIsNull(child, fk, childRow) {
+			continue
+		}
+		childKey, err := encodeIndexKey(child, fk.Columns, childRow)
+		if err != nil {
+			return err
+		}
+		if childKey != parentKey {
+			continue
+		}
+
+		switch action {
+		case fkActionCascade:
+			if newRow == nil {
+				err = st.deleteRow(child, pos)
+				break
+			}
+			// 子の参照カラムを親の新しいキーに合わせる
+			updated := make(tableRow, len(childRow))
+			copy(updated, childRow)
+			// （親の行外保存のポインタは親のサイドファイルを指すので、本体を読んでから入れる）
+			for i, col := range fk.Columns {
+				field, ferr := rowField(parent, newRow, parent.ColumnIndex(fk.RefColumns[i]))
+				if ferr != nil {
+					return ferr
+				}
+				updated[child.ColumnIndex(col)] = field
+			}
+			err = st.updateRow(child, pos, updated)
+		case fkActionSetNull:
+			updated := make(tableRow, len(childRow))
+			copy(updated, childRow)
+			for _, col := range fk.Columns {
+				updated[child.ColumnIndex(col)] = nullField
+			}
+			err = st.updateRow(child, pos, updated)
+		default:
+			// RESTRICT / NO ACTION
+			err = newForeignKeyViolationError(child.Name, fk, parent, fk.RefColumns, oldRow, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentKeyExists - 子の行が参照しているキーが親テーブルに存在するか
+// 親テーブルをこの文の中で変更している場合はメモリ上の行を、そうでなければ親のインデックスを見る
+func (st *stmtState) parentKeyExists(child *tableSchema, fk foreignKeyDef, row tableRow) (bool, error) {
+	parentRows, loaded := st.rows[fk.RefTable]
+	if !loaded {
+		return st.db.parentKeyExists(child, fk, row)
+	}
+
+	parent, err := st.db.getTable(fk.RefTable)
+	if err != nil {
+		return false, err
+	}
+	key, err := encodeIndexKey(child, fk.Columns, row)
+	if err != nil {
+		return false, err
+	}
+	for _, parentRow := range parentRows {
+		if parentRow == nil {
+			continue
+		}
+		parentKey, err := encodeIndexKey(parent, fk.RefColumns, parentRow)
+		if err != nil {
+			return false, err
+		}
+		if parentKey == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// commit - 変更したテーブルの一意性を確認してから、データファイルを書き直してインデックスを再構築する
+func (st *stmtState) commit() error {
+	// 書き込む前に取り消されていたら、何も変えずにやめる
+	if err := st.db.ctx.Err(); err != nil {
+		return err
+	}
+	finalRows := make(map[string][]tableRow, len(st.changed))
+	for _, tableName := range st.changed {
+		tableDef := st.db.catalog.Tables[tableName]
+		rows := []tableRow{}
+		for _, row := range st.rows[tableName] {
+			if row != nil {
+				rows = append(rows, row)
+			}
+		}
+		if err := checkUniqueRows(tableDef, rows); err != nil {
+			return err
+		}
+		finalRows[tableName] = rows
+	}
+
+	for _, tableName := range st.changed {
+		tableDef := st.db.catalog.Tables[tableName]
+		if err := st.db.pool.WriteAllRows(tableDef.path, tableDef.Version, finalRows[tableName]); err != nil {
+			return fmt.Errorf("データ保存エラー: %v", err)
+		}
+		// 全行を今の版で書き直したので、以前の版のカラムの並びはもう要らない
+		if err := st.db.dropHistory(tableDef); err != nil {
+			return err
+		}
+		if err := st.db.rebuildIndexes(tableName); err != nil {
+			return err
+		}
+		st.db.countModified(tableName, st.counts[tableName])
+	}
+	return nil
+}
+
+// columnsChanged - 2 つの行で指定カラムの値が変わっているか
+func columnsChanged(tableDef *tableSchema, columns []string, oldRow, newRow tableRow) bool {
+	for _, col := range columns {
+		pos := tableDef.ColumnIndex(col)
+		if oldRow[pos] != newRow[pos] {
+			return true
+		}
+	}
+	return false
+}
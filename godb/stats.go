@@ -0,0 +1,473 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 統計情報（ANALYZE）
+//
+// ANALYZE [テーブル, ...] はテーブルから行を標本として取り出し、カラムごとの統計情報を集めてカタログ（tableSchema.Stats）に保存する
+// オプティマイザ（optimizer.go）はこれを使って条件の選択率と行数を見積もる（統計情報がなければ既定値を使う）
+//   - 行数と、そのときのデータファイルの大きさ（今の行数は、今のファイルの大きさに比例するとして見積もる）
+//   - NULL の割合（null_frac）
+//   - 値の種類の数（n_distinct。postgres と同じく、行数に比例すると見られるときは -（行数に対する割合）で持つ）
+//   - 最頻値とその割合（most_common_vals / most_common_freqs）
+//   - 最頻値を除いた値の等深ヒストグラムの境界（histogram_bounds。隣り合う境界の間に同じ数の値が入る）
+// 値はデータファイルのフィールドの表記のまま保存する（読むときに decodeField でカラムの型の値にする）
+// 集めた統計情報は pg_stats ビュー（catalog.go）で見られる
+//
+// 自動 ANALYZE: INSERT / UPDATE / DELETE で変更した行の数をテーブルごとに数えておき、
+// autoAnalyzeBase + autoAnalyzeScale × 行数 を超えたらそのテーブルを ANALYZE する（postgres の autovacuum の analyze と同じ条件）
+// 数えた行の数はデータディレクトリの stat.json に閉じるときに保存する（クラッシュしたら数え直しになる。postgres の pg_stat と同じ）
+
+const (
+	statisticsTarget  = 100                    // 最頻値の数とヒストグラムの区間の数の上限（postgres の default_statistics_target）
+	analyzeSampleRows = 300 * statisticsTarget // 標本にする行の数（postgres と同じ）
+	analyzeMaxWidth   = 1024                   // これより大きい値は統計情報に入れない（行外保存の値も）
+	autoAnalyzeBase   = 50                     // 自動 ANALYZE の閾値の最小の行数（postgres の autovacuum_analyze_threshold）
+	statFileName      = "stat.json"            // 変更した行の数を保存するファイル（データディレクトリの直下）
+)
+
+// tableStatsはテーブルの統計情報を表す
+type tableStats struct {
+	RowCount float64       // ANALYZE したときの行数
+	FileSize int64         // ANALYZE したときのデータファイルの大きさ（バイト）
+	Columns  []columnStats `json:",omitempty"` // カラムごとの統計情報
+}
+
+// columnStatsはカラムの統計情報を表す
+type columnStats struct {
+	ColumnID         int       // カラム番号（columnDef.ID）
+	NullFrac         float64   // NULL の行の割合
+	NDistinct        float64   // NULL 以外の値の種類の数（負の場合は行数に対する割合。-1 ならすべて違う値）
+	MostCommonValues []string  `json:",omitempty"` // 最頻値（多い順。データファイルの表記）
+	MostCommonFreqs  []float64 `json:",omitempty"` // 最頻値の行の割合
+	HistogramBounds  []string  `json:",omitempty"` // 最頻値を除いた値の等深ヒストグラムの境界（小さい順）
+}
+
+// columnStats - カラムの統計情報（なければ nil）
+func (s *tableStats) columnStats(col columnDef) *columnStats {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Columns {
+		if s.Columns[i].ColumnID == col.ID {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Analyze - ANALYZE文を実行
+func (db *database) Analyze(sql string) (*Result, error) {
+	def, err := parseAnalyze(sql)
+	if err != nil {
+		return nil, fmt.Errorf("パースエラー: %v", err)
+	}
+	names := def.TableNames
+	if len(names) == 0 {
+		names = db.catalog.tableNames()
+	}
+	for _, name := range names {
+		if _, err := db.getTable(name); err != nil {
+			return nil, err
+		}
+	}
+
+	// 全部のテーブルの統計情報を 1 つのトランザクションでカタログに保存する
+	change := catalogChange{}
+	for _, name := range names {
+		analyzed, err := db.analyzeTable(db.catalog.Tables[name])
+		if err != nil {
+			return nil, err
+		}
+		change.Tables = append(change.Tables, analyzed)
+	}
+	if err := db.commitCatalog(change); err != nil {
+		return nil, err
+	}
+	for _, tableDef := range change.Tables {
+		delete(db.modified, tableDef.Name)
+		db.logf("テーブル '%s' を分析しました（%.0f 行）", tableDef.Name, tableDef.Stats.RowCount)
+	}
+	return newResult("ANALYZE"), nil
+}
+
+// analyzeTable - テーブルの統計情報を集めて、統計情報を入れ替えたテーブル定義を返す（カタログはまだ変えない）
+func (db *database) analyzeTable(tableDef *tableSchema) (*tableSchema, error) {
+	stats := &tableStats{}
+	if info, err := os.Stat(tableFileName(tableDef.path)); err == nil {
+		stats.FileSize = info.Size()
+	}
+	sample, total, err := sampleRows(db.pool, tableDef)
+	if err != nil {
+		return nil, err
+	}
+	stats.RowCount = float64(total)
+	for pos := range tableDef.Columns {
+		colStats, err := analyzeColumn(tableDef, pos, sample, total)
+		if err != nil {
+			return nil, err
+		}
+		stats.Columns = append(stats.Columns, colStats)
+	}
+
+	analyzed, err := cloneTableDef(tableDef)
+	if err != nil {
+		return nil, err
+	}
+	analyzed.Stats = stats
+	return analyzed, nil
+}
+
+// sampleRows - テーブルから analyzeSampleRows 行までを無作為に取り出す（リザーバサンプリング）と、全体の行数を返す
+// 同じデータからは同じ標本になるよう、乱数の種は固定する
+func sampleRows(pool *bufferPool, tableDef *tableSchema) ([]tableRow, int, error) {
+	reader, err := pool.OpenRowReader(tableDef.path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("データ読み込みエラー: %v", err)
+	}
+	defer reader.Close()
+
+	random := rand.New(rand.NewSource(1))
+	sample := []tableRow{}
+	total := 0
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("データ読み込みエラー: %v", err)
+		}
+		total++
+		if len(sample) < analyzeSampleRows {
+			sample = append(sample, normalizeRow(tableDef, row))
+		} else if i := random.Intn(total); i < analyzeSampleRows {
+			sample[i] = normalizeRow(tableDef, row)
+		}
+	}
+	return sample, total, nil
+}
+
+// sampleValue - 標本の 1 つの値（同じ表記のフィールドをまとめたもの）
+type sampleValue struct {
+	field string
+	value any
+	count int
+}
+
+// analyzeColumn - 標本の行から pos 番目のカラムの統計情報を作る（postgres の compute_scalar_stats を簡単にしたもの）
+func analyzeColumn(tableDef *tableSchema, pos int, sample []tableRow, total int) (columnStats, error) {
+	col := tableDef.Columns[pos]
+	stats := columnStats{ColumnID: col.ID}
+	if len(sample) == 0 {
+		return stats, nil
+	}
+
+	// 値ごとに数える。大きすぎる値は数だけ数えて、すべて違う値とみなす
+	nulls, wide := 0, 0
+	counts := map[string]*sampleValue{}
+	for _, row := range sample {
+		field := nullField
+		if pos < len(row) {
+			field = row[pos]
+		}
+		switch {
+		case isNullField(col, field):
+			nulls++
+		case isToastPointer(field) || len(field) > analyzeMaxWidth:
+			wide++
+		case counts[field] != nil:
+			counts[field].count++
+		default:
+			v, err := decodeField(col, field)
+			if err != nil {
+				return stats, err
+			}
+			counts[field] = &sampleValue{field: field, value: v, count: 1}
+		}
+	}
+	n := float64(len(sample))
+	nonNull := len(sample) - nulls
+	stats.NullFrac = float64(nulls) / n
+	if nonNull == 0 {
+		return stats, nil
+	}
+
+	values := make([]*sampleValue, 0, len(counts))
+	singles := wide
+	for _, sv := range counts {
+		values = append(values, sv)
+		if sv.count == 1 {
+			singles++
+		}
+	}
+	distinct := len(values) + wide
+	stats.NDistinct = estimateDistinct(distinct, singles, nonNull, len(sample), total, stats.NullFrac)
+
+	// 多い順（同じ数なら値の小さい順）に並べて、平均より十分に多い値を最頻値にする
+	// 標本がテーブル全体で値の種類が少なければ、全部の値を最頻値にする（ヒストグラムは要らない。すべて違う値のカラムは除く）
+	var sortErr error
+	less := func(a, b *sampleValue) bool {
+		cmp, err := compareValues(a.value, b.value)
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return cmp < 0
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].count != values[j].count {
+			return values[i].count > values[j].count
+		}
+		return less(values[i], values[j])
+	})
+	average := float64(nonNull) / float64(distinct)
+	allFit := distinct <= statisticsTarget && wide == 0 && len(sample) == total && stats.NDistinct > 0
+	mcvs := 0
+	for _, sv := range values {
+		if mcvs == statisticsTarget {
+			break
+		}
+		if !allFit && (sv.count < 2 || float64(sv.count) <= 1.25*average) {
+			break
+		}
+		stats.MostCommonValues = append(stats.MostCommonValues, sv.field)
+		stats.MostCommonFreqs = append(stats.MostCommonFreqs, float64(sv.count)/n)
+		mcvs++
+	}
+
+	// 残りの値（同じ値は数の分だけ並べたもの）を小さい順にして、等間隔の位置の値をヒストグラムの境界にする
+	rest := values[mcvs:]
+	sort.Slice(rest, func(i, j int) bool { return less(rest[i], rest[j]) })
+	if sortErr != nil {
+		return stats, sortErr
+	}
+	if len(rest) >= 2 {
+		restCount := 0
+		for _, sv := range rest {
+			restCount += sv.count
+		}
+		buckets := statisticsTarget
+		if len(rest)-1 < buckets {
+			buckets = len(rest) - 1
+		}
+		next, seen := 0, 0
+		for b := 0; b <= buckets; b++ {
+			target := b * (restCount - 1) / buckets
+			for seen+rest[next].count <= target {
+				seen += rest[next].count
+				next++
+			}
+			stats.HistogramBounds = append(stats.HistogramBounds, rest[next].field)
+		}
+	}
+	return stats, nil
+}
+
+// estimateDistinct - 標本から値の種類の数を見積もる（postgres と同じく Haas と Stokes の推定量を使う）
+// distinct は標本の値の種類の数、singles はそのうち標本に 1 回しか出てこない値の数
+func estimateDistinct(distinct, singles, nonNull, sampled, total int, nullFrac float64) float64 {
+	// 標本の値がすべて違えば、テーブル全体でもすべて違う値とみなす
+	if singles == distinct {
+		return -1 * (1 - nullFrac)
+	}
+	estimate := float64(distinct)
+	if sampled < total {
+		n, N := float64(nonNull), float64(total)
+		f1 := float64(singles)
+		estimate = n * float64(distinct) / ((n - f1) + f1*n/N)
+		estimate = math.Max(float64(distinct), math.Min(estimate, N*(1-nullFrac)))
+		estimate = math.Floor(estimate + 0.5)
+	}
+	// 行数の 1 割を超える種類があれば、行数に比例して増えるとみなす
+	if estimate > 0.1*float64(total) {
+		return -(estimate / float64(total))
+	}
+	return estimate
+}
+
+// 選択率の見積もり（optimizer.go から使う）
+
+// distinctValues - NULL 以外の値の種類の数（rows はテーブルの今の推定の行数）
+func (s *columnStats) distinctValues(rows float64) float64 {
+	if s.NDistinct < 0 {
+		return math.Max(-s.NDistinct*rows, 1)
+	}
+	return math.Max(s.NDistinct, 1)
+}
+
+// eqSelectivity - カラム = v の選択率
+// v が最頻値ならその割合、そうでなければ最頻値以外の行を最頻値以外の種類の数で等分する
+func (s *columnStats) eqSelectivity(col columnDef, v any, rows float64) float64 {
+	if v == nil {
+		return 0
+	}
+	mcvTotal := 0.0
+	for i, field := range s.MostCommonValues {
+		mcvTotal += s.MostCommonFreqs[i]
+		if mcv, err := decodeField(col, field); err == nil {
+			if cmp, err := compareValues(mcv, v); err == nil && cmp == 0 {
+				return s.MostCommonFreqs[i]
+			}
+		}
+	}
+	others := s.distinctValues(rows) - float64(len(s.MostCommonValues))
+	if others < 1 {
+		// 最頻値が全部の値なら、最頻値でない値の行はない
+		return 0
+	}
+	return math.Max(1-s.NullFrac-mcvTotal, 0) / others
+}
+
+// ltSelectivity - カラム < v（inclusive なら <=）の選択率
+// 最頻値は 1 つずつ比べ、それ以外の行はヒストグラムのどこに v が入るかで見積もる
+func (s *columnStats) ltSelectivity(col columnDef, v any, inclusive bool) float64 {
+	if v == nil {
+		return 0
+	}
+	mcvSel, mcvTotal := 0.0, 0.0
+	for i, field := range s.MostCommonValues {
+		mcvTotal += s.MostCommonFreqs[i]
+		mcv, err := decodeField(col, field)
+		if err != nil {
+			continue
+		}
+		if cmp, err := compareValues(mcv, v); err == nil && (cmp < 0 || (inclusive && cmp == 0)) {
+			mcvSel += s.MostCommonFreqs[i]
+		}
+	}
+	rest := math.Max(1-s.NullFrac-mcvTotal, 0)
+	if len(s.HistogramBounds) < 2 {
+		return mcvSel + rest*defaultIneqSel
+	}
+	return mcvSel + rest*s.histogramFraction(col, v)
+}
+
+// histogramFraction - ヒストグラムの値のうち v より小さいものの割合
+// v が入る区間の中は、数値・日付なら境界の値から線形に補間し、それ以外は区間の真ん中とみなす
+func (s *columnStats) histogramFraction(col columnDef, v any) float64 {
+	bounds := make([]any, len(s.HistogramBounds))
+	for i, field := range s.HistogramBounds {
+		b, err := decodeField(col, field)
+		if err != nil {
+			return defaultIneqSel
+		}
+		bounds[i] = b
+	}
+	buckets := float64(len(bounds) - 1)
+	for i, b := range bounds {
+		cmp, err := compareValues(v, b)
+		if err != nil {
+			return defaultIneqSel
+		}
+		if cmp > 0 {
+			continue
+		}
+		if i == 0 {
+			return 0
+		}
+		within := 0.5
+		lo, ok1 := scalarPosition(bounds[i-1])
+		hi, ok2 := scalarPosition(b)
+		x, ok3 := scalarPosition(v)
+		if ok1 && ok2 && ok3 && hi > lo {
+			within = (x - lo) / (hi - lo)
+		}
+		return (float64(i-1) + within) / buckets
+	}
+	return 1
+}
+
+// scalarPosition - 値を数直線上の位置にする（ヒストグラムの区間の中の補間に使う。数値・日付・時刻以外は false）
+func scalarPosition(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case Decimal:
+		return v.Float64(), true
+	case Date:
+		return float64(v.Unix()), true
+	case Timestamp:
+		return float64(v.UnixMicro()), true
+	}
+	return 0, false
+}
+
+// 自動 ANALYZE
+
+// countModified - テーブルで変更した行の数を足し、閾値を超えたら自動 ANALYZE する
+// 変更はもう書き込んであるので、ANALYZE に失敗しても文はエラーにせず警告を表示する
+func (db *database) countModified(tableName string, rows int) {
+	if rows == 0 {
+		return
+	}
+	db.modified[tableName] += int64(rows)
+	if db.autoAnalyzeScale <= 0 {
+		return
+	}
+	tableDef, ok := db.catalog.Tables[tableName]
+	if !ok {
+		return
+	}
+	threshold := float64(autoAnalyzeBase)
+	if tableDef.Stats != nil {
+		threshold += db.autoAnalyzeScale * tableDef.Stats.RowCount
+	}
+	if float64(db.modified[tableName]) <= threshold {
+		return
+	}
+	analyzed, err := db.analyzeTable(tableDef)
+	if err == nil {
+		err = db.commitCatalog(catalogChange{Tables: []*tableSchema{analyzed}})
+	}
+	if err != nil {
+		db.logf("警告: テーブル '%s' の自動 ANALYZE に失敗しました: %v", tableName, err)
+		return
+	}
+	delete(db.modified, tableName)
+}
+
+// loadModified - 前回閉じたときに保存した、テーブルごとの変更した行の数を読み込む
+func loadModified(dir string) (map[string]int64, error) {
+	modified := map[string]int64{}
+	data, err := os.ReadFile(filepath.Join(dir, statFileName))
+	if os.IsNotExist(err) {
+		return modified, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &modified); err != nil {
+		// 壊れていても数え直すだけなので、エラーにはしない
+		return map[string]int64{}, nil
+	}
+	return modified, nil
+}
+
+// saveModified - テーブルごとの変更した行の数を保存する（もうないテーブルの分は捨てる）
+func (db *database) saveModified() error {
+	modified := map[string]int64{}
+	for name, rows := range db.modified {
+		if _, ok := db.catalog.Tables[name]; ok {
+			modified[name] = rows
+		}
+	}
+	data, err := json.Marshal(modified)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(db.dir, statFileName), data, 0644)
+}
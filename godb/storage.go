@@ -0,0 +1,356 @@
+// storage.go: テーブルデータの保存・読み込みを担当
+
+package godb
+
+import (
+	"encoding/csv" // CSVファイル操作用
+	"fmt"          // エラーメッセージ出力用
+	"io"
+	"os" // ファイル操作用
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// テーブルの1行分のデータ構造
+// カラム定義（tableSchema.Columns）の順番で値を文字列として持つ
+// 例: users テーブルなら {"1", "Alice"} → ID: 1, Name: Alice
+type tableRow []string
+
+// 行の先頭に付けるスキーマの版のフィールドの接頭辞（例: \V3）
+// 文字列の値は \ で始まる場合に \ を足して保存するので、値のフィールドと区別できる
+const rowVersionPrefix = `\V`
+
+// 行の先頭にスキーマの版のフィールドを付ける関数
+func versionedRow(version int, row tableRow) tableRow {
+	versioned := make(tableRow, 0, len(row)+1)
+	versioned = append(versioned, rowVersionPrefix+strconv.Itoa(version))
+	return append(versioned, row...)
+}
+
+// データファイルから読んだ行から、スキーマの版と値のフィールドを取り出す関数
+// 版を記録する前に書いた行は版 1 とみなす
+func splitRowVersion(row tableRow) (int, tableRow) {
+	if len(row) == 0 || !strings.HasPrefix(row[0], rowVersionPrefix) {
+		return 1, row
+	}
+	version, err := strconv.Atoi(row[0][len(rowVersionPrefix):])
+	if err != nil {
+		return 1, row
+	}
+	return version, row[1:]
+}
+
+// テーブルのデータファイル名を取得
+// path はテーブルのファイルのパスから拡張子を除いたもの（データディレクトリの base/ の下。catalog.tablePath）
+// 例: data/base/users → data/base/users.db
+func tableFileName(path string) string {
+	return path + ".db"
+}
+
+// データファイルの読み書きは bufferPool のメソッドで行う（読んだページはバッファプールに置き、書き換えたファイルのページは捨てる。bufpool.go）
+
+// テーブルのデータファイルを新規作成する関数
+// 既にファイルが存在する場合は中身を空にする（大きな値のサイドファイルも消す）
+// 既存のファイルは消してから作り直す（トランザクションのスナップショット（snapshot.go）がハードリンクで持っている元の中身を壊さないように）
+func (bp *bufferPool) CreateTableFile(path string) error {
+	bp.invalidate(tableFileName(path))
+	if err := os.Remove(tableFileName(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// os.Createはファイルを新規作成（既存なら上書き）
+	f, err := os.Create(tableFileName(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(toastFileName(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// テーブルのデータファイルと大きな値のサイドファイルを削除する関数（DROP TABLE 用）
+func (bp *bufferPool) RemoveTableFiles(path string) error {
+	bp.invalidate(tableFileName(path))
+	for _, filename := range []string{tableFileName(path), toastFileName(path)} {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// テーブルのデータファイルと大きな値のサイドファイルの名前を変える関数（ALTER TABLE RENAME TO 用）
+// 行外保存のポインタはサイドファイル内の位置だけを持つので、ファイル名が変わってもそのまま読める
+func (bp *bufferPool) RenameTableFiles(oldPath, newPath string) error {
+	bp.invalidate(tableFileName(oldPath))
+	bp.invalidate(tableFileName(newPath))
+	pairs := [][2]string{
+		{tableFileName(oldPath), tableFileName(newPath)},
+		{toastFileName(oldPath), toastFileName(newPath)},
+	}
+	for _, pair := range pairs {
+		if err := os.Rename(pair[0], pair[1]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RowをCSV形式でテーブルのデータファイルに追記保存する関数
+// 例: \V1,1,alice\n \V1,2,bob\n のように1行1レコードで、先頭にスキーマの版を付けて保存
+func (bp *bufferPool) AppendRows(path string, version int, rows []tableRow) error {
+	// 最後のページが変わるので、このファイルのページはバッファプールから捨てる
+	bp.invalidate(tableFileName(path))
+
+	// 大きなフィールドは先にサイドファイルへ追い出す（toast.go）
+	toast := newToastWriter(path, bp.toastThreshold())
+	toasted := make([]tableRow, len(rows))
+	for i, row := range rows {
+		var err error
+		if toasted[i], err = toast.toastRow(row); err != nil {
+			toast.close()
+			return err
+		}
+		toasted[i] = versionedRow(version, toasted[i])
+	}
+	if err := toast.close(); err != nil {
+		return err
+	}
+
+	// os.OpenFileでファイルを開く
+	// os.O_APPEND: 追記モード
+	// os.O_CREATE: なければ新規作成
+	// os.O_WRONLY: 書き込み専用
+	f, err := os.OpenFile(tableFileName(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	// 全行を 1 回の書き込みで追記する
+	writer := csv.NewWriter(f) // CSV書き込み用
+	for _, row := range toasted {
+		if err := writer.Write(row); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	// 行の変更は WAL に書かないので、SyncFull ならここでディスクに書き出す（文が返った時点で落ちても消えない）
+	if bp.syncMode == SyncFull {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// テーブルのデータファイルを rows の内容で丸ごと書き直す関数（UPDATE 用。全行を version の版で書く）
+// 一時ファイルに書いてから rename することで、途中で落ちても元のファイルが壊れないようにする
+func (bp *bufferPool) WriteAllRows(path string, version int, rows []tableRow) error {
+	filename := tableFileName(path)
+	tmpFilename := filename + ".tmp"
+	defer bp.invalidate(filename)
+
+	if err := bp.WriteRowsFile(path, tmpFilename, version, rows); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return err
+	}
+	// SyncFull なら置き換えたことも書き出す（落ちたあとに元のファイルに戻らないように）
+	if bp.syncMode == SyncFull {
+		return syncDir(filepath.Dir(filename))
+	}
+	return nil
+}
+
+// テーブル path の全行を version の版で別のファイル filename に書き出す関数（書き出したファイルはディスクまで書き出しておく）
+// 大きなフィールドはテーブルのサイドファイルへ追い出す（既にポインタになっているフィールドはそのまま）
+// ファイルをテーブルのデータファイルと入れ替えるのは呼び出し側で行う
+func (bp *bufferPool) WriteRowsFile(path, filename string, version int, rows []tableRow) error {
+	toast := newToastWriter(path, bp.toastThreshold())
+	toasted := make([]tableRow, len(rows))
+	for i, row := range rows {
+		var err error
+		if toasted[i], err = toast.toastRow(row); err != nil {
+			toast.close()
+			return err
+		}
+		toasted[i] = versionedRow(version, toasted[i])
+	}
+	if err := toast.close(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(f)
+	for _, row := range toasted {
+		if err := writer.Write(row); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// データファイルから全件を読み込み、Rowスライスとして返す関数
+// ファイルが空でも空スライスを返す
+// スライスの添字がそのままレコード位置（インデックスに登録する値）になる
+func (bp *bufferPool) ReadAllRows(path string) ([]tableRow, error) {
+	f, err := os.Open(tableFileName(path)) // 読み込み専用で開く
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(&pageReader{bp: bp, f: f, file: tableFileName(path)}) // CSV読み込み用（ページはバッファプールから）
+	// 行ごとにフィールド数が違ってもエラーにしない（カラム数との突き合わせは呼び出し側で行う）
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]tableRow, 0, len(records))
+	for _, rec := range records {
+		rows = append(rows, tableRow(rec))
+	}
+	return rows, nil
+}
+
+// データファイルを先頭から 1 行ずつ読むための構造体（seqScan 用）
+// ReadAllRows と違って全件をメモリに載せない
+type rowReader struct {
+	f      *os.File
+	pages  *pageReader
+	reader *csv.Reader
+}
+
+// データファイルを開いて rowReader を返す関数
+func (bp *bufferPool) OpenRowReader(path string) (*rowReader, error) {
+	f, err := os.Open(tableFileName(path))
+	if err != nil {
+		return nil, err
+	}
+	pages := &pageReader{bp: bp, f: f, file: tableFileName(path)}
+	reader := csv.NewReader(pages)
+	reader.FieldsPerRecord = -1
+	// 読んだ行のスライスを使い回さない（返した Row を呼び出し側が持ち続けられるように）
+	reader.ReuseRecord = false
+	return &rowReader{f: f, pages: pages, reader: reader}, nil
+}
+
+// 次の 1 行を読む関数（最後まで読んだら io.EOF を返す）
+func (r *rowReader) Next() (tableRow, error) {
+	rec, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return tableRow(rec), nil
+}
+
+// ここまでに読んだページの数を返す関数（バッファプールにあったものと、ファイルから読んだもの）
+func (r *rowReader) Buffers() bufferUsage {
+	return r.pages.usage
+}
+
+// データファイルを閉じる関数
+func (r *rowReader) Close() error {
+	return r.f.Close()
+}
+
+// 指定したレコード位置の行をまとめて読み込む関数（indexScan 用）
+// データファイルを先頭から 1 回だけ読み、一番後ろの位置まで読んだらやめる
+// 返すスライスは positions と同じ並びで、読んだページの数も返す
+func (bp *bufferPool) ReadRowsAt(path string, positions []int) ([]tableRow, bufferUsage, error) {
+	if len(positions) == 0 {
+		return []tableRow{}, bufferUsage{}, nil
+	}
+	found := make(map[int]tableRow, len(positions))
+	last := -1
+	for _, pos := range positions {
+		found[pos] = nil
+		if pos > last {
+			last = pos
+		}
+	}
+
+	reader, err := bp.OpenRowReader(path)
+	if err != nil {
+		return nil, bufferUsage{}, err
+	}
+	defer reader.Close()
+	for pos := 0; pos <= last; pos++ {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, reader.Buffers(), err
+		}
+		if _, ok := found[pos]; ok {
+			found[pos] = row
+		}
+	}
+
+	rows := make([]tableRow, len(positions))
+	for i, pos := range positions {
+		if found[pos] == nil {
+			return nil, reader.Buffers(), fmt.Errorf("位置 %d にレコードが存在しません", pos)
+		}
+		rows[i] = found[pos]
+	}
+	return rows, reader.Buffers(), nil
+}
+
+// 実際のRDBでは、データ読み出しはページ単位（I/O最適化、キャッシュ管理もしやすい、WALもページ単位）
+// N件ずつデータファイルから読み込む関数
+// offset: 読み込み開始位置（0から）
+// limit: 読み込む最大件数
+func (bp *bufferPool) ReadRowsWithPaging(path string, offset, limit int) ([]tableRow, error) {
+	rows, err := bp.ReadAllRows(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// オフセット分をスキップ
+	if offset >= len(rows) {
+		return []tableRow{}, nil
+	}
+	rows = rows[offset:]
+
+	// 指定件数に達したら終了
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+// データファイルの総レコード数を取得する関数
+func (bp *bufferPool) CountRows(path string) (int, error) {
+	rows, err := bp.ReadAllRows(path)
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
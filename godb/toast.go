@@ -0,0 +1,138 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 大きな値の行外保存（postgres の TOAST と同じ考え方）
+//
+// データファイルは 1 行 1 レコードなので、数 MB の BYTEA や TEXT をそのまま入れると
+// その行を読むたびに（SELECT id だけでも）全部を読み込むことになる
+// そこで 1 つのフィールドが toastThreshold バイト（ページの 1/4。postgres の TOAST_TUPLE_THRESHOLD と同じ考え方）を超えたら本体をテーブルごとのサイドファイル（users.toast）に追記し、
+// データファイルには「サイドファイルのどこにあるか」だけを \T<オフセット>:<長さ> の形で書いておく
+//
+//   - 本体を読むのはカラムの値が必要になったとき（rowField）だけなので、SELECT や WHERE で使わないカラムは読まない
+//   - UPDATE で変えなかったカラムはポインタのまま書き直すので、本体のコピーは起きない
+//   - サイドファイルは追記のみ。DELETE や UPDATE で参照されなくなった本体は残る（回収は VACUUM 相当の仕組みを作るときに行う）
+//
+// 本物の TEXT の値が \ で始まる場合は \ を足して保存するので（value.go の escapeText）、ポインタと区別できる
+
+const (
+	toastPrefix = `\T` // データファイル上のポインタの先頭
+)
+
+// toastFileNameはテーブルのサイドファイル名を返す
+// 例: data/base/users → data/base/users.toast
+func toastFileName(path string) string {
+	return path + ".toast"
+}
+
+// isToastPointerはフィールドがサイドファイルへのポインタかどうか
+func isToastPointer(field string) bool {
+	return strings.HasPrefix(field, toastPrefix)
+}
+
+// toastWriterは行の大きなフィールドをサイドファイルに追い出す
+// サイドファイルは最初に追い出すフィールドが出てきたときに開く
+type toastWriter struct {
+	path      string // テーブルのファイルのパス（拡張子なし）
+	threshold int    // これより大きいフィールドを追い出す
+	file      *os.File
+	offset    int64
+}
+
+func newToastWriter(path string, threshold int) *toastWriter {
+	return &toastWriter{path: path, threshold: threshold}
+}
+
+// toastThresholdは行外に保存するフィールドの大きさの下限（ページの 1/4）
+func (bp *bufferPool) toastThreshold() int {
+	return bp.pageSize / 4
+}
+
+// toastRowは大きなフィールドをポインタに置き換えた行を返す（元の行は変更しない）
+func (w *toastWriter) toastRow(row tableRow) (tableRow, error) {
+	var result tableRow
+	for i, field := range row {
+		if len(field) <= w.threshold || isToastPointer(field) {
+			continue
+		}
+		if result == nil {
+			result = make(tableRow, len(row))
+			copy(result, row)
+		}
+		pointer, err := w.write(field)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = pointer
+	}
+	if result == nil {
+		return row, nil
+	}
+	return result, nil
+}
+
+// writeは値をサイドファイルの末尾に追記して、ポインタを返す
+func (w *toastWriter) write(field string) (string, error) {
+	if w.file == nil {
+		f, err := os.OpenFile(toastFileName(w.path), os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return "", err
+		}
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return "", err
+		}
+		w.file, w.offset = f, offset
+	}
+	if _, err := w.file.WriteString(field); err != nil {
+		return "", err
+	}
+	pointer := fmt.Sprintf("%s%d:%d", toastPrefix, w.offset, len(field))
+	w.offset += int64(len(field))
+	return pointer, nil
+}
+
+// closeはサイドファイルをディスクに書き出して閉じる
+// データファイルがポインタを書く前に呼ぶ（ポインタの先に本体がない状態を作らないため）
+func (w *toastWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// detoastはフィールドがポインタならサイドファイルから本体を読み込んで返す（ポインタでなければそのまま）
+func detoast(path, field string) (string, error) {
+	if !isToastPointer(field) {
+		return field, nil
+	}
+	offsetText, lengthText, ok := strings.Cut(field[len(toastPrefix):], ":")
+	offset, err1 := strconv.ParseInt(offsetText, 10, 64)
+	length, err2 := strconv.Atoi(lengthText)
+	if !ok || err1 != nil || err2 != nil || offset < 0 || length < 0 {
+		return "", fmt.Errorf("テーブル '%s' の行外保存のポインタ '%s' が壊れています", filepath.Base(path), field)
+	}
+
+	f, err := os.Open(toastFileName(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return "", fmt.Errorf("テーブル '%s' の行外保存の値を読めません（%s）: %v", filepath.Base(path), field, err)
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,78 @@
+// トランザクション管理
+// Go では構造体に他の場所からメソッド追加もOK
+package godb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type transactionStatus string
+
+const (
+	transactionActive     transactionStatus = "ACTIVE"
+	transactionCommitted  transactionStatus = "COMMITTED"
+	transactionRolledBack transactionStatus = "ROLLEDBACK"
+)
+
+type transaction struct {
+	ID        string
+	Status    transactionStatus
+	StartTime int64
+}
+
+// ファクトリ
+func (db *database) newTransaction() *transaction {
+	tx := &transaction{
+		ID:     uuid.New().String(),
+		Status: transactionActive,
+
+		StartTime: time.Now().Unix(),
+	}
+	return tx
+}
+
+// トランザクション開始
+func (db *database) BeginTransaction() (*transaction, error) {
+	tx := db.newTransaction()
+	if err := db.logOperation(tx, opTypeBegin, "", ""); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// logOperation - トランザクションの操作を WAL に書く
+func (db *database) logOperation(tx *transaction, operation opType, tableName, data string) error {
+	if tx.Status != transactionActive {
+		return fmt.Errorf("トランザクション %s は既に終了しています", tx.ID)
+	}
+	if err := db.wal.append(db.wal.NewWALEntry(tx, operation, tableName, data)); err != nil {
+		return fmt.Errorf("WAL書き込みエラー: %v", err)
+	}
+	return nil
+}
+
+// トランザクションコミット
+// COMMIT を WAL に書いてディスクに書き出した時点でコミット完了（このあとクラッシュしても起動時にやり直せる）
+func (db *database) CommitTransaction(tx *transaction) error {
+	if err := db.logOperation(tx, opTypeCommit, "", ""); err != nil {
+		return err
+	}
+	if err := db.wal.sync(); err != nil {
+		return fmt.Errorf("WAL書き込みエラー: %v", err)
+	}
+	tx.Status = transactionCommitted
+	return nil
+}
+
+// トランザクションロールバック
+// まだ何も反映していないので、ROLLBACK を記録するだけ（COMMIT のないトランザクションは起動時にも捨てる）
+func (db *database) RollbackTransaction(tx *transaction) error {
+	if err := db.logOperation(tx, opTypeRollback, "", ""); err != nil {
+		return err
+	}
+	tx.Status = transactionRolledBack
+	return nil
+}
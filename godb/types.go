@@ -0,0 +1,468 @@
+package godb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// カラムの型
+// columnDef.Type には正規化した型名（INT, VARCHAR(255), DECIMAL(10,2) など）を文字列で保存し、使うときに SQLType にパースする
+
+// TypeKindは型の種類を表す
+type TypeKind int
+
+const (
+	TypeInt       TypeKind = iota // INT（32 ビット整数）
+	TypeBigInt                    // BIGINT（64 ビット整数）
+	TypeFloat                     // FLOAT（倍精度浮動小数点数）
+	TypeDecimal                   // DECIMAL(p, s)（10 進の固定小数点数）
+	TypeBoolean                   // BOOLEAN
+	TypeText                      // TEXT（長さ制限なし）
+	TypeVarchar                   // VARCHAR(n)（n 文字まで）
+	TypeDate                      // DATE
+	TypeTimestamp                 // TIMESTAMP（タイムゾーンなし）
+	TypeBytea                     // BYTEA（バイト列）
+	TypeJSON                      // JSON
+)
+
+// SQLTypeはカラムの型（引数付きの型を含む）を表す
+type SQLType struct {
+	Kind      TypeKind
+	Length    int // VARCHAR(n) の n（0 なら制限なし）
+	Precision int // DECIMAL(p, s) の p（0 なら制限なし）
+	Scale     int // DECIMAL(p, s) の s
+}
+
+// typeNamesは型名（別名を含む）と型の種類の対応
+var typeNames = map[string]TypeKind{
+	"INT":               TypeInt,
+	"INTEGER":           TypeInt,
+	"INT4":              TypeInt,
+	"BIGINT":            TypeBigInt,
+	"INT8":              TypeBigInt,
+	"FLOAT":             TypeFloat,
+	"FLOAT8":            TypeFloat,
+	"REAL":              TypeFloat,
+	"DOUBLE PRECISION":  TypeFloat,
+	"DECIMAL":           TypeDecimal,
+	"NUMERIC":           TypeDecimal,
+	"BOOLEAN":           TypeBoolean,
+	"BOOL":              TypeBoolean,
+	"TEXT":              TypeText,
+	"VARCHAR":           TypeVarchar,
+	"CHARACTER VARYING": TypeVarchar,
+	"DATE":              TypeDate,
+	"TIMESTAMP":         TypeTimestamp,
+	"BYTEA":             TypeBytea,
+	"BLOB":              TypeBytea,
+	"JSON":              TypeJSON,
+	"JSONB":             TypeJSON,
+}
+
+// 型の引数の上限（postgres と同じ）
+const (
+	maxVarcharLength    = 10485760
+	maxDecimalPrecision = 1000
+)
+
+func (t SQLType) String() string {
+	switch t.Kind {
+	case TypeInt:
+		return "INT"
+	case TypeBigInt:
+		return "BIGINT"
+	case TypeFloat:
+		return "FLOAT"
+	case TypeDecimal:
+		if t.Precision > 0 {
+			return fmt.Sprintf("DECIMAL(%d,%d)", t.Precision, t.Scale)
+		}
+		return "DECIMAL"
+	case TypeBoolean:
+		return "BOOLEAN"
+	case TypeText:
+		return "TEXT"
+	case TypeVarchar:
+		if t.Length > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", t.Length)
+		}
+		return "VARCHAR"
+	case TypeDate:
+		return "DATE"
+	case TypeTimestamp:
+		return "TIMESTAMP"
+	case TypeBytea:
+		return "BYTEA"
+	case TypeJSON:
+		return "JSON"
+	}
+	return "UNKNOWN"
+}
+
+// isIntegerは整数型（INT, BIGINT）かどうか
+func (t SQLType) isInteger() bool {
+	return t.Kind == TypeInt || t.Kind == TypeBigInt
+}
+
+// isStringは文字列型（TEXT, VARCHAR）かどうか
+func (t SQLType) isString() bool {
+	return t.Kind == TypeText || t.Kind == TypeVarchar
+}
+
+// sameKeyFamilyは 2 つの型の値が同じ形式のインデックスキーになるか（外部キーの型の一致の確認用）
+func sameKeyFamily(a, b SQLType) bool {
+	return a.Kind == b.Kind || (a.isInteger() && b.isInteger()) || (a.isString() && b.isString())
+}
+
+// parseTypeは型名の文字列（"VARCHAR(255)" など）をパースする
+func parseType(s string) (SQLType, error) {
+	p, err := newSQLParser(s)
+	if err != nil {
+		return SQLType{}, err
+	}
+	t, err := p.parseTypeName()
+	if err != nil {
+		return SQLType{}, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return SQLType{}, err
+	}
+	return t, nil
+}
+
+// parseTypeNameは型名をパースする（DOUBLE PRECISION のような 2 語の型名と、VARCHAR(255) / DECIMAL(10,2) の引数を含む）
+func (p *sqlParser) parseTypeName() (SQLType, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return SQLType{}, err
+	}
+	name = strings.ToUpper(name)
+	if name == "DOUBLE" && p.acceptKeyword("PRECISION") {
+		name = "DOUBLE PRECISION"
+	}
+	if name == "CHARACTER" && p.acceptKeyword("VARYING") {
+		name = "CHARACTER VARYING"
+	}
+	kind, ok := typeNames[name]
+	if !ok {
+		return SQLType{}, fmt.Errorf("type %q does not exist", strings.ToLower(name))
+	}
+
+	var args []int
+	if p.acceptSymbol("(") {
+		for {
+			tok := p.peek()
+			n, err := strconv.Atoi(tok.Text)
+			if tok.Kind != tokenNumber || err != nil {
+				return SQLType{}, p.errorf("type modifier must be an integer")
+			}
+			p.next()
+			args = append(args, n)
+			if p.acceptSymbol(")") {
+				break
+			}
+			if err := p.expectSymbol(","); err != nil {
+				return SQLType{}, err
+			}
+		}
+	}
+
+	t := SQLType{Kind: kind}
+	switch {
+	case len(args) == 0:
+	case kind == TypeVarchar && len(args) == 1:
+		if args[0] < 1 || args[0] > maxVarcharLength {
+			return SQLType{}, fmt.Errorf("length for type varchar must be between 1 and %d", maxVarcharLength)
+		}
+		t.Length = args[0]
+	case kind == TypeDecimal && len(args) <= 2:
+		t.Precision = args[0]
+		if len(args) == 2 {
+			t.Scale = args[1]
+		}
+		if t.Precision < 1 || t.Precision > maxDecimalPrecision {
+			return SQLType{}, fmt.Errorf("NUMERIC precision %d must be between 1 and %d", t.Precision, maxDecimalPrecision)
+		}
+		if t.Scale < 0 || t.Scale > t.Precision {
+			return SQLType{}, fmt.Errorf("NUMERIC scale %d must be between 0 and precision %d", t.Scale, t.Precision)
+		}
+	default:
+		return SQLType{}, fmt.Errorf("invalid type modifier for type %s", strings.ToLower(name))
+	}
+	return t, nil
+}
+
+// columnTypeはカラムの型を返す
+// .schema の型名は CREATE TABLE と起動時の読み込みで検証済みなので、ここではエラーにならない（なった場合は TEXT として扱う）
+func columnType(col columnDef) SQLType {
+	t, err := parseType(col.Type)
+	if err != nil {
+		return SQLType{Kind: TypeText}
+	}
+	return t
+}
+
+// Dateは DATE 型の値（UTC の 0 時で持つ）
+type Date struct {
+	time.Time
+}
+
+// Timestampは TIMESTAMP 型の値（タイムゾーンなし。UTC として持ち、マイクロ秒まで）
+type Timestamp struct {
+	time.Time
+}
+
+const (
+	dateLayout      = "2006-01-02"
+	timestampLayout = "2006-01-02 15:04:05.999999"
+)
+
+func (d Date) String() string {
+	return d.Format(dateLayout)
+}
+
+func (t Timestamp) String() string {
+	return t.Format(timestampLayout)
+}
+
+// parseDateは '2024-01-31' 形式の文字列を DATE にする
+func parseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return Date{}, fmt.Errorf("'%s' は日付（YYYY-MM-DD）として読めません", s)
+	}
+	return Date{t}, nil
+}
+
+// parseTimestampは '2024-01-31 12:34:56[.789]' 形式（T 区切りや日付のみも可）の文字列を TIMESTAMP にする
+func parseTimestamp(s string) (Timestamp, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04", dateLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Timestamp{t.Truncate(time.Microsecond)}, nil
+		}
+	}
+	return Timestamp{}, fmt.Errorf("'%s' は日時（YYYY-MM-DD HH:MM:SS）として読めません", s)
+}
+
+// parseBoolは真偽値の文字列（postgres と同じく true / yes / on / 1 / t などと、その否定）を読む
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "true", "y", "yes", "on", "1":
+		return true, nil
+	case "f", "false", "n", "no", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' は真偽値として読めません", s)
+}
+
+// parseByteaは BYTEA の文字列表記を読む
+// '\xDEADBEEF' のような 16 進形式（postgres の出力形式と同じ）はバイト列に戻し、それ以外は文字列のバイトをそのまま使う
+func parseBytea(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, `\x`) {
+		return []byte(s), nil
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("'%s' は BYTEA の 16 進表記として読めません", s)
+	}
+	return b, nil
+}
+
+// formatByteaは BYTEA の値を 16 進形式（\xdeadbeef）の文字列にする
+func formatBytea(b []byte) string {
+	return `\x` + hex.EncodeToString(b)
+}
+
+// valueTypeNameは値の型名を返す（エラーメッセージ用）
+func valueTypeName(v any) string {
+	switch v.(type) {
+	case int64:
+		return "BIGINT"
+	case float64:
+		return "FLOAT"
+	case Decimal:
+		return "DECIMAL"
+	case bool:
+		return "BOOLEAN"
+	case string:
+		return "TEXT"
+	case Date:
+		return "DATE"
+	case Timestamp:
+		return "TIMESTAMP"
+	case []byte:
+		return "BYTEA"
+	case JSON:
+		return "JSON"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// convertValueは値を型 t に変換する
+// どの場面で変換してよいかは呼び出し側（cast.go の castValue）で確認しておく
+// 文字列はその型の表記として読む。範囲・長さ・精度に収まらない値はエラー
+func convertValue(v any, t SQLType) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	mismatch := func() error {
+		return &TypeMismatchError{Expected: t.String(), Actual: valueTypeName(v), Value: literalText(v)}
+	}
+
+	switch t.Kind {
+	case TypeInt, TypeBigInt:
+		var n int64
+		switch v := v.(type) {
+		case int64:
+			n = v
+		case bool:
+			if v {
+				n = 1
+			}
+		case float64:
+			if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, fmt.Errorf("%s の範囲外の値です: %v", t, v)
+			}
+			n = int64(math.RoundToEven(v))
+		case Decimal:
+			var ok bool
+			if n, ok = v.Int64(); !ok {
+				return nil, fmt.Errorf("%s の範囲外の値です: %s", t, v)
+			}
+		case string:
+			var err error
+			if n, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil {
+				return nil, fmt.Errorf("'%s' は %s 型の値として読めません", v, t)
+			}
+		default:
+			return nil, mismatch()
+		}
+		if t.Kind == TypeInt && (n < math.MinInt32 || n > math.MaxInt32) {
+			return nil, fmt.Errorf("%s の範囲外の値です: %d", t, n)
+		}
+		return n, nil
+
+	case TypeFloat:
+		switch v := v.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case Decimal:
+			return v.Float64(), nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' は %s 型の値として読めません", v, t)
+			}
+			return f, nil
+		}
+		return nil, mismatch()
+
+	case TypeDecimal:
+		var d Decimal
+		var err error
+		switch v := v.(type) {
+		case int64:
+			d = NewDecimalFromInt(v)
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%s に %v は保存できません", t, v)
+			}
+			d, err = decimalFromFloat(v)
+		case Decimal:
+			d = v
+		case string:
+			if d, err = ParseDecimal(v); err != nil {
+				err = fmt.Errorf("'%s' は %s 型の値として読めません", v, t)
+			}
+		default:
+			return nil, mismatch()
+		}
+		if err != nil {
+			return nil, err
+		}
+		// DECIMAL(p, s) は小数点以下 s 桁に丸め、整数部が p - s 桁に収まるか確認する
+		if t.Precision > 0 {
+			d = d.Round(t.Scale)
+			if d.IntegerDigits() > t.Precision-t.Scale {
+				return nil, fmt.Errorf("%s の範囲外の値です: %s（整数部は %d 桁まで）", t, d, t.Precision-t.Scale)
+			}
+		}
+		return d, nil
+
+	case TypeBoolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case string:
+			b, err := parseBool(v)
+			if err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+		return nil, mismatch()
+
+	case TypeText, TypeVarchar:
+		s, ok := v.(string)
+		if !ok {
+			// 文字列型へは、どの型の値もその表記の文字列として代入できる
+			s = formatValue(v)
+		}
+		if t.Length > 0 && utf8.RuneCountInString(s) > t.Length {
+			return nil, fmt.Errorf("%s には長すぎる値です（%d 文字）", t, utf8.RuneCountInString(s))
+		}
+		return s, nil
+
+	case TypeDate:
+		switch v := v.(type) {
+		case Date:
+			return v, nil
+		case Timestamp:
+			y, m, d := v.Date()
+			return Date{time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}, nil
+		case string:
+			return parseDate(v)
+		}
+		return nil, mismatch()
+
+	case TypeTimestamp:
+		switch v := v.(type) {
+		case Timestamp:
+			return v, nil
+		case Date:
+			return Timestamp{v.Time}, nil
+		case string:
+			return parseTimestamp(v)
+		}
+		return nil, mismatch()
+
+	case TypeBytea:
+		switch v := v.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return parseBytea(v)
+		}
+		return nil, mismatch()
+
+	case TypeJSON:
+		switch v := v.(type) {
+		case JSON:
+			return v, nil
+		case string:
+			return parseJSON(v)
+		}
+		return nil, mismatch()
+	}
+	return nil, mismatch()
+}
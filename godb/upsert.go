@@ -0,0 +1,247 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// INSERT ... ON CONFLICT（UPSERT）
+//
+// 追加しようとした行が ON CONFLICT で指定した一意制約（主キー・UNIQUE 制約・UNIQUE インデックス）のキーと重複したら、
+// エラーにせず DO NOTHING（その行は追加しない）か DO UPDATE（既存の行を更新する）を行う
+//   INSERT INTO users (id, name) VALUES (1, 'Alice')
+//     ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name;
+//
+// 既存の行との重複はその一意制約の B+Tree で探し、同じ文で先に追加・更新した行との重複はメモリ上のキーで探す
+// 行ごとに「追加」「更新」「何もしない」のどれか 1 つを行い、UPDATE と同じく stmtState で全体を確かめてからまとめて書き込む
+
+// ConflictTargetErrorは ON CONFLICT の対象に一致する一意制約がないことを表す
+type ConflictTargetError struct {
+	TableName string // 対象テーブル名
+	Target    string // ON CONFLICT の対象（カラムのリストか制約名）
+}
+
+func (e *ConflictTargetError) Error() string {
+	return fmt.Sprintf("ON CONFLICT の対象 %s に一致する主キー・一意制約がテーブル '%s' にありません", e.Target, e.TableName)
+}
+
+// conflictArbiters - 重複を判定するインデックスの位置（indexSpecs() の添字）を返す
+// 対象の指定がなければテーブルの全部の一意インデックスで判定する（DO NOTHING のみ）
+func conflictArbiters(tableDef *tableSchema, specs []indexSpec, clause *onConflictClause) ([]int, error) {
+	arbiters := []int{}
+	for i, spec := range specs {
+		if !spec.Unique {
+			continue
+		}
+		if clause.Constraint != "" && !strings.EqualFold(spec.Name, clause.Constraint) {
+			continue
+		}
+		if clause.Columns != nil && !sameColumnSet(spec, clause.Columns) {
+			continue
+		}
+		arbiters = append(arbiters, i)
+	}
+
+	if len(arbiters) == 0 && clause.Constraint != "" {
+		return nil, &ConflictTargetError{TableName: tableDef.Name, Target: "\"" + clause.Constraint + "\""}
+	}
+	if len(arbiters) == 0 && clause.Columns != nil {
+		return nil, &ConflictTargetError{TableName: tableDef.Name, Target: "(" + strings.Join(clause.Columns, ", ") + ")"}
+	}
+	return arbiters, nil
+}
+
+// sameColumnSet - インデックスのキーがちょうど指定したカラムの集合か（順番は問わない）
+func sameColumnSet(spec indexSpec, columns []string) bool {
+	if len(spec.Keys) != len(columns) {
+		return false
+	}
+	for _, key := range spec.Keys {
+		ref, ok := key.(*columnRef)
+		if !ok {
+			return false
+		}
+		found := false
+		for _, col := range columns {
+			if strings.EqualFold(ref.Name, col) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// upsertEnv - DO UPDATE の式の評価環境（カラムは既存の行、EXCLUDED.カラム は追加しようとした行を指す）
+func upsertEnv(tableDef *tableSchema, current, excluded tableRow) evalEnv {
+	currentEnv := rowEnv(tableDef, current)
+	excludedEnv := rowEnv(tableDef, excluded)
+	return func(ref *columnRef) (any, error) {
+		if strings.EqualFold(ref.Table, "excluded") {
+			return excludedEnv(&columnRef{Name: ref.Name})
+		}
+		return currentEnv(ref)
+	}
+}
+
+// upsert - ON CONFLICT 付きの INSERT を実行する（rows は DEFAULT・制約の確認まで済んだ追加しようとする行）
+func (db *database) upsert(tableDef *tableSchema, insertDef *insertDef, rows []tableRow) (*Result, error) {
+	clause := insertDef.OnConflict
+	specs, err := tableDef.indexSpecs()
+	if err != nil {
+		return nil, err
+	}
+	arbiters, err := conflictArbiters(tableDef, specs, clause)
+	if err != nil {
+		return nil, err
+	}
+
+	// DO UPDATE の SET 句のカラムを解決
+	setPositions := make([]int, len(clause.Sets))
+	for i, set := range clause.Sets {
+		pos := tableDef.ColumnIndex(set.Column)
+		if pos < 0 {
+			return nil, fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", set.Column, tableDef.Name)
+		}
+		setPositions[i] = pos
+		clause.Sets[i].Value = db.bindSequences(set.Value)
+	}
+	clause.Where = db.bindSequences(clause.Where)
+
+	st := db.newStmtState()
+	if _, err := st.load(tableDef); err != nil {
+		return nil, err
+	}
+
+	// この文で追加・更新した行のキー（判定に使うインデックスごと。キー → レコード位置）
+	// B+Tree にはファイルの状態のキーしかないので、同じ文の中での重複はこちらで見る
+	pending := make([]map[string]int, len(arbiters))
+	for i := range pending {
+		pending[i] = make(map[string]int)
+	}
+	affected := make(map[int]bool) // この文で追加・更新した行のレコード位置
+	remember := func(pos int, row tableRow) error {
+		for i, j := range arbiters {
+			key, err := encodeKeyExprs(tableDef, specs[j].Keys, row)
+			if err != nil {
+				return err
+			}
+			if !keyHasNull(key) {
+				pending[i][key] = pos
+			}
+		}
+		affected[pos] = true
+		return nil
+	}
+
+	changed := []int{} // 追加・更新した行のレコード位置（RETURNING 用）
+	inserted, updated, skipped := 0, 0, 0
+	for _, row := range rows {
+		pos, found, err := db.findConflict(tableDef, specs, arbiters, pending, affected, row)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if pos, err = st.insertRow(tableDef, row); err != nil {
+				return nil, err
+			}
+			if err := remember(pos, row); err != nil {
+				return nil, err
+			}
+			changed = append(changed, pos)
+			inserted++
+			continue
+		}
+		if clause.DoNothing {
+			skipped++
+			continue
+		}
+		if affected[pos] {
+			// postgres と同じく、同じ文で追加・更新した行をもう一度更新することはできない
+			return nil, fmt.Errorf("ON CONFLICT DO UPDATE で同じ行を 2 回更新することはできません（同じキーの行が複数あります）")
+		}
+
+		current := st.rows[tableDef.Name][pos]
+		env := upsertEnv(tableDef, current, row)
+		match, err := evalCondition(clause.Where, env)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			skipped++
+			continue
+		}
+		// SET 句の式は更新前の行（と EXCLUDED の行）の値で評価する
+		newRow := make(tableRow, len(current))
+		copy(newRow, current)
+		for i, set := range clause.Sets {
+			field, err := evalAssignment(tableDef.Columns[setPositions[i]], set.Value, env)
+			if err != nil {
+				return nil, err
+			}
+			newRow[setPositions[i]] = field
+		}
+		if err := st.updateRow(tableDef, pos, newRow); err != nil {
+			return nil, err
+		}
+		if err := remember(pos, newRow); err != nil {
+			return nil, err
+		}
+		changed = append(changed, pos)
+		updated++
+	}
+
+	// RETURNING 句は追加・更新した行で評価する（何もしなかった行は返さない）
+	var returned *queryResult
+	if insertDef.Returning != nil {
+		result := []tableRow{}
+		for _, pos := range changed {
+			if row := st.rows[tableDef.Name][pos]; row != nil {
+				result = append(result, row)
+			}
+		}
+		if returned, err = evalReturning(tableDef, db.bindReturning(insertDef.Returning), result); err != nil {
+			return nil, err
+		}
+	}
+
+	// 全行で主キー・UNIQUE制約を確認してから書き込む
+	if err := st.commit(); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("テーブル '%s' に %d 行追加、%d 行更新しました", tableDef.Name, inserted, updated)
+	if skipped > 0 {
+		message += fmt.Sprintf("（%d 行は重複のため何もしませんでした）", skipped)
+	}
+	db.logf("%s", message)
+	res := newResult("INSERT")
+	res.RowsAffected = int64(inserted + updated)
+	res.setRows(returned)
+	return res, nil
+}
+
+// findConflict - 追加しようとした行と重複する行のレコード位置を探す
+// 同じ文で追加・更新した行はメモリ上のキーで、それ以外の既存の行は B+Tree で探す
+// （B+Tree が返した行をこの文で更新していれば、そのキーはもう古いので使わない）
+func (db *database) findConflict(tableDef *tableSchema, specs []indexSpec, arbiters []int, pending []map[string]int, affected map[int]bool, row tableRow) (int, bool, error) {
+	for i, j := range arbiters {
+		key, err := encodeKeyExprs(tableDef, specs[j].Keys, row)
+		if err != nil {
+			return 0, false, err
+		}
+		if keyHasNull(key) {
+			continue // NULL を含むキーはどのキーとも重複しない
+		}
+		if pos, ok := pending[i][key]; ok {
+			return pos, true, nil
+		}
+		if pos, ok := db.indexes[tableDef.Name][j].Search(key); ok && !affected[pos] {
+			return pos, true, nil
+		}
+	}
+	return 0, false, nil
+}
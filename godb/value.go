@@ -0,0 +1,191 @@
+package godb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// データファイル上の文字列と、式の評価で使う値（expr.go 参照）の相互変換
+//
+// NULL は postgres の COPY のテキスト形式と同じく \N というフィールドで表す
+// 本物の文字列が \ で始まる場合は先頭に \ を 1 つ足して保存するので、'\N' という文字列は \\N になり NULL と区別できる
+
+// nullFieldはデータファイル上で NULL を表すフィールド
+const nullField = `\N`
+
+// escapeTextは TEXT の値をデータファイルのフィールドに変換する
+func escapeText(s string) string {
+	if strings.HasPrefix(s, `\`) {
+		return `\` + s
+	}
+	return s
+}
+
+// unescapeTextは escapeText の逆変換
+func unescapeText(field string) string {
+	return strings.TrimPrefix(field, `\`)
+}
+
+// isNullFieldはフィールドが NULL かどうか
+// （NULL を \N で保存する前のデータでは、文字列型以外の空のフィールドが値なしを表していたのでそれも NULL とみなす）
+func isNullField(col columnDef, field string) bool {
+	return field == nullField || (field == "" && !columnType(col).isString())
+}
+
+// decodeFieldはデータファイルの 1 フィールドをカラムの型に応じた値に変換する
+// NULL は nil になる
+func decodeField(col columnDef, field string) (any, error) {
+	if isNullField(col, field) {
+		return nil, nil
+	}
+	t := columnType(col)
+	var v any
+	var err error
+	switch t.Kind {
+	case TypeInt, TypeBigInt:
+		v, err = strconv.ParseInt(field, 10, 64)
+	case TypeFloat:
+		v, err = strconv.ParseFloat(field, 64)
+	case TypeDecimal:
+		v, err = ParseDecimal(field)
+	case TypeBoolean:
+		v, err = strconv.ParseBool(field)
+	case TypeDate:
+		v, err = parseDate(field)
+	case TypeTimestamp:
+		v, err = parseTimestamp(field)
+	case TypeBytea:
+		v, err = parseBytea(field)
+	case TypeJSON:
+		v = JSON(field)
+	default:
+		return unescapeText(field), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("カラム '%s' (%s) の値 '%s' が壊れています", col.Name, t, field)
+	}
+	return v, nil
+}
+
+// encodeFieldは値をカラムの型に変換して、データファイルに保存する文字列にする
+// 変換は代入の規則（cast.go）に従う。変換できない型の値は TypeMismatchError
+func encodeField(col columnDef, v any) (string, error) {
+	return encodeFieldAs(col, v, castAssignment)
+}
+
+// encodeFieldAsは ctx の場面の規則で値をカラムの型に変換して、データファイルに保存する文字列にする
+func encodeFieldAs(col columnDef, v any, ctx castContext) (string, error) {
+	t := columnType(col)
+	converted, err := castValue(v, t, ctx)
+	if err != nil {
+		var mismatch *TypeMismatchError
+		if errors.As(err, &mismatch) {
+			mismatch.Column = col.Name
+			return "", mismatch
+		}
+		return "", fmt.Errorf("カラム '%s' (%s) に値を保存できません: %v", col.Name, t, err)
+	}
+	if converted == nil {
+		return nullField, nil
+	}
+	if s, ok := converted.(string); ok {
+		return escapeText(s), nil
+	}
+	return formatValue(converted), nil
+}
+
+// evalAssignmentは INSERT の VALUES・UPDATE の SET・DEFAULT の式を評価して、カラムに保存する文字列にする
+// 型のない文字列リテラル（'2024-01-31' など）はカラムの型の表記として読む
+func evalAssignment(col columnDef, e exprNode, env evalEnv) (string, error) {
+	v, err := evalExpr(e, env)
+	if err != nil {
+		return "", err
+	}
+	return encodeFieldAs(col, v, assignmentContext(e))
+}
+
+// formatValueは値を表示用の文字列にする（NULL は "NULL"）
+// NULL 以外はデータファイルに保存する表記と同じ
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return formatBytea(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// rowFieldは行の pos 番目のフィールドを返す
+// 行外に保存した大きな値（toast.go）は、ここで初めてサイドファイルから読む
+func rowField(tableDef *tableSchema, row tableRow, pos int) (string, error) {
+	if pos >= len(row) {
+		return nullField, nil
+	}
+	return detoast(tableDef.path, row[pos])
+}
+
+// decodeRowFieldは行の pos 番目のカラムの値を返す
+func decodeRowField(tableDef *tableSchema, row tableRow, pos int) (any, error) {
+	field, err := rowField(tableDef, row, pos)
+	if err != nil {
+		return nil, err
+	}
+	return decodeField(tableDef.Columns[pos], field)
+}
+
+// formatFieldは行の pos 番目のフィールドを表示用の文字列にする
+func formatField(tableDef *tableSchema, row tableRow, pos int) string {
+	v, err := decodeRowField(tableDef, row, pos)
+	if err != nil {
+		return row[pos]
+	}
+	return formatValue(v)
+}
+
+// formatRowは 1 行を表示用の "1, Alice, NULL" の形式にする
+func formatRow(tableDef *tableSchema, row tableRow) string {
+	fields := make([]string, len(row))
+	for i := range row {
+		fields[i] = formatField(tableDef, row, i)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// rowEnvは 1 行の値でカラム参照を解決する評価環境を作る
+func rowEnv(tableDef *tableSchema, row tableRow) evalEnv {
+	return func(ref *columnRef) (any, error) {
+		if ref.Table != "" && ref.Table != tableDef.Name {
+			return nil, fmt.Errorf("テーブル '%s' は参照できません", ref.Table)
+		}
+		pos := tableDef.ColumnIndex(ref.Name)
+		if pos < 0 {
+			return nil, fmt.Errorf("カラム '%s' はテーブル '%s' に存在しません", ref.Name, tableDef.Name)
+		}
+		return decodeRowField(tableDef, row, pos)
+	}
+}
+
+// evalConditionは WHERE 句の条件式を 1 行に対して評価する
+// 三値論理で TRUE になった行だけを対象にする（FALSE と NULL は対象外）
+func evalCondition(where exprNode, env evalEnv) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	v, err := evalExpr(where, env)
+	if err != nil {
+		return false, err
+	}
+	if v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("WHERE 句の条件は真偽値である必要があります: %s", where.String())
+	}
+	return b, nil
+}
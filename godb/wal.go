@@ -0,0 +1,339 @@
+package godb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WAL（Write Ahead Log）
+//
+// 変更の内容を先に WAL に書いて fsync し、COMMIT を記録してからデータファイルやカタログに反映する
+// 反映の途中でクラッシュしても、起動時に COMMIT まで書かれたトランザクションの変更をやり直せば（REDO）元に戻る
+// COMMIT のないトランザクションは反映を始めていないので捨てる
+// 反映し終わったら CHECKPOINT を書く。起動時にやり直すのは最後の CHECKPOINT より後のトランザクションだけ
+//
+// WAL はデータディレクトリの wal/ の下のセグメントファイル（0000000000000001.wal）に追記していき、
+// セグメントが walSegmentSize を超えたら次のセグメントに移る。CHECKPOINT より前のセグメントはもう要らないので消す
+//
+// 今 WAL に記録しているのはカタログの変更（CREATE / DROP / ALTER / TRUNCATE / CREATE INDEX）だけ（catalog.go）
+// INSERT / UPDATE / DELETE のデータの変更はまだ記録していない（データファイルは一時ファイルに書いてから rename で置き換える）
+
+const walSegmentSize = 1 << 20 // 1 つのセグメントの大きさの目安（これを超えたら次のセグメントに移る）
+
+type walEntry struct {
+	TransactionID string
+	LSN           int64
+	Operation     opType
+	TableName     string
+	Data          string // 面倒なので string で実装
+	TimeStamp     int64
+}
+
+// wal ファイル全体の管理
+// めんどくさいので wal は csv で実装(本来は byte 列とかな気がする)
+// 1 行が 1 エントリで、LSN, トランザクション ID, 操作, テーブル名, データ, 時刻 の順に並べる
+type walManager struct {
+	walFile   *os.File
+	mutex     sync.Mutex // ファイル操作の排他制御
+	walPath   string     // セグメントを置くディレクトリ
+	latestLSN int64      // 最後に書いたエントリの LSN
+	segment   int64      // 今書いているセグメントの番号
+	size      int64      // 今書いているセグメントの大きさ
+	syncMode  SyncMode   // コミットとチェックポイントでディスクに書き出すか（SyncOff なら書き出さない）
+}
+
+// ファクトリ
+// LSN は walManager が払い出す（最後に書いたエントリの次の番号）
+func (wm *walManager) NewWALEntry(tx *transaction, operation opType, tableName string, data string) walEntry {
+	wm.latestLSN++
+	entry := walEntry{
+		TransactionID: tx.ID,
+		LSN:           wm.latestLSN,
+		Operation:     operation,
+		TableName:     tableName,
+		Data:          data,
+		TimeStamp:     time.Now().Unix(),
+	}
+	return entry
+}
+
+// ファクトリ
+// 最後のセグメントを開いて、続きから追記できるようにする
+func newWALManager(walPath string, syncMode SyncMode) (*walManager, error) {
+	wm := &walManager{walPath: walPath, syncMode: syncMode}
+	segments, err := wm.segments()
+	if err != nil {
+		return nil, err
+	}
+	wm.segment = 1
+	if len(segments) > 0 {
+		wm.segment = segments[len(segments)-1]
+	}
+	lsn, err := wm.getLSN()
+	if err != nil {
+		return nil, err
+	}
+	wm.latestLSN = lsn
+	if err := wm.openSegment(); err != nil {
+		return nil, err
+	}
+	return wm, nil
+}
+
+// segmentFileName - セグメントのファイル名（例: 1 → wal/0000000000000001.wal）
+func (wm *walManager) segmentFileName(segment int64) string {
+	return filepath.Join(wm.walPath, fmt.Sprintf("%016d.wal", segment))
+}
+
+// segments - あるセグメントの番号（古い順）
+func (wm *walManager) segments() ([]int64, error) {
+	files, err := filepath.Glob(filepath.Join(wm.walPath, "*.wal"))
+	if err != nil {
+		return nil, err
+	}
+	segments := []int64{}
+	for _, file := range files {
+		n, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(file), ".wal"), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// openSegment - 今のセグメントを追記用に開く
+// 末尾に書きかけのエントリ（クラッシュで途中までしか書けなかった行）があれば切り捨てる
+func (wm *walManager) openSegment() error {
+	f, err := os.OpenFile(wm.segmentFileName(wm.segment), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("WALファイルを開けません: %v", err)
+	}
+	_, valid, err := readWALSegment(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	wm.walFile, wm.size = f, valid
+	return nil
+}
+
+// readWALSegment - セグメントのエントリを全部読む
+// 書きかけのエントリで止まり、そこまでのエントリと、正しく読めた部分の大きさを返す
+func readWALSegment(r io.Reader) ([]walEntry, int64, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = 6
+	entries := []walEntry{}
+	var valid int64
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// TODO: 末尾以外が壊れている場合（ディスクの故障など）も、ここで読むのをやめてしまう
+			break
+		}
+		lsn, err1 := strconv.ParseInt(record[0], 10, 64)
+		timestamp, err2 := strconv.ParseInt(record[5], 10, 64)
+		if err1 != nil || err2 != nil {
+			break
+		}
+		entries = append(entries, walEntry{
+			LSN:           lsn,
+			TransactionID: record[1],
+			Operation:     opType(record[2]),
+			TableName:     record[3],
+			Data:          record[4],
+			TimeStamp:     timestamp,
+		})
+		valid = reader.InputOffset()
+	}
+	return entries, valid, nil
+}
+
+// LSN を取得する関数
+// セグメントを古い順に読んで、最後のエントリの LSN を返す（エントリがなければ 0）
+func (wm *walManager) getLSN() (int64, error) {
+	// TODO:  本当は後ろから探すほうが効率的かも
+	entries, err := wm.readAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	return entries[len(entries)-1].LSN, nil
+}
+
+// readAll - 全セグメントのエントリを LSN の順に読む
+func (wm *walManager) readAll() ([]walEntry, error) {
+	segments, err := wm.segments()
+	if err != nil {
+		return nil, err
+	}
+	all := []walEntry{}
+	for _, segment := range segments {
+		// 既存の wal ファイルが存在するか確認
+		// if _, err := os.Stat(wm.walPath); os.IsNotExist(err) { のような os.Stat だと、他プロセスが削除したりするケースも出てくるので開いた方が良い
+		f, err := os.Open(wm.segmentFileName(segment))
+		if err != nil {
+			return nil, errors.New("WALファイルの読み込みに失敗しました")
+		}
+		entries, _, err := readWALSegment(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// append - エントリを今のセグメントに追記する（ディスクへの書き出しは sync で行う）
+func (wm *walManager) append(entry walEntry) error {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return wm.write(entry)
+}
+
+// write - エントリを CSV の 1 行にして今のセグメントに書く（mutex を持って呼ぶ）
+func (wm *walManager) write(entry walEntry) error {
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{
+		strconv.FormatInt(entry.LSN, 10),
+		entry.TransactionID,
+		string(entry.Operation),
+		entry.TableName,
+		entry.Data,
+		strconv.FormatInt(entry.TimeStamp, 10),
+	})
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	n, err := wm.walFile.WriteString(buf.String())
+	wm.size += int64(n)
+	return err
+}
+
+// sync - 書いたエントリをディスクに書き出す（COMMIT を書いたら呼ぶ。ここでコミットが確定する）
+func (wm *walManager) sync() error {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return wm.flush()
+}
+
+// flush - 今のセグメントをディスクに書き出す（mutex を持って呼ぶ）
+// SyncOff なら OS に任せて書き出さない（OS やマシンが落ちると直前のコミットが消えることがある）
+func (wm *walManager) flush() error {
+	if wm.syncMode == SyncOff {
+		return nil
+	}
+	return wm.walFile.Sync()
+}
+
+// checkpoint - ここまでのトランザクションを反映し終えたことを記録する
+// セグメントが大きくなっていれば次のセグメントに移り、古いセグメントを消す
+func (wm *walManager) checkpoint() error {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	if err := wm.write(wm.NewWALEntry(&transaction{}, opTypeCheckpoint, "", "")); err != nil {
+		return err
+	}
+	if err := wm.flush(); err != nil {
+		return err
+	}
+	if wm.size < walSegmentSize {
+		return nil
+	}
+
+	// 次のセグメントに移る。新しいセグメントの先頭にも CHECKPOINT を書いておけば、古いセグメントは全部消せる
+	// （古いセグメントを消すので、SyncOff でも新しいセグメントはディスクに書き出す）
+	if err := wm.walFile.Close(); err != nil {
+		return err
+	}
+	old := wm.segment
+	wm.segment++
+	f, err := os.OpenFile(wm.segmentFileName(wm.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("WALファイルを開けません: %v", err)
+	}
+	wm.walFile, wm.size = f, 0
+	if err := wm.write(wm.NewWALEntry(&transaction{}, opTypeCheckpoint, "", "")); err != nil {
+		return err
+	}
+	if err := wm.walFile.Sync(); err != nil {
+		return err
+	}
+	segments, err := wm.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment > old {
+			continue
+		}
+		if err := os.Remove(wm.segmentFileName(segment)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// committedSinceCheckpoint - 最後の CHECKPOINT より後に COMMIT したトランザクションのエントリ（BEGIN / COMMIT を除く）を LSN の順に返す
+func committedSinceCheckpoint(entries []walEntry) []walEntry {
+	start := 0
+	for i, entry := range entries {
+		if entry.Operation == opTypeCheckpoint {
+			start = i + 1
+		}
+	}
+	entries = entries[start:]
+
+	committed := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Operation == opTypeCommit {
+			committed[entry.TransactionID] = true
+		}
+	}
+	result := []walEntry{}
+	for _, entry := range entries {
+		switch entry.Operation {
+		case opTypeBegin, opTypeCommit, opTypeRollback:
+			continue
+		}
+		if committed[entry.TransactionID] {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Close - WAL を閉じる
+func (wm *walManager) Close() error {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return wm.walFile.Close()
+}